@@ -2,3 +2,4 @@
 
 go build $* leatea/sim/liti
 go build $* leatea/sim/analyze
+go build $* leatea/cmd/replay
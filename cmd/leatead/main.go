@@ -0,0 +1,152 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"leatea/core"
+	"leatea/http"
+	"leatea/metrics"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// max. time to wait for a stopping node to drain
+const stopTimeout = 5 * time.Second
+
+// run a single LEATEA node on a multicast group
+func main() {
+	log.Println("LEArn/TEAch routing daemon")
+	log.Println("(c) 2022, Bernd Fix   >Y<")
+
+	//------------------------------------------------------------------
+	// parse arguments
+	var cfgFile, group, ifName, metricsAddr, introAddr string
+	flag.StringVar(&cfgFile, "c", "", "JSON-encoded core configuration file")
+	flag.StringVar(&group, "g", "239.255.76.84:7654", "multicast group address")
+	flag.StringVar(&ifName, "i", "", "network interface (default: system-assigned)")
+	flag.StringVar(&metricsAddr, "m", "", "address of Prometheus metrics endpoint (default: none)")
+	flag.StringVar(&introAddr, "s", "", "address of HTTP introspection server (default: none)")
+	var verbose bool
+	flag.BoolVar(&verbose, "v", false, "verbose (debug) logging")
+	flag.Parse()
+	if verbose {
+		core.SetLogger(&core.StdLogger{Level: core.LogDebug})
+	}
+
+	// read configuration
+	if len(cfgFile) > 0 {
+		data, err := os.ReadFile(cfgFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg := new(core.Config)
+		if err = json.Unmarshal(data, cfg); err != nil {
+			log.Fatal(err)
+		}
+		core.SetConfiguration(cfg)
+	}
+
+	//------------------------------------------------------------------
+	// join multicast group
+	gaddr, err := net.ResolveUDPAddr("udp", group)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var ifi *net.Interface
+	if len(ifName) > 0 {
+		if ifi, err = net.InterfaceByName(ifName); err != nil {
+			log.Fatal(err)
+		}
+	}
+	trans, err := core.NewMulticastTransport(ifi, gaddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	//------------------------------------------------------------------
+	// create and run node
+	node := core.NewNode(core.NewPeerPrivate(), trans, false)
+	log.Printf("Node %s joined group %s", node.PeerID(), gaddr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var listener core.Listener
+	if len(metricsAddr) > 0 {
+		collector := metrics.NewCollector(node)
+		if err = collector.Serve(metricsAddr); err != nil {
+			log.Fatal(err)
+		}
+		defer collector.Close()
+		log.Printf("Metrics served on http://%s/metrics", collector.Addr())
+		listener = collector.Listener(nil)
+	}
+	if len(introAddr) > 0 {
+		srv := http.NewServer(node)
+		if err = srv.Serve(introAddr); err != nil {
+			log.Fatal(err)
+		}
+		defer srv.Close()
+		log.Printf("Node state served on http://%s/", srv.Addr())
+	}
+	go node.Start(ctx, listener)
+
+	//------------------------------------------------------------------
+	// handle signals: print forward table on SIGUSR1, terminate
+	// on SIGINT/SIGTERM.
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGUSR1, syscall.SIGINT, syscall.SIGTERM)
+	for sig := range sigCh {
+		switch sig {
+		case syscall.SIGUSR1:
+			log.Printf("Forward table: %s", listTable(node))
+		default:
+			log.Println("Terminating node...")
+			sctx, scancel := context.WithTimeout(context.Background(), stopTimeout)
+			if err := node.StopContext(sctx); err != nil {
+				log.Printf("Node stopped without draining: %s", err)
+			}
+			scancel()
+			return
+		}
+	}
+}
+
+// listTable returns a stringified forward table (sorted by target).
+func listTable(node *core.Node) string {
+	entries := make([]string, 0)
+	for _, e := range node.Forwards(false) {
+		s := fmt.Sprintf("{%s,%s,%d,%.3f}", e.Peer, e.NextHop, e.Hops, e.Origin.Age().Seconds())
+		entries = append(entries, s)
+	}
+	sort.Strings(entries)
+	return "[" + strings.Join(entries, ",") + "]"
+}
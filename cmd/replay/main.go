@@ -0,0 +1,206 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package main
+
+import (
+	"encoding/base32"
+	"flag"
+	"fmt"
+	"io"
+	"leatea/core"
+	"leatea/sim"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// Node in the replayed network; reconstructed from log events
+type Node struct {
+	idx      int
+	x, y, r2 float64
+	running  bool
+	forwards map[string]string // next hop for target ("" = neighbor)
+}
+
+// Replay reconstructs node positions and forward tables from an event log
+// and renders a SVG frame at each epoch boundary.
+type Replay struct {
+	nodes  map[string]*Node
+	out    string  // output directory
+	w, h   float64 // size of the environment
+	off    float64 // offset (border) of drawing
+	frames int     // number of written frames
+}
+
+// NewReplay creates a replay writing frames to the given directory.
+func NewReplay(out string, w, h, off float64) *Replay {
+	return &Replay{
+		nodes: make(map[string]*Node),
+		out:   out,
+		w:     w,
+		h:     h,
+		off:   off,
+	}
+}
+
+// short identifier of a peer (as used by the analyzer)
+func short(peer [32]byte) string {
+	return base32.StdEncoding.EncodeToString(peer[:5])[:8]
+}
+
+// Handle a log entry (in sequence order)
+func (r *Replay) Handle(ev *sim.LogEntry) error {
+	if ev.Type == sim.EvEpoch {
+		return r.frame(int(ev.Epoch))
+	}
+	self := short(ev.Peer)
+	node, ok := r.nodes[self]
+	if !ok {
+		node = &Node{forwards: make(map[string]string)}
+		r.nodes[self] = node
+	}
+	switch ev.Type {
+	case sim.EvNodeAdded, sim.EvNodeRemoved:
+		node.idx = int(ev.Idx)
+		node.x, node.y, node.r2 = ev.X, ev.Y, ev.R2
+		node.running = ev.Type == sim.EvNodeAdded
+		node.forwards = make(map[string]string)
+
+	case core.EvForwardChanged, core.EvForwardLearned:
+		next := ""
+		if ev.WithNext == 1 {
+			next = short(ev.NextHop)
+		}
+		node.forwards[short(ev.Target)] = next
+
+	case core.EvNeighborAdded, core.EvNeighborUpdated:
+		node.forwards[short(ev.Ref)] = ""
+
+	case core.EvNeighborExpired, core.EvRelayRemoved:
+		delete(node.forwards, short(ev.Ref))
+	}
+	return nil
+}
+
+// write frame for given epoch
+func (r *Replay) frame(epoch int) error {
+	fn := filepath.Join(r.out, fmt.Sprintf("epoch-%04d.svg", epoch))
+	c := sim.NewSVGCanvas(fn, r.w, r.h, r.off)
+	if err := c.Open(); err != nil {
+		return err
+	}
+	c.Render(func(c sim.Canvas, _ bool) {
+		r.Draw(c)
+	})
+	if err := c.Close(); err != nil {
+		return err
+	}
+	r.frames++
+	return nil
+}
+
+// Draw the network: running nodes with their reach and links to next hops
+// (one per running next hop); stopped nodes are drawn in gray.
+func (r *Replay) Draw(c sim.Canvas) {
+	list := make([]*Node, 0, len(r.nodes))
+	for _, node := range r.nodes {
+		list = append(list, node)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].idx < list[j].idx })
+	for _, node := range list {
+		if !node.running {
+			c.Circle(node.x, node.y, 0.3, 0, nil, sim.ClrGray)
+			continue
+		}
+		links := make(map[string]bool)
+		for tgt, next := range node.forwards {
+			if next == "" {
+				next = tgt
+			}
+			if to, ok := r.nodes[next]; ok && to.running && !links[next] {
+				c.Line(node.x, node.y, to.x, to.y, 0.15, sim.ClrBlue)
+				links[next] = true
+			}
+		}
+		c.Circle(node.x, node.y, 0.3, 0, nil, sim.ClrRed)
+		c.Circle(node.x, node.y, math.Sqrt(node.r2), 0.03, sim.ClrGray, nil)
+		c.Text(node.x, node.y+1.3, 1, strconv.Itoa(node.idx))
+	}
+}
+
+// replay an event log (entries sorted by sequence)
+func replayLog(fn string, r *Replay) error {
+	f, err := sim.OpenLog(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	entries := make([]*sim.LogEntry, 0)
+	for {
+		ev, err := sim.ReadLogEntry(f)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		entries = append(entries, ev)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Seq < entries[j].Seq
+	})
+	for _, ev := range entries {
+		if err = r.Handle(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run application
+func main() {
+	log.Println("LEArn/TEAch event log replay")
+	log.Println("(c) 2022, Bernd Fix     >Y<")
+
+	// parse arguments
+	var eventLog, cfgFile, outDir string
+	flag.StringVar(&eventLog, "i", "", "event log (binary)")
+	flag.StringVar(&cfgFile, "c", "", "simulator configuration (environment size and reach)")
+	flag.StringVar(&outDir, "o", ".", "output directory for SVG frames")
+	flag.Parse()
+
+	if len(cfgFile) > 0 {
+		if err := sim.ReadConfig(cfgFile); err != nil {
+			log.Fatalf("%s: %s", cfgFile, err.Error())
+		}
+	}
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		log.Fatal(err)
+	}
+	r := NewReplay(outDir, sim.Cfg.Env.Width, sim.Cfg.Env.Height, math.Sqrt(sim.Cfg.Node.Reach2))
+	if err := replayLog(eventLog, r); err != nil {
+		log.Fatalf("%s: %s", eventLog, err.Error())
+	}
+	log.Printf("%d frames written to %s", r.frames, outDir)
+}
@@ -0,0 +1,104 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"leatea/core"
+	"leatea/sim"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// write a log record (fields are written in binary or as raw bytes)
+func writeRecord(w *bytes.Buffer, typ uint32, seq uint32, peer []byte, fields ...any) {
+	_ = binary.Write(w, binary.BigEndian, typ)
+	_ = binary.Write(w, binary.BigEndian, int64(1000*seq))
+	_ = binary.Write(w, binary.BigEndian, seq)
+	w.Write(peer)
+	for _, f := range fields {
+		if b, ok := f.([]byte); ok {
+			w.Write(b)
+		} else {
+			_ = binary.Write(w, binary.BigEndian, f)
+		}
+	}
+}
+
+func TestReplayFrames(t *testing.T) {
+	// three nodes in a line (A - B - C); C dies in epoch 3
+	peers := make([][]byte, 3)
+	for i := range peers {
+		peers[i] = core.NewPeerPrivate().Public().Bytes()
+	}
+	a, b, c := peers[0], peers[1], peers[2]
+	none := make([]byte, 32)
+	buf := new(bytes.Buffer)
+	for i, p := range peers {
+		writeRecord(buf, sim.EvNodeAdded, uint32(i+1), p,
+			float64(10*i), 0., 200., uint16(i+1), uint16(i+1), uint16(0))
+	}
+	writeRecord(buf, core.EvNeighborAdded, 4, a, b)
+	writeRecord(buf, core.EvNeighborAdded, 5, b, a)
+	writeRecord(buf, sim.EvEpoch, 6, none, uint32(1))
+	writeRecord(buf, core.EvNeighborAdded, 7, b, c)
+	writeRecord(buf, core.EvNeighborAdded, 8, c, b)
+	writeRecord(buf, core.EvForwardLearned, 9, a, a, c, []byte{1}, b, int16(1))
+	writeRecord(buf, sim.EvEpoch, 10, none, uint32(2))
+	writeRecord(buf, sim.EvNodeRemoved, 11, c, 20., 0., 200., uint16(3), uint16(2), uint16(0))
+	writeRecord(buf, sim.EvEpoch, 12, none, uint32(3))
+
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "events.log")
+	w, err := sim.CreateLog(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write(buf.Bytes())
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "frames")
+	if err = os.Mkdir(out, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	r := NewReplay(out, 100, 100, 10)
+	if err = replayLog(fn, r); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(out, "*.svg"))
+	if r.frames != 3 || len(files) != 3 {
+		t.Fatalf("%d frames, %d files", r.frames, len(files))
+	}
+	// links to next hops per frame (both directions): A-B; A-B-C; A-B
+	for i, links := range []int{2, 4, 2} {
+		data, err := os.ReadFile(files[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := strings.Count(string(data), "<line"); n != links {
+			t.Fatalf("frame %d: %d links", i+1, n)
+		}
+	}
+}
@@ -24,9 +24,29 @@ package core
 type Config struct {
 	MaxTeachs  int `json:"maxTeachs"`  // max. number of entries in TEACH message
 	LearnIntv  int `json:"learnIntv"`  // LEARN interval
-	Outdated   int `json:"outdated"`   // time after a learned entry is considered outdated
+	Outdated   int `json:"outdated"`   // time after a relay not refreshed by its next hop is considered outdated (<0=never)
 	BeaconIntv int `json:"beaconIntv"` // BEACON interval
 	TTLBeacon  int `json:"ttlEntry"`   // time to live for a neighbor without beacons
+	DormantTTL int `json:"dormantTTL"` // time after a dormant entry is purged (0=never)
+	MaxHops    int `json:"maxHops"`    // max. number of hops for a reachable target
+
+	LearnIntvMax int     `json:"learnIntvMax"` // max. LEARN interval in a quiet network (0=fixed interval)
+	BeaconJitter float64 `json:"beaconJitter"` // max. random deviation of BEACON interval (seconds)
+
+	ReliableRemovals int `json:"reliableRemovals"` // max. re-broadcasts of unacknowledged removals (0=off)
+	RemovalRepeats   int `json:"removalRepeats"`   // LEArn broadcasts a taught removal is repeated in responses (0=taught once)
+	RouteHysteresis  int `json:"routeHysteresis"`  // min. age difference to switch to an equal-cost route (0=never)
+
+	FarewellOnStop bool `json:"farewellOnStop"` // announce own removal to neighbors when stopping
+
+	// no periodic beacons: neighbors are only seen in LEArn/TEAch messages,
+	// so TTLBeacon must exceed the (max.) LEArn interval. Beacon-related
+	// features (acks and re-broadcasts of reliable removals) are off.
+	Beaconless bool `json:"beaconless"`
+
+	ProcStats bool `json:"procStats"` // record processing time of received messages per type (see Node.ProcessingStats)
+
+	Seed int64 `json:"seed"` // seed for deterministic randomness in test runs (0=crypto/rand)
 }
 
 // package-local configuration data (with default values)
@@ -36,6 +56,7 @@ var cfg = &Config{
 	Outdated:   60,
 	BeaconIntv: 1,
 	TTLBeacon:  5,
+	MaxHops:    32,
 }
 
 // SetConfiguration before use
@@ -49,4 +70,41 @@ func SetConfiguration(c *Config) {
 	if c.LearnIntv > 0 {
 		cfg.LearnIntv = c.LearnIntv
 	}
+	if c.Outdated != 0 {
+		cfg.Outdated = c.Outdated
+	}
+	if c.DormantTTL > 0 {
+		cfg.DormantTTL = c.DormantTTL
+	}
+	if c.MaxHops > 0 {
+		cfg.MaxHops = c.MaxHops
+	}
+	if c.LearnIntvMax > 0 {
+		cfg.LearnIntvMax = c.LearnIntvMax
+	}
+	if c.BeaconJitter > 0 {
+		cfg.BeaconJitter = c.BeaconJitter
+	}
+	if c.ReliableRemovals > 0 {
+		cfg.ReliableRemovals = c.ReliableRemovals
+	}
+	if c.RemovalRepeats > 0 {
+		cfg.RemovalRepeats = c.RemovalRepeats
+	}
+	if c.RouteHysteresis > 0 {
+		cfg.RouteHysteresis = c.RouteHysteresis
+	}
+	if c.FarewellOnStop {
+		cfg.FarewellOnStop = true
+	}
+	if c.Beaconless {
+		cfg.Beaconless = true
+	}
+	if c.ProcStats {
+		cfg.ProcStats = true
+	}
+	if c.Seed != 0 {
+		cfg.Seed = c.Seed
+		SetSeed(c.Seed)
+	}
 }
@@ -22,9 +22,12 @@ package core
 
 // Event types
 const (
-	EvWantToLearn = 1 // sending out LEARN message
-	EvLearning    = 2 // received TEACH message, learning peers
-	EvTeaching    = 3 // sending out TEACH message
+	EvWantToLearn   = 1 // sending out LEARN message
+	EvLearning      = 2 // received TEACH message, learning peers
+	EvTeaching      = 3 // sending out TEACH message
+	EvLearnReceived = 4 // received LEARN message
+
+	EvBeaconReceived = 5 // received BEACON message (with neighbor count)
 
 	EvForwardLearned = 10 // new forward learned
 	EvForwardChanged = 11 // change in the forward table
@@ -39,7 +42,11 @@ const (
 	EvRelayUpdated = 32 // relay updated
 	EvShorterRoute = 33 // shorter path for forward entry found
 
-	EvLoopDetect = 40 // loop construction detected
+	EvLoopDetect         = 40 // loop construction detected
+	EvHopLimitExceeded   = 41 // hop count of a relay exceeded the limit
+	EvBloomFalsePositive = 42 // LEArn filter falsely contains a target (see SetFilterCheck)
+
+	EvSanityViolation = 50 // sanity check of forward table failed
 )
 
 // Event from network if something interesting happens
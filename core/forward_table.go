@@ -22,7 +22,6 @@ package core
 
 import (
 	"fmt"
-	"log"
 	"sort"
 	"sync"
 	"sync/atomic"
@@ -31,8 +30,24 @@ import (
 	"github.com/bfix/gospel/data"
 )
 
-// Debugging switch
-const Debug = true
+// debugging switch for the validation of forwards and entries
+var debugMode atomic.Bool
+
+// SetDebug enables or disables the validation of forwards and entries
+// (panics on unknown kind or invalid state). Sanity checks of forward
+// tables are enabled per table (see NewForwardTable).
+func SetDebug(on bool) {
+	debugMode.Store(on)
+}
+
+// split horizon: active relays are not taught to their next hop
+// (only switched off in tests to measure the effect)
+var splitHorizon = true
+
+// max. number of LEArn broadcasts using the same cached filter: the filter
+// is rebuilt with a new salt afterwards even if the table did not change,
+// so a false-positive can't hide a target from a neighbor for long.
+var filterReuse = 3
 
 // Kind and state of entry / forward
 const (
@@ -76,10 +91,10 @@ type Forward struct {
 	Peer *PeerID
 
 	// Expected number of hops to target
-	Hops int16 `size:"big"`
+	Hops int16 `order:"big"`
 
 	// Short identifier for next hop
-	NextHop uint32 `size:"big"`
+	NextHop uint32 `order:"big"`
 
 	// Age of entry since creation of the originating entry
 	Age Age
@@ -90,49 +105,60 @@ type Forward struct {
 func (f *Forward) Size() uint {
 	var id *PeerID
 	var age Age
-	return id.Size() + age.Size() + 4
+	return id.Size() + age.Size() + 6
 }
 
 // Kind of forward
 func (f *Forward) Kind() (kind int) {
+	kind = f.kind()
+	if debugMode.Load() && kind == KindUnknown {
+		panic(fmt.Sprintf("unknown kind: %s", f))
+	}
+	return
+}
+
+// kind of forward (no debug check)
+func (f *Forward) kind() int {
 	switch f.Hops {
 	case 0, -2, -4:
 		if f.NextHop != 0 {
-			kind = KindUnknown
-			panic("")
-		} else {
-			kind = KindNeighbor
+			return KindUnknown
 		}
+		return KindNeighbor
 	default:
 		if f.NextHop == 0 {
-			kind = KindUnknown
-			panic("")
-		} else {
-			kind = KindRelay
+			return KindUnknown
 		}
+		return KindRelay
 	}
-	if Debug && kind == KindUnknown {
-		panic(fmt.Sprintf("unknown kind: %s", f))
-	}
-	return
 }
 
 // State of the forward
 func (f *Forward) State() (state int) {
+	state = f.state()
+	if debugMode.Load() && state == StateInvalid {
+		panic(fmt.Sprintf("invalid state: %s", f))
+	}
+	return
+}
+
+// state of the forward (no debug check)
+func (f *Forward) state() int {
 	switch f.Hops {
 	case -1, -2:
-		state = StateRemoved
+		return StateRemoved
 	default:
 		if f.Hops >= 0 {
-			state = StateActive
-		} else {
-			state = StateInvalid
+			return StateActive
 		}
+		return StateInvalid
 	}
-	if Debug && state == StateInvalid {
-		panic(fmt.Sprintf("invalid state: %s", f))
-	}
-	return
+}
+
+// valid returns true if hops and next hop of the forward are consistent
+// (a forward of known kind and valid state).
+func (f *Forward) valid() bool {
+	return f.kind() != KindUnknown && f.state() != StateInvalid
 }
 
 // IsA checks if a forward is of given kind and state
@@ -172,6 +198,10 @@ type Entry struct {
 	// Next hop (nil for neighbors)
 	NextHop *PeerID
 
+	// Alternative next hops for routes of equal length (ECMP);
+	// only used for active relays.
+	AltNext []*PeerID
+
 	// Timestamp of the forward (route)
 	// It is the time the target was seen by its neighbor from which
 	// this route originated.
@@ -217,12 +247,61 @@ func (e *Entry) Clone() *Entry {
 		Peer:    e.Peer,
 		Hops:    e.Hops,
 		NextHop: e.NextHop,
+		AltNext: Clone(e.AltNext),
 		Origin:  e.Origin,
 		Changed: e.Changed,
 		Pending: e.Pending,
 	}
 }
 
+// maximum number of alternative next hops in an entry
+const maxAltNext = 3
+
+// add an alternative next hop (if not already known). Alternatives are
+// kept in ascending peer id order; if the list is full, only a smaller
+// peer id replaces the largest one. The set of alternatives therefore
+// doesn't depend on the order in which announcements arrive. Returns
+// true if the alternative was added.
+func (e *Entry) addAlternative(next *PeerID) bool {
+	if next.Equal(e.NextHop) {
+		return false
+	}
+	pos := len(e.AltNext)
+	for i, alt := range e.AltNext {
+		if alt.Equal(next) {
+			return false
+		}
+		if next.Less(alt) && pos == len(e.AltNext) {
+			pos = i
+		}
+	}
+	if pos == maxAltNext {
+		return false
+	}
+	if len(e.AltNext) == maxAltNext {
+		e.AltNext = e.AltNext[:maxAltNext-1]
+	}
+	e.AltNext = append(e.AltNext, nil)
+	copy(e.AltNext[pos+1:], e.AltNext[pos:])
+	e.AltNext[pos] = next
+	return true
+}
+
+// remove an alternative next hop. Returns true if the alternative
+// was removed.
+func (e *Entry) removeAlternative(next *PeerID) bool {
+	for i, alt := range e.AltNext {
+		if alt.Equal(next) {
+			e.AltNext = append(e.AltNext[:i], e.AltNext[i+1:]...)
+			if len(e.AltNext) == 0 {
+				e.AltNext = nil
+			}
+			return true
+		}
+	}
+	return false
+}
+
 // Kind of forward
 func (e *Entry) Kind() (kind int) {
 	switch e.Hops {
@@ -239,7 +318,7 @@ func (e *Entry) Kind() (kind int) {
 			kind = KindRelay
 		}
 	}
-	if Debug && kind == KindUnknown {
+	if debugMode.Load() && kind == KindUnknown {
 		panic(fmt.Sprintf("unknown kind: %s", e))
 	}
 	return
@@ -259,7 +338,7 @@ func (e *Entry) State() (state int) {
 			state = StateInvalid
 		}
 	}
-	if Debug && state == StateInvalid {
+	if debugMode.Load() && state == StateInvalid {
 		panic(fmt.Sprintf("invalid state: %s", e))
 	}
 	return
@@ -296,6 +375,7 @@ func (e *Entry) SetState(state int) {
 	default:
 		panic("unknown kind for state change")
 	}
+	e.AltNext = nil
 	e.Changed = now
 }
 
@@ -304,6 +384,18 @@ func (e *Entry) IsA(kind, state int) bool {
 	return e.Kind() == kind && e.State() == state
 }
 
+// Reachable returns true if the target of an active entry is in reach
+// (not more than MaxHops away).
+func (e *Entry) Reachable() bool {
+	return e.State() == StateActive && int(e.Hops) <= cfg.MaxHops
+}
+
+// inFilter returns true if the target of an entry is added to a LEArn
+// filter (not dormant and in reach).
+func (e *Entry) inFilter() bool {
+	return e.State() != StateDormant && int(e.Hops) <= cfg.MaxHops
+}
+
 // String returns a human-readable representation
 func (e *Entry) String() string {
 	if e == nil {
@@ -316,7 +408,7 @@ func (e *Entry) String() string {
 //----------------------------------------------------------------------
 // FowardTable holds a list of entries to all targets learned from the
 // leatea protocol:
-// Entries, once added to the table, are never removed from the table
+// Entries, once added to the table, are not removed from the table
 // again. If a forward is "removed", it is flagged by hop count (-1 for
 // removed relay and -2 for removed neighbor). A removed entry can be
 // included in a TEAch message; it is set to "dormant" once it was
@@ -324,6 +416,9 @@ func (e *Entry) String() string {
 // Dormant entries can be resurrected by announces; neighbors get
 // resurrected when a message from them is received and relays get
 // resurrected when a newer relay is learned.
+// To bound the size of the table on long-lived nodes, dormant entries
+// can be purged after some time (see PurgeDormant); a purged target is
+// learned again like any new target.
 //----------------------------------------------------------------------
 
 // ForwardTable is a map of entries with key "target"
@@ -342,8 +437,49 @@ type ForwardTable struct {
 	// sequence number
 	seq atomic.Uint32
 
-	// sanity checker (optional)
-	check func(string, ...any)
+	// sanity checker (optional) and handling of violations
+	check  func(*ForwardTable, string, ...any)
+	strict bool
+
+	// reliable removals (optional): taught removals not acknowledged
+	// by all neighbors and received removals to be acknowledged.
+	unacked map[string]*removal
+	acks    []*Ack
+
+	// ordering of TEAch candidates (nil = DefaultCandidatePolicy)
+	policy CandidatePolicy
+
+	// number of own LEArn broadcasts since a removed entry was first
+	// taught (only for repeated removals, see Config.RemovalRepeats)
+	repeats map[string]int
+
+	// check of filtered candidates for false positives (optional)
+	filterCheck FilterCheck
+
+	// number of beacons received from active neighbors and the time of
+	// the last beacon (neighbors sending beacons expire on their beacons)
+	beacons    map[string]int
+	lastBeacon map[string]Time
+
+	// time a relay was last learned or refreshed by its next hop (relays
+	// not refreshed expire, see Config.Outdated)
+	refreshed map[string]Time
+
+	// processing time of received messages per message type (optional)
+	procStats map[uint16]*ProcStat
+
+	// cached LEArn filter and the number of times it was used (nil if
+	// the set of targets in the filter changed)
+	pf     *data.SaltedBloomFilter
+	pfUses int
+
+	// subscribers to events (see Subscribe) and events queued for
+	// dispatch to listener and subscribers (after the table is unlocked)
+	subLock  sync.Mutex
+	subs     []*subscriber
+	subID    int
+	queued   []*Event
+	dispatch sync.Mutex
 }
 
 // NewForwardTable creates an empty table
@@ -355,26 +491,90 @@ func NewForwardTable(self *PeerID, debug bool) *ForwardTable {
 	}
 	tbl.seq.Store(0)
 	if debug {
-		tbl.check = tbl.sanityCheck
+		tbl.check = (*ForwardTable).checkTable
+		tbl.strict = true
 	}
 	return tbl
 }
 
+// SetStrict controls the handling of failed sanity checks (debug mode):
+// strict tables panic, others report violations to the listener and
+// keep running.
+func (tbl *ForwardTable) SetStrict(strict bool) {
+	tbl.Lock()
+	defer tbl.Unlock()
+	tbl.strict = strict
+}
+
+// SetCandidatePolicy sets the policy for ordering candidates in TEAch
+// messages; nil restores the default policy.
+func (tbl *ForwardTable) SetCandidatePolicy(policy CandidatePolicy) {
+	tbl.Lock()
+	defer tbl.Unlock()
+	tbl.policy = policy
+}
+
+// FilterCheck returns true if a learner actually knows a target. It is
+// used to detect false positives of LEArn filters (in simulations where
+// the tables of all nodes are known).
+type FilterCheck func(learner, target *PeerID) bool
+
+// SetFilterCheck sets the check for entries withheld from a learner
+// because they are contained in its LEArn filter: if the learner does
+// not know the target, an EvBloomFalsePositive event is emitted. nil
+// switches the check off.
+func (tbl *ForwardTable) SetFilterCheck(check FilterCheck) {
+	tbl.Lock()
+	defer tbl.Unlock()
+	tbl.filterCheck = check
+}
+
 //======================================================================
 // LEArn / TEAch and beacon message handling
 //======================================================================
 
-// Teach about our local forward table
-func (tbl *ForwardTable) Teach(msg *LEArnMsg) (*TEAchMsg, [4]int) {
+// Teach about our local forward table: returns TEAch messages (with max.
+// MaxTeachs entries each) that cover all candidates in order of priority
+// and the number of removed, unfiltered and pending entries taught.
+func (tbl *ForwardTable) Teach(msg *LEArnMsg) (out []*TEAchMsg, counts [3]int) {
 	// build a list of candidate entries for teaching:
 	// candidates are not included in the learn filter
 	// and don't have the learner as next hop.
-	candidates, counts := tbl.candidates(msg)
-	if len(candidates) == 0 {
-		return nil, counts
+	candidates, filtered, counts := tbl.candidates(msg)
+
+	// check filtered entries for false positives (table not locked, as
+	// the check accesses the table of the learner)
+	tbl.Lock()
+	check := tbl.filterCheck
+	tbl.Unlock()
+	if check != nil {
+		for _, target := range filtered {
+			if !check(msg.Sender(), target) {
+				tbl.emit(&Event{
+					Type: EvBloomFalsePositive,
+					Seq:  tbl.nextSeq(),
+					Peer: tbl.self,
+					Ref:  msg.Sender(),
+					Val:  target,
+				})
+			}
+		}
 	}
-	// assemble TEACH message
-	return NewTEAchMsg(tbl.self, candidates), counts
+	return tbl.teachMsgs(candidates), counts
+}
+
+// assemble TEACH messages (with max. MaxTeachs entries each) from a list
+// of forwards (in order).
+func (tbl *ForwardTable) teachMsgs(list []*Forward) (out []*TEAchMsg) {
+	for len(list) > 0 {
+		n := cfg.MaxTeachs
+		if n > len(list) {
+			n = len(list)
+		}
+		out = append(out, NewTEAchMsg(tbl.self, list[:n]))
+		list = list[n:]
+	}
+	return
 }
 
 // AddNeighbor to forward table:
@@ -383,10 +583,11 @@ func (tbl *ForwardTable) Teach(msg *LEArnMsg) (*TEAchMsg, [4]int) {
 func (tbl *ForwardTable) AddNeighbor(node *PeerID) {
 	tbl.Lock()
 	defer func() {
-		if Debug {
-			tbl.check("add neighbor")
+		if tbl.check != nil {
+			tbl.check(tbl, "add neighbor")
 		}
 		tbl.Unlock()
+		tbl.flush()
 	}()
 	// check for active table
 	if tbl.recs == nil {
@@ -399,14 +600,23 @@ func (tbl *ForwardTable) AddNeighbor(node *PeerID) {
 		// next hop and hop count need to be reset in case
 		// the old entry was a relay.
 		wasRelay := (entry.Kind() == KindRelay)
+		if !entry.IsA(KindNeighbor, StateActive) {
+			delete(tbl.beacons, node.Key())
+			delete(tbl.lastBeacon, node.Key())
+		}
+		delete(tbl.refreshed, node.Key())
+		if !entry.inFilter() {
+			tbl.pf = nil
+		}
 		entry.NextHop = nil
+		entry.AltNext = nil
 		entry.Hops = 0
 		entry.Origin = now
 		entry.Changed = now
 
 		// notify listener
-		if wasRelay && tbl.listener != nil {
-			tbl.listener(&Event{
+		if wasRelay {
+			tbl.notify(&Event{
 				Type: EvNeighborUpdated,
 				Seq:  tbl.nextSeq(),
 				Peer: tbl.self,
@@ -416,6 +626,7 @@ func (tbl *ForwardTable) AddNeighbor(node *PeerID) {
 		return
 	}
 	// new neighbor: insert new entry into table
+	tbl.pf = nil
 	tbl.recs[node.Key()] = &Entry{
 		Peer:    node,
 		Hops:    0,
@@ -425,29 +636,52 @@ func (tbl *ForwardTable) AddNeighbor(node *PeerID) {
 		Pending: true,
 	}
 	// notify listener
-	if tbl.listener != nil {
-		tbl.listener(&Event{
-			Type: EvNeighborAdded,
-			Seq:  tbl.nextSeq(),
-			Peer: tbl.self,
-			Ref:  node,
-		})
-	}
+	tbl.notify(&Event{
+		Type: EvNeighborAdded,
+		Seq:  tbl.nextSeq(),
+		Peer: tbl.self,
+		Ref:  node,
+	})
 }
 
 // NewLearn creates a new LEArn message from current table
 func (tbl *ForwardTable) NewLearn() *LEArnMsg {
+	tbl.ageRemovals()
 	return NewLearnMsg(tbl.self, tbl.filter())
 }
 
+// ageRemovals counts a LEArn broadcast for all taught removals: a
+// removal is taught in responses until RemovalRepeats broadcasts
+// passed (to survive lost messages); the entry is dormant afterwards.
+func (tbl *ForwardTable) ageRemovals() {
+	tbl.Lock()
+	defer tbl.Unlock()
+	for key, n := range tbl.repeats {
+		entry, ok := tbl.recs[key]
+		if !ok || entry.State() != StateRemoved {
+			delete(tbl.repeats, key)
+			continue
+		}
+		if n++; n < cfg.RemovalRepeats {
+			tbl.repeats[key] = n
+			continue
+		}
+		// tag entry as dormant (not in LEArn filter)
+		delete(tbl.repeats, key)
+		entry.SetState(StateDormant)
+		tbl.pf = nil
+	}
+}
+
 // Learn from announcements in a TEAch message
 func (tbl *ForwardTable) Learn(msg *TEAchMsg) {
 	tbl.Lock()
 	defer func() {
-		if Debug {
-			tbl.check("learn", msg.Sender(), msg.Announce)
+		if tbl.check != nil {
+			tbl.check(tbl, "learn", msg.Sender(), msg.Announce)
 		}
 		tbl.Unlock()
+		tbl.flush()
 	}()
 	// check for active table
 	if tbl.recs == nil {
@@ -457,8 +691,24 @@ func (tbl *ForwardTable) Learn(msg *TEAchMsg) {
 	sender := msg.Sender()
 	now := TimeNow()
 	for _, announce := range msg.Announce {
-		// ignore announcements about ourself
+		// skip inconsistent announcements
+		if !announce.valid() {
+			continue
+		}
+		// acknowledge removals (reliable mode)
 		peer := announce.Peer
+		if cfg.ReliableRemovals > 0 && announce.State() == StateRemoved {
+			tbl.ackRemoval(sender, peer)
+		}
+		// farewell of the sender (node stopping): remove the neighbor
+		// and its dependent relays.
+		if peer.Equal(sender) && announce.IsA(KindNeighbor, StateRemoved) {
+			if entry, ok := tbl.recs[peer.Key()]; ok && entry.IsA(KindNeighbor, StateActive) {
+				tbl.removeNeighbor(entry)
+			}
+			continue
+		}
+		// ignore announcements about ourself
 		if peer.Equal(tbl.self) {
 			continue
 		}
@@ -480,6 +730,8 @@ func (tbl *ForwardTable) Learn(msg *TEAchMsg) {
 			} else if announce.IsA(KindNeighbor, StateRemoved) {
 				hops = -2
 				next = nil
+			} else if tbl.overLimit(announce, sender) || tbl.viaSelf(announce, sender) {
+				continue
 			}
 			// create new entry
 			e := &Entry{
@@ -492,17 +744,19 @@ func (tbl *ForwardTable) Learn(msg *TEAchMsg) {
 			}
 			// add entry to forward table
 			tbl.recs[key] = e
+			tbl.pf = nil
+			if next != nil {
+				tbl.refresh(e)
+			}
 
 			// notify listener
-			if tbl.listener != nil {
-				tbl.listener(&Event{
-					Type: EvForwardLearned,
-					Seq:  tbl.nextSeq(),
-					Peer: tbl.self,
-					Ref:  sender,
-					Val:  e,
-				})
-			}
+			tbl.notify(&Event{
+				Type: EvForwardLearned,
+				Seq:  tbl.nextSeq(),
+				Peer: tbl.self,
+				Ref:  sender,
+				Val:  e,
+			})
 			continue
 		}
 		//--------------------------------------------------------------
@@ -515,8 +769,13 @@ func (tbl *ForwardTable) Learn(msg *TEAchMsg) {
 		// out-dated announcement?
 		outdated := (origin.Diff(entry.Origin) < 1)
 
-		// candidate for update: remove pending flag
-		entry.Pending = false
+		// candidate for update: the sender knows about the target, so
+		// there is no need to broadcast the entry (unless the sender's
+		// announcement is out-dated: a stale announcement doesn't clear
+		// the pending flag).
+		if !outdated {
+			entry.Pending = false
+		}
 
 		// remember old entry
 		oldEntry := entry.Clone()
@@ -526,7 +785,10 @@ func (tbl *ForwardTable) Learn(msg *TEAchMsg) {
 		// "removal" announced?
 		//--------------------------------------------------------------
 		if announce.State() == StateRemoved {
-			// yes: continue if entry is already removed or dormant
+			// the sender is no alternative next hop anymore
+			entry.removeAlternative(sender)
+
+			// continue if entry is already removed or dormant
 			if entry.State() != StateActive {
 				continue
 			}
@@ -536,9 +798,9 @@ func (tbl *ForwardTable) Learn(msg *TEAchMsg) {
 			}
 			// neighbor entry?
 			if entry.Kind() == KindNeighbor {
-				// broadcast entry to counter the removal
+				// we still see the neighbor: ignore the removal, but
+				// broadcast our entry to counter it.
 				entry.Pending = true
-				//log.Printf("[%s] D sender %s: announce = %s,entry = %s", tbl.self, sender, announce, entry)
 				continue
 			}
 			// relay entry:
@@ -549,96 +811,129 @@ func (tbl *ForwardTable) Learn(msg *TEAchMsg) {
 				entry.SetState(StateRemoved)
 				entry.Origin = origin
 				entry.Pending = true
+				delete(tbl.refreshed, key)
 				changed = true
 
 				// notify listener we removed a forward
-				if tbl.listener != nil {
-					tbl.listener(&Event{
-						Type: EvRelayRemoved,
-						Seq:  tbl.nextSeq(),
-						Peer: tbl.self,
-						Ref:  entry.Peer,
-					})
-				}
+				tbl.notify(&Event{
+					Type: EvRelayRemoved,
+					Seq:  tbl.nextSeq(),
+					Peer: tbl.self,
+					Ref:  entry.Peer,
+				})
 			} else {
-				//log.Printf("[%s] A sender %s: announce = %s,entry = %s", tbl.self, sender, announce, entry)
+				// our route does not depend on the sender: ignore
 				continue
 			}
 		} else if entry.Kind() == KindRelay {
 			// relay:
 
+			// drop the sender as alternative next hop if its
+			// route has changed.
+			if announce.Hops+1 != entry.Hops {
+				entry.removeAlternative(sender)
+			}
 			// only update on dormant entry or shorter route
 			evType := 0
 			switch {
 			case announce.Hops+1 < entry.Hops && !outdated:
 				evType = EvShorterRoute
-			//case announce.Hops+1 == entry.Hops && !sender.Equal(entry.NextHop):
-			//	evType = EvRelayUpdated
+			case announce.Hops+1 == entry.Hops && !sender.Equal(entry.NextHop) &&
+				entry.State() == StateActive && cfg.RouteHysteresis > 0 &&
+				origin.Diff(entry.Origin) >= float64(cfg.RouteHysteresis):
+				// route of equal length via a different neighbor that
+				// is much newer than our (not refreshed) route: switch
+				// (hysteresis prevents flapping between neighbors).
+				evType = EvRelayUpdated
 			case entry.State() == StateDormant:
 				evType = EvRelayRevived
+			case announce.Hops+1 == entry.Hops && sender.Equal(entry.NextHop) && !outdated:
+				// newer announcement for the same route: refresh the
+				// relay (no change in forwarding). Neighbors learn
+				// the refresh when the relay is due for refresh in
+				// their LEArn filters (see filterTargets).
+				entry.Origin = origin
+				tbl.refresh(entry)
+				continue
+			case announce.Hops+1 == entry.Hops && entry.State() == StateActive &&
+				announce.NextHop != tbl.self.Tag():
+				// route of equal length via a different neighbor:
+				// keep sender as alternative next hop.
+				entry.addAlternative(sender)
+				continue
 			default:
-				//log.Printf("[%s] C sender %s: announce = %s,entry = %s", tbl.self, sender, announce, entry)
+				continue
+			}
+			// route too long?
+			if tbl.overLimit(announce, sender) {
 				continue
 			}
 			// possible loop construction?
 			if entry.NextHop.Equal(sender) && announce.NextHop == tbl.self.Tag() {
-				if tbl.listener != nil {
-					tbl.listener(&Event{
-						Type: EvLoopDetect,
-						Seq:  tbl.nextSeq(),
-						Peer: tbl.self,
-						Ref:  sender,
-						Val:  []any{entry, announce},
-					})
-				}
+				tbl.notify(&Event{
+					Type: EvLoopDetect,
+					Seq:  tbl.nextSeq(),
+					Peer: tbl.self,
+					Ref:  sender,
+					Val:  []any{entry, announce},
+				})
+				continue
+			}
+			if tbl.viaSelf(announce, sender) {
 				continue
 			}
 			// update relay with newer relay
 			entry.Hops = announce.Hops + 1
 			entry.NextHop = sender
+			entry.AltNext = nil
 			entry.Origin = origin
 			entry.Changed = now
 			entry.Pending = true
 			changed = true
+			tbl.refresh(entry)
 
 			// notify listener
-			if tbl.listener != nil {
-				tbl.listener(&Event{
-					Type: evType,
-					Seq:  tbl.nextSeq(),
-					Peer: tbl.self,
-					Ref:  entry.Peer,
-				})
-			}
+			tbl.notify(&Event{
+				Type: evType,
+				Seq:  tbl.nextSeq(),
+				Peer: tbl.self,
+				Ref:  entry.Peer,
+			})
 		} else if entry.IsA(KindNeighbor, StateDormant) {
 			// dormant neighbor:
-
+			if tbl.overLimit(announce, sender) || tbl.viaSelf(announce, sender) {
+				continue
+			}
 			// update with newer relay
 			entry.Hops = announce.Hops + 1
 			entry.NextHop = sender
+			entry.AltNext = nil
 			entry.Origin = origin
 			entry.Changed = now
 			entry.Pending = true
 			changed = true
+			tbl.refresh(entry)
 
 			// notify listener
-			if tbl.listener != nil {
-				tbl.listener(&Event{
-					Type: EvNeighborRelayed,
-					Seq:  tbl.nextSeq(),
-					Peer: tbl.self,
-					Ref:  entry.Peer,
-				})
-			}
+			tbl.notify(&Event{
+				Type: EvNeighborRelayed,
+				Seq:  tbl.nextSeq(),
+				Peer: tbl.self,
+				Ref:  entry.Peer,
+			})
 		} else {
-			// log.Printf("[%s] B sender %s: announce = %s,entry = %s", tbl.self, sender, announce, entry)
 			continue
 		}
-		// notify listener if table entry has changed
-		if changed && tbl.listener != nil {
+		// revived entries are added to the LEArn filter
+		if !oldEntry.inFilter() && entry.inFilter() {
+			tbl.pf = nil
+		}
+		// notify listener if table entry has changed (next hop or hops)
+		changed = changed && (oldEntry.Hops != entry.Hops || !oldEntry.NextHop.Equal(entry.NextHop))
+		if changed {
 			// send event
 			annEntry := EntryFromForward(announce, sender)
-			tbl.listener(&Event{
+			tbl.notify(&Event{
 				Type: EvForwardChanged,
 				Seq:  tbl.nextSeq(),
 				Peer: tbl.self,
@@ -653,16 +948,45 @@ func (tbl *ForwardTable) Learn(msg *TEAchMsg) {
 // Helper methods for message handling
 //======================================================================
 
+// viaSelf returns true if the sender of an (active relay) announcement
+// forwards to the target via us: learning such a route would create a
+// self-referential forward (loop). A warning is logged.
+func (tbl *ForwardTable) viaSelf(announce *Forward, sender *PeerID) bool {
+	if announce.NextHop != tbl.self.Tag() || !announce.IsA(KindRelay, StateActive) {
+		return false
+	}
+	logger().Warn("[%s] forward to %s from %s ignored: next hop is self", tbl.self, announce.Peer, sender)
+	return true
+}
+
+// overLimit returns true if the route of an (active) announcement would
+// exceed the hop limit (metric infinity); such announcements are ignored.
+// The listener is notified about the ignored route (count-to-infinity).
+func (tbl *ForwardTable) overLimit(announce *Forward, sender *PeerID) bool {
+	if int(announce.Hops)+1 <= cfg.MaxHops {
+		return false
+	}
+	tbl.notify(&Event{
+		Type: EvHopLimitExceeded,
+		Seq:  tbl.nextSeq(),
+		Peer: tbl.self,
+		Ref:  sender,
+		Val:  EntryFromForward(announce, sender),
+	})
+	return true
+}
+
 // cleanup forward table and flag expired neighbors (and their dependencies)
-// for removal. The actual deletion of the entry in the table happens after
-// the removed entry was broadcasted in a TEAch message.
+// and outdated relays for removal. The actual deletion of the entry in the
+// table happens after the removed entry was broadcasted in a TEAch message.
 func (tbl *ForwardTable) cleanup() {
 	tbl.Lock()
 	defer func() {
-		if Debug {
-			tbl.check("clean-up")
+		if tbl.check != nil {
+			tbl.check(tbl, "clean-up")
 		}
 		tbl.Unlock()
+		tbl.flush()
 	}()
 
 	// remove expired neighbors (and their dependent relays)
@@ -672,144 +996,295 @@ func (tbl *ForwardTable) cleanup() {
 			// no:
 			continue
 		}
-		// has the neighbor expired?
-		if !entry.Origin.Expired(time.Duration(cfg.TTLBeacon) * time.Second) {
+		// has the neighbor expired? A neighbor that sent beacons expires
+		// when its beacons stop (even if it still sends other messages);
+		// otherwise the last message of the neighbor counts.
+		seen := entry.Origin
+		if t, ok := tbl.lastBeacon[entry.Peer.Key()]; ok {
+			seen = t
+		}
+		if !seen.Expired(time.Duration(cfg.TTLBeacon) * time.Second) {
 			// no:
 			continue
 		}
-		// notify listener
-		if tbl.listener != nil {
-			tbl.listener(&Event{
-				Type: EvNeighborExpired,
+		// remove neighbor
+		tbl.removeNeighbor(entry)
+	}
+	// remove outdated relays (if configured)
+	if cfg.Outdated > 0 {
+		ttl := time.Duration(cfg.Outdated) * time.Second
+		for key, entry := range tbl.recs {
+			// only active relays (relays depending on an expired
+			// neighbor have already been removed)
+			if !entry.IsA(KindRelay, StateActive) {
+				continue
+			}
+			// is the relay outdated?
+			seen := tbl.lastRefresh(entry)
+			if !seen.Expired(ttl) {
+				// relay due for refresh: rebuild a cached filter that
+				// still contains it (see filter)
+				if seen.Expired(ttl/2) && tbl.pf != nil && tbl.pf.Contains(entry.Peer.Bytes()) {
+					tbl.pf = nil
+				}
+				continue
+			}
+			// remove relay
+			entry.SetState(StateRemoved)
+			entry.Pending = true
+			delete(tbl.refreshed, key)
+
+			// notify listener we removed a forward
+			tbl.notify(&Event{
+				Type: EvRelayRemoved,
 				Seq:  tbl.nextSeq(),
 				Peer: tbl.self,
 				Ref:  entry.Peer,
 			})
 		}
-		// remove neighbor
-		entry.SetState(StateRemoved)
-		entry.Pending = true
-
-		// remove dependent relays
-		for _, fw := range tbl.recs {
-			// only relays where next hop equals neighbor
-			if fw.NextHop.Equal(entry.Peer) {
-				// remove forward
-				fw.SetState(StateRemoved)
-				fw.Pending = true
-				// notify listener we removed a forward
-				if tbl.listener != nil {
-					tbl.listener(&Event{
-						Type: EvRelayRemoved,
-						Seq:  tbl.nextSeq(),
-						Peer: tbl.self,
-						Ref:  fw.Peer,
-					})
-				}
-			}
+	}
+	// purge long-dormant entries (if configured)
+	if cfg.DormantTTL > 0 {
+		tbl.purgeDormant(time.Duration(cfg.DormantTTL) * time.Second)
+	}
+}
+
+// refresh a relay: it was (re-)learned from its next hop. A relay that
+// was due for refresh is in the LEArn filter again.
+// (only call from within a locked table instance!)
+func (tbl *ForwardTable) refresh(entry *Entry) {
+	if cfg.Outdated > 0 && tbl.lastRefresh(entry).Expired(time.Duration(cfg.Outdated)*time.Second/2) {
+		tbl.pf = nil
+	}
+	if tbl.refreshed == nil {
+		tbl.refreshed = make(map[string]Time)
+	}
+	tbl.refreshed[entry.Peer.Key()] = TimeNow()
+}
+
+// lastRefresh returns the time a relay was last refreshed by its next
+// hop (or its origin if the relay was not learned by this table).
+// (only call from within a locked table instance!)
+func (tbl *ForwardTable) lastRefresh(entry *Entry) Time {
+	if t, ok := tbl.refreshed[entry.Peer.Key()]; ok {
+		return t
+	}
+	return entry.Origin
+}
+
+// remove an (expired or departed) neighbor and its dependent relays.
+// (only call from within a locked table instance!)
+func (tbl *ForwardTable) removeNeighbor(entry *Entry) {
+	// notify listener
+	tbl.notify(&Event{
+		Type: EvNeighborExpired,
+		Seq:  tbl.nextSeq(),
+		Peer: tbl.self,
+		Ref:  entry.Peer,
+	})
+	// remove neighbor
+	entry.SetState(StateRemoved)
+	entry.Pending = true
+
+	// remove dependent relays
+	for _, fw := range tbl.recs {
+		// drop neighbor as alternative next hop
+		fw.removeAlternative(entry.Peer)
+
+		// only relays where next hop equals neighbor
+		if fw.NextHop.Equal(entry.Peer) {
+			// remove forward
+			fw.SetState(StateRemoved)
+			fw.Pending = true
+			delete(tbl.refreshed, fw.Peer.Key())
+			// notify listener we removed a forward
+			tbl.notify(&Event{
+				Type: EvRelayRemoved,
+				Seq:  tbl.nextSeq(),
+				Peer: tbl.self,
+				Ref:  fw.Peer,
+			})
+		}
+	}
+}
+
+// purge dormant entries that have not changed for 'maxAge'. Entries that
+// are still referenced as next hop by other entries are kept.
+// (only call from within a locked table instance!)
+func (tbl *ForwardTable) purgeDormant(maxAge time.Duration) (count int) {
+	// collect referenced next hops
+	refs := make(map[string]bool)
+	for _, entry := range tbl.recs {
+		if entry.NextHop != nil {
+			refs[entry.NextHop.Key()] = true
+		}
+	}
+	// delete unreferenced dormant entries
+	for key, entry := range tbl.recs {
+		if entry.State() != StateDormant || refs[key] {
+			continue
+		}
+		if entry.Changed.Expired(maxAge) {
+			delete(tbl.recs, key)
+			delete(tbl.refreshed, key)
+			delete(tbl.beacons, key)
+			delete(tbl.lastBeacon, key)
+			delete(tbl.repeats, key)
+			count++
+		}
+	}
+	return
+}
+
+// filterFPR is the false-positive rate of a LEArn filter for n targets.
+func filterFPR(n int) float64 {
+	return 1. / float64(n+1)
+}
+
+// filterTargets returns the targets for a LEArn filter: all entries
+// except dormant entries and unreachable targets, and ourself (can't
+// learn about myself from others). Relays due for refresh are left out,
+// so our neighbors teach them again (relays not refreshed by their next
+// hop expire).
+// (only call from within a locked table instance!)
+func (tbl *ForwardTable) filterTargets() []*PeerID {
+	refresh := time.Duration(cfg.Outdated) * time.Second / 2
+	targets := make([]*PeerID, 0, len(tbl.recs)+1)
+	for _, entry := range tbl.recs {
+		if !entry.inFilter() {
+			continue
 		}
+		if cfg.Outdated > 0 && entry.IsA(KindRelay, StateActive) && tbl.lastRefresh(entry).Expired(refresh) {
+			continue
+		}
+		targets = append(targets, entry.Peer)
 	}
+	return append(targets, tbl.self)
 }
 
 // filter returns a bloomfilter from all table entries (PeerID).
-// Remove expired entries first.
+// Remove expired entries first. The filter is cached as long as the
+// set of targets in the filter is unchanged (and the filter was not
+// used more than filterReuse times).
 func (tbl *ForwardTable) filter() *data.SaltedBloomFilter {
 	// clean-up first
 	tbl.cleanup()
 
-	// create bloomfilter
+	// use cached filter
 	tbl.Lock()
 	defer tbl.Unlock()
+	if tbl.pf != nil && tbl.pfUses < filterReuse {
+		tbl.pfUses++
+		return tbl.pf
+	}
+	// create bloomfilter sized for the targets
+	targets := tbl.filterTargets()
 	salt := RndUInt32()
-	n := len(tbl.recs) + 2
-	fpr := 1. / float64(n)
-	pf := data.NewSaltedBloomFilter(salt, n, fpr)
-
-	// process all table entries
-	for _, entry := range tbl.recs {
-		// skip dormant entries
-		if entry.State() == StateDormant {
-			continue
-		}
-		// add entry to filter
-		pf.Add(entry.Peer.Bytes())
+	n := len(targets)
+	pf := data.NewSaltedBloomFilter(salt, n, filterFPR(n))
+	for _, peer := range targets {
+		pf.Add(peer.Bytes())
 	}
-	// add ourself to the filter (can't learn about myself from others)
-	pf.Add(tbl.self.Bytes())
+	tbl.pf, tbl.pfUses = pf, 1
 	return pf
 }
 
 //----------------------------------------------------------------------
 
+// CandidatePolicy scores a candidate entry for inclusion in a TEAch message:
+// candidates are taught in order of ascending score (and ascending number
+// of hops for equal scores). The policy is called with the table entry,
+// a flag if the entry is filtered (contained in the LEArn filter) and a
+// flag if the entry is pending (changed but not taught yet). The entry
+// must not be modified.
+type CandidatePolicy func(e *Entry, filtered, pending bool) int
+
+// DefaultCandidatePolicy prefers unfiltered entries (0) over removed
+// neighbors (1), removed relays (2) and pending entries (3).
+func DefaultCandidatePolicy(e *Entry, filtered, pending bool) int {
+	switch {
+	case e.State() == StateRemoved:
+		if e.Kind() == KindRelay {
+			return 2
+		}
+		return 1
+	case pending:
+		return 3
+	}
+	return 0
+}
+
 // Candidate entry for inclusion in a TEAch message
 type candidate struct {
-	e    *Entry // reference to entry
-	kind int    // entry classification (lower value = higher priority)
+	e     *Entry // reference to entry
+	score int    // score of entry (lower value = higher priority)
 }
 
 // Candiates returns a list of table entries that are not filtered out by the
 // bloomfilter contained in the LEArn message.
-// Pending entries (updated but not forwarded yet) are collected if there is
-// space for them in the result list.
-func (tbl *ForwardTable) candidates(m *LEArnMsg) (list []*Forward, counts [4]int) {
+// Removed and pending entries (updated but not forwarded yet) are always
+// collected. The list is sorted by the candidate policy. If a filter check
+// is set, the targets only withheld because of the filter are returned
+// too.
+func (tbl *ForwardTable) candidates(m *LEArnMsg) (list []*Forward, withheld []*PeerID, counts [3]int) {
 	tbl.Lock()
 	defer func() {
-		if Debug {
-			tbl.check("candidates")
+		if tbl.check != nil {
+			tbl.check(tbl, "candidates")
 		}
 		tbl.Unlock()
+		tbl.flush()
 	}()
 
+	policy := tbl.policy
+	if policy == nil {
+		policy = DefaultCandidatePolicy
+	}
 	// collect forwards for response
 	collect := make([]*candidate, 0)
 	for _, entry := range tbl.recs {
-		// new candidate and flag for inclusion
-		cnd := &candidate{entry, -1}
-		add := false
-
 		// add entry if not filtered
-		if !m.Filter.Contains(entry.Peer.Bytes()) {
-			add = true
-			cnd.kind = 0 // unfiltered entry
-		}
-		// don't add dormant entries
+		filtered := m.Filter.Contains(entry.Peer.Bytes())
+		add := !filtered
+		byFilter := filtered
+
+		// don't add dormant entries or routes too long for the
+		// receiver (no need to broadcast them); removed and
+		// pending entries are always added.
 		if entry.State() == StateDormant {
-			add = false
-		} else if entry.State() == StateRemoved {
+			add, byFilter = false, false
+		} else if entry.State() == StateActive && int(entry.Hops) >= cfg.MaxHops {
+			add, byFilter = false, false
+			entry.Pending = false
+		} else if splitHorizon && entry.IsA(KindRelay, StateActive) && entry.NextHop.Equal(m.Sender()) {
+			// split horizon: don't teach a route back to its next hop
+			// (a pending entry stays pending for other learners).
+			add, byFilter = false, false
+		} else if entry.State() == StateRemoved || entry.Pending {
 			add = true
-			cnd.kind = 1
-			if entry.Kind() == KindRelay {
-				cnd.kind = 2
-			}
-		} else if entry.Pending {
-			// pending entry
-			add = true
-			cnd.kind = 3
 		}
 		// add forward to response if required
 		if add {
-			collect = append(collect, cnd)
-		}
-	}
-	// honor TEAch limit.
-	counts[3] = 0
-	if len(collect) > cfg.MaxTeachs {
-		// sort list by descending kind (primary) and ascending number
-		// of hops (secondary)
-		sort.Slice(collect, func(i, j int) bool {
-			ci := collect[i]
-			cj := collect[j]
-			if ci.kind < cj.kind {
-				return true
-			} else if ci.kind > cj.kind {
-				return false
-			}
-			return ci.e.Hops < cj.e.Hops
-		})
-		// trim list to max. length
-		counts[3] = len(collect) - cfg.MaxTeachs
-		collect = collect[:cfg.MaxTeachs]
+			collect = append(collect, &candidate{
+				e:     entry,
+				score: policy(entry, filtered, entry.Pending),
+			})
+		} else if byFilter && tbl.filterCheck != nil {
+			withheld = append(withheld, entry.Peer)
+		}
 	}
+	// sort list by score (primary) and ascending number of hops
+	// (secondary): candidates are taught in this order.
+	sort.Slice(collect, func(i, j int) bool {
+		ci := collect[i]
+		cj := collect[j]
+		if ci.score < cj.score {
+			return true
+		} else if ci.score > cj.score {
+			return false
+		}
+		return ci.e.Hops < cj.e.Hops
+	})
 	// if we have removed relays in our response, remove them
 	// from the forward table. Reset pending flag on entry and
 	// correct for removed meighbors (they are zombified).
@@ -817,8 +1292,24 @@ func (tbl *ForwardTable) candidates(m *LEArnMsg) (list []*Forward, counts [4]int
 		entry := cnd.e
 		forward := entry.Target()
 		if entry.State() == StateRemoved {
-			// tag entry as dormant
-			entry.SetState(StateDormant)
+			key := entry.Peer.Key()
+			_, repeated := tbl.repeats[key]
+			// track removal for acknowledgements (reliable mode)
+			if cfg.ReliableRemovals > 0 && !repeated {
+				tbl.trackRemoval(entry)
+			}
+			if cfg.RemovalRepeats == 0 {
+				// tag entry as dormant (not in LEArn filter)
+				entry.SetState(StateDormant)
+				tbl.pf = nil
+			} else if !repeated {
+				// keep the removal for further responses (see
+				// ageRemovals)
+				if tbl.repeats == nil {
+					tbl.repeats = make(map[string]int)
+				}
+				tbl.repeats[key] = 0
+			}
 			counts[0]++
 		} else if entry.Pending {
 			counts[2]++
@@ -842,11 +1333,26 @@ func (tbl *ForwardTable) nextSeq() uint32 {
 // Public access methods
 //======================================================================
 
-// Start forward table
+// Start forward table (with entries restored before start or with an
+// empty table)
 func (tbl *ForwardTable) Start() {
+	tbl.Lock()
+	defer tbl.Unlock()
+	if tbl.recs == nil {
+		tbl.recs = make(map[string]*Entry)
+	}
+}
+
+// Restore the table from a list of entries (e.g. from a checkpoint). The
+// table must not be running.
+func (tbl *ForwardTable) Restore(list []*Entry) {
 	tbl.Lock()
 	defer tbl.Unlock()
 	tbl.recs = make(map[string]*Entry)
+	for _, entry := range list {
+		tbl.recs[entry.Peer.Key()] = entry.Clone()
+	}
+	tbl.pf = nil
 }
 
 // Stop forward table:
@@ -857,17 +1363,52 @@ func (tbl *ForwardTable) Stop() {
 	tbl.Lock()
 	defer tbl.Unlock()
 	tbl.recs = nil
+	tbl.pf = nil
+	tbl.beacons = nil
+	tbl.lastBeacon = nil
+	tbl.refreshed = nil
+	tbl.repeats = nil
+	tbl.unacked = nil
+	tbl.acks = nil
+}
+
+// HasPending returns true if the table has entries that are changed but not
+// forwarded yet. Relays that split horizon withholds from the only active
+// neighbor (their next hop) are not counted: there is no one to teach them
+// to (yet).
+func (tbl *ForwardTable) HasPending() bool {
+	tbl.Lock()
+	defer tbl.Unlock()
+	neighbors := 0
+	for _, entry := range tbl.recs {
+		if entry.IsA(KindNeighbor, StateActive) {
+			neighbors++
+		}
+	}
+	for _, entry := range tbl.recs {
+		if !entry.Pending {
+			continue
+		}
+		if splitHorizon && neighbors < 2 && entry.IsA(KindRelay, StateActive) {
+			continue
+		}
+		return true
+	}
+	return false
 }
 
 // Forward returns the peerid of the next hop to target and the number of
-// expected hops along the route.
+// expected hops along the route. Among equal-length routes the next hop
+// is always the primary one (the next hop announced in TEAch messages
+// that neighbors use to detect loops), never an alternative: repeated
+// calls return the same next hop as long as the entry is unchanged.
 func (tbl *ForwardTable) Forward(target *PeerID) (*PeerID, int) {
 	tbl.Lock()
 	defer tbl.Unlock()
 	// lookup entry in table
 	if entry, ok := tbl.recs[target.Key()]; ok {
-		// ignore removed or dormant entries
-		if entry.State() != StateActive {
+		// ignore removed or dormant entries and unreachable targets
+		if !entry.Reachable() {
 			return nil, 0
 		}
 		// return forward information
@@ -877,6 +1418,40 @@ func (tbl *ForwardTable) Forward(target *PeerID) (*PeerID, int) {
 	return nil, 0
 }
 
+// ForwardMulti returns the list of next hops on equal-length routes to
+// target and the number of expected hops along the routes. The first
+// element in the list is the next hop returned by Forward, followed by
+// the alternatives in ascending peer id order. For neighbors
+// the list is nil (and the number of hops is 1).
+func (tbl *ForwardTable) ForwardMulti(target *PeerID) ([]*PeerID, int) {
+	tbl.Lock()
+	defer tbl.Unlock()
+	// lookup entry in table
+	if entry, ok := tbl.recs[target.Key()]; ok {
+		// ignore removed or dormant entries and unreachable targets
+		if !entry.Reachable() {
+			return nil, 0
+		}
+		// neighbor?
+		if entry.NextHop == nil {
+			return nil, 1
+		}
+		// return forward information
+		list := append([]*PeerID{entry.NextHop}, entry.AltNext...)
+		return list, int(entry.Hops) + 1
+	}
+	// target not in table
+	return nil, 0
+}
+
+// PurgeDormant deletes dormant entries from the table that have not changed
+// for 'maxAge'. Returns the number of deleted entries.
+func (tbl *ForwardTable) PurgeDormant(maxAge time.Duration) int {
+	tbl.Lock()
+	defer tbl.Unlock()
+	return tbl.purgeDormant(maxAge)
+}
+
 // NumForwards returns the number of (active) targets in the forward table
 func (tbl *ForwardTable) NumForwards() (count int) {
 	tbl.Lock()
@@ -903,6 +1478,26 @@ func (tbl *ForwardTable) Forwards(all bool) (list []*Entry) {
 	return
 }
 
+// Hop to a reachable target
+type Hop struct {
+	Target  *PeerID // target node
+	NextHop *PeerID // next hop on route (nil for neighbors)
+}
+
+// NextHops returns a snapshot of the next hops to all reachable targets (as
+// returned by Forward for each target).
+func (tbl *ForwardTable) NextHops() (list []Hop) {
+	tbl.Lock()
+	defer tbl.Unlock()
+	list = make([]Hop, 0, len(tbl.recs))
+	for _, entry := range tbl.recs {
+		if entry.Reachable() {
+			list = append(list, Hop{entry.Peer, entry.NextHop})
+		}
+	}
+	return
+}
+
 // Return a list of active direct neighbors
 func (tbl *ForwardTable) Neighbors() (list []*PeerID) {
 	tbl.Lock()
@@ -916,25 +1511,177 @@ func (tbl *ForwardTable) Neighbors() (list []*PeerID) {
 	return
 }
 
+// NeighborStat holds information about an active neighbor
+type NeighborStat struct {
+	Peer     *PeerID // neighbor
+	LastSeen Age     // time since last message from neighbor
+	Beacons  int     // number of beacons received (while active)
+}
+
+// number of buckets in a processing time histogram
+const procBuckets = 16
+
+// ProcStat holds the processing time of received messages of a type. The
+// histogram counts durations in buckets of powers of two microseconds:
+// bucket i holds durations below 2^i µs (the last bucket holds all
+// longer durations).
+type ProcStat struct {
+	Count   int              // number of messages
+	Total   time.Duration    // accumulated processing time
+	Max     time.Duration    // longest processing time
+	Buckets [procBuckets]int // histogram of processing times
+}
+
+// Mean processing time of a message
+func (s *ProcStat) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// add a processing time sample
+func (s *ProcStat) add(d time.Duration) {
+	s.Count++
+	s.Total += d
+	if d > s.Max {
+		s.Max = d
+	}
+	i := 0
+	for limit := time.Microsecond; i < procBuckets-1 && d >= limit; limit *= 2 {
+		i++
+	}
+	s.Buckets[i]++
+}
+
+// record the processing time of a received message
+func (tbl *ForwardTable) recordProcessing(mt uint16, d time.Duration) {
+	tbl.Lock()
+	defer tbl.Unlock()
+	if tbl.procStats == nil {
+		tbl.procStats = make(map[uint16]*ProcStat)
+	}
+	stat, ok := tbl.procStats[mt]
+	if !ok {
+		stat = new(ProcStat)
+		tbl.procStats[mt] = stat
+	}
+	stat.add(d)
+}
+
+// Knows returns true if the target is in the LEArn filter of the table
+// (the table itself or a reachable, non-dormant target).
+func (tbl *ForwardTable) Knows(target *PeerID) bool {
+	if target.Equal(tbl.self) {
+		return true
+	}
+	tbl.Lock()
+	defer tbl.Unlock()
+	entry, ok := tbl.recs[target.Key()]
+	return ok && entry.inFilter()
+}
+
+// NeighborInfo returns information about active neighbors (sorted by
+// recency: most recently seen neighbors first).
+func (tbl *ForwardTable) NeighborInfo() (list []*NeighborStat) {
+	tbl.Lock()
+	defer tbl.Unlock()
+	for key, entry := range tbl.recs {
+		if entry.IsA(KindNeighbor, StateActive) {
+			list = append(list, &NeighborStat{
+				Peer:     entry.Peer,
+				LastSeen: entry.Origin.Age(),
+				Beacons:  tbl.beacons[key],
+			})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].LastSeen.Val < list[j].LastSeen.Val
+	})
+	return
+}
+
+// count a beacon received from a neighbor
+func (tbl *ForwardTable) beaconReceived(node *PeerID) {
+	tbl.Lock()
+	defer tbl.Unlock()
+	if tbl.beacons == nil {
+		tbl.beacons = make(map[string]int)
+		tbl.lastBeacon = make(map[string]Time)
+	}
+	tbl.beacons[node.Key()]++
+	tbl.lastBeacon[node.Key()] = TimeNow()
+}
+
 //======================================================================
 // Debug helpers
 //======================================================================
 
-// sanity check of forward table in debug mode.
+// Violation of the table consistency found in a sanity check
+type Violation struct {
+	Msg    string // description of the violation
+	Entry  *Entry // bad entry
+	Detail string // details on bad entry (optional)
+}
+
+// String returns a human-readable violation
+func (v *Violation) String() string {
+	return v.Msg
+}
+
+// checkTable runs a sanity check and handles violations: in strict mode
+// the table panics, otherwise violations are logged and reported to the
+// listener. (only call from within a locked table instance!)
+func (tbl *ForwardTable) checkTable(label string, args ...any) {
+	violations := tbl.sanityCheck(label)
+	if len(violations) == 0 {
+		return
+	}
+	log := logger()
+	for _, v := range violations {
+		log.Warn("%s", v.Msg)
+		if len(v.Detail) > 0 {
+			for i, arg := range args {
+				log.Warn("Arg #%d: %v", i+1, arg)
+			}
+			log.Warn("Bad entry: %s", v.Detail)
+		}
+		if !tbl.strict {
+			tbl.notify(&Event{
+				Type: EvSanityViolation,
+				Seq:  tbl.nextSeq(),
+				Peer: tbl.self,
+				Val:  v,
+			})
+		}
+	}
+	if tbl.strict {
+		panic(label)
+	}
+}
+
+// sanityCheck of forward table returns a list of violations.
 // (only call from within a locked table instance!)
-func (tbl *ForwardTable) sanityCheck(label string, args ...any) {
+func (tbl *ForwardTable) sanityCheck(label string) (violations []*Violation) {
+	add := func(entry *Entry, detail, format string, args ...any) {
+		violations = append(violations, &Violation{
+			Msg:    fmt.Sprintf("[%s] "+format, append([]any{label}, args...)...),
+			Entry:  entry.Clone(),
+			Detail: detail,
+		})
+	}
 	// check all forward entries in table
 	for _, entry := range tbl.recs {
 
 		// check for valid target
 		if entry.Peer == nil {
-			log.Printf("[%s] peer %s forward to nil", label, tbl.self)
-			panic(label)
+			add(entry, "", "peer %s forward to nil", tbl.self)
+			continue
 		}
 		// check for self target
 		if entry.Peer.Equal(tbl.self) {
-			log.Printf("[%s] peer %s forward to self", label, tbl.self)
-			panic(label)
+			add(entry, "", "peer %s forward to self", tbl.self)
+			continue
 		}
 		// check entry
 		if entry.Kind() == KindRelay {
@@ -943,21 +1690,14 @@ func (tbl *ForwardTable) sanityCheck(label string, args ...any) {
 			// check for valid neighor as next hop
 			nb, ok := tbl.recs[entry.NextHop.Key()]
 			if !ok {
-				log.Printf("[%s] peer %s has forward %s with unknown next hop", label, tbl.self, entry.Peer)
-				for i, arg := range args {
-					log.Printf("Arg #%d: %v", i+1, arg)
-				}
-				log.Printf("Bad entry: %s", entry)
-				panic(label)
-			}
-			if nb.Kind() != KindNeighbor {
-				log.Printf("[%s] peer %s has forward %s with invalid next hop", label, tbl.self, entry.Peer)
-				for i, arg := range args {
-					log.Printf("Arg #%d: %v", i+1, arg)
-				}
-				log.Printf("Bad entry: %s / %s", entry, nb)
-				panic(label)
+				add(entry, entry.String(), "peer %s has forward %s with unknown next hop", tbl.self, entry.Peer)
+			} else if nb.Kind() != KindNeighbor && entry.State() != StateDormant {
+				// (the next hop of a dormant relay may have become a
+				// relay itself)
+				add(entry, fmt.Sprintf("%s / %s", entry, nb),
+					"peer %s has forward %s with invalid next hop", tbl.self, entry.Peer)
 			}
 		}
 	}
+	return
 }
@@ -0,0 +1,1550 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package core
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bfix/gospel/data"
+)
+
+// create a new random peer id
+func newPeer() *PeerID {
+	return NewPeerPrivate().Public()
+}
+
+// create a running forward table that records all emitted events
+func newTestTable(t *testing.T) (tbl *ForwardTable, events *[]*Event) {
+	t.Helper()
+	tbl = NewForwardTable(newPeer(), true)
+	tbl.Start()
+	list := make([]*Event, 0)
+	events = &list
+	tbl.listener = func(ev *Event) {
+		*events = append(*events, ev)
+	}
+	return
+}
+
+// count events of given type
+func countEvents(events []*Event, evType int) (count int) {
+	for _, ev := range events {
+		if ev.Type == evType {
+			count++
+		}
+	}
+	return
+}
+
+// age in seconds
+func ageSecs(secs float64) Age {
+	return Age{int64(secs * 1e6)}
+}
+
+// create running forward tables for a line of nodes: each table only
+// knows its direct neighbors.
+func newTestLine(t *testing.T, n int) (tbls []*ForwardTable, links map[int][]int) {
+	t.Helper()
+	tbls = make([]*ForwardTable, n)
+	links = make(map[int][]int)
+	for i := range tbls {
+		tbls[i], _ = newTestTable(t)
+	}
+	for i := 1; i < n; i++ {
+		tbls[i-1].AddNeighbor(tbls[i].self)
+		tbls[i].AddNeighbor(tbls[i-1].self)
+		links[i-1] = append(links[i-1], i)
+		links[i] = append(links[i], i-1)
+	}
+	return
+}
+
+// routes of a forward table (target -> hops/next hop/state)
+func routes(tbl *ForwardTable) map[string]string {
+	list := make(map[string]string)
+	for key, entry := range tbl.recs {
+		list[key] = fmt.Sprintf("%d/%s/%d", entry.Hops, entry.NextHop, entry.State())
+	}
+	return list
+}
+
+// LEArn message of a table with a (practically) exact filter: a false
+// positive can't hide a target from the learner.
+func exactLearn(tbl *ForwardTable) *LEArnMsg {
+	tbl.cleanup()
+	tbl.Lock()
+	targets := tbl.filterTargets()
+	tbl.Unlock()
+	filter := data.NewSaltedBloomFilter(RndUInt32(), len(targets), 1e-9)
+	for _, peer := range targets {
+		filter.Add(peer.Bytes())
+	}
+	return NewLearnMsg(tbl.self, filter)
+}
+
+// exchange LEArn/TEAch messages between linked tables in rounds (each
+// table sends a LEArn to its neighbors and learns from their TEAch
+// responses) until no table has pending entries and no route changed in
+// the last round. Returns the number of rounds or -1 if the tables are
+// not stable after 'maxRounds'.
+func exchange(tbls []*ForwardTable, links map[int][]int, maxRounds int) int {
+	for round := 1; round <= maxRounds; round++ {
+		stable := true
+		for i, tbl := range tbls {
+			before := routes(tbl)
+			for _, j := range links[i] {
+				out, _ := tbls[j].Teach(exactLearn(tbl))
+				for _, msg := range out {
+					tbl.Learn(msg)
+				}
+			}
+			if !reflect.DeepEqual(before, routes(tbl)) {
+				stable = false
+			}
+		}
+		for _, tbl := range tbls {
+			if tbl.HasPending() {
+				stable = false
+				break
+			}
+		}
+		if stable {
+			return round
+		}
+	}
+	return -1
+}
+
+func TestLearnRefreshUnchanged(t *testing.T) {
+	tbl, events := newTestTable(t)
+	nb, target := newPeer(), newPeer()
+	tbl.AddNeighbor(nb)
+
+	// learn relay to target via neighbor
+	tbl.Learn(NewTEAchMsg(nb, []*Forward{
+		{Peer: target, Hops: 0, Age: ageSecs(5)},
+	}))
+	entry := tbl.recs[target.Key()]
+	if entry == nil || entry.Hops != 1 || !entry.NextHop.Equal(nb) {
+		t.Fatalf("relay not learned: %s", entry)
+	}
+	origin, changed := entry.Origin, entry.Changed
+	entry.Pending = false // (taught)
+
+	// newer announcement of the same route: only the origin is refreshed
+	*events = (*events)[:0]
+	tbl.Learn(NewTEAchMsg(nb, []*Forward{
+		{Peer: target, Hops: 0, Age: ageSecs(0)},
+	}))
+	if len(*events) != 0 {
+		t.Fatalf("%d events on refresh", len(*events))
+	}
+	if entry.Changed != changed || entry.Pending {
+		t.Fatalf("entry changed by refresh: %s", entry)
+	}
+	if !origin.Before(entry.Origin) {
+		t.Fatal("origin not refreshed")
+	}
+	if entry.Origin.Expired(time.Second) {
+		t.Fatal("refreshed origin too old")
+	}
+}
+
+func TestLearnInvalidForward(t *testing.T) {
+	tbl, _ := newTestTable(t)
+	nb := newPeer()
+	tbl.AddNeighbor(nb)
+
+	// inconsistent announcements are skipped...
+	bad := []*Forward{
+		{Peer: newPeer(), Hops: -3, NextHop: 7, Age: ageSecs(1)},
+		{Peer: newPeer(), Hops: -3, Age: ageSecs(1)},
+		{Peer: newPeer(), Hops: 2, Age: ageSecs(1)},
+	}
+	tbl.Learn(NewTEAchMsg(nb, bad))
+	for _, f := range bad {
+		if _, ok := tbl.recs[f.Peer.Key()]; ok {
+			t.Fatalf("invalid forward %s learned", f)
+		}
+	}
+	// ...so the table can still be taught
+	learner := newPeer()
+	filter := data.NewSaltedBloomFilter(RndUInt32(), 2, 0.01)
+	filter.Add(learner.Bytes())
+	tbl.Teach(NewLearnMsg(learner, filter))
+	tbl.cleanup()
+}
+
+func TestLearnForwardChanged(t *testing.T) {
+	tbl, events := newTestTable(t)
+	nb1, nb2, target, relay := newPeer(), newPeer(), newPeer(), newPeer()
+	tbl.AddNeighbor(nb1)
+	tbl.AddNeighbor(nb2)
+	learn := func(sender *PeerID, hops int16, secs float64) {
+		tbl.Learn(NewTEAchMsg(sender, []*Forward{
+			{Peer: target, Hops: hops, NextHop: relay.Tag(), Age: ageSecs(secs)},
+		}))
+	}
+	learn(nb1, 2, 10) // new relay (3 hops via nb1)
+	learn(nb1, 2, 8)  // refresh of the same route
+	learn(nb2, 2, 6)  // route of same length via nb2
+	learn(nb2, 1, 4)  // shorter route via nb2
+	learn(nb2, 1, 2)  // refresh of the same route
+
+	// only the shorter route changed next hop and hops of the entry
+	if n := countEvents(*events, EvForwardChanged); n != 1 {
+		t.Fatalf("%d forward changes (expected 1)", n)
+	}
+	for _, ev := range *events {
+		if ev.Type != EvForwardChanged {
+			continue
+		}
+		e := ev.Val.([3]*Entry)
+		if e[0].Hops == e[2].Hops && e[0].NextHop.Equal(e[2].NextHop) {
+			t.Fatalf("forward change without new route: %s -> %s", e[0], e[2])
+		}
+	}
+}
+
+func TestLearnRepeatedAnnouncement(t *testing.T) {
+	tbl, _ := newTestTable(t)
+	nb, target := newPeer(), newPeer()
+	tbl.AddNeighbor(nb)
+
+	// learn relay to target via neighbor
+	msg := NewTEAchMsg(nb, []*Forward{
+		{Peer: target, Hops: 0, Age: ageSecs(5)},
+	})
+	tbl.Learn(msg)
+	entry := tbl.recs[target.Key()]
+	if entry == nil || !entry.Pending {
+		t.Fatalf("relay not learned: %s", entry)
+	}
+	changed, origin := entry.Changed, entry.Origin
+
+	// identical announcements are neither newer nor better
+	for i := 0; i < 5; i++ {
+		tbl.Learn(msg)
+		if !entry.Pending {
+			t.Fatalf("pending flag cleared by announcement #%d", i+2)
+		}
+		if entry.Changed != changed || entry.Origin != origin {
+			t.Fatalf("entry updated by announcement #%d", i+2)
+		}
+	}
+}
+
+func TestLearnMultipleNew(t *testing.T) {
+	tbl, events := newTestTable(t)
+	nb := newPeer()
+	tbl.AddNeighbor(nb)
+
+	// all unknown peers in a TEAch are learned
+	peers := []*PeerID{newPeer(), newPeer(), newPeer()}
+	list := make([]*Forward, len(peers))
+	for i, p := range peers {
+		list[i] = &Forward{Peer: p, Hops: int16(i), Age: ageSecs(1)}
+		if i > 0 {
+			list[i].NextHop = RndUInt32()
+		}
+	}
+	tbl.Learn(NewTEAchMsg(nb, list))
+	for i, p := range peers {
+		entry, ok := tbl.recs[p.Key()]
+		if !ok || entry.Hops != int16(i+1) || !entry.NextHop.Equal(nb) {
+			t.Fatalf("peer #%d not learned: %s", i, entry)
+		}
+	}
+	if n := countEvents(*events, EvForwardLearned); n != len(peers) {
+		t.Fatalf("%d forwards learned (expected %d)", n, len(peers))
+	}
+}
+
+func TestRouteHysteresis(t *testing.T) {
+	defer func(n int) { cfg.RouteHysteresis = n }(cfg.RouteHysteresis)
+	cfg.RouteHysteresis = 5
+
+	tbl, events := newTestTable(t)
+	nb1, nb2, target := newPeer(), newPeer(), newPeer()
+	tbl.AddNeighbor(nb1)
+	tbl.AddNeighbor(nb2)
+	announce := func(nb *PeerID, age float64) {
+		tbl.Learn(NewTEAchMsg(nb, []*Forward{
+			{Peer: target, Hops: 0, Age: ageSecs(age)},
+		}))
+	}
+	// learn relay via first neighbor; both neighbors announce
+	// (slightly) newer equal-cost routes in turn.
+	announce(nb1, 30)
+	entry := tbl.recs[target.Key()]
+	*events = (*events)[:0]
+	for age := 29.; age > 18; age -= 2 {
+		announce(nb2, age)
+		announce(nb1, age-1)
+		if !entry.NextHop.Equal(nb1) {
+			t.Fatalf("route switched at age %.0f", age)
+		}
+	}
+	if n := countEvents(*events, EvForwardChanged); n != 0 {
+		t.Fatalf("%d forward changes (expected 0)", n)
+	}
+	// first neighbor stops refreshing: switch to the (much newer)
+	// route of the second neighbor and stay there.
+	announce(nb2, 10)
+	if !entry.NextHop.Equal(nb2) {
+		t.Fatal("route not switched to newer route")
+	}
+	announce(nb1, 9)
+	if !entry.NextHop.Equal(nb2) {
+		t.Fatal("route switched back")
+	}
+	if n := countEvents(*events, EvRelayUpdated); n != 1 {
+		t.Fatalf("%d route switches (expected 1)", n)
+	}
+}
+
+func TestNeighborInfo(t *testing.T) {
+	tbl, _ := newTestTable(t)
+	stale, fresh := newPeer(), newPeer()
+	tbl.AddNeighbor(stale)
+	tbl.AddNeighbor(fresh)
+	tbl.recs[stale.Key()].Origin = TimeFromAge(ageSecs(3))
+	for i := 0; i < 3; i++ {
+		tbl.beaconReceived(fresh)
+	}
+	list := tbl.NeighborInfo()
+	if len(list) != 2 {
+		t.Fatalf("%d neighbors (expected 2)", len(list))
+	}
+	if !list[0].Peer.Equal(fresh) || !list[1].Peer.Equal(stale) {
+		t.Fatal("neighbors not sorted by recency")
+	}
+	if list[0].LastSeen.Seconds() >= list[1].LastSeen.Seconds() {
+		t.Fatalf("fresh neighbor is older: %s >= %s", list[0].LastSeen, list[1].LastSeen)
+	}
+	if list[0].Beacons != 3 || list[1].Beacons != 0 {
+		t.Fatalf("beacon counts %d/%d (expected 3/0)", list[0].Beacons, list[1].Beacons)
+	}
+}
+
+func TestCandidatesMaxTeachs(t *testing.T) {
+	defer func(n int) { cfg.MaxTeachs = n }(cfg.MaxTeachs)
+	cfg.MaxTeachs = 10
+
+	tbl, _ := newTestTable(t)
+	for i := 0; i < 50; i++ {
+		tbl.AddNeighbor(newPeer())
+	}
+	// learner with an empty filter: all entries are unfiltered
+	learner := newPeer()
+	filter := data.NewSaltedBloomFilter(RndUInt32(), 2, 0.01)
+	filter.Add(learner.Bytes())
+	out, counts := tbl.Teach(NewLearnMsg(learner, filter))
+	if len(out) != 5 {
+		t.Fatalf("%d TEAch messages (expected 5)", len(out))
+	}
+	for _, msg := range out {
+		if len(msg.Announce) != cfg.MaxTeachs {
+			t.Fatalf("TEAch not capped: %v", msg)
+		}
+	}
+	if sum := counts[0] + counts[1] + counts[2]; sum != 50 {
+		t.Fatalf("counted %d taught entries", sum)
+	}
+	// no entries are pending
+	for _, e := range tbl.recs {
+		if e.Pending {
+			t.Fatalf("pending entry: %s", e)
+		}
+	}
+}
+
+func TestTeachBatching(t *testing.T) {
+	defer func(n int) { cfg.MaxTeachs = n }(cfg.MaxTeachs)
+	cfg.MaxTeachs = 10
+
+	tbl, _ := newTestTable(t)
+	nb := newPeer()
+	tbl.AddNeighbor(nb)
+	for i := 0; i < 23; i++ {
+		tbl.AddNeighbor(newPeer())
+	}
+	// teach a two-hop entry via the first neighbor
+	tbl.Learn(NewTEAchMsg(nb, []*Forward{
+		{Peer: newPeer(), Hops: 0, Age: ageSecs(1)},
+	}))
+	learner := newPeer()
+	filter := data.NewSaltedBloomFilter(RndUInt32(), 2, 0.01)
+	filter.Add(learner.Bytes())
+	out, _ := tbl.Teach(NewLearnMsg(learner, filter))
+	if len(out) != 3 {
+		t.Fatalf("%d TEAch messages (expected 3)", len(out))
+	}
+	// priority ordering is preserved across messages
+	hops, total := int16(0), 0
+	for _, msg := range out {
+		for _, ann := range msg.Announce {
+			if ann.Hops < hops {
+				t.Fatalf("announcement out of order: %v", ann)
+			}
+			hops = ann.Hops
+			total++
+		}
+	}
+	if total != 25 || len(out[2].Announce) != 5 {
+		t.Fatalf("taught %d entries (last message: %d)", total, len(out[2].Announce))
+	}
+}
+
+func TestCandidatePolicy(t *testing.T) {
+	tbl, _ := newTestTable(t)
+	nb := newPeer()
+	tbl.AddNeighbor(nb)
+	for i := 0; i < 5; i++ {
+		f := &Forward{Peer: newPeer(), Hops: int16(i), Age: ageSecs(1)}
+		if i > 0 {
+			f.NextHop = RndUInt32()
+		}
+		tbl.Learn(NewTEAchMsg(nb, []*Forward{f}))
+	}
+	learner := newPeer()
+	teach := func() (list []*Forward) {
+		filter := data.NewSaltedBloomFilter(RndUInt32(), 2, 0.01)
+		filter.Add(learner.Bytes())
+		out, _ := tbl.Teach(NewLearnMsg(learner, filter))
+		for _, msg := range out {
+			list = append(list, msg.Announce...)
+		}
+		return
+	}
+	// teach all entries (no pending entries left); then learn a new
+	// (pending) relay with two hops.
+	teach()
+	tbl.Learn(NewTEAchMsg(nb, []*Forward{
+		{Peer: newPeer(), Hops: 1, NextHop: RndUInt32(), Age: ageSecs(1)},
+	}))
+	// default policy: pending entry comes last
+	list := teach()
+	if n := len(list); n != 7 || list[n-1].Hops != 2 || list[n-2].Hops != 5 {
+		t.Fatalf("unexpected default order: %v", list)
+	}
+	// lowest hops first (with a new pending relay)
+	tbl.SetCandidatePolicy(func(e *Entry, filtered, pending bool) int {
+		return int(e.Hops)
+	})
+	tbl.Learn(NewTEAchMsg(nb, []*Forward{
+		{Peer: newPeer(), Hops: 1, NextHop: RndUInt32(), Age: ageSecs(1)},
+	}))
+	list = teach()
+	if len(list) != 8 {
+		t.Fatalf("%d entries taught (expected 8)", len(list))
+	}
+	for i := 1; i < len(list); i++ {
+		if list[i].Hops < list[i-1].Hops {
+			t.Fatalf("unexpected order: %v", list)
+		}
+	}
+}
+
+func TestLearnRemovalOfActiveEntries(t *testing.T) {
+	tbl, events := newTestTable(t)
+	nb1, nb2, target := newPeer(), newPeer(), newPeer()
+	tbl.AddNeighbor(nb1)
+	tbl.AddNeighbor(nb2)
+	tbl.Learn(NewTEAchMsg(nb1, []*Forward{
+		{Peer: target, Hops: 0, Age: ageSecs(5)},
+	}))
+	// make entries older than the removal announcements
+	for _, e := range tbl.recs {
+		e.Origin = TimeFromAge(ageSecs(10))
+	}
+	*events = (*events)[:0]
+
+	// nb2 announces removal of neighbor nb1 and of relay target
+	tbl.Learn(NewTEAchMsg(nb2, []*Forward{
+		{Peer: nb1, Hops: -2, Age: ageSecs(0)},
+		{Peer: target, Hops: -1, NextHop: nb1.Tag(), Age: ageSecs(0)},
+	}))
+	if e := tbl.recs[nb1.Key()]; !e.IsA(KindNeighbor, StateActive) {
+		t.Fatalf("neighbor changed: %s", e)
+	} else if !e.Pending {
+		t.Fatal("neighbor not pending after removal announce")
+	}
+	if e := tbl.recs[target.Key()]; !e.IsA(KindRelay, StateActive) || !e.NextHop.Equal(nb1) {
+		t.Fatalf("relay changed: %s", e)
+	}
+	if n := countEvents(*events, EvRelayRemoved); n != 0 {
+		t.Fatalf("%d relays removed", n)
+	}
+	// removal of relay by its next hop
+	tbl.Learn(NewTEAchMsg(nb1, []*Forward{
+		{Peer: target, Hops: -2, Age: ageSecs(0)},
+	}))
+	if e := tbl.recs[target.Key()]; !e.IsA(KindRelay, StateRemoved) {
+		t.Fatalf("relay not removed: %s", e)
+	}
+	if n := countEvents(*events, EvRelayRemoved); n != 1 {
+		t.Fatalf("%d relays removed", n)
+	}
+}
+
+func TestCleanupOutdatedRelay(t *testing.T) {
+	defer func(n int) { cfg.Outdated = n }(cfg.Outdated)
+	cfg.Outdated = 60
+
+	tbl, events := newTestTable(t)
+	nb, stale, fresh := newPeer(), newPeer(), newPeer()
+	tbl.AddNeighbor(nb)
+	tbl.Learn(NewTEAchMsg(nb, []*Forward{
+		{Peer: stale, Hops: 0, Age: ageSecs(50)},
+		{Peer: fresh, Hops: 0, Age: ageSecs(50)},
+	}))
+	// let both relays age without a refresh by the next hop
+	older := func(secs float64) {
+		for key, ts := range tbl.refreshed {
+			tbl.refreshed[key] = Time{ts.Val - int64(secs*1e6)}
+		}
+	}
+	older(40)
+
+	// relays due for refresh are left out of the LEArn filter
+	inFilter := func(peer *PeerID) bool {
+		tbl.Lock()
+		defer tbl.Unlock()
+		for _, p := range tbl.filterTargets() {
+			if p.Equal(peer) {
+				return true
+			}
+		}
+		return false
+	}
+	tbl.NewLearn()
+	if inFilter(stale) || inFilter(fresh) || !inFilter(nb) {
+		t.Fatal("relays due for refresh in filter")
+	}
+	// the next hop teaches a newer announcement of one relay: the relay
+	// is refreshed (but not re-taught to our neighbors)
+	tbl.recs[fresh.Key()].Pending = false
+	tbl.Learn(NewTEAchMsg(nb, []*Forward{
+		{Peer: fresh, Hops: 0, Age: ageSecs(1)},
+	}))
+	if e := tbl.recs[fresh.Key()]; e.Pending || tbl.refreshed[fresh.Key()].Expired(time.Second) {
+		t.Fatalf("relay not refreshed: %s", e)
+	}
+	if tbl.pf != nil || !inFilter(fresh) {
+		t.Fatal("refreshed relay not in filter")
+	}
+	// only the relay not refreshed is outdated
+	older(30)
+	*events = (*events)[:0]
+	tbl.cleanup()
+
+	if e := tbl.recs[stale.Key()]; !e.IsA(KindRelay, StateRemoved) || !e.Pending {
+		t.Fatalf("stale relay not removed: %s", e)
+	}
+	if e := tbl.recs[fresh.Key()]; !e.IsA(KindRelay, StateActive) {
+		t.Fatalf("refreshed relay removed: %s", e)
+	}
+	if e := tbl.recs[nb.Key()]; !e.IsA(KindNeighbor, StateActive) {
+		t.Fatalf("neighbor removed: %s", e)
+	}
+	if n := countEvents(*events, EvRelayRemoved); n != 1 {
+		t.Fatalf("%d relays removed", n)
+	}
+	// removed relays are not expired again
+	tbl.cleanup()
+	if n := countEvents(*events, EvRelayRemoved); n != 1 {
+		t.Fatalf("%d relays removed", n)
+	}
+}
+
+func TestRelayRefreshLine(t *testing.T) {
+	defer func(n int) { cfg.Outdated = n }(cfg.Outdated)
+	cfg.Outdated = 60
+
+	// line of tables learning routes in rounds of LEArn/TEAch exchanges
+	tbls, links := newTestLine(t, 6)
+	target := tbls[0].self
+	removed := 0
+	for _, tbl := range tbls {
+		tbl.listener = func(ev *Event) {
+			if ev.Type == EvRelayRemoved {
+				removed++
+			}
+		}
+	}
+	// each round ages all relays by a LEArn interval; the tables learn
+	// and refresh routes with their LEArn filters.
+	rounds := func(n int) {
+		for round := 0; round < n; round++ {
+			for _, tbl := range tbls {
+				for key, ts := range tbl.refreshed {
+					tbl.refreshed[key] = Time{ts.Val - 10e6}
+				}
+				for _, e := range tbl.recs {
+					if e.Kind() == KindRelay {
+						e.Origin = Time{e.Origin.Val - 10e6}
+					}
+				}
+			}
+			for i, tbl := range tbls {
+				for _, j := range links[i] {
+					out, _ := tbls[j].Teach(exactLearn(tbl))
+					for _, msg := range out {
+						tbl.Learn(msg)
+					}
+				}
+			}
+		}
+	}
+	// routes are refreshed (for more than twice the time relays are
+	// outdated)
+	rounds(15)
+	if removed != 0 {
+		t.Fatalf("%d refreshed relays removed", removed)
+	}
+	// refreshes are not re-taught: the converged tables are quiet
+	for i, tbl := range tbls {
+		if tbl.HasPending() {
+			t.Fatalf("table %d has pending entries", i)
+		}
+	}
+	for _, tbl := range tbls[2:] {
+		if e := tbl.recs[target.Key()]; e == nil || !e.IsA(KindRelay, StateActive) {
+			t.Fatalf("no route to target: %s", e)
+		}
+	}
+	// the first node leaves and the removal of its neighbor entry is lost:
+	// the dead route is not refreshed and expires along the line.
+	links[0], links[1] = nil, links[1][1:]
+	tbls[1].recs[target.Key()].SetState(StateDormant)
+	rounds(8)
+	for _, tbl := range tbls[2:] {
+		if e := tbl.recs[target.Key()]; e.State() == StateActive {
+			t.Fatalf("dead route not removed: %s", e)
+		}
+	}
+}
+
+func TestRefreshedRemoved(t *testing.T) {
+	defer func(n int) { cfg.Outdated = n }(cfg.Outdated)
+	cfg.Outdated = 60
+
+	tbl, _ := newTestTable(t)
+	nb1, nb2 := newPeer(), newPeer()
+	tbl.AddNeighbor(nb1)
+	tbl.AddNeighbor(nb2)
+	x, y, z := newPeer(), newPeer(), newPeer()
+	tbl.Learn(NewTEAchMsg(nb1, []*Forward{
+		{Peer: x, Hops: 0, Age: ageSecs(1)},
+		{Peer: y, Hops: 0, Age: ageSecs(1)},
+	}))
+	tbl.Learn(NewTEAchMsg(nb2, []*Forward{
+		{Peer: z, Hops: 0, Age: ageSecs(1)},
+	}))
+	if n := len(tbl.refreshed); n != 3 {
+		t.Fatalf("%d relays refreshed", n)
+	}
+	// the refresh time is dropped when a relay is removed (by its next
+	// hop or with its next hop) or becomes a neighbor
+	tbl.Learn(NewTEAchMsg(nb1, []*Forward{
+		{Peer: x, Hops: -1, NextHop: RndUInt32(), Age: ageSecs(0)},
+	}))
+	tbl.AddNeighbor(y)
+	tbl.removeNeighbor(tbl.recs[nb2.Key()])
+	if n := len(tbl.refreshed); n != 0 {
+		t.Fatalf("%d refresh times kept", n)
+	}
+}
+
+func TestLearnEqualCostAlternatives(t *testing.T) {
+	tbl, _ := newTestTable(t)
+	nb1, nb2, target := newPeer(), newPeer(), newPeer()
+	tbl.AddNeighbor(nb1)
+	tbl.AddNeighbor(nb2)
+
+	// two routes of equal length to target
+	tbl.Learn(NewTEAchMsg(nb1, []*Forward{
+		{Peer: target, Hops: 0, Age: ageSecs(1)},
+	}))
+	tbl.Learn(NewTEAchMsg(nb2, []*Forward{
+		{Peer: target, Hops: 0, Age: ageSecs(1)},
+	}))
+	list, hops := tbl.ForwardMulti(target)
+	if hops != 2 || len(list) != 2 {
+		t.Fatalf("got %d next hops (%d hops)", len(list), hops)
+	}
+	if !list[0].Equal(nb1) || !list[1].Equal(nb2) {
+		t.Fatalf("wrong next hops: %v", list)
+	}
+	if next, _ := tbl.Forward(target); !next.Equal(nb1) {
+		t.Fatalf("wrong next hop %s", next)
+	}
+	// a longer route is no alternative
+	nb3 := newPeer()
+	tbl.AddNeighbor(nb3)
+	tbl.Learn(NewTEAchMsg(nb3, []*Forward{
+		{Peer: target, Hops: 1, NextHop: nb1.Tag(), Age: ageSecs(1)},
+	}))
+	if list, _ = tbl.ForwardMulti(target); len(list) != 2 {
+		t.Fatalf("got %d next hops", len(list))
+	}
+	// alternative removed if its route is removed
+	tbl.Learn(NewTEAchMsg(nb2, []*Forward{
+		{Peer: target, Hops: -2, Age: ageSecs(0)},
+	}))
+	if list, _ = tbl.ForwardMulti(target); len(list) != 1 {
+		t.Fatalf("got %d next hops", len(list))
+	}
+}
+
+func TestForwardDeterministic(t *testing.T) {
+	nbs := make([]*PeerID, 6)
+	for i := range nbs {
+		nbs[i] = newPeer()
+	}
+	target := newPeer()
+	// learn equal-length routes in different orders
+	for _, perm := range [][]int{{0, 1, 2, 3, 4, 5}, {5, 4, 3, 2, 1, 0}, {0, 3, 5, 1, 4, 2}} {
+		tbl, _ := newTestTable(t)
+		for _, i := range perm {
+			tbl.AddNeighbor(nbs[i])
+		}
+		for _, i := range perm {
+			tbl.Learn(NewTEAchMsg(nbs[i], []*Forward{
+				{Peer: target, Hops: 0, Age: ageSecs(1)},
+			}))
+		}
+		// repeated calls return the identical (primary) next hop
+		next, _ := tbl.Forward(target)
+		for i := 0; i < 10; i++ {
+			if n, _ := tbl.Forward(target); n != next {
+				t.Fatalf("next hop changed: %s -> %s", next, n)
+			}
+		}
+		if !next.Equal(nbs[perm[0]]) {
+			t.Fatalf("next hop %s is not the primary route", next)
+		}
+		// alternatives are the smallest peer ids in ascending order
+		list, _ := tbl.ForwardMulti(target)
+		alt := list[1:]
+		if len(alt) != maxAltNext {
+			t.Fatalf("%d alternatives", len(alt))
+		}
+		var rest []*PeerID
+		for _, nb := range nbs {
+			if !nb.Equal(next) {
+				rest = append(rest, nb)
+			}
+		}
+		sort.Slice(rest, func(i, j int) bool { return rest[i].Less(rest[j]) })
+		for i := range alt {
+			if !alt[i].Equal(rest[i]) {
+				t.Fatalf("alternative %d: %s (expected %s)", i, alt[i], rest[i])
+			}
+		}
+	}
+}
+
+func TestPurgeDormant(t *testing.T) {
+	defer func(n int) { cfg.DormantTTL = n }(cfg.DormantTTL)
+	cfg.DormantTTL = 60
+
+	tbl, _ := newTestTable(t)
+	nb := newPeer()
+	tbl.AddNeighbor(nb)
+
+	// many long-dormant relays
+	peers := make([]*PeerID, 200)
+	old := TimeFromAge(ageSecs(120))
+	tbl.refreshed = make(map[string]Time)
+	tbl.repeats = make(map[string]int)
+	tbl.beacons = make(map[string]int)
+	tbl.lastBeacon = make(map[string]Time)
+	for i := range peers {
+		peers[i] = newPeer()
+		tbl.recs[peers[i].Key()] = &Entry{
+			Peer:    peers[i],
+			Hops:    -3,
+			NextHop: nb,
+			Origin:  old,
+			Changed: old,
+		}
+		// (state kept for the peer while it was a neighbor or removed)
+		tbl.refreshed[peers[i].Key()] = old
+		tbl.repeats[peers[i].Key()] = 1
+		tbl.beacons[peers[i].Key()] = 3
+		tbl.lastBeacon[peers[i].Key()] = old
+	}
+	// a recently dormant relay
+	recent := newPeer()
+	tbl.recs[recent.Key()] = &Entry{
+		Peer:    recent,
+		Hops:    -3,
+		NextHop: nb,
+		Origin:  old,
+		Changed: TimeNow(),
+	}
+	tbl.cleanup()
+	if n := len(tbl.recs); n != 2 {
+		t.Fatalf("%d entries after purge (expected 2)", n)
+	}
+	if _, ok := tbl.recs[recent.Key()]; !ok {
+		t.Fatal("recent dormant entry purged")
+	}
+	if n := len(tbl.refreshed); n != 0 {
+		t.Fatalf("%d refresh times of purged entries kept", n)
+	}
+	if len(tbl.repeats) != 0 || len(tbl.beacons) != 0 || len(tbl.lastBeacon) != 0 {
+		t.Fatalf("state of purged entries kept: %d repeats, %d beacon counts, %d beacon times",
+			len(tbl.repeats), len(tbl.beacons), len(tbl.lastBeacon))
+	}
+	// purged entries are learned again
+	tbl.Learn(NewTEAchMsg(nb, []*Forward{
+		{Peer: peers[0], Hops: 0, Age: ageSecs(1)},
+	}))
+	if e := tbl.recs[peers[0].Key()]; e == nil || !e.IsA(KindRelay, StateActive) {
+		t.Fatalf("purged entry not learned: %s", e)
+	}
+}
+
+func TestLearnLoopDetect(t *testing.T) {
+	tbl, events := newTestTable(t)
+	nb, target := newPeer(), newPeer()
+	tbl.AddNeighbor(nb)
+
+	// learn relay to target via neighbor (3 hops)
+	tbl.Learn(NewTEAchMsg(nb, []*Forward{
+		{Peer: target, Hops: 2, NextHop: RndUInt32(), Age: ageSecs(5)},
+	}))
+	entry := tbl.recs[target.Key()]
+	if entry == nil || entry.Hops != 3 {
+		t.Fatalf("relay not learned: %s", entry)
+	}
+	// neighbor announces a shorter route to target via us
+	*events = (*events)[:0]
+	tbl.Learn(NewTEAchMsg(nb, []*Forward{
+		{Peer: target, Hops: 1, NextHop: tbl.self.Tag(), Age: ageSecs(1)},
+	}))
+	if n := countEvents(*events, EvLoopDetect); n != 1 {
+		t.Fatalf("%d loop detections (expected 1)", n)
+	}
+	ev := (*events)[0]
+	val := GetVal[[]any](ev)
+	if !ev.Ref.Equal(nb) || len(val) != 2 || val[0] != entry {
+		t.Fatalf("invalid loop event: %v", ev)
+	}
+	// the update is skipped
+	if entry.Hops != 3 || !entry.NextHop.Equal(nb) {
+		t.Fatalf("looping entry updated: %s", entry)
+	}
+}
+
+func TestHopLimit(t *testing.T) {
+	defer func(n int) { cfg.MaxHops = n }(cfg.MaxHops)
+	cfg.MaxHops = 5
+
+	tbl, events := newTestTable(t)
+	nb := newPeer()
+	tbl.AddNeighbor(nb)
+
+	// announcements of targets with increasing distance
+	targets := make([]*PeerID, 8)
+	for i := range targets {
+		targets[i] = newPeer()
+		tbl.Learn(NewTEAchMsg(nb, []*Forward{
+			{Peer: targets[i], Hops: int16(i + 1), NextHop: RndUInt32(), Age: ageSecs(1)},
+		}))
+		next, hops := tbl.Forward(targets[i])
+		if reachable := i+2 <= cfg.MaxHops; reachable != (next != nil) {
+			t.Fatalf("target at %d hops: next=%s (%d hops)", i+2, next, hops)
+		}
+	}
+	if n := countEvents(*events, EvHopLimitExceeded); n != 4 {
+		t.Fatalf("%d hop limit events (expected 4)", n)
+	}
+	// a dormant relay revived with a longer route
+	entry := tbl.recs[targets[0].Key()]
+	entry.Hops = -3
+	*events = (*events)[:0]
+	tbl.Learn(NewTEAchMsg(nb, []*Forward{
+		{Peer: targets[0], Hops: 9, NextHop: RndUInt32(), Age: ageSecs(0)},
+	}))
+	if n := countEvents(*events, EvHopLimitExceeded); n != 1 {
+		t.Fatalf("%d hop limit events (expected 1)", n)
+	}
+	if next, _ := tbl.Forward(targets[0]); next != nil {
+		t.Fatal("unreachable target forwarded")
+	}
+	if list, _ := tbl.ForwardMulti(targets[0]); list != nil {
+		t.Fatal("unreachable target forwarded")
+	}
+}
+
+func TestSplitHorizon(t *testing.T) {
+	tbl, _ := newTestTable(t)
+	nb1, nb2, target := newPeer(), newPeer(), newPeer()
+	tbl.AddNeighbor(nb1)
+	tbl.Learn(NewTEAchMsg(nb1, []*Forward{
+		{Peer: target, Hops: 0, Age: ageSecs(1)},
+	}))
+	// the relay (pending) is not taught back to its next hop...
+	teaches := func(learner *PeerID) bool {
+		filter := data.NewSaltedBloomFilter(RndUInt32(), 2, 0.01)
+		filter.Add(learner.Bytes())
+		out, _ := tbl.Teach(NewLearnMsg(learner, filter))
+		for _, msg := range out {
+			for _, f := range msg.Announce {
+				if f.Peer.Equal(target) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if teaches(nb1) {
+		t.Fatal("relay taught back to next hop")
+	}
+	// ...and stays pending, even if the next hop is the only neighbor
+	if !tbl.recs[target.Key()].Pending {
+		t.Fatal("relay not pending after split horizon")
+	}
+	// (but has no one to be taught to)
+	if tbl.HasPending() {
+		t.Fatal("withheld relay counted as pending")
+	}
+	// ...so it is taught to neighbors showing up later
+	tbl.AddNeighbor(nb2)
+	if !teaches(nb2) {
+		t.Fatal("relay not taught to other neighbor")
+	}
+}
+
+func TestSplitHorizonLine(t *testing.T) {
+	defer func() { splitHorizon = true }()
+
+	// count announcements on a line of nodes (each node only knows
+	// its direct neighbors) until the tables are stable.
+	run := func() (sent int) {
+		tbls := make([]*ForwardTable, 10)
+		for i := range tbls {
+			tbls[i], _ = newTestTable(t)
+		}
+		for i := 1; i < len(tbls); i++ {
+			tbls[i-1].AddNeighbor(tbls[i].self)
+			tbls[i].AddNeighbor(tbls[i-1].self)
+		}
+		for round := 0; round < 2*len(tbls); round++ {
+			for i, tbl := range tbls {
+				for _, j := range []int{i - 1, i + 1} {
+					if j < 0 || j >= len(tbls) {
+						continue
+					}
+					out, _ := tbls[j].Teach(tbl.NewLearn())
+					for _, msg := range out {
+						for _, f := range msg.Announce {
+							if splitHorizon && f.NextHop == tbl.self.Tag() && f.Hops > 0 {
+								t.Fatalf("%d -> %d: relay taught back to next hop", j, i)
+							}
+						}
+						sent += len(msg.Announce)
+						tbl.Learn(msg)
+					}
+				}
+			}
+		}
+		// all tables are complete
+		for i, tbl := range tbls {
+			if n := tbl.NumForwards(); n != len(tbls)-1 {
+				t.Fatalf("table %d has %d forwards", i, n)
+			}
+		}
+		return
+	}
+	with := run()
+	splitHorizon = false
+	without := run()
+	if with >= without {
+		t.Fatalf("no reduction: %d announcements (%d without split horizon)", with, without)
+	}
+	t.Logf("split horizon: %d announcements (%d without, -%.1f%%)",
+		with, without, 100*float64(without-with)/float64(without))
+}
+
+func TestHopLimitLine(t *testing.T) {
+	defer func(n int) { cfg.MaxHops = n }(cfg.MaxHops)
+	cfg.MaxHops = 3
+
+	// line of nodes: run LEArn/TEAch exchanges until the tables are stable
+	tbls, links := newTestLine(t, 10)
+	if rounds := exchange(tbls, links, 2*len(tbls)); rounds < 0 {
+		t.Fatal("tables not stable")
+	}
+	// no entry exceeds the hop limit; targets within reach are known
+	for i, tbl := range tbls {
+		for j, other := range tbls {
+			if i == j {
+				continue
+			}
+			entry, ok := tbl.recs[other.self.Key()]
+			dist := i - j
+			if dist < 0 {
+				dist = -dist
+			}
+			if ok && int(entry.Hops) > cfg.MaxHops {
+				t.Fatalf("%d -> %d: %d hops", i, j, entry.Hops)
+			}
+			if within := dist-1 <= cfg.MaxHops; within != ok {
+				t.Fatalf("%d -> %d: known=%v", i, j, ok)
+			}
+		}
+	}
+}
+
+// logger recording messages per level
+type testLogger struct {
+	sync.Mutex
+	msgs map[string][]string
+}
+
+func (l *testLogger) Debug(format string, args ...any) { l.add("debug", format, args...) }
+func (l *testLogger) Info(format string, args ...any)  { l.add("info", format, args...) }
+func (l *testLogger) Warn(format string, args ...any)  { l.add("warn", format, args...) }
+
+func (l *testLogger) add(level, format string, args ...any) {
+	l.Lock()
+	defer l.Unlock()
+	l.msgs[level] = append(l.msgs[level], fmt.Sprintf(format, args...))
+}
+
+// number of recorded messages of given level
+func (l *testLogger) count(level string) int {
+	l.Lock()
+	defer l.Unlock()
+	return len(l.msgs[level])
+}
+
+func TestSanityCheckLogging(t *testing.T) {
+	log := &testLogger{msgs: make(map[string][]string)}
+	SetLogger(log)
+	defer SetLogger(&StdLogger{Level: LogInfo})
+
+	// relay with unknown next hop
+	tbl, _ := newTestTable(t)
+	target := newPeer()
+	tbl.recs[target.Key()] = &Entry{
+		Peer:    target,
+		Hops:    1,
+		NextHop: newPeer(),
+		Origin:  TimeNow(),
+		Changed: TimeNow(),
+	}
+	func() {
+		defer func() {
+			if r := recover(); r != "test" {
+				t.Fatalf("unexpected panic: %v", r)
+			}
+		}()
+		tbl.checkTable("test", 42)
+	}()
+	warn := log.msgs["warn"]
+	if len(warn) != 3 || len(log.msgs["debug"])+len(log.msgs["info"]) != 0 {
+		t.Fatalf("unexpected log messages: %v", log.msgs)
+	}
+	expect := fmt.Sprintf("[test] peer %s has forward %s with unknown next hop", tbl.self, target)
+	if warn[0] != expect || warn[1] != "Arg #1: 42" {
+		t.Fatalf("unexpected log messages: %v", warn)
+	}
+}
+
+func TestSanityViolation(t *testing.T) {
+	SetLogger(nil)
+	defer SetLogger(&StdLogger{Level: LogInfo})
+
+	// non-strict table with a dangling relay
+	tbl, events := newTestTable(t)
+	tbl.SetStrict(false)
+	nb := newPeer()
+	tbl.AddNeighbor(nb)
+	target := newPeer()
+	tbl.Learn(NewTEAchMsg(nb, []*Forward{
+		{Peer: target, Hops: 1, NextHop: RndUInt32(), Age: ageSecs(1)},
+	}))
+	delete(tbl.recs, nb.Key())
+
+	// next operation reports the violation
+	tbl.AddNeighbor(newPeer())
+	if n := countEvents(*events, EvSanityViolation); n != 1 {
+		t.Fatalf("%d violations reported (expected 1)", n)
+	}
+	v := GetVal[*Violation]((*events)[len(*events)-1])
+	if v == nil || !v.Entry.Peer.Equal(target) {
+		t.Fatalf("unexpected violation: %v", v)
+	}
+	if list := tbl.sanityCheck("test"); len(list) != 1 {
+		t.Fatalf("%d violations found", len(list))
+	}
+}
+
+func TestLearnNextHopSelf(t *testing.T) {
+	log := &testLogger{msgs: make(map[string][]string)}
+	SetLogger(log)
+	defer SetLogger(&StdLogger{Level: LogInfo})
+
+	tbl, _ := newTestTable(t)
+	nb1, nb2 := newPeer(), newPeer()
+	tbl.AddNeighbor(nb1)
+	tbl.AddNeighbor(nb2)
+
+	// new target announced with ourself as next hop
+	target := newPeer()
+	tbl.Learn(NewTEAchMsg(nb1, []*Forward{
+		{Peer: target, Hops: 1, NextHop: tbl.self.Tag(), Age: ageSecs(1)},
+	}))
+	if _, ok := tbl.recs[target.Key()]; ok {
+		t.Fatal("self-referential forward stored")
+	}
+	// shorter route to known target via ourself
+	tbl.Learn(NewTEAchMsg(nb1, []*Forward{
+		{Peer: target, Hops: 3, NextHop: RndUInt32(), Age: ageSecs(1)},
+	}))
+	tbl.Learn(NewTEAchMsg(nb2, []*Forward{
+		{Peer: target, Hops: 1, NextHop: tbl.self.Tag(), Age: ageSecs(0)},
+	}))
+	if e := tbl.recs[target.Key()]; !e.NextHop.Equal(nb1) || e.Hops != 4 {
+		t.Fatalf("self-referential forward learned: %s", e)
+	}
+	if n := len(log.msgs["warn"]); n != 2 {
+		t.Fatalf("%d warnings (expected 2)", n)
+	}
+}
+
+func TestDebugSwitch(t *testing.T) {
+	if tbl := NewForwardTable(newPeer(), false); tbl.check != nil {
+		t.Fatal("sanity check enabled")
+	}
+	// invalid forward (neighbor with next hop)
+	f := &Forward{Peer: newPeer(), Hops: 0, NextHop: 1}
+	if f.Kind() != KindUnknown {
+		t.Fatal("invalid forward has known kind")
+	}
+	SetDebug(true)
+	defer SetDebug(false)
+	defer func() {
+		if recover() == nil {
+			t.Fatal("no panic in debug mode")
+		}
+	}()
+	f.Kind()
+}
+
+// Learn with and without sanity checks of the table
+func BenchmarkLearn(b *testing.B) {
+	for _, debug := range []bool{false, true} {
+		b.Run(fmt.Sprintf("debug=%v", debug), func(b *testing.B) {
+			tbl := NewForwardTable(newPeer(), debug)
+			tbl.Start()
+			nbs := make([]*PeerID, 50)
+			for i := range nbs {
+				nbs[i] = newPeer()
+				tbl.AddNeighbor(nbs[i])
+			}
+			// announcements of 200 relays
+			fws := make([]*Forward, 200)
+			for i := range fws {
+				fws[i] = &Forward{Peer: newPeer(), Hops: int16(1 + i%5), NextHop: RndUInt32()}
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				tbl.Learn(NewTEAchMsg(nbs[i%len(nbs)], fws))
+			}
+		})
+	}
+}
+
+func TestNextHops(t *testing.T) {
+	defer func(n int) { cfg.MaxHops = n }(cfg.MaxHops)
+	cfg.MaxHops = 3
+
+	// neighbor, relay, removed relay and relay beyond the hop limit
+	tbl, _ := newTestTable(t)
+	nb := newPeer()
+	tbl.AddNeighbor(nb)
+	targets := make([]*PeerID, 3)
+	for i, hops := range []int16{2, -1, 4} {
+		targets[i] = newPeer()
+		tbl.recs[targets[i].Key()] = &Entry{Peer: targets[i], NextHop: nb, Hops: hops}
+	}
+	list := tbl.NextHops()
+	if len(list) != 2 {
+		t.Fatalf("%d next hops", len(list))
+	}
+	// snapshot matches forward lookups
+	for _, hop := range list {
+		next, num := tbl.Forward(hop.Target)
+		if num == 0 || !next.Equal(hop.NextHop) {
+			t.Fatalf("next hop %s does not match forward %s", hop.NextHop, next)
+		}
+	}
+}
+
+func TestFilterCache(t *testing.T) {
+	tbl, _ := newTestTable(t)
+	tbl.AddNeighbor(newPeer())
+
+	// unchanged table: filter is reused
+	pf := tbl.NewLearn().Filter
+	if tbl.NewLearn().Filter != pf {
+		t.Fatal("filter not reused")
+	}
+	// beacon from known neighbor: filter is reused
+	tbl.AddNeighbor(tbl.Neighbors()[0])
+	if tbl.NewLearn().Filter != pf {
+		t.Fatal("filter not reused after neighbor update")
+	}
+	// new neighbor: filter is rebuilt
+	nb := newPeer()
+	tbl.AddNeighbor(nb)
+	pf2 := tbl.NewLearn().Filter
+	if pf2 == pf || !pf2.Contains(nb.Bytes()) {
+		t.Fatal("filter not rebuilt")
+	}
+	// filter is rebuilt (new salt) after filterReuse broadcasts
+	for i := 1; i < filterReuse; i++ {
+		if tbl.NewLearn().Filter != pf2 {
+			t.Fatalf("filter not reused (use %d)", i+1)
+		}
+	}
+	if tbl.NewLearn().Filter == pf2 {
+		t.Fatal("worn-out filter reused")
+	}
+}
+
+func TestFilterSize(t *testing.T) {
+	// few active and many dormant entries
+	tbl, _ := newTestTable(t)
+	active := make([]*PeerID, 8)
+	for i := range active {
+		active[i] = newPeer()
+		tbl.AddNeighbor(active[i])
+	}
+	for i := 0; i < 200; i++ {
+		peer := newPeer()
+		tbl.recs[peer.Key()] = &Entry{Peer: peer, Hops: -3, Origin: TimeNow(), Changed: TimeNow()}
+	}
+	pf := tbl.NewLearn().Filter
+	for _, peer := range append(active, tbl.self) {
+		if !pf.Contains(peer.Bytes()) {
+			t.Fatalf("active peer %s not in filter", peer)
+		}
+	}
+	// filter is sized for the active entries (and ourself)
+	if size, max := pf.Size(), data.NewSaltedBloomFilter(0, 20, filterFPR(20)).Size(); size > max {
+		t.Fatalf("filter size %d (max. %d)", size, max)
+	}
+	// measured false-positive rate (mean over filters with different
+	// salts) meets the bound
+	defer func(n int) { filterReuse = n }(filterReuse)
+	filterReuse = 0
+	rnd := rand.New(rand.NewSource(19)) //nolint:gosec // deterministic testing
+	buf := make([]byte, len(tbl.self.Bytes()))
+	const filters, probes = 50, 10000
+	fp := 0
+	for i := 0; i < filters; i++ {
+		pf = tbl.NewLearn().Filter
+		for j := 0; j < probes; j++ {
+			rnd.Read(buf)
+			if pf.Contains(buf) {
+				fp++
+			}
+		}
+	}
+	rate, bound := float64(fp)/(filters*probes), filterFPR(len(active)+1)
+	t.Logf("false-positive rate %.4f (bound %.4f)", rate, bound)
+	if rate > bound {
+		t.Fatalf("false-positive rate %.4f exceeds %.4f", rate, bound)
+	}
+}
+
+// state machine of table entries: each step drives the table (with
+// sanity checks and validation of entries enabled) and checks kind and
+// state of an entry as well as the emitted event.
+func TestStateMachine(t *testing.T) {
+	SetDebug(true)
+	defer SetDebug(false)
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("panic on valid input: %v", r)
+		}
+	}()
+	tbl, events := newTestTable(t)
+	a, b, x := newPeer(), newPeer(), newPeer()
+
+	// LEArn from a peer knowing nothing (all entries are taught)
+	learner := NewForwardTable(newPeer(), false)
+	learner.Start()
+	teach := func() { tbl.Teach(learner.NewLearn()) }
+
+	// expire an active neighbor
+	expire := func(p *PeerID) func() {
+		return func() {
+			tbl.recs[p.Key()].Origin = TimeFromAge(ageSecs(float64(cfg.TTLBeacon) + 1))
+			tbl.cleanup()
+		}
+	}
+	steps := []struct {
+		name   string
+		action func()
+		peer   *PeerID
+		kind   int
+		state  int
+		evType int // expected event (0 = none)
+	}{
+		// neighbor lifecycle
+		{"add neighbor", func() { tbl.AddNeighbor(a) }, a, KindNeighbor, StateActive, EvNeighborAdded},
+		{"refresh neighbor", func() { tbl.AddNeighbor(a) }, a, KindNeighbor, StateActive, 0},
+		{"add 2nd neighbor", func() { tbl.AddNeighbor(b) }, b, KindNeighbor, StateActive, EvNeighborAdded},
+
+		// relay lifecycle
+		{"learn relay", func() {
+			tbl.Learn(NewTEAchMsg(a, []*Forward{{Peer: x, Hops: 2, NextHop: RndUInt32(), Age: ageSecs(5)}}))
+		}, x, KindRelay, StateActive, EvForwardLearned},
+		{"shorter route", func() {
+			tbl.Learn(NewTEAchMsg(b, []*Forward{{Peer: x, Hops: 1, NextHop: RndUInt32(), Age: ageSecs(4)}}))
+		}, x, KindRelay, StateActive, EvShorterRoute},
+		{"removal from other neighbor", func() {
+			tbl.Learn(NewTEAchMsg(a, []*Forward{{Peer: x, Hops: -1, NextHop: RndUInt32(), Age: ageSecs(1)}}))
+		}, x, KindRelay, StateActive, 0},
+		{"removal from next hop", func() {
+			tbl.Learn(NewTEAchMsg(b, []*Forward{{Peer: x, Hops: -1, NextHop: RndUInt32(), Age: ageSecs(1)}}))
+		}, x, KindRelay, StateRemoved, EvRelayRemoved},
+		{"removed relay not re-learned", func() {
+			tbl.Learn(NewTEAchMsg(a, []*Forward{{Peer: x, Hops: 1, NextHop: RndUInt32(), Age: ageSecs(0)}}))
+		}, x, KindRelay, StateRemoved, 0},
+		{"removal taught", teach, x, KindRelay, StateDormant, EvTeaching},
+		{"revive relay", func() {
+			tbl.Learn(NewTEAchMsg(a, []*Forward{{Peer: x, Hops: 3, NextHop: RndUInt32(), Age: ageSecs(0)}}))
+		}, x, KindRelay, StateActive, EvRelayRevived},
+
+		// neighbor expiry and removal propagation to dependent relays
+		{"expire neighbor", expire(a), a, KindNeighbor, StateRemoved, EvNeighborExpired},
+		{"dependent relay removed", func() {}, x, KindRelay, StateRemoved, 0},
+		{"neighbor removal taught", teach, a, KindNeighbor, StateDormant, EvTeaching},
+		{"dormant neighbor relayed", func() {
+			tbl.Learn(NewTEAchMsg(b, []*Forward{{Peer: a, Hops: 0, Age: ageSecs(0)}}))
+		}, a, KindRelay, StateActive, EvNeighborRelayed},
+		{"relay becomes neighbor", func() { tbl.AddNeighbor(a) }, a, KindNeighbor, StateActive, EvNeighborUpdated},
+	}
+	for _, step := range steps {
+		*events = (*events)[:0]
+		step.action()
+		e := tbl.recs[step.peer.Key()]
+		if e == nil || e.Kind() != step.kind || e.State() != step.state {
+			t.Fatalf("%s: entry %s (kind %d, state %d expected)", step.name, e, step.kind, step.state)
+		}
+		if step.evType == EvTeaching {
+			// Teach itself emits no table events
+			continue
+		}
+		if step.evType == 0 {
+			for _, ev := range *events {
+				if ev.Ref.Equal(step.peer) {
+					t.Fatalf("%s: unexpected event %d", step.name, ev.Type)
+				}
+			}
+		} else if countEvents(*events, step.evType) == 0 {
+			t.Fatalf("%s: no event %d", step.name, step.evType)
+		}
+	}
+}
+
+func TestExchangeLine(t *testing.T) {
+	// four nodes on a line converge within a bounded number of rounds
+	tbls, links := newTestLine(t, 4)
+	rounds := exchange(tbls, links, 10)
+	if rounds < 0 || rounds > len(tbls) {
+		t.Fatalf("not converged in %d rounds", rounds)
+	}
+	for i, tbl := range tbls {
+		for j, other := range tbls {
+			if i == j {
+				continue
+			}
+			dist := i - j
+			if dist < 0 {
+				dist = -dist
+			}
+			if _, hops := tbl.Forward(other.self); hops != dist {
+				t.Fatalf("%d -> %d: %d hops (expected %d)", i, j, hops, dist)
+			}
+		}
+	}
+}
+
+func TestFilterFalsePositive(t *testing.T) {
+	tbl, events := newTestTable(t)
+	learner := newPeer()
+
+	// LEArn filter of the learner (only containing itself) and a
+	// target that is a false positive of the filter.
+	filter := data.NewSaltedBloomFilter(RndUInt32(), 1, 0.5)
+	filter.Add(learner.Bytes())
+	var target *PeerID
+	for target == nil {
+		if p := newPeer(); filter.Contains(p.Bytes()) {
+			target = p
+		}
+	}
+	tbl.AddNeighbor(learner)
+	tbl.AddNeighbor(target)
+	for _, entry := range tbl.recs {
+		entry.Pending = false
+	}
+	teach := func() (taught bool) {
+		*events = (*events)[:0]
+		out, _ := tbl.Teach(NewLearnMsg(learner, filter))
+		for _, msg := range out {
+			for _, f := range msg.Announce {
+				taught = taught || f.Peer.Equal(target)
+			}
+		}
+		return
+	}
+	// no check: false positive goes unnoticed
+	if teach() || countEvents(*events, EvBloomFalsePositive) != 0 {
+		t.Fatal("false positive taught or reported without check")
+	}
+	// with check: false positive reported (but not for the learner)
+	tbl.SetFilterCheck(func(l, p *PeerID) bool {
+		if !l.Equal(learner) {
+			t.Fatalf("check for wrong learner %s", l)
+		}
+		return p.Equal(learner)
+	})
+	if teach() || countEvents(*events, EvBloomFalsePositive) != 1 {
+		t.Fatalf("%d false positives reported", countEvents(*events, EvBloomFalsePositive))
+	}
+	for _, ev := range *events {
+		if ev.Type == EvBloomFalsePositive && (!ev.Ref.Equal(learner) || !GetVal[*PeerID](ev).Equal(target)) {
+			t.Fatalf("invalid event %v", ev)
+		}
+	}
+	// a learner knowing the target is not a false positive
+	tbl.SetFilterCheck(func(l, p *PeerID) bool { return true })
+	if teach() || countEvents(*events, EvBloomFalsePositive) != 0 {
+		t.Fatal("false positive reported for known target")
+	}
+}
+
+func TestKnows(t *testing.T) {
+	tbl, _ := newTestTable(t)
+	nb, other := newPeer(), newPeer()
+	tbl.AddNeighbor(nb)
+	if !tbl.Knows(tbl.self) || !tbl.Knows(nb) || tbl.Knows(other) {
+		t.Fatal("wrong known targets")
+	}
+	tbl.recs[nb.Key()].SetState(StateDormant)
+	if tbl.Knows(nb) {
+		t.Fatal("dormant target known")
+	}
+}
+
+func TestRemovalRepeats(t *testing.T) {
+	defer func(n int) { cfg.RemovalRepeats = n }(cfg.RemovalRepeats)
+
+	// star: node X and three learners are neighbors of the center C.
+	// X expires at C; the removal is taught by C to the learners (two
+	// hops from X) with 50% loss of TEAch responses. Returns the number
+	// of rounds until all learners removed their relay to X (or -1).
+	run := func(maxRounds int) int {
+		tbls, links := newTestLine(t, 2)
+		center, x := tbls[0], tbls[1]
+		learners := make([]*ForwardTable, 3)
+		for i := range learners {
+			learners[i], _ = newTestTable(t)
+			tbls = append(tbls, learners[i])
+			j := len(tbls) - 1
+			center.AddNeighbor(learners[i].self)
+			learners[i].AddNeighbor(center.self)
+			links[0] = append(links[0], j)
+			links[j] = []int{0}
+		}
+		if exchange(tbls, links, 10) < 0 {
+			t.Fatal("tables not stable")
+		}
+		// make relays older than the removal and remove X at C
+		for _, l := range learners {
+			l.recs[x.self.Key()].Origin = TimeFromAge(ageSecs(10))
+		}
+		center.Lock()
+		center.removeNeighbor(center.recs[x.self.Key()])
+		center.Unlock()
+
+		rnd := rand.New(rand.NewSource(23)) //nolint:gosec // deterministic testing
+		for round := 1; round <= maxRounds; round++ {
+			learn := center.NewLearn()
+			for _, l := range learners {
+				out, _ := l.Teach(learn)
+				for _, msg := range out {
+					center.Learn(msg)
+				}
+				out, _ = center.Teach(exactLearn(l))
+				for _, msg := range out {
+					if rnd.Float64() < 0.5 {
+						continue
+					}
+					l.Learn(msg)
+				}
+			}
+			// center must not revive the removed entry
+			if center.recs[x.self.Key()].State() == StateActive {
+				t.Fatalf("round %d: removed entry revived", round)
+			}
+			done := true
+			for _, l := range learners {
+				if l.recs[x.self.Key()].State() == StateActive {
+					done = false
+				}
+			}
+			if done {
+				return round
+			}
+		}
+		return -1
+	}
+	const K = 8
+	cfg.RemovalRepeats = 0
+	if rounds := run(K); rounds > 0 {
+		t.Fatalf("removal without repeats reached all learners in %d rounds", rounds)
+	}
+	cfg.RemovalRepeats = K
+	rounds := run(K)
+	if rounds < 0 {
+		t.Fatalf("removal not propagated in %d rounds", K)
+	}
+	t.Logf("removal propagated in %d rounds", rounds)
+}
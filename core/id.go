@@ -25,10 +25,18 @@ import (
 	"encoding/base32"
 	"encoding/base64"
 	"encoding/binary"
+	"errors"
+	"fmt"
 
 	"github.com/bfix/gospel/crypto/ed25519"
 )
 
+// Error codes
+var (
+	ErrPeerIDInvalid = errors.New("invalid peer id")
+	ErrPeerIDShort   = errors.New("short peer id (can't be parsed)")
+)
+
 //----------------------------------------------------------------------
 
 // PeerID is the identifier for a node in the network. It is the binary
@@ -43,25 +51,49 @@ type PeerID struct {
 	str64 string             // string representation (base64)
 }
 
-// Create a new PeerID from binary data
-func NewPeerID(data []byte) *PeerID {
+// Create a new PeerID from binary data (of size 32)
+func NewPeerID(data []byte) (*PeerID, error) {
 	p := new(PeerID)
-	p.Data = make([]byte, p.Size())
+	p.Data = make([]byte, len(data))
 	copy(p.Data, data)
-	p.Init()
-	return p
-}
-
-// Initialize transient attributes based on Data
-func (p *PeerID) Init() {
-	if p != nil {
-		p.tag = binary.BigEndian.Uint32(p.Data[:4])
-		p.str64 = base64.StdEncoding.EncodeToString(p.Data)
-		p.str32 = base32.StdEncoding.EncodeToString(p.Data)[:8]
-		if p.pub == nil {
-			p.pub = ed25519.NewPublicKeyFromBytes(p.Data)
+	if err := p.Init(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// PeerIDFromString parses a peer id from its full string representation
+// (base64, see Key or FullString). Short (truncated base32) identifiers
+// as returned by String are rejected.
+func PeerIDFromString(s string) (*PeerID, error) {
+	if len(s) == 8 {
+		if _, err := base32.StdEncoding.DecodeString(s); err == nil {
+			return nil, ErrPeerIDShort
 		}
 	}
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrPeerIDInvalid, err.Error())
+	}
+	return NewPeerID(data)
+}
+
+// Initialize transient attributes based on Data. Fails if Data is not
+// a binary peer id (of size 32).
+func (p *PeerID) Init() error {
+	if p == nil {
+		return nil
+	}
+	if len(p.Data) != int(p.Size()) {
+		return fmt.Errorf("%w: size %d", ErrPeerIDInvalid, len(p.Data))
+	}
+	p.tag = binary.BigEndian.Uint32(p.Data[:4])
+	p.str64 = base64.StdEncoding.EncodeToString(p.Data)
+	p.str32 = base32.StdEncoding.EncodeToString(p.Data)[:8]
+	if p.pub == nil {
+		p.pub = ed25519.NewPublicKeyFromBytes(p.Data)
+	}
+	return nil
 }
 
 // Size of a peerid (used for serialization).
@@ -93,6 +125,14 @@ func (p *PeerID) String() string {
 	return p.str32
 }
 
+// FullString returns the complete peer identifier (base64)
+func (p *PeerID) FullString() string {
+	if p == nil {
+		return "(none)"
+	}
+	return p.str64
+}
+
 // Equal returns true if two peerids are equal
 func (p *PeerID) Equal(q *PeerID) bool {
 	// handle edge cases involving nil pointers
@@ -106,6 +146,12 @@ func (p *PeerID) Equal(q *PeerID) bool {
 	return bytes.Equal(p.Data, q.Data)
 }
 
+// Less returns true if p sorts before q. Peer ids are ordered by their
+// binary representation (and therefore by tag first).
+func (p *PeerID) Less(q *PeerID) bool {
+	return bytes.Compare(p.Data, q.Data) < 0
+}
+
 // Bytes returns the binary representation (as a clone)
 func (p *PeerID) Bytes() []byte {
 	return Clone(p.Data)
@@ -119,18 +165,36 @@ type PeerPrivate struct {
 	Data []byte `size:"(Size)"` // binary representation
 
 	// transient
-	prv *ed25519.PrivateKey // node private signng key
+	prv  *ed25519.PrivateKey // node private signng key
+	seed []byte              // seed of the private key
 }
 
 // NewPeerPrivate creates a new node private signing key
 func NewPeerPrivate() *PeerPrivate {
-	_, prv := ed25519.NewKeypair()
+	seed := make([]byte, 32)
+	RndRead(seed)
+	return NewPeerPrivateFromSeed(seed)
+}
+
+// NewPeerPrivateFromSeed re-creates a private signing key from its
+// (32 byte) seed. Returns nil if the seed is invalid.
+func NewPeerPrivateFromSeed(seed []byte) *PeerPrivate {
+	prv := ed25519.NewPrivateKeyFromSeed(seed)
+	if prv == nil {
+		return nil
+	}
 	return &PeerPrivate{
 		Data: prv.Bytes(),
 		prv:  prv,
+		seed: Clone(seed),
 	}
 }
 
+// Seed returns the seed of the private key (used for checkpoints).
+func (p *PeerPrivate) Seed() []byte {
+	return Clone(p.seed)
+}
+
 // Size of a peer private key (used for local serialization).
 func (p *PeerPrivate) Size() uint {
 	return 64
@@ -144,6 +208,6 @@ func (p *PeerPrivate) Public() *PeerID {
 		Data: pub.Bytes(),
 		pub:  pub,
 	}
-	id.Init()
+	_ = id.Init() // public keys are always valid peer ids
 	return id
 }
@@ -0,0 +1,73 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestPeerIDFromString(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		p := newPeer()
+		for _, s := range []string{p.Key(), p.FullString()} {
+			q, err := PeerIDFromString(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !q.Equal(p) || q.Tag() != p.Tag() || q.String() != p.String() {
+				t.Fatalf("round-trip failed: %s != %s", q.FullString(), p.FullString())
+			}
+		}
+	}
+	// short and invalid identifiers
+	p := newPeer()
+	if _, err := PeerIDFromString(p.String()); !errors.Is(err, ErrPeerIDShort) {
+		t.Fatalf("short id: %v", err)
+	}
+	for _, s := range []string{"", "no base64!", p.Key()[:20]} {
+		if _, err := PeerIDFromString(s); !errors.Is(err, ErrPeerIDInvalid) {
+			t.Fatalf("invalid id %q: %v", s, err)
+		}
+	}
+}
+
+func TestNewPeerIDSize(t *testing.T) {
+	data := newPeer().Bytes()
+	for _, n := range []int{0, 3, 31, 33} {
+		buf := make([]byte, n)
+		copy(buf, data)
+		if _, err := NewPeerID(buf); !errors.Is(err, ErrPeerIDInvalid) {
+			t.Fatalf("%d bytes: %v", n, err)
+		}
+		if err := (&PeerID{Data: buf}).Init(); !errors.Is(err, ErrPeerIDInvalid) {
+			t.Fatalf("init with %d bytes: %v", n, err)
+		}
+	}
+	p, err := NewPeerID(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p.Bytes(), data) || p.Tag() == 0 {
+		t.Fatalf("invalid peer id %s", p.FullString())
+	}
+}
@@ -0,0 +1,115 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package core
+
+import (
+	"log"
+	"sync"
+)
+
+// Log levels
+const (
+	LogDebug = iota // verbose output for debugging
+	LogInfo         // informational messages
+	LogWarn         // problems (like failed sanity checks)
+)
+
+// Logger for leveled log messages of the core package
+type Logger interface {
+	// Debug message
+	Debug(format string, args ...any)
+
+	// Info message
+	Info(format string, args ...any)
+
+	// Warn message
+	Warn(format string, args ...any)
+}
+
+//----------------------------------------------------------------------
+
+// StdLogger writes log messages of given minimum level via the standard
+// library logger.
+type StdLogger struct {
+	Level int // minimum level of messages to be logged
+}
+
+// Debug message (interface impl)
+func (l *StdLogger) Debug(format string, args ...any) {
+	l.printf(LogDebug, format, args...)
+}
+
+// Info message (interface impl)
+func (l *StdLogger) Info(format string, args ...any) {
+	l.printf(LogInfo, format, args...)
+}
+
+// Warn message (interface impl)
+func (l *StdLogger) Warn(format string, args ...any) {
+	l.printf(LogWarn, format, args...)
+}
+
+// log message if level is high enough
+func (l *StdLogger) printf(level int, format string, args ...any) {
+	if level >= l.Level {
+		log.Printf(format, args...)
+	}
+}
+
+//----------------------------------------------------------------------
+
+// NopLogger discards all log messages.
+type NopLogger struct{}
+
+// Debug message (interface impl)
+func (NopLogger) Debug(string, ...any) {}
+
+// Info message (interface impl)
+func (NopLogger) Info(string, ...any) {}
+
+// Warn message (interface impl)
+func (NopLogger) Warn(string, ...any) {}
+
+//----------------------------------------------------------------------
+
+// logger currently in use
+var (
+	logLock sync.RWMutex
+	logImpl Logger = &StdLogger{Level: LogInfo}
+)
+
+// SetLogger sets the logger used by the core package; a nil logger
+// discards all messages.
+func SetLogger(l Logger) {
+	logLock.Lock()
+	defer logLock.Unlock()
+	if l == nil {
+		l = NopLogger{}
+	}
+	logImpl = l
+}
+
+// logger returns the current logger
+func logger() Logger {
+	logLock.RLock()
+	defer logLock.RUnlock()
+	return logImpl
+}
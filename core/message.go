@@ -21,7 +21,10 @@
 package core
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"math"
 
 	"github.com/bfix/gospel/data"
 )
@@ -40,6 +43,90 @@ type Message interface {
 	Type() uint16
 	Sender() *PeerID
 	String() string
+	Marshal() ([]byte, error)
+}
+
+// Error codes
+var (
+	ErrMsgTooShort = errors.New("message too short")
+	ErrMsgSize     = errors.New("message size mismatch")
+	ErrMsgType     = errors.New("unknown message type")
+	ErrMsgFilter   = errors.New("invalid filter in message")
+	ErrMsgForward  = errors.New("invalid forward in message")
+)
+
+// Unmarshal a message from its binary representation. The type of the
+// message is taken from the message header.
+func Unmarshal(buf []byte) (msg Message, err error) {
+	// check message header
+	if len(buf) < 4 {
+		return nil, ErrMsgTooShort
+	}
+	if int(binary.BigEndian.Uint16(buf[:2])) != len(buf) {
+		return nil, ErrMsgSize
+	}
+	// create message instance
+	switch binary.BigEndian.Uint16(buf[2:4]) {
+	case MsgBeacon:
+		msg = new(BeaconMsg)
+	case MsgLEArn:
+		msg = new(LEArnMsg)
+	case MsgTEAch:
+		msg = new(TEAchMsg)
+	default:
+		return nil, ErrMsgType
+	}
+	// deserialize message (no trailing bytes) and initialize peerids
+	if err = data.Unmarshal(msg, buf); err != nil {
+		return nil, err
+	}
+	if contentSize(msg) != uint(len(buf)) {
+		return nil, ErrMsgSize
+	}
+	if m, ok := msg.(*LEArnMsg); ok && !validFilter(m.Filter) {
+		return nil, ErrMsgFilter
+	}
+	if err = msg.Sender().Init(); err != nil {
+		return nil, err
+	}
+	if m, ok := msg.(*TEAchMsg); ok {
+		for _, f := range m.Announce {
+			if !f.valid() {
+				return nil, ErrMsgForward
+			}
+			if err = f.Peer.Init(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return
+}
+
+// validFilter returns true if the parameters of a (parsed) filter are
+// consistent (as in a filter created for the given number of bits and
+// indices), so the filter can be used safely.
+func validFilter(pf *data.SaltedBloomFilter) bool {
+	if pf.NumBits == 0 || pf.NumIdx == 0 {
+		return false
+	}
+	numIdxBits := int(math.Ceil(math.Log2(float64(pf.NumBits))))
+	numHash := (numIdxBits*int(pf.NumIdx) + 255) / 256
+	return int(pf.NumIdxBits) == numIdxBits && int(pf.NumHash) == numHash
+}
+
+// contentSize returns the size of the parsed fields of a message.
+func contentSize(msg Message) uint {
+	switch m := msg.(type) {
+	case *BeaconMsg:
+		var a *Ack
+		return 6 + m.Sender_.Size() + uint(len(m.Acks))*a.Size()
+	case *LEArnMsg:
+		return 4 + m.Sender_.Size() + m.Filter.Size()
+	case *TEAchMsg:
+		var f *Forward
+		return 4 + m.Sender_.Size() + uint(len(m.Announce))*f.Size()
+	}
+	return 0
 }
 
 //----------------------------------------------------------------------
@@ -69,20 +156,64 @@ func (m *MessageImpl) Sender() *PeerID {
 
 //----------------------------------------------------------------------
 
+// Ack acknowledges the receipt of a removal announced by a neighbor
+// (see Config.ReliableRemovals); acks are piggybacked on beacons.
+type Ack struct {
+	Sender uint32 `order:"big"` // short identifier of the announcing neighbor
+	Target uint32 `order:"big"` // short identifier of the removed target
+}
+
+// Size of the binary representation of an ack
+func (a *Ack) Size() uint {
+	return 8
+}
+
+// Beacon message: "I am here (with that many neighbors)..."
 type BeaconMsg struct {
 	MessageImpl
+
+	NumNeighbors uint16 `order:"big"`      // number of active neighbors of sender
+	Acks         []*Ack `size:"(NumAcks)"` // acknowledged removals
 }
 
-func NewBeaconMsg(sender *PeerID) *BeaconMsg {
+// NewBeaconMsg creates a new beacon message advertising the number
+// of active neighbors of the sender (local density) and acknowledging
+// received removals.
+func NewBeaconMsg(sender *PeerID, numNeighbors int, acks ...*Ack) *BeaconMsg {
 	msg := new(BeaconMsg)
 	msg.MsgType = MsgBeacon
-	msg.MsgSize = uint16(4 + sender.Size())
+	msg.MsgSize = uint16(6 + sender.Size())
 	msg.Sender_ = sender
+	msg.NumNeighbors = uint16(numNeighbors)
+	msg.Acks = acks
+	for _, a := range acks {
+		msg.MsgSize += uint16(a.Size())
+	}
 	return msg
 }
 
+// NumAcks returns the number of acks in the message (computed from the
+// message size; used for serialization).
+func (m *BeaconMsg) NumAcks() uint {
+	var a *Ack
+	hdr := 6 + m.Sender_.Size()
+	if uint(m.MsgSize) < hdr {
+		return 0
+	}
+	return (uint(m.MsgSize) - hdr) / a.Size()
+}
+
+// String returns a human-readable representation of the message
 func (m *BeaconMsg) String() string {
-	return fmt.Sprintf("Beacon{%s}", m.Sender_)
+	if len(m.Acks) > 0 {
+		return fmt.Sprintf("Beacon{%s:%d,acks=%d}", m.Sender_, m.NumNeighbors, len(m.Acks))
+	}
+	return fmt.Sprintf("Beacon{%s:%d}", m.Sender_, m.NumNeighbors)
+}
+
+// Marshal returns the binary representation of the message
+func (m *BeaconMsg) Marshal() ([]byte, error) {
+	return data.Marshal(m)
 }
 
 //----------------------------------------------------------------------
@@ -109,13 +240,18 @@ func (m *LEArnMsg) String() string {
 	return fmt.Sprintf("Learn{%s}", m.Sender_)
 }
 
+// Marshal returns the binary representation of the message
+func (m *LEArnMsg) Marshal() ([]byte, error) {
+	return data.Marshal(m)
+}
+
 //----------------------------------------------------------------------
 
 // Teach message: "This is what I know and you don't..."
 type TEAchMsg struct {
 	MessageImpl
 
-	Announce []*Forward `size:"*"` // unfiltered table entries
+	Announce []*Forward `size:"(NumForwards)"` // unfiltered table entries
 }
 
 // NewTEAchMsg creates a new message for broadcast
@@ -131,7 +267,23 @@ func NewTEAchMsg(sender *PeerID, candidates []*Forward) *TEAchMsg {
 	return msg
 }
 
+// NumForwards returns the number of forwards in the message (computed
+// from the message size; used for serialization).
+func (m *TEAchMsg) NumForwards() uint {
+	var f *Forward
+	hdr := 4 + m.Sender_.Size()
+	if uint(m.MsgSize) < hdr {
+		return 0
+	}
+	return (uint(m.MsgSize) - hdr) / f.Size()
+}
+
 // String returns a human-readable representation of the message
 func (m *TEAchMsg) String() string {
 	return fmt.Sprintf("Teach{%s:%d}", m.Sender_, len(m.Announce))
 }
+
+// Marshal returns the binary representation of the message
+func (m *TEAchMsg) Marshal() ([]byte, error) {
+	return data.Marshal(m)
+}
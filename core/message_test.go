@@ -0,0 +1,228 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/bfix/gospel/data"
+)
+
+// marshal a message and unmarshal it again; the binary representations
+// must be identical.
+func roundtrip(t *testing.T, msg Message) Message {
+	t.Helper()
+	buf, err := msg.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buf) != int(msg.Size()) {
+		t.Fatalf("size mismatch: %d != %d", len(buf), msg.Size())
+	}
+	msg2, err := Unmarshal(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg2.Type() != msg.Type() || !msg2.Sender().Equal(msg.Sender()) {
+		t.Fatalf("header mismatch: %s != %s", msg2, msg)
+	}
+	buf2, err := msg2.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, buf2) {
+		t.Fatal("binary mismatch")
+	}
+	return msg2
+}
+
+func TestMarshalBeacon(t *testing.T) {
+	msg, _ := roundtrip(t, NewBeaconMsg(newPeer(), 3)).(*BeaconMsg)
+	if msg.NumNeighbors != 3 {
+		t.Fatalf("got %d neighbors (expected 3)", msg.NumNeighbors)
+	}
+	acks := []*Ack{{Sender: RndUInt32(), Target: RndUInt32()}, {Sender: RndUInt32(), Target: RndUInt32()}}
+	msg, _ = roundtrip(t, NewBeaconMsg(newPeer(), 3, acks...)).(*BeaconMsg)
+	if len(msg.Acks) != len(acks) {
+		t.Fatalf("got %d acks (expected %d)", len(msg.Acks), len(acks))
+	}
+	for i, a := range msg.Acks {
+		if *a != *acks[i] {
+			t.Fatalf("ack mismatch: %v != %v", a, acks[i])
+		}
+	}
+}
+
+func TestMarshalLearn(t *testing.T) {
+	filter := data.NewSaltedBloomFilter(RndUInt32(), 20, 0.05)
+	peers := make([]*PeerID, 10)
+	for i := range peers {
+		peers[i] = newPeer()
+		filter.Add(peers[i].Bytes())
+	}
+	msg, _ := roundtrip(t, NewLearnMsg(newPeer(), filter)).(*LEArnMsg)
+	for _, p := range peers {
+		if !msg.Filter.Contains(p.Bytes()) {
+			t.Fatalf("peer %s missing in filter", p)
+		}
+	}
+}
+
+func TestMarshalTeach(t *testing.T) {
+	list := make([]*Forward, 10)
+	for i := range list {
+		list[i] = &Forward{
+			Peer:    newPeer(),
+			Hops:    int16(i),
+			NextHop: RndUInt32(),
+			Age:     ageSecs(float64(i)),
+		}
+	}
+	list[0].NextHop = 0
+	msg, _ := roundtrip(t, NewTEAchMsg(newPeer(), list)).(*TEAchMsg)
+	if len(msg.Announce) != len(list) {
+		t.Fatalf("got %d forwards (expected %d)", len(msg.Announce), len(list))
+	}
+	for i, f := range msg.Announce {
+		if !f.Peer.Equal(list[i].Peer) || f.Peer.Tag() != list[i].Peer.Tag() ||
+			f.Hops != list[i].Hops || f.NextHop != list[i].NextHop || f.Age != list[i].Age {
+			t.Fatalf("forward mismatch: %s != %s", f, list[i])
+		}
+	}
+}
+
+func TestTeachLayout(t *testing.T) {
+	// wire layout of a TEAch message with n forwards:
+	//   size (2) | type (2) | sender (32) | n * forward (46)
+	// with a forward encoded as:
+	//   peer (32) | hops (2) | next hop (4) | age (8)
+	sender, peer := newPeer(), newPeer()
+	f := &Forward{Peer: peer, Hops: 3, NextHop: 0x01020304, Age: Age{0x0506070809}}
+	for n := 0; n < 4; n++ {
+		list := make([]*Forward, n)
+		for i := range list {
+			list[i] = f
+		}
+		buf, err := roundtrip(t, NewTEAchMsg(sender, list)).Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(buf) != 36+46*n {
+			t.Fatalf("%d forwards: encoded length %d (expected %d)", n, len(buf), 36+46*n)
+		}
+		if binary.BigEndian.Uint16(buf[0:2]) != uint16(len(buf)) ||
+			binary.BigEndian.Uint16(buf[2:4]) != MsgTEAch ||
+			!bytes.Equal(buf[4:36], sender.Bytes()) {
+			t.Fatalf("header mismatch: %x", buf[:36])
+		}
+		for i := 0; i < n; i++ {
+			fb := buf[36+46*i : 36+46*(i+1)]
+			if !bytes.Equal(fb[0:32], peer.Bytes()) ||
+				int16(binary.BigEndian.Uint16(fb[32:34])) != f.Hops ||
+				binary.BigEndian.Uint32(fb[34:38]) != f.NextHop ||
+				int64(binary.BigEndian.Uint64(fb[38:46])) != f.Age.Val {
+				t.Fatalf("forward #%d mismatch: %x", i, fb)
+			}
+		}
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	buf, _ := NewBeaconMsg(newPeer(), 0).Marshal()
+	if _, err := Unmarshal(buf[:3]); err != ErrMsgTooShort {
+		t.Fatalf("short buffer: %v", err)
+	}
+	if _, err := Unmarshal(buf[:20]); err != ErrMsgSize {
+		t.Fatalf("size mismatch: %v", err)
+	}
+	buf[3] = 99
+	if _, err := Unmarshal(buf); err != ErrMsgType {
+		t.Fatalf("unknown type: %v", err)
+	}
+	// forwards with inconsistent hops and next hop
+	for _, f := range []*Forward{
+		{Peer: newPeer(), Hops: -3, NextHop: 7},
+		{Peer: newPeer(), Hops: -3},
+		{Peer: newPeer(), Hops: 0, NextHop: 7},
+		{Peer: newPeer(), Hops: 1},
+	} {
+		buf, _ := NewTEAchMsg(newPeer(), []*Forward{f}).Marshal()
+		if _, err := Unmarshal(buf); err != ErrMsgForward {
+			t.Fatalf("invalid forward %s: %v", f, err)
+		}
+	}
+}
+
+// FuzzUnmarshal feeds arbitrary bytes to Unmarshal: parsing must never
+// panic, and a successfully parsed message must marshal to the input.
+func FuzzUnmarshal(f *testing.F) {
+	// seed corpus: valid messages of all types
+	self, nb := newPeer(), newPeer()
+	tbl := NewForwardTable(self, false)
+	tbl.Start()
+	tbl.AddNeighbor(nb)
+	for _, msg := range []Message{
+		NewBeaconMsg(newPeer(), 2, &Ack{Sender: 1, Target: 2}),
+		tbl.NewLearn(),
+		NewTEAchMsg(newPeer(), []*Forward{
+			{Peer: newPeer(), Hops: 1, NextHop: 7, Age: Age{10}},
+			{Peer: newPeer(), Hops: -2, Age: Age{20}},
+		}),
+		// inconsistent forward (rejected)
+		NewTEAchMsg(newPeer(), []*Forward{
+			{Peer: newPeer(), Hops: -3, NextHop: 7, Age: Age{10}},
+		}),
+	} {
+		buf, err := msg.Marshal()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf)
+	}
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		msg, err := Unmarshal(buf)
+		if err != nil {
+			return
+		}
+		out, err := msg.Marshal()
+		if err != nil {
+			t.Fatalf("parsed message not marshaled: %s", err)
+		}
+		if !bytes.Equal(buf, out) {
+			t.Fatalf("malformed message accepted: %x", buf)
+		}
+		// parsed messages can be processed
+		tbl := NewForwardTable(self, false)
+		tbl.Start()
+		tbl.AddNeighbor(nb)
+		switch m := msg.(type) {
+		case *LEArnMsg:
+			tbl.Teach(m)
+		case *TEAchMsg:
+			// learned entries can be taught and cleaned up
+			tbl.Learn(m)
+			tbl.Teach(tbl.NewLearn())
+			tbl.cleanup()
+		}
+	})
+}
@@ -22,11 +22,18 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// Error codes
+var (
+	ErrNodeRunning = errors.New("node is running")
+)
+
 //----------------------------------------------------------------------
 
 // Node represents a node in the network
@@ -35,25 +42,34 @@ type Node struct {
 	ForwardTable
 
 	prv   *PeerPrivate // private signing key
-	inCh  chan Message // channel for incoming messages
-	outCh chan Message // channel for outgoing messages
+	trans Transport    // transport for messages
 
 	// Node running?
 	// I know: "Share memory by communicating; don't communicate by
 	// sharing memory.", but: just a signal whether the receiver is
 	// still alive seems an excusable exception.
 	active atomic.Bool
+
+	// shutdown handling: the 'done' channel is closed when the node
+	// stops; in-flight go routines are tracked by the wait group.
+	done     chan struct{}
+	doneLock sync.Mutex
+	pending  sync.WaitGroup
+	loop     sync.WaitGroup // message loop (see run)
 }
 
-// NewNode creates a new node with a given private signing key and an input /
-// output channel pair to send and receive messages.
-func NewNode(prv *PeerPrivate, in, out chan Message, debug bool) *Node {
+// NewNode creates a new node with a given private signing key and a
+// transport to send and receive messages. The transport is closed when
+// the node stops.
+func NewNode(prv *PeerPrivate, trans Transport, debug bool) *Node {
 	pub := prv.Public()
+	done := make(chan struct{})
+	close(done)
 	return &Node{
 		ForwardTable: *NewForwardTable(pub, debug),
 		prv:          prv,
-		inCh:         in,
-		outCh:        out,
+		trans:        trans,
+		done:         done,
 	}
 }
 
@@ -62,62 +78,302 @@ func (n *Node) PeerID() *PeerID {
 	return n.self
 }
 
-// Send message (to outgoing message channel)
+// Private returns the private signing key of the node.
+func (n *Node) Private() *PeerPrivate {
+	return n.prv
+}
+
+// Done returns a channel that is closed when the node stops.
+func (n *Node) Done() <-chan struct{} {
+	n.doneLock.Lock()
+	defer n.doneLock.Unlock()
+	return n.done
+}
+
+// Send message (broadcast on transport); the message is discarded
+// if the node stops before it could be sent.
 func (n *Node) send(msg Message) {
+	if _, ok := n.track(); !ok {
+		return
+	}
+	// synchronous transport: send broadcast in order
+	if synchronous(n.trans) {
+		defer n.pending.Done()
+		_ = n.trans.Broadcast(msg)
+		return
+	}
 	go func() {
-		n.outCh <- msg
+		defer n.pending.Done()
+		// failed broadcasts are lost messages (like in a real network)
+		_ = n.trans.Broadcast(msg)
 	}()
 }
 
 // Start the node (with periodic tasks and message handling)
 func (n *Node) Start(ctx context.Context, notify Listener) {
-	// remember listener for events
-	n.listener = notify
+	n.loop.Add(1)
+	n.run(ctx, n.activate(notify))
+}
 
-	// start forward table
-	n.ForwardTable.Start()
+// Restart a stopped node on a new transport (Stop closed the old one).
+// The node keeps its identity but starts with an empty forward table.
+// Periodic tasks and message handling run in a separate go routine.
+// Fails if the node is running.
+func (n *Node) Restart(ctx context.Context, notify Listener, trans Transport) error {
+	if n.active.Load() {
+		return ErrNodeRunning
+	}
+	// wait for the message loop of the stopped node to finish
+	n.loop.Wait()
+	if !n.active.CompareAndSwap(false, true) {
+		return ErrNodeRunning
+	}
+	n.trans = trans
+	n.loop.Add(1)
+	go n.run(ctx, n.activate(notify))
+	return nil
+}
 
-	// broadcast LEARN message periodically
-	learn := time.NewTicker(time.Duration(cfg.LearnIntv) * time.Second)
-	beacon := time.NewTicker(time.Duration(cfg.BeaconIntv) * time.Second)
-	n.active.Store(true)
+// SetTransport replaces the transport of a stopped node (Stop closed the
+// old one) before it is activated again. Fails if the node is running.
+func (n *Node) SetTransport(trans Transport) error {
+	if n.active.Load() {
+		return ErrNodeRunning
+	}
+	n.loop.Wait()
+	n.trans = trans
+	return nil
+}
+
+// run periodic tasks and handle incoming messages until the node stops
+// (or the context is cancelled).
+func (n *Node) run(ctx context.Context, done <-chan struct{}) {
+	defer n.loop.Done()
+	// broadcast LEARN message periodically. In adaptive mode the interval
+	// is doubled (up to a max.) as long as the table has no pending entries
+	// and is reset to the base interval if the table changes.
+	baseIntv := time.Duration(cfg.LearnIntv) * time.Second
+	maxIntv := time.Duration(cfg.LearnIntvMax) * time.Second
+	adaptive := maxIntv > baseIntv
+	learnIntv := baseIntv
+	learn := time.NewTicker(learnIntv)
+	defer learn.Stop()
+	// send beacons periodically (not in beaconless mode)
+	var beacon *time.Timer
+	var beaconC <-chan time.Time
+	if !cfg.Beaconless {
+		beacon = time.NewTimer(beaconDelay())
+		defer beacon.Stop()
+		beaconC = beacon.C
+	}
 	for n.active.Load() {
 		select {
 		case <-ctx.Done():
 			// termination requested
 			n.active.Store(false)
+			n.shutdown()
 			return
 
-		case <-beacon.C:
+		case <-done:
+			// node stopped
+			return
+
+		case <-beaconC:
 			// send out beacon message
-			msg := NewBeaconMsg(n.self)
-			n.send(msg)
+			n.SendBeacon()
+			beacon.Reset(beaconDelay())
+
+			// table changed in adaptive mode: reset LEArn interval
+			if adaptive && learnIntv > baseIntv && n.HasPending() {
+				learnIntv = baseIntv
+				learn.Reset(learnIntv)
+			}
 
 		case <-learn.C:
 			// send out our own learn message
-			msg := n.NewLearn()
-			n.send(msg)
-			// notify listener
-			if notify != nil {
-				notify(&Event{
-					Type: EvWantToLearn,
-					Peer: n.self,
-					Val:  msg,
-				})
+			n.SendLearn()
+			// adjust LEArn interval in adaptive mode
+			if adaptive {
+				if n.HasPending() {
+					learnIntv = baseIntv
+				} else {
+					learnIntv *= 2
+					if learnIntv > maxIntv {
+						learnIntv = maxIntv
+					}
+				}
+				learn.Reset(learnIntv)
 			}
 
-		case msg := <-n.inCh:
-			// handle incoming message
-			go n.Receive(msg)
+		case msg, ok := <-n.trans.Receive():
+			// transport closed: stop node
+			if !ok {
+				n.active.Store(false)
+				n.shutdown()
+				return
+			}
+			// handle incoming message (in order of arrival; broadcasts
+			// by the handler are sent asynchronously, so the loop is
+			// not blocked by the transport)
+			if _, ok := n.track(); ok {
+				n.Receive(msg)
+				n.pending.Done()
+			}
 		}
 	}
 }
 
-// Stop a running node
+// Activate the node without periodic tasks and message handling: the node
+// is driven externally by calls to SendLearn, SendBeacon and Receive (as
+// in single-stepped simulations).
+func (n *Node) Activate(notify Listener) {
+	n.activate(notify)
+}
+
+// activate node: start forward table and (re-)open shutdown channel.
+// Returns the shutdown channel.
+func (n *Node) activate(notify Listener) <-chan struct{} {
+	// remember listener for events
+	n.listener = notify
+
+	// start forward table
+	n.ForwardTable.Start()
+
+	// (re-)open shutdown channel
+	n.doneLock.Lock()
+	n.done = make(chan struct{})
+	done := n.done
+	n.doneLock.Unlock()
+
+	n.active.Store(true)
+	return done
+}
+
+// SendLearn broadcasts a LEArn message
+func (n *Node) SendLearn() {
+	msg := n.NewLearn()
+	n.send(msg)
+	// notify listener
+	n.emit(&Event{
+		Type: EvWantToLearn,
+		Peer: n.self,
+		Val:  msg,
+	})
+}
+
+// SendBeacon broadcasts a beacon message (with acknowledgements for
+// received removals) and re-broadcasts unacknowledged removals.
+func (n *Node) SendBeacon() {
+	msg := NewBeaconMsg(n.self, len(n.Neighbors()), n.Acks()...)
+	n.send(msg)
+	if cfg.ReliableRemovals > 0 {
+		for _, teach := range n.teachMsgs(n.Unacked()) {
+			n.send(teach)
+		}
+	}
+}
+
+// beaconDelay returns the time until the next beacon: the beacon interval
+// varied randomly by up to ±jitter (to avoid synchronized broadcasts).
+func beaconDelay() time.Duration {
+	intv := time.Duration(cfg.BeaconIntv) * time.Second
+	jitter := time.Duration(cfg.BeaconJitter * float64(time.Second))
+	if jitter <= 0 {
+		return intv
+	}
+	if jitter > intv {
+		jitter = intv
+	}
+	return intv - jitter + time.Duration(RndUInt64()%uint64(2*jitter+1))
+}
+
+// Stop a running node: wait for in-flight messages to be processed
+// or discarded. If configured, neighbors are told about the departure.
 func (n *Node) Stop() {
+	_ = n.StopContext(context.Background())
+}
+
+// StopContext stops a running node like Stop, but waits for the farewell
+// broadcast and in-flight messages only until the context is done. The
+// node is stopped in any case; the context error is returned if the
+// wait was cut short (remaining in-flight messages are discarded by the
+// stopped forward table).
+func (n *Node) StopContext(ctx context.Context) (err error) {
+	// say goodbye
+	if cfg.FarewellOnStop && n.active.Load() {
+		n.farewell(ctx)
+	}
 	// flag as removed
 	n.active.Store(false)
+	n.shutdown()
+	_ = n.trans.Close()
+
+	// wait for in-flight messages
+	drained := make(chan struct{})
+	go func() {
+		n.pending.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
 	n.ForwardTable.Stop()
+	return
+}
+
+// max. time to wait for the farewell broadcast of a stopping node
+const farewellTimeout = time.Second
+
+// farewell broadcasts a TEAch announcing ourself as a removed neighbor,
+// so neighbors can drop dependent relays immediately (instead of waiting
+// for the neighbor to expire). The wait for the broadcast ends after a
+// timeout or when the context is done.
+func (n *Node) farewell(ctx context.Context) {
+	msg := NewTEAchMsg(n.self, []*Forward{
+		{Peer: n.self, Hops: -2, Age: Age{0}},
+	})
+	// synchronous transport: send broadcast in order
+	if synchronous(n.trans) {
+		n.send(msg)
+		return
+	}
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		_ = n.trans.Broadcast(msg)
+	}()
+	select {
+	case <-sent:
+	case <-ctx.Done():
+	case <-time.After(farewellTimeout):
+	}
+}
+
+// track a new in-flight go routine (if the node is not stopped).
+// Returns the shutdown channel and true if the go routine is tracked.
+func (n *Node) track() (<-chan struct{}, bool) {
+	n.doneLock.Lock()
+	defer n.doneLock.Unlock()
+	select {
+	case <-n.done:
+		return n.done, false
+	default:
+	}
+	n.pending.Add(1)
+	return n.done, true
+}
+
+// close the shutdown channel (if not closed yet)
+func (n *Node) shutdown() {
+	n.doneLock.Lock()
+	defer n.doneLock.Unlock()
+	select {
+	case <-n.done:
+	default:
+		close(n.done)
+	}
 }
 
 // IsRunning returns true if the node is active
@@ -132,8 +388,12 @@ func (n *Node) Receive(msg Message) {
 		return
 	}
 	// add the sender as direct neighbor to the
-	// forward table.
+	// forward table (ignore our own broadcasts).
 	sender := msg.Sender()
+	if sender.Equal(n.self) {
+		return
+	}
+	start := procStart()
 	n.AddNeighbor(sender)
 
 	// handle received message
@@ -142,27 +402,46 @@ func (n *Node) Receive(msg Message) {
 	// Beacon received
 	//------------------------------------------------------------------
 	case MsgBeacon:
-		// no actions
+		// count beacon, handle acknowledged removals and notify
+		// listener about local density of sender
+		m, _ := msg.(*BeaconMsg)
+		n.beaconReceived(sender)
+		if len(m.Acks) > 0 {
+			n.Acknowledged(m.Sender(), m.Acks)
+		}
+		n.procDone(MsgBeacon, start)
+		n.emit(&Event{
+			Type: EvBeaconReceived,
+			Peer: n.self,
+			Ref:  m.Sender(),
+			Val:  int(m.NumNeighbors),
+		})
 
 	//------------------------------------------------------------------
 	// LEArn message received
 	//------------------------------------------------------------------
 	case MsgLEArn:
-		// assemble teach message
+		// assemble teach messages
 		m, _ := msg.(*LEArnMsg)
 		out, counts := n.Teach(m)
-		if out != nil {
-			n.send(out)
+		n.procDone(MsgLEArn, start)
+		n.emit(&Event{
+			Type: EvLearnReceived,
+			Peer: n.self,
+			Ref:  m.Sender(),
+		})
+		if len(out) > 0 {
+			for _, teach := range out {
+				n.send(teach)
+			}
 
 			// notify listener
-			if n.listener != nil {
-				n.listener(&Event{
-					Type: EvTeaching,
-					Peer: n.self,
-					Ref:  m.Sender(),
-					Val:  []any{out, counts},
-				})
-			}
+			n.emit(&Event{
+				Type: EvTeaching,
+				Peer: n.self,
+				Ref:  m.Sender(),
+				Val:  []any{out, counts},
+			})
 		}
 
 	//------------------------------------------------------------------
@@ -172,17 +451,46 @@ func (n *Node) Receive(msg Message) {
 		// learn new peers
 		m, _ := msg.(*TEAchMsg)
 		n.Learn(m)
+		n.procDone(MsgTEAch, start)
 
 		// notify listener
-		if n.listener != nil {
-			n.listener(&Event{
-				Type: EvLearning,
-				Peer: n.self,
-				Ref:  m.Sender(),
-				Val:  m,
-			})
-		}
+		n.emit(&Event{
+			Type: EvLearning,
+			Peer: n.self,
+			Ref:  m.Sender(),
+			Val:  m,
+		})
+	}
+}
+
+// start timing the processing of a received message (zero time if
+// processing times are not recorded)
+func procStart() time.Time {
+	if !cfg.ProcStats {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// record the processing time of a received message since 'start'
+func (n *Node) procDone(mt uint16, start time.Time) {
+	if !start.IsZero() {
+		n.recordProcessing(mt, time.Since(start))
+	}
+}
+
+// ProcessingStats returns a snapshot of the processing times of received
+// messages per message type (only recorded if enabled in the
+// configuration).
+func (n *Node) ProcessingStats() map[uint16]*ProcStat {
+	n.Lock()
+	defer n.Unlock()
+	res := make(map[uint16]*ProcStat)
+	for mt, stat := range n.procStats {
+		s := *stat
+		res[mt] = &s
 	}
+	return res
 }
 
 // String returns a human-readable representation of the node
@@ -0,0 +1,526 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package core
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNodeStopNoLeak(t *testing.T) {
+	base := runtime.NumGoroutine()
+
+	// start nodes (sharing a key) on unread channels
+	prv := NewPeerPrivate()
+	in, out := make(chan Message), make(chan Message)
+	nodes := make([]*Node, 1000)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := range nodes {
+		nodes[i] = NewNode(prv, NewChannelTransport(in, out), true)
+		go nodes[i].Start(ctx, nil)
+	}
+	// wait for beacons to be sent (blocking on the output channel)
+	time.Sleep(time.Duration(cfg.BeaconIntv)*time.Second + 200*time.Millisecond)
+	if n := runtime.NumGoroutine() - base; n < 2*len(nodes) {
+		t.Fatalf("only %d go routines running", n)
+	}
+	// stop all nodes
+	for _, node := range nodes {
+		node.Stop()
+	}
+	// wait for go routines to terminate
+	for i := 0; i < 50; i++ {
+		if runtime.NumGoroutine() <= base {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("%d go routines leaked", runtime.NumGoroutine()-base)
+}
+
+func TestNodeStopContext(t *testing.T) {
+	in, out := make(chan Message), make(chan Message)
+	node := NewNode(NewPeerPrivate(), NewChannelTransport(in, out), true)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go node.Start(ctx, nil)
+	for !node.IsRunning() {
+		time.Sleep(time.Millisecond)
+	}
+	// an in-flight message that is never finished
+	if _, ok := node.track(); !ok {
+		t.Fatal("in-flight message not tracked")
+	}
+	defer node.pending.Done()
+
+	// the wait for in-flight messages is bounded by the context
+	sctx, scancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer scancel()
+	start := time.Now()
+	if err := node.StopContext(sctx); err != context.DeadlineExceeded {
+		t.Fatalf("stop returned %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("stop took %s", d)
+	}
+	if node.IsRunning() || node.NumForwards() != 0 {
+		t.Fatal("node not stopped")
+	}
+}
+
+func TestNodeBeaconNeighbors(t *testing.T) {
+	in, out := make(chan Message), make(chan Message)
+	node := NewNode(NewPeerPrivate(), NewChannelTransport(in, out), true)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go node.Start(ctx, nil)
+	defer node.Stop()
+	for !node.IsRunning() {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 3; i++ {
+		node.AddNeighbor(newPeer())
+	}
+
+	// wait for the first beacon sent
+	timeout := time.After(time.Duration(cfg.BeaconIntv+cfg.LearnIntv) * time.Second)
+	for {
+		select {
+		case msg := <-out:
+			if m, ok := msg.(*BeaconMsg); ok {
+				if m.NumNeighbors != 3 {
+					t.Fatalf("beacon advertises %d neighbors", m.NumNeighbors)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatal("no beacon sent")
+		}
+	}
+}
+
+func TestNodeAdaptiveLearn(t *testing.T) {
+	// adaptive LEArn interval (restore config when done)
+	saved := *cfg
+	defer func() { *cfg = saved }()
+	cfg.LearnIntv, cfg.LearnIntvMax = 1, 8
+
+	// static line of five nodes
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var learns atomic.Int32
+	listener := func(ev *Event) {
+		if ev.Type == EvWantToLearn {
+			learns.Add(1)
+		}
+	}
+	nodes := make([]*Node, 5)
+	outs := make([]chan Message, len(nodes))
+	ins := make([]chan Message, len(nodes))
+	for i := range nodes {
+		ins[i], outs[i] = make(chan Message), make(chan Message)
+		nodes[i] = NewNode(NewPeerPrivate(), NewChannelTransport(ins[i], outs[i]), true)
+	}
+	// deliver broadcasts to left and right neighbor
+	for i := range nodes {
+		go func(i int) {
+			for {
+				select {
+				case msg := <-outs[i]:
+					for _, j := range []int{i - 1, i + 1} {
+						if j < 0 || j >= len(nodes) {
+							continue
+						}
+						select {
+						case ins[j] <- msg:
+						case <-ctx.Done():
+							return
+						}
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(i)
+	}
+	for _, node := range nodes {
+		go node.Start(ctx, listener)
+		defer node.Stop()
+	}
+	// count LEArn messages after convergence: with a fixed interval
+	// each node would send a message every second.
+	time.Sleep(4 * time.Second)
+	learns.Store(0)
+	time.Sleep(8 * time.Second)
+	for i, node := range nodes {
+		if n := node.NumForwards(); n != len(nodes)-1 {
+			t.Fatalf("node %d has %d forwards", i, n)
+		}
+	}
+	if n := int(learns.Load()); n >= 8*len(nodes)/2 {
+		t.Fatalf("LEArn frequency not dropping: %d messages in 8s", n)
+	}
+}
+
+func TestBeaconJitter(t *testing.T) {
+	defer func(intv int, jitter float64) {
+		cfg.BeaconIntv, cfg.BeaconJitter = intv, jitter
+		SetSeed(0)
+	}(cfg.BeaconIntv, cfg.BeaconJitter)
+	cfg.BeaconIntv = 1
+	cfg.BeaconJitter = 0.3
+
+	// sample beacon intervals (seeded)
+	sample := func(num int) []time.Duration {
+		SetSeed(42)
+		list := make([]time.Duration, num)
+		for i := range list {
+			list[i] = beaconDelay()
+		}
+		return list
+	}
+	const num = 10000
+	list := sample(num)
+	var sum, lo, hi time.Duration = 0, time.Hour, 0
+	for _, d := range list {
+		if d < 700*time.Millisecond || d > 1300*time.Millisecond {
+			t.Fatalf("beacon interval %s out of bounds", d)
+		}
+		sum += d
+		if d < lo {
+			lo = d
+		}
+		if d > hi {
+			hi = d
+		}
+	}
+	if mean := sum / num; mean < 990*time.Millisecond || mean > 1010*time.Millisecond {
+		t.Fatalf("mean beacon interval %s", mean)
+	}
+	if hi-lo < 500*time.Millisecond {
+		t.Fatalf("beacon intervals not varied: %s - %s", lo, hi)
+	}
+	// reproducible with same seed
+	for i, d := range sample(100) {
+		if d != list[i] {
+			t.Fatal("beacon intervals not reproducible")
+		}
+	}
+}
+
+func TestReliableRemovals(t *testing.T) {
+	defer func(n int) { cfg.ReliableRemovals = n }(cfg.ReliableRemovals)
+
+	// run a removal over lossy links: node 0 has target as neighbor and
+	// the other nodes (its neighbors) learn the target from node 0. The
+	// TEAch with the removal never reaches node 2 on first delivery.
+	run := func(retries int) (removed int, unacked int) {
+		cfg.ReliableRemovals = retries
+		rnd := rand.New(rand.NewSource(7))
+		nodes := make([]*Node, 4)
+		trans := make([]*QueueTransport, len(nodes))
+		for i := range nodes {
+			trans[i] = NewQueueTransport()
+			nodes[i] = NewNode(NewPeerPrivate(), trans[i], true)
+			nodes[i].Activate(nil)
+			defer nodes[i].Stop()
+		}
+		target := newPeer()
+		hub := nodes[0]
+		hub.AddNeighbor(target)
+		for _, node := range nodes[1:] {
+			hub.AddNeighbor(node.self)
+			node.AddNeighbor(hub.self)
+			node.Learn(NewTEAchMsg(hub.self, []*Forward{
+				{Peer: target, Hops: 0, Age: ageSecs(10)},
+			}))
+		}
+		// target expires at node 0 and is taught
+		hub.recs[target.Key()].Origin = TimeFromAge(ageSecs(100))
+		hub.cleanup()
+		hub.Receive(nodes[1].NewLearn())
+
+		// deliver queued messages of a node (50% loss)
+		first := true
+		deliver := func(from int) {
+			for _, msg := range trans[from].Pop() {
+				for i, node := range nodes {
+					if i == from || (from != 0 && i != 0) {
+						continue
+					}
+					if first && i == 2 && msg.Type() == MsgTEAch {
+						continue
+					}
+					if rnd.Intn(2) == 0 {
+						node.Receive(msg)
+					}
+				}
+			}
+		}
+		for round := 0; round < 20; round++ {
+			deliver(0)
+			first = false
+			for i := range nodes {
+				nodes[i].SendBeacon()
+				deliver(i)
+			}
+		}
+		for _, node := range nodes[1:] {
+			if next, _ := node.Forward(target); next == nil {
+				removed++
+			}
+		}
+		return removed, len(hub.unacked)
+	}
+	// without acknowledgements the removal is lost
+	if removed, _ := run(0); removed == 3 {
+		t.Fatal("removal propagated without re-broadcasts")
+	}
+	removed, unacked := run(10)
+	if removed != 3 {
+		t.Fatalf("removal reached %d of 3 neighbors", removed)
+	}
+	if unacked != 0 {
+		t.Fatalf("%d removals not acknowledged", unacked)
+	}
+}
+
+func TestFarewellOnStop(t *testing.T) {
+	defer func(on bool) { cfg.FarewellOnStop = on }(cfg.FarewellOnStop)
+
+	// node 0 stops; node 1 has a relay to target via node 0. Returns
+	// true if node 1 has dropped the relay after the messages of the
+	// stopped node are delivered.
+	run := func(farewell bool) bool {
+		cfg.FarewellOnStop = farewell
+		trans := NewQueueTransport()
+		node := NewNode(NewPeerPrivate(), trans, true)
+		node.Activate(nil)
+		nb := NewNode(NewPeerPrivate(), NewQueueTransport(), true)
+		nb.Activate(nil)
+		defer nb.Stop()
+
+		target := newPeer()
+		nb.AddNeighbor(node.self)
+		nb.Learn(NewTEAchMsg(node.self, []*Forward{
+			{Peer: target, Hops: 0, Age: ageSecs(1)},
+		}))
+		if next, _ := nb.Forward(target); !next.Equal(node.self) {
+			t.Fatal("relay not learned")
+		}
+		node.Stop()
+		for _, msg := range trans.Pop() {
+			nb.Receive(msg)
+		}
+		next, _ := nb.Forward(target)
+		return next == nil
+	}
+	if run(false) {
+		t.Fatal("relay dropped without farewell")
+	}
+	if !run(true) {
+		t.Fatal("relay not dropped after farewell")
+	}
+}
+
+func TestLearnReceived(t *testing.T) {
+	// every LEArn received is reported, even if it is not answered
+	trans := NewQueueTransport()
+	node := NewNode(NewPeerPrivate(), trans, true)
+	var received, teaching int
+	node.Activate(func(ev *Event) {
+		switch ev.Type {
+		case EvLearnReceived:
+			received++
+		case EvTeaching:
+			teaching++
+		}
+	})
+	defer node.Stop()
+
+	// the second LEArn finds nothing new to teach
+	nb := NewNode(NewPeerPrivate(), NewQueueTransport(), true)
+	learn := nb.NewLearn()
+	node.Receive(learn)
+	node.Receive(learn)
+	if received != 2 || teaching != 1 {
+		t.Fatalf("%d LEArns received, %d taught (expected 2, 1)", received, teaching)
+	}
+}
+
+func TestBeaconless(t *testing.T) {
+	saved := *cfg
+	defer func() { *cfg = saved }()
+	cfg.LearnIntv, cfg.TTLBeacon = 1, 2
+
+	// run a line of five nodes for a few seconds: returns the number of
+	// neighbors of each node and the total traffic (in bytes).
+	run := func() (nbs []int, traffic int64) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var bytes atomic.Int64
+		nodes := make([]*Node, 5)
+		outs := make([]chan Message, len(nodes))
+		ins := make([]chan Message, len(nodes))
+		for i := range nodes {
+			ins[i], outs[i] = make(chan Message), make(chan Message)
+			nodes[i] = NewNode(NewPeerPrivate(), NewChannelTransport(ins[i], outs[i]), true)
+		}
+		for i := range nodes {
+			go func(i int) {
+				for {
+					select {
+					case msg := <-outs[i]:
+						bytes.Add(int64(msg.Size()))
+						for _, j := range []int{i - 1, i + 1} {
+							if j < 0 || j >= len(nodes) {
+								continue
+							}
+							select {
+							case ins[j] <- msg:
+							case <-ctx.Done():
+								return
+							}
+						}
+					case <-ctx.Done():
+						return
+					}
+				}
+			}(i)
+		}
+		for _, node := range nodes {
+			go node.Start(ctx, nil)
+		}
+		time.Sleep(3500 * time.Millisecond)
+		for _, node := range nodes {
+			nbs = append(nbs, len(node.Neighbors()))
+			node.Stop()
+		}
+		return nbs, bytes.Load()
+	}
+	withBeacons, traffic1 := run()
+	cfg.Beaconless = true
+	without, traffic2 := run()
+	t.Logf("traffic: %d bytes with beacons, %d bytes beaconless", traffic1, traffic2)
+
+	// same neighbors (beyond the TTL of a neighbor), less traffic
+	for i, n := range []int{1, 2, 2, 2, 1} {
+		if withBeacons[i] != n || without[i] != n {
+			t.Fatalf("node %d: %d/%d neighbors (expected %d)", i, withBeacons[i], without[i], n)
+		}
+	}
+	if traffic2 >= traffic1 {
+		t.Fatalf("no traffic reduction: %d >= %d bytes", traffic2, traffic1)
+	}
+}
+
+func TestProcessingStats(t *testing.T) {
+	defer func(on bool) { cfg.ProcStats = on }(cfg.ProcStats)
+
+	node := NewNode(NewPeerPrivate(), NewQueueTransport(), true)
+	node.Activate(nil)
+	defer node.Stop()
+	teach := func() {
+		nb := NewPeerPrivate().Public()
+		node.Receive(NewTEAchMsg(nb, []*Forward{
+			{Peer: newPeer(), Hops: 0, Age: ageSecs(1)},
+		}))
+	}
+	// no samples recorded if switched off
+	cfg.ProcStats = false
+	teach()
+	if stats := node.ProcessingStats(); len(stats) != 0 {
+		t.Fatalf("%d message types recorded", len(stats))
+	}
+	// processing a TEAch records a sample
+	cfg.ProcStats = true
+	teach()
+	stats := node.ProcessingStats()
+	stat, ok := stats[MsgTEAch]
+	if !ok || len(stats) != 1 {
+		t.Fatalf("no TEAch samples recorded: %v", stats)
+	}
+	if stat.Count != 1 || stat.Total <= 0 || stat.Max != stat.Total || stat.Mean() != stat.Total {
+		t.Fatalf("invalid TEAch sample: %+v", stat)
+	}
+	sum := 0
+	for _, n := range stat.Buckets {
+		sum += n
+	}
+	if sum != 1 {
+		t.Fatalf("%d samples in histogram", sum)
+	}
+	// the snapshot is not changed by later samples
+	teach()
+	if stat.Count != 1 || node.ProcessingStats()[MsgTEAch].Count != 2 {
+		t.Fatal("snapshot changed")
+	}
+}
+
+func TestProcStatBuckets(t *testing.T) {
+	stat := new(ProcStat)
+	for _, d := range []time.Duration{
+		500 * time.Nanosecond, // bucket 0
+		time.Microsecond,      // bucket 1
+		3 * time.Microsecond,  // bucket 2
+		time.Hour,             // last bucket
+	} {
+		stat.add(d)
+	}
+	exp := [procBuckets]int{1, 1, 1}
+	exp[procBuckets-1] = 1
+	if stat.Buckets != exp || stat.Max != time.Hour {
+		t.Fatalf("histogram %v", stat.Buckets)
+	}
+}
+
+func TestBeaconExpiry(t *testing.T) {
+	defer func(ttl int) { cfg.TTLBeacon = ttl }(cfg.TTLBeacon)
+	cfg.TTLBeacon = 1
+
+	node := NewNode(NewPeerPrivate(), NewQueueTransport(), true)
+	node.Activate(nil)
+	defer node.Stop()
+
+	// nb1 sends a beacon and then only TEAch messages; nb2 never sends
+	// beacons (liveness by messages).
+	nb1, nb2 := newPeer(), newPeer()
+	node.Receive(NewBeaconMsg(nb1, 1))
+	deadline := time.Now().Add(1500 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		for _, nb := range []*PeerID{nb1, nb2} {
+			node.Receive(NewTEAchMsg(nb, []*Forward{}))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	node.cleanup()
+	if e := node.recs[nb1.Key()]; e.State() != StateRemoved {
+		t.Fatalf("neighbor without beacons not expired: %s", e)
+	}
+	if e := node.recs[nb2.Key()]; !e.IsA(KindNeighbor, StateActive) {
+		t.Fatalf("neighbor sending messages expired: %s", e)
+	}
+}
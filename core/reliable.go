@@ -0,0 +1,145 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package core
+
+import "sort"
+
+//----------------------------------------------------------------------
+// Reliable removals (optional, see Config.ReliableRemovals):
+// TEAch messages are broadcasted without acknowledgement, so a removal
+// can get lost and never propagate. If enabled, a node keeps track of
+// the neighbors that have not acknowledged a removal it taught and
+// re-broadcasts the removal (up to ReliableRemovals times). Receivers
+// acknowledge removals in their next beacon.
+//----------------------------------------------------------------------
+
+// removal taught but not acknowledged by all neighbors
+type removal struct {
+	entry   *Entry             // removed entry (as taught)
+	waiting map[string]*PeerID // neighbors without acknowledgement
+	rounds  int                // number of beacon rounds since teaching
+	sends   int                // number of re-broadcasts
+}
+
+// track a removed entry that is taught: all active neighbors (except the
+// target itself) need to acknowledge the removal.
+// (only call from within a locked table instance!)
+func (tbl *ForwardTable) trackRemoval(entry *Entry) {
+	r := &removal{
+		entry:   entry.Clone(),
+		waiting: make(map[string]*PeerID),
+	}
+	for key, e := range tbl.recs {
+		if e.IsA(KindNeighbor, StateActive) && !e.Peer.Equal(entry.Peer) {
+			r.waiting[key] = e.Peer
+		}
+	}
+	if len(r.waiting) == 0 {
+		return
+	}
+	if tbl.unacked == nil {
+		tbl.unacked = make(map[string]*removal)
+	}
+	tbl.unacked[entry.Peer.Key()] = r
+}
+
+// queue an acknowledgement for a removal announced by sender.
+// (only call from within a locked table instance!)
+func (tbl *ForwardTable) ackRemoval(sender, target *PeerID) {
+	ack := &Ack{
+		Sender: sender.Tag(),
+		Target: target.Tag(),
+	}
+	for _, a := range tbl.acks {
+		if *a == *ack {
+			return
+		}
+	}
+	tbl.acks = append(tbl.acks, ack)
+}
+
+// Acks returns the queued acknowledgements (for the next beacon); the
+// queue is emptied.
+func (tbl *ForwardTable) Acks() (acks []*Ack) {
+	tbl.Lock()
+	defer tbl.Unlock()
+	acks, tbl.acks = tbl.acks, nil
+	return
+}
+
+// Acknowledged handles the acknowledgements received in a beacon from a
+// neighbor: the neighbor is no longer waited for on the removals.
+func (tbl *ForwardTable) Acknowledged(sender *PeerID, acks []*Ack) {
+	tbl.Lock()
+	defer tbl.Unlock()
+	self := tbl.self.Tag()
+	for _, ack := range acks {
+		if ack.Sender != self {
+			continue
+		}
+		for key, r := range tbl.unacked {
+			if r.entry.Peer.Tag() != ack.Target {
+				continue
+			}
+			delete(r.waiting, sender.Key())
+			if len(r.waiting) == 0 {
+				delete(tbl.unacked, key)
+			}
+		}
+	}
+}
+
+// Unacked returns the removals that need to be re-broadcasted (called
+// once per beacon round). Removals are dropped if all (remaining) active
+// neighbors have acknowledged them, if the entry was revived or if the
+// max. number of re-broadcasts is reached. A removal is not re-broadcasted
+// in the first round after teaching (pending acknowledgements).
+func (tbl *ForwardTable) Unacked() (list []*Forward) {
+	tbl.Lock()
+	defer tbl.Unlock()
+	for key, r := range tbl.unacked {
+		// entry revived or purged?
+		if e, ok := tbl.recs[key]; !ok || e.State() != StateDormant {
+			delete(tbl.unacked, key)
+			continue
+		}
+		// forget about neighbors that have gone
+		for k := range r.waiting {
+			if e, ok := tbl.recs[k]; !ok || !e.IsA(KindNeighbor, StateActive) {
+				delete(r.waiting, k)
+			}
+		}
+		if len(r.waiting) == 0 || r.sends >= cfg.ReliableRemovals {
+			delete(tbl.unacked, key)
+			continue
+		}
+		// re-broadcast removal
+		if r.rounds++; r.rounds > 1 {
+			r.sends++
+			list = append(list, r.entry.Target())
+		}
+	}
+	// removed neighbors first
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Hops < list[j].Hops
+	})
+	return
+}
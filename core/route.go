@@ -0,0 +1,85 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package core
+
+// Status of a route
+const (
+	RouteSuccess = 0 // target reached
+	RouteBroken  = 1 // no forward to target on the route
+	RouteLoop    = 2 // route is a cycle (target not reached)
+)
+
+// WalkRoute follows a route from a node to a target. The function 'next'
+// returns the next hop to the target at a given node; ok is false if the
+// node has no forward to the target. A route is a loop if the target is
+// not reached within maxHops. Returns the path (starting with 'from' and
+// ending with the target on success), the number of hops and the status.
+func WalkRoute[T comparable](from, to T, maxHops int, next func(at T) (hop T, ok bool)) (path []T, hops, status int) {
+	path = append(path, from)
+	for {
+		hop, ok := next(from)
+		if !ok {
+			return path, hops, RouteBroken
+		}
+		hops++
+		path = append(path, hop)
+		if hop == to {
+			return path, hops, RouteSuccess
+		}
+		if hops >= maxHops {
+			return path, hops, RouteLoop
+		}
+		from = hop
+	}
+}
+
+// Ordered types of node identifiers (used for canonical cycles)
+type Ordered interface {
+	~int | ~int32 | ~int64 | ~uint32 | ~uint64 | ~string
+}
+
+// RouteCycle splits a looping route (as returned by WalkRoute) into the
+// head leading to the cycle and the cycle itself (the nodes from the
+// first repeated node up to, but not including, its repetition). The
+// cycle is nil if no node is repeated.
+func RouteCycle[T comparable](path []T) (head, cycle []T) {
+	seen := make(map[T]int)
+	for i, n := range path {
+		if j, ok := seen[n]; ok {
+			return path[:j], path[j:i]
+		}
+		seen[n] = i
+	}
+	return path, nil
+}
+
+// CanonicalCycle returns a copy of the cycle rotated to start with its
+// smallest node: the same cycle entered at different nodes has the same
+// canonical form.
+func CanonicalCycle[T Ordered](cycle []T) []T {
+	pos := 0
+	for i, n := range cycle {
+		if n < cycle[pos] {
+			pos = i
+		}
+	}
+	return append(append(make([]T, 0, len(cycle)), cycle[pos:]...), cycle[:pos]...)
+}
@@ -0,0 +1,130 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package core
+
+//----------------------------------------------------------------------
+// Event subscriptions: besides the listener passed on start, any number
+// of subscribers can receive (selected) events of a forward table.
+// Events emitted while the table is locked are queued and dispatched
+// (in order) to the listener and the subscribers after the table is
+// unlocked, so event handlers can safely call back into the table.
+//----------------------------------------------------------------------
+
+// subscriber to table events
+type subscriber struct {
+	id    int          // subscription identifier
+	types map[int]bool // event types (nil = all events)
+	fn    Listener     // event handler
+}
+
+// Subscribe to events of the given types (all events if no types are
+// given). Returns a function to cancel the subscription.
+func (tbl *ForwardTable) Subscribe(types []int, fn Listener) (unsubscribe func()) {
+	sub := &subscriber{fn: fn}
+	if len(types) > 0 {
+		sub.types = make(map[int]bool)
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+	tbl.subLock.Lock()
+	defer tbl.subLock.Unlock()
+	tbl.subID++
+	sub.id = tbl.subID
+	tbl.subs = append(tbl.subs, sub)
+	return func() {
+		tbl.subLock.Lock()
+		defer tbl.subLock.Unlock()
+		for i, s := range tbl.subs {
+			if s.id == sub.id {
+				tbl.subs = append(tbl.subs[:i:i], tbl.subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// queue an event for the listener and subscribers (dispatched in flush).
+// (only call from within a locked table instance!)
+func (tbl *ForwardTable) notify(ev *Event) {
+	tbl.subLock.Lock()
+	n := len(tbl.subs)
+	tbl.subLock.Unlock()
+	if tbl.listener != nil || n > 0 {
+		tbl.queued = append(tbl.queued, ev)
+	}
+}
+
+// emit an event to the listener and subscribers (table not locked)
+func (tbl *ForwardTable) emit(ev *Event) {
+	tbl.Lock()
+	tbl.notify(ev)
+	tbl.Unlock()
+	tbl.flush()
+}
+
+// flush queued events to listener and subscribers (table not locked).
+// Only one go routine dispatches events at a time (preserving order);
+// events queued during dispatch (e.g. by handlers calling back into the
+// table) are dispatched by the same go routine.
+func (tbl *ForwardTable) flush() {
+	for {
+		if !tbl.dispatch.TryLock() {
+			return
+		}
+		tbl.Lock()
+		list := tbl.queued
+		tbl.queued = nil
+		listener := tbl.listener
+		tbl.Unlock()
+		for _, ev := range list {
+			if listener != nil {
+				listener(ev)
+			}
+			tbl.publish(ev)
+		}
+		tbl.dispatch.Unlock()
+
+		// check for events queued in the meantime
+		tbl.Lock()
+		more := len(tbl.queued) > 0
+		tbl.Unlock()
+		if !more {
+			return
+		}
+	}
+}
+
+// publish an event to all interested subscribers (in order of
+// subscription)
+func (tbl *ForwardTable) publish(ev *Event) {
+	tbl.subLock.Lock()
+	list := make([]Listener, 0, len(tbl.subs))
+	for _, sub := range tbl.subs {
+		if sub.types == nil || sub.types[ev.Type] {
+			list = append(list, sub.fn)
+		}
+	}
+	tbl.subLock.Unlock()
+	for _, fn := range list {
+		fn(ev)
+	}
+}
@@ -0,0 +1,105 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscribe(t *testing.T) {
+	tbl, events := newTestTable(t)
+
+	// two subscribers for different events; handlers access the table
+	// (events are dispatched outside the lock).
+	var added, learned []*Event
+	unsub := tbl.Subscribe([]int{EvNeighborAdded}, func(ev *Event) {
+		added = append(added, ev)
+		tbl.NumForwards()
+	})
+	tbl.Subscribe([]int{EvForwardLearned, EvRelayRemoved}, func(ev *Event) {
+		learned = append(learned, ev)
+		tbl.NumForwards()
+	})
+	nb := newPeer()
+	tbl.AddNeighbor(nb)
+	tbl.Learn(NewTEAchMsg(nb, []*Forward{
+		{Peer: newPeer(), Hops: 0, Age: ageSecs(1)},
+		{Peer: newPeer(), Hops: 1, NextHop: RndUInt32(), Age: ageSecs(1)},
+	}))
+	if len(added) != 1 || added[0].Type != EvNeighborAdded || !added[0].Ref.Equal(nb) {
+		t.Fatalf("first subscriber: %d events", len(added))
+	}
+	if len(learned) != 2 || learned[0].Type != EvForwardLearned {
+		t.Fatalf("second subscriber: %d events", len(learned))
+	}
+	// the listener still gets all events
+	if len(*events) != 3 {
+		t.Fatalf("listener: %d events (expected 3)", len(*events))
+	}
+	// cancelled subscription
+	unsub()
+	tbl.AddNeighbor(newPeer())
+	if len(added) != 1 {
+		t.Fatal("event after unsubscribe")
+	}
+}
+
+func TestListenerCallback(t *testing.T) {
+	tbl, _ := newTestTable(t)
+
+	// listener calls back into the table (and modifies it)
+	var seqs []uint32
+	counts := make(map[int]int)
+	tbl.listener = func(ev *Event) {
+		seqs = append(seqs, ev.Seq)
+		counts[ev.Type] = tbl.NumForwards()
+		if ev.Type == EvForwardLearned {
+			tbl.AddNeighbor(newPeer())
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		nb := newPeer()
+		tbl.AddNeighbor(nb)
+		tbl.Learn(NewTEAchMsg(nb, []*Forward{
+			{Peer: newPeer(), Hops: 0, Age: ageSecs(1)},
+		}))
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener dead-locked")
+	}
+	// events are dispatched in order (after the table changes)
+	if len(seqs) != 3 {
+		t.Fatalf("%d events (expected 3)", len(seqs))
+	}
+	for i := 1; i < len(seqs); i++ {
+		if seqs[i] <= seqs[i-1] {
+			t.Fatalf("events out of order: %v", seqs)
+		}
+	}
+	if counts[EvForwardLearned] != 2 {
+		t.Fatalf("%d forwards in listener (expected 2)", counts[EvForwardLearned])
+	}
+}
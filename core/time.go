@@ -21,6 +21,7 @@
 package core
 
 import (
+	"sync/atomic"
 	"time"
 )
 
@@ -33,6 +34,32 @@ import (
 // when a message is received).
 //----------------------------------------------------------------------
 
+// Clock returns the current time (microseconds since the Unix epoch).
+type Clock func() int64
+
+// clock used for timestamps and expiry (nil = wall clock)
+var clock atomic.Pointer[Clock]
+
+// SetClock sets the clock for timestamps and the expiry of entries (nil
+// resets to the wall clock). Single-stepped simulations derive the time
+// from their steps, so expiry does not depend on how fast (or slow) the
+// simulation is stepped.
+func SetClock(c Clock) {
+	if c == nil {
+		clock.Store(nil)
+		return
+	}
+	clock.Store(&c)
+}
+
+// current time (microseconds since the Unix epoch)
+func now() int64 {
+	if c := clock.Load(); c != nil {
+		return (*c)()
+	}
+	return time.Now().UnixMicro()
+}
+
 // Time is the number of microseconds since Jan 1st, 1970 (Unix epoch)
 type Time struct {
 	Val int64 `order:"big"`
@@ -40,12 +67,12 @@ type Time struct {
 
 // Age of the timestamp
 func (t Time) Age() Age {
-	return Age{time.Now().UnixMicro() - t.Val}
+	return Age{now() - t.Val}
 }
 
 // Expired returns true if 't+ttl' is in the past
 func (t Time) Expired(ttl time.Duration) bool {
-	return (time.Now().UnixMicro() - t.Val) > ttl.Microseconds()
+	return (now() - t.Val) > ttl.Microseconds()
 }
 
 // Before returns true if t is before t2
@@ -65,12 +92,12 @@ func (t Time) String() string {
 
 // TimeNow returns the current time
 func TimeNow() Time {
-	return Time{Val: time.Now().UnixMicro()}
+	return Time{Val: now()}
 }
 
 // TimeFromAge returns a time for a given age.
 func TimeFromAge(a Age) Time {
-	return Time{time.Now().UnixMicro() - a.Val}
+	return Time{now() - a.Val}
 }
 
 //----------------------------------------------------------------------
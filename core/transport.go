@@ -0,0 +1,284 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package core
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Error codes
+var (
+	ErrTransportClosed = errors.New("transport closed")
+)
+
+// Transport for messages between nodes: a node broadcasts messages to all
+// nodes in reach and receives the broadcasts of other nodes (including its
+// own broadcasts in some transports).
+type Transport interface {
+	// Broadcast a message (blocking until sent or transport is closed)
+	Broadcast(Message) error
+
+	// Receive returns a channel for incoming messages
+	Receive() <-chan Message
+
+	// Close the transport (pending broadcasts are discarded)
+	Close() error
+}
+
+// SyncTransport is a transport that never blocks on broadcasts: a node
+// sends its messages synchronously (in order of sending) instead of in
+// separate go routines.
+type SyncTransport interface {
+	Transport
+
+	// Synchronous returns true if broadcasts are sent synchronously
+	Synchronous() bool
+}
+
+// synchronous returns true if broadcasts on the transport are sent
+// synchronously (see SyncTransport).
+func synchronous(t Transport) bool {
+	st, ok := t.(SyncTransport)
+	return ok && st.Synchronous()
+}
+
+//----------------------------------------------------------------------
+
+// ChannelTransport uses an input / output channel pair to send and receive
+// messages (in-process transport as used in the simulation).
+type ChannelTransport struct {
+	in   chan Message  // channel for incoming messages
+	out  chan Message  // channel for outgoing messages
+	done chan struct{} // closed when transport is closed
+	once sync.Once
+}
+
+// NewChannelTransport creates a new transport on a channel pair.
+func NewChannelTransport(in, out chan Message) *ChannelTransport {
+	return &ChannelTransport{
+		in:   in,
+		out:  out,
+		done: make(chan struct{}),
+	}
+}
+
+// Broadcast a message to the output channel
+func (t *ChannelTransport) Broadcast(msg Message) error {
+	select {
+	case t.out <- msg:
+		return nil
+	case <-t.done:
+		return ErrTransportClosed
+	}
+}
+
+// Receive returns the input channel
+func (t *ChannelTransport) Receive() <-chan Message {
+	return t.in
+}
+
+// Close the transport; the channels are not closed as they are usually
+// shared with other nodes.
+func (t *ChannelTransport) Close() error {
+	t.once.Do(func() { close(t.done) })
+	return nil
+}
+
+//----------------------------------------------------------------------
+
+// QueueTransport collects broadcasted messages in a queue; it never blocks
+// and is served synchronously by the node (deterministic order of messages
+// in single-stepped simulations). Incoming messages are not received via
+// the transport but handed to the node directly (see Node.Receive).
+type QueueTransport struct {
+	sync.Mutex
+	queue  []Message // queued messages
+	closed bool      // transport closed?
+}
+
+// NewQueueTransport creates a new (empty) queue transport.
+func NewQueueTransport() *QueueTransport {
+	return new(QueueTransport)
+}
+
+// Broadcast a message by appending it to the queue
+func (t *QueueTransport) Broadcast(msg Message) error {
+	t.Lock()
+	defer t.Unlock()
+	if t.closed {
+		return ErrTransportClosed
+	}
+	t.queue = append(t.queue, msg)
+	return nil
+}
+
+// Synchronous returns true: broadcasts are queued without blocking.
+func (t *QueueTransport) Synchronous() bool {
+	return true
+}
+
+// Receive returns no channel (messages are delivered directly)
+func (t *QueueTransport) Receive() <-chan Message {
+	return nil
+}
+
+// Close the transport: no more broadcasts are accepted (queued messages
+// can still be popped).
+func (t *QueueTransport) Close() error {
+	t.Lock()
+	defer t.Unlock()
+	t.closed = true
+	return nil
+}
+
+// Pop all queued messages (in order of broadcast)
+func (t *QueueTransport) Pop() (list []Message) {
+	t.Lock()
+	defer t.Unlock()
+	list, t.queue = t.queue, nil
+	return
+}
+
+//----------------------------------------------------------------------
+
+// UDPTransport sends marshaled messages to a (broadcast) address and
+// receives messages on a local UDP socket.
+type UDPTransport struct {
+	conn  *net.UDPConn  // local socket
+	bcast *net.UDPAddr  // broadcast address
+	recv  chan Message  // channel for incoming messages
+	done  chan struct{} // closed when transport is closed
+	once  sync.Once
+}
+
+// NewUDPTransport creates a new transport on a (listening) UDP socket that
+// sends broadcasts to the given address.
+func NewUDPTransport(conn *net.UDPConn, bcast *net.UDPAddr) *UDPTransport {
+	t := &UDPTransport{
+		conn:  conn,
+		bcast: bcast,
+		recv:  make(chan Message),
+		done:  make(chan struct{}),
+	}
+	go t.listen()
+	return t
+}
+
+// NewMulticastTransport joins a multicast group on the given interface (or
+// on the system-assigned interface if nil) and broadcasts messages to the
+// group. Multicast loopback is enabled, so multiple nodes can run on the
+// same host.
+func NewMulticastTransport(ifi *net.Interface, group *net.UDPAddr) (*UDPTransport, error) {
+	network := "udp6"
+	if group.IP.To4() != nil {
+		network = "udp4"
+	}
+	conn, err := net.ListenMulticastUDP(network, ifi, group)
+	if err != nil {
+		return nil, err
+	}
+	if network == "udp4" {
+		err = ipv4.NewPacketConn(conn).SetMulticastLoopback(true)
+	} else {
+		err = ipv6.NewPacketConn(conn).SetMulticastLoopback(true)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return NewUDPTransport(conn, group), nil
+}
+
+// back-off for repeated read errors on a UDP socket
+const (
+	readBackoffMin = 10 * time.Millisecond
+	readBackoffMax = 5 * time.Second
+)
+
+// read and unmarshal incoming messages until the socket is closed.
+// Invalid messages are dropped. Other read errors are logged and the
+// next read is delayed (doubling the delay on repeated errors).
+func (t *UDPTransport) listen() {
+	defer close(t.recv)
+	buf := make([]byte, 65536)
+	var delay time.Duration
+	for {
+		n, _, err := t.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if delay *= 2; delay < readBackoffMin {
+				delay = readBackoffMin
+			} else if delay > readBackoffMax {
+				delay = readBackoffMax
+			}
+			logger().Warn("UDP read failed (retry in %s): %s", delay, err)
+			select {
+			case <-t.done:
+				return
+			case <-time.After(delay):
+			}
+			continue
+		}
+		delay = 0
+		msg, err := Unmarshal(buf[:n])
+		if err != nil {
+			continue
+		}
+		select {
+		case t.recv <- msg:
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// Broadcast a marshaled message to the broadcast address
+func (t *UDPTransport) Broadcast(msg Message) error {
+	buf, err := msg.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = t.conn.WriteToUDP(buf, t.bcast)
+	return err
+}
+
+// Receive returns a channel for incoming messages; the channel is
+// closed when the transport is closed.
+func (t *UDPTransport) Receive() <-chan Message {
+	return t.recv
+}
+
+// Close the transport (and the underlying socket)
+func (t *UDPTransport) Close() (err error) {
+	t.once.Do(func() {
+		close(t.done)
+		err = t.conn.Close()
+	})
+	return
+}
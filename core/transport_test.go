@@ -0,0 +1,159 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package core
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// open a UDP socket on loopback
+func loopback(t *testing.T) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("no loopback UDP: %v", err)
+	}
+	return conn
+}
+
+// wait until two nodes see each other as neighbors
+func waitNeighbors(n1, n2 *Node, timeout time.Duration) bool {
+	isNeighbor := func(n *Node, p *PeerID) bool {
+		for _, nb := range n.Neighbors() {
+			if nb.Equal(p) {
+				return true
+			}
+		}
+		return false
+	}
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if isNeighbor(n1, n2.PeerID()) && isNeighbor(n2, n1.PeerID()) {
+			return true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return false
+}
+
+func TestUDPTransport(t *testing.T) {
+	// two nodes on loopback "broadcasting" to each other
+	conn1, conn2 := loopback(t), loopback(t)
+	addr1, _ := conn1.LocalAddr().(*net.UDPAddr)
+	addr2, _ := conn2.LocalAddr().(*net.UDPAddr)
+	node1 := NewNode(NewPeerPrivate(), NewUDPTransport(conn1, addr2), true)
+	node2 := NewNode(NewPeerPrivate(), NewUDPTransport(conn2, addr1), true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, node := range []*Node{node1, node2} {
+		go node.Start(ctx, nil)
+		defer node.Stop()
+	}
+	if !waitNeighbors(node1, node2, time.Duration(3*cfg.BeaconIntv)*time.Second) {
+		t.Fatal("nodes are not neighbors")
+	}
+}
+
+func TestUDPReadErrors(t *testing.T) {
+	log := &testLogger{msgs: make(map[string][]string)}
+	SetLogger(log)
+	defer SetLogger(&StdLogger{Level: LogInfo})
+
+	// every read on the socket fails (read deadline in the past)
+	conn := loopback(t)
+	addr, _ := conn.LocalAddr().(*net.UDPAddr)
+	trans := NewUDPTransport(conn, addr)
+	if err := conn.SetReadDeadline(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	// failed reads are logged and retried with back-off
+	time.Sleep(300 * time.Millisecond)
+	if n := log.count("warn"); n < 1 || n > 10 {
+		t.Fatalf("%d failed reads in 300ms", n)
+	}
+	// closing the socket stops the listener (even while backing off)
+	_ = trans.Close()
+	select {
+	case _, ok := <-trans.Receive():
+		if ok {
+			t.Fatal("message received")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("listener not stopped")
+	}
+}
+
+func TestMulticastTransport(t *testing.T) {
+	// find loopback interface with multicast support
+	var lo *net.Interface
+	ifs, _ := net.Interfaces()
+	for i := range ifs {
+		if ifs[i].Flags&net.FlagLoopback != 0 && ifs[i].Flags&net.FlagMulticast != 0 {
+			lo = &ifs[i]
+			break
+		}
+	}
+	if lo == nil {
+		t.Skip("no multicast on loopback interface")
+	}
+	// two nodes in the same multicast group
+	group := &net.UDPAddr{IP: net.IPv4(239, 255, 76, 84), Port: 27654}
+	nodes := make([]*Node, 2)
+	for i := range nodes {
+		trans, err := NewMulticastTransport(lo, group)
+		if err != nil {
+			t.Skipf("no multicast transport: %v", err)
+		}
+		nodes[i] = NewNode(NewPeerPrivate(), trans, true)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, node := range nodes {
+		go node.Start(ctx, nil)
+		defer node.Stop()
+	}
+	if !waitNeighbors(nodes[0], nodes[1], time.Duration(3*cfg.BeaconIntv)*time.Second) {
+		t.Fatal("nodes are not neighbors")
+	}
+}
+
+func TestSyncTransport(t *testing.T) {
+	// only the queue transport sends synchronously
+	if !synchronous(NewQueueTransport()) {
+		t.Fatal("queue transport not synchronous")
+	}
+	if synchronous(NewChannelTransport(nil, nil)) {
+		t.Fatal("channel transport synchronous")
+	}
+	// a node on a synchronous transport has sent its broadcast on return
+	trans := NewQueueTransport()
+	node := NewNode(NewPeerPrivate(), trans, false)
+	node.Activate(nil)
+	defer node.Stop()
+	node.SendBeacon()
+	if n := len(trans.Pop()); n != 1 {
+		t.Fatalf("%d messages queued", n)
+	}
+}
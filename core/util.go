@@ -24,16 +24,48 @@ import (
 	"bytes"
 	"crypto/rand"
 	"encoding/binary"
+	mrand "math/rand"
+	"sync"
 )
 
 //----------------------------------------------------------------------
 // Random numbers
 //----------------------------------------------------------------------
 
+// source of randomness: crypto/rand or a seeded generator for
+// reproducible test runs.
+var (
+	rndLock sync.Mutex
+	rndGen  *mrand.Rand
+)
+
+// SetSeed switches to a deterministic random generator with given seed.
+// A seed of 0 switches back to crypto/rand.
+func SetSeed(seed int64) {
+	rndLock.Lock()
+	defer rndLock.Unlock()
+	if seed == 0 {
+		rndGen = nil
+		return
+	}
+	rndGen = mrand.New(mrand.NewSource(seed)) //nolint:gosec // deterministic testing
+}
+
+// RndRead fills a byte array with random data
+func RndRead(b []byte) {
+	rndLock.Lock()
+	defer rndLock.Unlock()
+	if rndGen != nil {
+		_, _ = rndGen.Read(b)
+		return
+	}
+	_, _ = rand.Read(b)
+}
+
 // RndUInt64 returns a random uint64 integer
 func RndUInt64() uint64 {
 	b := make([]byte, 8)
-	_, _ = rand.Read(b)
+	RndRead(b)
 	var v uint64
 	c := bytes.NewBuffer(b)
 	_ = binary.Read(c, binary.BigEndian, &v)
@@ -0,0 +1,191 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+// Package http serves the state of a running node (neighbors, forward
+// table and routes) as JSON for introspection. The server only reads
+// the forward table of the node; it is optional and not needed for
+// the operation of a node.
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"leatea/core"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Peer identifier (short and full form)
+type Peer struct {
+	ID   string `json:"id"`   // short identifier
+	Full string `json:"full"` // full identifier (see core.PeerIDFromString)
+}
+
+// newPeer returns the JSON representation of a peer (nil if p is nil)
+func newPeer(p *core.PeerID) *Peer {
+	if p == nil {
+		return nil
+	}
+	return &Peer{
+		ID:   p.String(),
+		Full: p.FullString(),
+	}
+}
+
+// Neighbor of the node
+type Neighbor struct {
+	Peer     *Peer   `json:"peer"`     // neighbor
+	LastSeen float64 `json:"lastSeen"` // seconds since last message
+	Beacons  int     `json:"beacons"`  // number of beacons received
+}
+
+// Forward table entry of the node
+type Forward struct {
+	Target  *Peer   `json:"target"`            // target peer
+	NextHop *Peer   `json:"nextHop,omitempty"` // next hop (relays only)
+	Hops    int     `json:"hops"`              // hop count (negative: removed/dormant)
+	Age     float64 `json:"age"`               // seconds since origin of route
+	Pending bool    `json:"pending"`           // changed but not taught yet
+}
+
+// Route to a target
+type Route struct {
+	Target *Peer   `json:"target"`             // target peer
+	Next   []*Peer `json:"nextHops,omitempty"` // next hops (none for neighbors)
+	Hops   int     `json:"hops"`               // number of hops to target
+}
+
+// Server for node introspection
+type Server struct {
+	node   *core.Node   // node to introspect
+	srv    *http.Server // HTTP server
+	listen net.Listener // listener of HTTP server
+}
+
+// NewServer creates a new introspection server for a node.
+func NewServer(node *core.Node) *Server {
+	return &Server{
+		node: node,
+	}
+}
+
+// Handler returns the HTTP handler for the endpoints "/neighbors",
+// "/forwards" (all entries with "?all=1") and "/route?to=<peerid>".
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/neighbors", s.neighbors)
+	mux.HandleFunc("/forwards", s.forwards)
+	mux.HandleFunc("/route", s.route)
+	return mux
+}
+
+// Serve the endpoints on given address (non-blocking)
+func (s *Server) Serve(addr string) (err error) {
+	if s.listen, err = net.Listen("tcp", addr); err != nil {
+		return
+	}
+	s.srv = &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		_ = s.srv.Serve(s.listen)
+	}()
+	return
+}
+
+// Addr returns the address of the HTTP server
+func (s *Server) Addr() net.Addr {
+	if s.listen == nil {
+		return nil
+	}
+	return s.listen.Addr()
+}
+
+// Close the HTTP server
+func (s *Server) Close() error {
+	if s.srv == nil {
+		return nil
+	}
+	return s.srv.Shutdown(context.Background())
+}
+
+// list active neighbors (most recently seen first)
+func (s *Server) neighbors(w http.ResponseWriter, _ *http.Request) {
+	list := make([]*Neighbor, 0)
+	for _, nb := range s.node.NeighborInfo() {
+		list = append(list, &Neighbor{
+			Peer:     newPeer(nb.Peer),
+			LastSeen: nb.LastSeen.Seconds(),
+			Beacons:  nb.Beacons,
+		})
+	}
+	reply(w, http.StatusOK, list)
+}
+
+// list forward table entries (sorted by target)
+func (s *Server) forwards(w http.ResponseWriter, r *http.Request) {
+	all := r.URL.Query().Get("all") == "1"
+	list := make([]*Forward, 0)
+	for _, e := range s.node.Forwards(all) {
+		list = append(list, &Forward{
+			Target:  newPeer(e.Peer),
+			NextHop: newPeer(e.NextHop),
+			Hops:    int(e.Hops),
+			Age:     e.Origin.Age().Seconds(),
+			Pending: e.Pending,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Target.Full < list[j].Target.Full
+	})
+	reply(w, http.StatusOK, list)
+}
+
+// lookup route to a target
+func (s *Server) route(w http.ResponseWriter, r *http.Request) {
+	target, err := core.PeerIDFromString(r.URL.Query().Get("to"))
+	if err != nil {
+		reply(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	next, hops := s.node.ForwardMulti(target)
+	if hops == 0 {
+		reply(w, http.StatusNotFound, map[string]string{"error": "no route to target"})
+		return
+	}
+	rt := &Route{
+		Target: newPeer(target),
+		Hops:   hops,
+	}
+	for _, p := range next {
+		rt.Next = append(rt.Next, newPeer(p))
+	}
+	reply(w, http.StatusOK, rt)
+}
+
+// reply with a JSON-encoded object
+func reply(w http.ResponseWriter, status int, obj any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(obj)
+}
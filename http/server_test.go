@@ -0,0 +1,104 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package http
+
+import (
+	"encoding/json"
+	"leatea/core"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// get a JSON-encoded object from an endpoint
+func get(t *testing.T, base, path string, obj any) int {
+	t.Helper()
+	resp, err := http.Get(base + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if obj != nil && resp.StatusCode == http.StatusOK {
+		if err = json.NewDecoder(resp.Body).Decode(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestServer(t *testing.T) {
+	// node with a neighbor and a relay via the neighbor
+	node := core.NewNode(core.NewPeerPrivate(), core.NewQueueTransport(), true)
+	node.Activate(nil)
+	defer node.Stop()
+	nb, target := core.NewPeerPrivate().Public(), core.NewPeerPrivate().Public()
+	node.AddNeighbor(nb)
+	node.Learn(core.NewTEAchMsg(nb, []*core.Forward{
+		{Peer: target, Hops: 0},
+	}))
+	ts := httptest.NewServer(NewServer(node).Handler())
+	defer ts.Close()
+
+	var nbs []*Neighbor
+	if get(t, ts.URL, "/neighbors", &nbs) != http.StatusOK {
+		t.Fatal("neighbors failed")
+	}
+	if len(nbs) != 1 || nbs[0].Peer.ID != nb.String() || nbs[0].Peer.Full != nb.FullString() {
+		t.Fatalf("unexpected neighbors: %v", nbs)
+	}
+	var fws []*Forward
+	if get(t, ts.URL, "/forwards", &fws) != http.StatusOK {
+		t.Fatal("forwards failed")
+	}
+	if len(fws) != 2 {
+		t.Fatalf("%d forwards (expected 2)", len(fws))
+	}
+	for _, f := range fws {
+		switch f.Target.Full {
+		case nb.FullString():
+			if f.NextHop != nil || f.Hops != 0 {
+				t.Fatalf("unexpected neighbor entry: %v", f)
+			}
+		case target.FullString():
+			if f.NextHop == nil || f.NextHop.Full != nb.FullString() || f.Hops != 1 {
+				t.Fatalf("unexpected relay entry: %v", f)
+			}
+		default:
+			t.Fatalf("unknown target %s", f.Target.ID)
+		}
+	}
+	var rt *Route
+	if get(t, ts.URL, "/route?to="+url.QueryEscape(target.FullString()), &rt) != http.StatusOK {
+		t.Fatal("route failed")
+	}
+	if rt.Hops != 2 || len(rt.Next) != 1 || rt.Next[0].Full != nb.FullString() {
+		t.Fatalf("unexpected route: %v", rt)
+	}
+	// unknown target and invalid peer id
+	unknown := core.NewPeerPrivate().Public().FullString()
+	if code := get(t, ts.URL, "/route?to="+url.QueryEscape(unknown), nil); code != http.StatusNotFound {
+		t.Fatalf("unknown target: status %d", code)
+	}
+	if code := get(t, ts.URL, "/route?to=xyz", nil); code != http.StatusBadRequest {
+		t.Fatalf("invalid target: status %d", code)
+	}
+}
@@ -0,0 +1,165 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+// Package metrics exports the state of a running node as Prometheus
+// metrics. The collector is fed by the event stream of a node (it is
+// used as a core.Listener), so the core package stays independent of
+// Prometheus.
+package metrics
+
+import (
+	"context"
+	"leatea/core"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Table is the part of a forward table that is polled for gauges
+// (implemented by core.ForwardTable and core.Node).
+type Table interface {
+	// NumForwards returns the number of active forwards
+	NumForwards() int
+
+	// Neighbors returns the list of active neighbors
+	Neighbors() []*core.PeerID
+}
+
+// Collector for node metrics
+type Collector struct {
+	reg    *prometheus.Registry
+	msgs   *prometheus.CounterVec // messages sent/received per type
+	loops  prometheus.Counter     // loop detections
+	hops   prometheus.Counter     // routes exceeding the hop limit
+	srv    *http.Server           // HTTP server for metrics
+	listen net.Listener           // listener of HTTP server
+}
+
+// NewCollector creates a new collector for metrics of a node. If tbl is
+// not nil, the size of the forward table and the number of neighbors are
+// exported as gauges.
+func NewCollector(tbl Table) *Collector {
+	c := &Collector{
+		reg: prometheus.NewRegistry(),
+		msgs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "leatea_messages_total",
+			Help: "Number of messages sent/received per type.",
+		}, []string{"direction", "type"}),
+		loops: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "leatea_loops_detected_total",
+			Help: "Number of detected loop constructions.",
+		}),
+		hops: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "leatea_hop_limit_exceeded_total",
+			Help: "Number of routes ignored for exceeding the hop limit.",
+		}),
+	}
+	c.reg.MustRegister(c.msgs, c.loops, c.hops)
+	if tbl != nil {
+		c.reg.MustRegister(
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "leatea_forwards",
+				Help: "Number of active entries in the forward table.",
+			}, func() float64 {
+				return float64(tbl.NumForwards())
+			}),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "leatea_neighbors",
+				Help: "Number of active neighbors.",
+			}, func() float64 {
+				return float64(len(tbl.Neighbors()))
+			}),
+		)
+	}
+	return c
+}
+
+// Listener returns the listener to be passed to a node. Events are
+// handed to the next listener (if not nil) after processing.
+func (c *Collector) Listener(next core.Listener) core.Listener {
+	return func(ev *core.Event) {
+		c.Handle(ev)
+		if next != nil {
+			next(ev)
+		}
+	}
+}
+
+// Handle an event from a node
+func (c *Collector) Handle(ev *core.Event) {
+	switch ev.Type {
+	case core.EvWantToLearn:
+		c.msgs.WithLabelValues("sent", "learn").Inc()
+	case core.EvLearnReceived:
+		c.msgs.WithLabelValues("received", "learn").Inc()
+	case core.EvTeaching:
+		// TEAch messages sent in response to a LEArn
+		val := core.GetVal[[]any](ev)
+		if len(val) > 0 {
+			out, _ := val[0].([]*core.TEAchMsg)
+			c.msgs.WithLabelValues("sent", "teach").Add(float64(len(out)))
+		}
+	case core.EvLearning:
+		c.msgs.WithLabelValues("received", "teach").Inc()
+	case core.EvBeaconReceived:
+		c.msgs.WithLabelValues("received", "beacon").Inc()
+	case core.EvLoopDetect:
+		c.loops.Inc()
+	case core.EvHopLimitExceeded:
+		c.hops.Inc()
+	}
+}
+
+// Serve metrics via HTTP on given address (in the background). The
+// metrics are available under "/metrics".
+func (c *Collector) Serve(addr string) (err error) {
+	if c.listen, err = net.Listen("tcp", addr); err != nil {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(c.reg, promhttp.HandlerOpts{}))
+	c.srv = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		_ = c.srv.Serve(c.listen)
+	}()
+	return
+}
+
+// Addr returns the address of the HTTP server
+func (c *Collector) Addr() net.Addr {
+	if c.listen == nil {
+		return nil
+	}
+	return c.listen.Addr()
+}
+
+// Close the HTTP server
+func (c *Collector) Close() error {
+	if c.srv == nil {
+		return nil
+	}
+	return c.srv.Shutdown(context.Background())
+}
@@ -0,0 +1,100 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package metrics
+
+import (
+	"io"
+	"leatea/core"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// table with fixed size
+type testTable struct {
+	nb []*core.PeerID
+}
+
+func (t *testTable) NumForwards() int          { return 7 }
+func (t *testTable) Neighbors() []*core.PeerID { return t.nb }
+
+func TestCollector(t *testing.T) {
+	tbl := &testTable{
+		nb: []*core.PeerID{
+			core.NewPeerPrivate().Public(),
+			core.NewPeerPrivate().Public(),
+		},
+	}
+	c := NewCollector(tbl)
+	if err := c.Serve("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// inject events (passed on to next listener)
+	count := 0
+	listener := c.Listener(func(*core.Event) { count++ })
+	// (the second LEArn received is not answered by a TEAch)
+	for _, evType := range []int{
+		core.EvWantToLearn, core.EvWantToLearn, core.EvLearnReceived,
+		core.EvTeaching, core.EvLearnReceived, core.EvLearning,
+		core.EvBeaconReceived, core.EvBeaconReceived, core.EvBeaconReceived, core.EvLoopDetect, core.EvForwardLearned,
+	} {
+		ev := &core.Event{Type: evType}
+		if evType == core.EvTeaching {
+			// a LEArn answered with two TEAch messages
+			out := []*core.TEAchMsg{
+				core.NewTEAchMsg(tbl.nb[0], nil),
+				core.NewTEAchMsg(tbl.nb[0], nil),
+			}
+			ev.Val = []any{out, [3]int{}}
+		}
+		listener(ev)
+	}
+	if count != 11 {
+		t.Fatalf("%d events passed on (expected 11)", count)
+	}
+	// scrape metrics
+	resp, err := http.Get("http://" + c.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`leatea_messages_total{direction="sent",type="learn"} 2`,
+		`leatea_messages_total{direction="received",type="learn"} 2`,
+		`leatea_messages_total{direction="sent",type="teach"} 2`,
+		`leatea_messages_total{direction="received",type="teach"} 1`,
+		`leatea_messages_total{direction="received",type="beacon"} 3`,
+		`leatea_loops_detected_total 1`,
+		`leatea_hop_limit_exceeded_total 0`,
+		`leatea_forwards 7`,
+		`leatea_neighbors 2`,
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("missing %q", line)
+		}
+	}
+}
@@ -23,6 +23,7 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"leatea/core"
 	"log"
 	"sort"
 	"strconv"
@@ -34,33 +35,28 @@ import (
 // ----------------------------------------------------------------------
 
 func route(fromNode, toNode *Node) (hops int, route []string) {
-	ttl := len(nodes)
-	hops = 0
-	from := fromNode.self
 	to := toNode.self
-	for {
-		route = append(route, from)
-		hops++
-		forward, ok := fromNode.forwards[to]
+	route, hops, status := core.WalkRoute(fromNode.self, to, len(nodes), func(at string) (string, bool) {
+		node, ok := nodes[at]
 		if !ok {
-			hops = 0
-			return
+			return "", false
 		}
-		if forward.next == "" {
-			route = append(route, to)
-			return
-		}
-		if forward.hops < 0 {
-			hops = 0
-			return
+		forward, ok := node.forwards[to]
+		if !ok {
+			return "", false
 		}
-		from = forward.next
-		fromNode = nodes[from]
-		if ttl--; ttl < 0 {
-			hops = -1
-			return
+		if forward.next == "" {
+			return to, true
 		}
+		return forward.next, forward.hops >= 0
+	})
+	switch status {
+	case core.RouteBroken:
+		hops = 0
+	case core.RouteLoop:
+		hops = -1
 	}
+	return
 }
 
 type Loop struct {
@@ -74,6 +70,7 @@ type Result struct {
 	broken    int
 	success   int
 	totalHops int
+	diameter  int
 	bestTo    *Node
 	bestFrom  *Node
 	bestHops  int
@@ -96,18 +93,9 @@ func analyzeRoutes() (res *Result) {
 			if hops == -1 {
 				res.loops++
 				// analyze loop
-				num := len(route)
 				l := &Loop{from: from.self, to: to.self}
-			loop:
-				for i, hop := range route {
-					for j := i + 1; j < num; j++ {
-						if hop == route[j] {
-							l.head = route[:i]
-							l.cycle = route[i:j]
-							res.loopList = append(res.loopList, l)
-							break loop
-						}
-					}
+				if l.head, l.cycle = core.RouteCycle(route); l.cycle != nil {
+					res.loopList = append(res.loopList, l)
 				}
 			} else if hops == 0 {
 				res.broken++
@@ -123,6 +111,9 @@ func analyzeRoutes() (res *Result) {
 			} else {
 				res.totalHops += hops
 				res.success++
+				if hops > res.diameter {
+					res.diameter = hops
+				}
 			}
 		}
 	}
@@ -135,29 +126,11 @@ func analyzeLoops(res *Result) {
 		log.Printf("      -> %d loops found.", res.loops)
 		log.Println("  * finding distinct loops:")
 		routes := make([][]string, 0)
+		distinct := make(map[string]bool)
 		for _, l := range res.loopList {
-			cl := len(l.cycle)
-			found := false
-		search:
-			for _, e := range routes {
-				if cl == len(e) {
-					hop := l.cycle[0]
-					for k, hop2 := range e {
-						if hop2 == hop {
-							// check if rest is the same...
-							for q := 1; q < cl; q++ {
-								r := (q + k) % cl
-								if l.cycle[q] != e[r] {
-									continue search
-								}
-							}
-							found = true
-							break search
-						}
-					}
-				}
-			}
-			if !found {
+			key := strings.Join(core.CanonicalCycle(l.cycle), "-")
+			if !distinct[key] {
+				distinct[key] = true
 				routes = append(routes, l.cycle)
 			}
 		}
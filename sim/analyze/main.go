@@ -22,47 +22,16 @@ package main
 
 import (
 	"encoding/base32"
-	"encoding/binary"
+	"encoding/base64"
 	"flag"
 	"fmt"
 	"io"
-	"leatea/core"
 	"leatea/sim"
 	"log"
 	"math"
 	"os"
-	"sort"
 )
 
-// LogEntry is a representation of an entry in the log file
-type LogEntry struct {
-	// mandatory fields
-	Type uint32   // event type
-	TS   int64    // time stamp (event handler)
-	Seq  uint32   // sequence number (global)
-	Peer [32]byte // event sender
-
-	// EvForwardChanged, EvForwardLearned, EvNeighborAdded,
-	// EvNeighborExpired, EvNeighborUpdated, EvRelayRemoved
-	// EvTraffic
-	Ref [32]byte // reference peer
-
-	// EvForwardChanged, EvForwardLearned
-	Target   [32]byte
-	WithNext uint32
-	NextHop  [32]byte
-	Hops     uint32
-
-	// EvNodeTraffic
-	TraffIn  uint64
-	TraffOut uint64
-
-	// EvNodeAdded
-	Running  uint16
-	Pending  uint16
-	X, Y, R2 float64
-}
-
 // Forward in simplified form (no timing information)
 type Forward struct {
 	next string
@@ -72,8 +41,10 @@ type Forward struct {
 // Node in the ad-hoc network; reconstructed from log events
 type Node struct {
 	self     string
-	traffIn  uint64
-	traffOut uint64
+	peer     [32]byte    // full peer identifier
+	traffIn  uint64      // last reported traffic (in)
+	traffOut uint64      // last reported traffic (out)
+	traffic  [][2]uint64 // traffic samples (cumulative in/out)
 	forwards map[string]*Forward
 	idx      int
 	x, y, r2 float64
@@ -100,7 +71,9 @@ func (n *Node) SetForward(target, next string, hops int16) {
 
 // list of all nodes in the simulation
 var (
-	nodes = make(map[string]*Node)
+	nodes       = make(map[string]*Node)
+	loopDetects = 0 // number of detected loop constructions
+	violations  = 0 // number of failed sanity checks
 )
 
 // run application
@@ -110,166 +83,112 @@ func main() {
 
 	// parse arguments
 	var (
-		eventLog string
-		stats    string
+		eventLog    string
+		stats       string
+		statsFormat string
+		trafficDump string
+		streamed    bool
 	)
 	flag.StringVar(&eventLog, "i", "", "event log (binary)")
-	flag.StringVar(&stats, "s", "", "statistics output file (csv)")
+	flag.StringVar(&stats, "s", "", "statistics output file")
+	flag.StringVar(&statsFormat, "f", "csv", "statistics format (csv or json)")
+	flag.StringVar(&trafficDump, "d", "", "dump per-node traffic (CSV)")
+	flag.BoolVar(&streamed, "S", false, "streaming mode (replay entries as they arrive)")
 	flag.Parse()
 
-	// read event log
-	f, err := os.Open(eventLog)
+	// create statistics on demand
+	p := new(replay)
+	if len(stats) > 0 {
+		// create file
+		f, err := os.Create(stats)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		if p.sw, err = sim.NewStatsWriter(f, statsFormat); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// read event log and reconstruct forward tables of nodes step by step
+	f, err := sim.OpenLog(eventLog)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("%s: %s", eventLog, err.Error())
 	}
 	defer f.Close()
-	entries := make([]*LogEntry, 0)
-	flag := make([]byte, 1)
-	perf := 0
-	for k := 1; ; k++ {
-		// read mandatory fields
-		ev := new(LogEntry)
-		if err = binary.Read(f, binary.BigEndian, &ev.Type); err != nil {
-			if err == io.EOF {
-				log.Printf("%d log entries read.", k-1)
-				break
-			}
-			log.Fatal(err)
-		}
-		//log.Printf("type=%d", ev.Type)
-		_ = binary.Read(f, binary.BigEndian, &ev.TS)
-		_ = binary.Read(f, binary.BigEndian, &ev.Seq)
-		_, _ = f.Read(ev.Peer[:])
-		self := base32.StdEncoding.EncodeToString(ev.Peer[:5])[:8]
-		node, ok := nodes[self]
-		if !ok {
-			node = NewNode(self)
-			nodes[self] = node
+	var num, perf, gaps int
+	if streamed {
+		num, perf, gaps, err = stream(f, p)
+	} else {
+		num, perf, err = batch(f, p)
+	}
+	if err != nil {
+		log.Fatalf("%s: %s", eventLog, err.Error())
+	}
+	log.Printf("%d log entries read (%d traffic samples).", num, perf)
+	if gaps > 0 {
+		log.Printf("%d sequence numbers missing in log.", gaps)
+	}
+	for _, node := range nodes {
+		if len(node.traffic) == 0 {
+			log.Fatal("missing performance data")
 		}
-		// read additional fields depending on type
-		switch ev.Type {
-		case sim.EvNodeAdded:
-			var idx uint16
-			_ = binary.Read(f, binary.BigEndian, &ev.X)
-			_ = binary.Read(f, binary.BigEndian, &ev.Y)
-			_ = binary.Read(f, binary.BigEndian, &ev.R2)
-			_ = binary.Read(f, binary.BigEndian, &idx)
-			_ = binary.Read(f, binary.BigEndian, &ev.Running)
-			_ = binary.Read(f, binary.BigEndian, &ev.Pending)
-			node.idx = int(idx)
-			node.x = ev.X
-			node.y = ev.Y
-			node.r2 = ev.R2
+	}
+	info()
 
-		case sim.EvNodeRemoved:
-			_ = binary.Read(f, binary.BigEndian, &ev.Running)
-			_ = binary.Read(f, binary.BigEndian, &ev.Pending)
+	// dump traffic on demand
+	if len(trafficDump) > 0 {
+		if err = dumpTraffic(trafficDump); err != nil {
+			log.Fatalf("%s: %s", trafficDump, err.Error())
+		}
+	}
+}
 
-		case core.EvForwardChanged, core.EvForwardLearned:
-			_, _ = f.Read(ev.Ref[:])
-			_, _ = f.Read(ev.Target[:])
-			_, _ = f.Read(flag)
-			ev.WithNext = 0
-			if flag[0] == 1 {
-				ev.WithNext = 1
-				_, _ = f.Read(ev.NextHop[:])
+// read entries from an event log (after the header). Returns the list of
+// entries and the number of traffic samples.
+func readLog(r io.Reader) (entries []*sim.LogEntry, perf int, err error) {
+	entries = make([]*sim.LogEntry, 0)
+	for {
+		var ev *sim.LogEntry
+		if ev, err = readEntry(r); err != nil {
+			if err == io.EOF {
+				err = nil
 			}
-			var hops int16
-			_ = binary.Read(f, binary.BigEndian, &hops)
-
-		case sim.EvNodeTraffic:
-			_ = binary.Read(f, binary.BigEndian, &ev.TraffIn)
-			_ = binary.Read(f, binary.BigEndian, &ev.TraffOut)
+			return
+		}
+		if ev.Type == sim.EvNodeTraffic {
 			perf++
-
-		case core.EvNeighborAdded, core.EvNeighborExpired,
-			core.EvNeighborUpdated, core.EvRelayRemoved:
-			_, _ = f.Read(ev.Ref[:])
-
-		default:
-			log.Fatalf("unknown log entry type %d", ev.Type)
 		}
-		// append to list
 		entries = append(entries, ev)
 	}
-	// sort entries by sequence
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].Seq < entries[j].Seq
-	})
+}
 
-	// create statistics on demand
-	var csv *os.File
-	var start, epoch int64
-	if len(stats) > 0 {
-		// create file
-		if csv, err = os.Create(stats); err != nil {
-			log.Fatal(err)
-		}
-		defer csv.Close()
-		// write header
-		_, _ = csv.WriteString("Epoch,Loops,Broken,Success,NumPeers,Started,StopPending,MeanHops\n")
-		start = entries[0].TS
+// read the next entry from an event log (io.EOF at end of log). The node
+// sending the event is registered on first sight.
+func readEntry(r io.Reader) (ev *sim.LogEntry, err error) {
+	if ev, err = sim.ReadLogEntry(r); err != nil || ev.Type == sim.EvEpoch {
+		// no peer in epoch markers
+		return
 	}
-	// reconstruct forward tables of node step by step
-	running, started, pending := 0, 0, 0
-	for _, ev := range entries {
-		if csv != nil {
-			// check for new epoch
-			et := (ev.TS - start) / (1000000 * 5)
-			if et > epoch {
-				epoch = et
-				res := analyzeRoutes()
-				if csv != nil {
-					mean := 0.
-					if res.success > 0 {
-						mean = float64(res.totalHops) / float64(res.success)
-					}
-					line := fmt.Sprintf("%d,%d,%d,%d,%d,%d,%d,%.2f\n",
-						epoch, res.loops, res.broken, res.success, running, started, pending, mean)
-					_, _ = csv.WriteString(line)
-				}
-			}
-		}
-		// handle entry
-		self := base32.StdEncoding.EncodeToString(ev.Peer[:5])[:8]
-		node := nodes[self]
-		ref := base32.StdEncoding.EncodeToString(ev.Ref[:5])[:8]
-		switch ev.Type {
-		case sim.EvNodeAdded:
-			running = int(ev.Running)
-			pending = int(ev.Pending)
-			started++
-
-		case sim.EvNodeRemoved:
-			running = int(ev.Running)
-			pending = int(ev.Pending)
-
-		case core.EvForwardChanged, core.EvForwardLearned, core.EvShorterRoute, core.EvRelayRevived, core.EvNeighborRelayed:
-			next := ""
-			if ev.WithNext == 1 {
-				next = base32.StdEncoding.EncodeToString(ev.NextHop[:5])[:8]
-			}
-			tgt := base32.StdEncoding.EncodeToString(ev.Target[:5])[:8]
-			node.SetForward(tgt, next, int16(ev.Hops))
-
-		case sim.EvNodeTraffic:
-			node.traffIn = ev.TraffIn
-			node.traffOut = ev.TraffOut
-
-		case core.EvNeighborAdded, core.EvNeighborUpdated:
-			node.SetForward(ref, "", 0)
-
-		case core.EvNeighborExpired, core.EvRelayRemoved:
-			node.SetForward(ref, "", -2)
-			delete(nodes, ref)
-		default:
-			log.Fatalf("unhandled log entry type %d", ev.Type)
-		}
+	self := base32.StdEncoding.EncodeToString(ev.Peer[:5])[:8]
+	node, ok := nodes[self]
+	if !ok {
+		node = NewNode(self)
+		node.peer = ev.Peer
+		nodes[self] = node
+	} else if node.peer != ev.Peer {
+		// different peers with the same short identifier
+		return nil, fmt.Errorf("short id collision: %s / %s",
+			base64.StdEncoding.EncodeToString(node.peer[:]),
+			base64.StdEncoding.EncodeToString(ev.Peer[:]))
 	}
-	if perf != len(nodes) {
-		log.Fatal("missing performance data")
+	if ev.Type == sim.EvNodeAdded || ev.Type == sim.EvNodeRemoved {
+		// node position (last known position on removal)
+		node.idx = int(ev.Idx)
+		node.x = ev.X
+		node.y = ev.Y
+		node.r2 = ev.R2
 	}
-	info()
+	return ev, nil
 }
 
 func info() {
@@ -309,6 +228,20 @@ func info() {
 		sim.Scale(mIn), sim.Scale(dIn),
 		sim.Scale(mOut), sim.Scale(dOut))
 
+	// traffic distribution (reveals hotspots)
+	in := make([]uint64, 0, len(nodes))
+	out := make([]uint64, 0, len(nodes))
+	for _, node := range nodes {
+		in = append(in, node.traffIn)
+		out = append(out, node.traffOut)
+	}
+	log.Printf("Traffic distribution in:  %s", percentiles(in))
+	log.Printf("Traffic distribution out: %s", percentiles(out))
+	for k, s := range trafficSeries() {
+		log.Printf("  * Traffic at epoch %d: %s in, %s out",
+			k+1, sim.Scale(float64(s[0])), sim.Scale(float64(s[1])))
+	}
+
 	// run analysis
 	log.Printf("Analyzing routes between %d peers:", len(nodes))
 	res := analyzeRoutes()
@@ -320,8 +253,12 @@ func info() {
 		perc := func(n int) float64 {
 			return float64(100*n) / total
 		}
-		log.Printf("  * Loops: %d (%.2f%%)", res.loops, perc(res.loops))
+		log.Printf("  * Loops: %d (%.2f%%, %d constructions detected)",
+			res.loops, perc(res.loops), loopDetects)
 		log.Printf("  * Broken: %d (%.2f%%)", res.broken, perc(res.broken))
+		if violations > 0 {
+			log.Printf("  * Sanity violations: %d", violations)
+		}
 		log.Printf("  * Success: %d (%.2f%%)", res.success, perc(res.success))
 		if res.success > 0 {
 			mean := float64(res.totalHops) / float64(res.success)
@@ -0,0 +1,140 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package main
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/binary"
+	"leatea/core"
+	"leatea/sim"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadCompressedLog(t *testing.T) {
+	// write a handful of events to a compressed log
+	fn := filepath.Join(t.TempDir(), "events.log.gz")
+	w, err := sim.CreateLog(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers := make([]*core.PeerID, 3)
+	for i := range peers {
+		peers[i] = core.NewPeerPrivate().Public()
+	}
+	for i := 1; i < len(peers); i++ {
+		_ = binary.Write(w, binary.BigEndian, uint32(core.EvNeighborAdded))
+		_ = binary.Write(w, binary.BigEndian, int64(1000*i))
+		_ = binary.Write(w, binary.BigEndian, uint32(i))
+		_, _ = w.Write(peers[0].Data)
+		_, _ = w.Write(peers[i].Data)
+	}
+	_ = binary.Write(w, binary.BigEndian, uint32(sim.EvNodeTraffic))
+	_ = binary.Write(w, binary.BigEndian, int64(5000))
+	_ = binary.Write(w, binary.BigEndian, uint32(3))
+	_, _ = w.Write(peers[0].Data)
+	_ = binary.Write(w, binary.BigEndian, uint64(123))
+	_ = binary.Write(w, binary.BigEndian, uint64(456))
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// read log back
+	r, err := sim.OpenLog(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	entries, perf, err := readLog(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || perf != 1 {
+		t.Fatalf("got %d entries, %d with performance data", len(entries), perf)
+	}
+	for i, ev := range entries[:2] {
+		if ev.Type != core.EvNeighborAdded || ev.Seq != uint32(i+1) ||
+			string(ev.Ref[:]) != string(peers[i+1].Data) {
+			t.Fatalf("invalid entry #%d: %v", i, ev)
+		}
+	}
+	if ev := entries[2]; ev.TraffIn != 123 || ev.TraffOut != 456 {
+		t.Fatalf("invalid traffic entry: %v", ev)
+	}
+}
+
+func TestShortIDCollision(t *testing.T) {
+	nodes = make(map[string]*Node)
+	defer func() { nodes = make(map[string]*Node) }()
+
+	// two peers with the same short identifier (first 5 bytes)
+	p1 := core.NewPeerPrivate().Public().Bytes()
+	p2 := core.Clone(p1)
+	p2[31] ^= 0x01
+	buf := new(bytes.Buffer)
+	for i, p := range [][]byte{p1, p2} {
+		buf.Write(record(sim.EvNodeRemoved, int64(1000*i), uint32(i), p,
+			0., 0., 0., uint16(i), uint16(0), uint16(0)))
+	}
+	entries, _, err := readLog(buf)
+	if err == nil || !strings.Contains(err.Error(), "collision") {
+		t.Fatalf("collision not detected: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("%d entries read", len(entries))
+	}
+}
+
+func TestNodeRemovedPosition(t *testing.T) {
+	nodes = make(map[string]*Node)
+	defer func() { nodes = make(map[string]*Node) }()
+
+	// node A is added and removed after moving; node B only appears in
+	// removal context (added before logging started).
+	a := core.NewPeerPrivate().Public().Bytes()
+	b := core.NewPeerPrivate().Public().Bytes()
+	buf := new(bytes.Buffer)
+	buf.Write(record(sim.EvNodeAdded, 1000, 1, a, 10., 20., 900., uint16(1), uint16(2), uint16(0)))
+	buf.Write(record(sim.EvNodeRemoved, 2000, 2, a, 15., 25., 900., uint16(1), uint16(1), uint16(0)))
+	buf.Write(record(sim.EvNodeRemoved, 3000, 3, b, 50., 60., 400., uint16(2), uint16(0), uint16(0)))
+	entries, _, err := readLog(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[2].Running != 0 || entries[1].Running != 1 {
+		t.Fatalf("invalid entries: %d", len(entries))
+	}
+	for _, tc := range []struct {
+		peer     []byte
+		idx      int
+		x, y, r2 float64
+	}{
+		{a, 1, 15, 25, 900},
+		{b, 2, 50, 60, 400},
+	} {
+		self := base32.StdEncoding.EncodeToString(tc.peer[:5])[:8]
+		node := nodes[self]
+		if node == nil || node.idx != tc.idx || node.x != tc.x || node.y != tc.y || node.r2 != tc.r2 {
+			t.Fatalf("node %d: wrong position %v", tc.idx, node)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package main
+
+import (
+	"container/heap"
+	"encoding/base32"
+	"io"
+	"leatea/core"
+	"leatea/sim"
+	"log"
+	"sort"
+)
+
+// ----------------------------------------------------------------------
+// Replay log entries: reconstruct forward tables of nodes
+// ----------------------------------------------------------------------
+
+// replay reconstructs the forward tables of nodes from log entries (in
+// sequence order) and writes statistics at epoch markers on demand.
+type replay struct {
+	sw      *sim.StatsWriter // statistics writer (nil = no statistics)
+	num     int              // number of handled entries
+	running int              // number of running nodes
+	started int              // number of started nodes
+	pending int              // number of nodes pending removal
+}
+
+// handle a log entry
+func (p *replay) handle(ev *sim.LogEntry) {
+	p.num++
+	if ev.Type == sim.EvEpoch {
+		p.epoch(int(ev.Epoch))
+		return
+	}
+	// handle entry
+	self := base32.StdEncoding.EncodeToString(ev.Peer[:5])[:8]
+	node := nodes[self]
+	ref := base32.StdEncoding.EncodeToString(ev.Ref[:5])[:8]
+	switch ev.Type {
+	case sim.EvNodeAdded:
+		p.running = int(ev.Running)
+		p.pending = int(ev.Pending)
+		p.started++
+
+	case sim.EvNodeRemoved:
+		p.running = int(ev.Running)
+		p.pending = int(ev.Pending)
+
+	case core.EvForwardChanged, core.EvForwardLearned, core.EvShorterRoute, core.EvRelayRevived, core.EvNeighborRelayed:
+		next := ""
+		if ev.WithNext == 1 {
+			next = base32.StdEncoding.EncodeToString(ev.NextHop[:5])[:8]
+		}
+		tgt := base32.StdEncoding.EncodeToString(ev.Target[:5])[:8]
+		node.SetForward(tgt, next, int16(ev.Hops))
+
+	case sim.EvNodeTraffic:
+		node.traffIn = ev.TraffIn
+		node.traffOut = ev.TraffOut
+		node.traffic = append(node.traffic, [2]uint64{ev.TraffIn, ev.TraffOut})
+
+	case core.EvNeighborAdded, core.EvNeighborUpdated:
+		node.SetForward(ref, "", 0)
+
+	case core.EvNeighborExpired, core.EvRelayRemoved:
+		node.SetForward(ref, "", -2)
+		delete(nodes, ref)
+
+	case core.EvLoopDetect:
+		loopDetects++
+	case core.EvSanityViolation:
+		violations++
+	default:
+		log.Fatalf("unhandled log entry type %d", ev.Type)
+	}
+}
+
+// epoch boundary: write statistics of the current forward tables
+func (p *replay) epoch(epoch int) {
+	if p.sw == nil {
+		return
+	}
+	res := analyzeRoutes()
+	mean := 0.
+	if res.success > 0 {
+		mean = float64(res.totalHops) / float64(res.success)
+	}
+	_ = p.sw.Write(&sim.EpochStats{
+		Epoch:       epoch,
+		Loops:       res.loops,
+		Broken:      res.broken,
+		Success:     res.success,
+		NumPeers:    p.running,
+		Started:     p.started,
+		StopPending: p.pending,
+		MeanHops:    mean,
+		Diameter:    res.diameter,
+	})
+}
+
+// batch reads all entries of an event log, sorts them by sequence and
+// replays them. Returns the number of entries and traffic samples.
+func batch(r io.Reader, p *replay) (num, perf int, err error) {
+	var entries []*sim.LogEntry
+	if entries, perf, err = readLog(r); err != nil {
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Seq < entries[j].Seq
+	})
+	for _, ev := range entries {
+		p.handle(ev)
+	}
+	return len(entries), perf, nil
+}
+
+// ----------------------------------------------------------------------
+// Streaming mode: entries are replayed in arrival order; only a small
+// window of entries is buffered to repair interleaved logging.
+// ----------------------------------------------------------------------
+
+// number of entries buffered to restore sequence order
+var reorderWindow = 64
+
+// seqHeap is a min-heap of log entries ordered by sequence number
+type seqHeap []*sim.LogEntry
+
+func (h seqHeap) Len() int           { return len(h) }
+func (h seqHeap) Less(i, j int) bool { return h[i].Seq < h[j].Seq }
+func (h seqHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *seqHeap) Push(x any)        { *h = append(*h, x.(*sim.LogEntry)) }
+func (h *seqHeap) Pop() any {
+	old := *h
+	n := len(old)
+	ev := old[n-1]
+	*h = old[:n-1]
+	return ev
+}
+
+// stream replays entries of an event log as they arrive. Disorder within
+// the reorder window is repaired; entries arriving later are replayed out
+// of order (with a warning). Returns the number of entries, traffic
+// samples and missing sequence numbers.
+func stream(r io.Reader, p *replay) (num, perf, gaps int, err error) {
+	buf := make(seqHeap, 0, reorderWindow+1)
+	var next uint32 // next expected sequence number
+	emit := func(ev *sim.LogEntry) {
+		switch {
+		case p.num == 0:
+		case ev.Seq < next:
+			log.Printf("warning: entry #%d out of order (beyond reorder window)", ev.Seq)
+			gaps--
+		case ev.Seq > next:
+			gaps += int(ev.Seq - next)
+		}
+		if p.num == 0 || ev.Seq >= next {
+			next = ev.Seq + 1
+		}
+		p.handle(ev)
+	}
+	for {
+		var ev *sim.LogEntry
+		if ev, err = readEntry(r); err != nil {
+			break
+		}
+		num++
+		if ev.Type == sim.EvNodeTraffic {
+			perf++
+		}
+		heap.Push(&buf, ev)
+		if buf.Len() > reorderWindow {
+			emit(heap.Pop(&buf).(*sim.LogEntry))
+		}
+	}
+	for buf.Len() > 0 {
+		emit(heap.Pop(&buf).(*sim.LogEntry))
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return
+}
@@ -0,0 +1,210 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"leatea/core"
+	"leatea/sim"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// encode a log record (fields are written in binary or as raw bytes)
+func record(typ uint32, ts int64, seq uint32, peer []byte, fields ...any) []byte {
+	buf := new(bytes.Buffer)
+	_ = binary.Write(buf, binary.BigEndian, typ)
+	_ = binary.Write(buf, binary.BigEndian, ts)
+	_ = binary.Write(buf, binary.BigEndian, seq)
+	buf.Write(peer)
+	for _, f := range fields {
+		if b, ok := f.([]byte); ok {
+			buf.Write(b)
+		} else {
+			_ = binary.Write(buf, binary.BigEndian, f)
+		}
+	}
+	return buf.Bytes()
+}
+
+// synthetic event log (without header) of nodes learning random forwards
+// over a number of epochs. Entries are logged with local disorder (as
+// concurrent event handlers do); some sequence numbers are skipped.
+func synthLog(numNodes, epochs int) (log []byte, skipped int) {
+	rnd := rand.New(rand.NewSource(4711)) //nolint:gosec // deterministic testing
+	peers := make([][]byte, numNodes)
+	for i := range peers {
+		peers[i] = core.NewPeerPrivate().Public().Bytes()
+	}
+	var (
+		entries [][]byte
+		seq     uint32
+		ts      int64
+	)
+	entry := func(typ uint32, peer []byte, fields ...any) {
+		seq++
+		if rnd.Intn(100) == 0 {
+			seq++
+			skipped++
+		}
+		ts += 1000
+		entries = append(entries, record(typ, ts, seq, peer, fields...))
+	}
+	for i, p := range peers {
+		entry(sim.EvNodeAdded, p, 0., 0., 1., uint16(i+1), uint16(i+1), uint16(0))
+	}
+	for epoch := 0; epoch < epochs; epoch++ {
+		for i, p := range peers {
+			for k := 0; k < 20; k++ {
+				tgt := peers[rnd.Intn(numNodes)]
+				if rnd.Intn(4) == 0 {
+					entry(core.EvNeighborAdded, p, tgt)
+					continue
+				}
+				next := peers[rnd.Intn(numNodes)]
+				entry(core.EvForwardLearned, p, p, tgt, []byte{1}, next, int16(rnd.Intn(5)))
+			}
+			entry(sim.EvNodeTraffic, p, uint64(100*epoch+i), uint64(50*epoch+i))
+		}
+		entry(sim.EvEpoch, make([]byte, 32), uint32(epoch+1))
+	}
+	// local disorder: shuffle blocks of entries
+	for i := 0; i < len(entries); i += 16 {
+		end := i + 16
+		if end > len(entries) {
+			end = len(entries)
+		}
+		blk := entries[i:end]
+		rnd.Shuffle(len(blk), func(j, k int) { blk[j], blk[k] = blk[k], blk[j] })
+	}
+	return bytes.Join(entries, nil), skipped
+}
+
+// result of a replay (final statistics)
+type replayResult struct {
+	stats                     string
+	loops, broken, success    int
+	totalHops, diameter, perf int
+	traffic                   [][2]uint64
+}
+
+// replay a log in batch or streaming mode
+func runReplay(t *testing.T, data []byte, streamed bool) (res *replayResult, gaps int) {
+	nodes = make(map[string]*Node)
+	loopDetects, violations = 0, 0
+	out := new(bytes.Buffer)
+	sw, err := sim.NewStatsWriter(out, "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &replay{sw: sw}
+	res = new(replayResult)
+	if streamed {
+		_, res.perf, gaps, err = stream(bytes.NewReader(data), p)
+	} else {
+		_, res.perf, err = batch(bytes.NewReader(data), p)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := analyzeRoutes()
+	res.stats = out.String()
+	res.loops, res.broken, res.success = r.loops, r.broken, r.success
+	res.totalHops, res.diameter = r.totalHops, r.diameter
+	res.traffic = trafficSeries()
+	return
+}
+
+func TestStreamReplay(t *testing.T) {
+	defer func() { nodes = make(map[string]*Node) }()
+
+	data, skipped := synthLog(40, 50)
+	res1, _ := runReplay(t, data, false)
+	res2, gaps := runReplay(t, data, true)
+	if res1.perf != 40*50 || len(res1.traffic) != 50 {
+		t.Fatalf("%d traffic samples, %d epochs", res1.perf, len(res1.traffic))
+	}
+	if rows := strings.Count(res1.stats, "\n"); rows != 50+1 {
+		t.Fatalf("%d lines of statistics", rows)
+	}
+	if !reflect.DeepEqual(res1, res2) {
+		t.Fatalf("results differ:\n%+v\n%+v", res1, res2)
+	}
+	if gaps != skipped {
+		t.Fatalf("%d gaps detected (%d skipped)", gaps, skipped)
+	}
+}
+
+func TestEpochMarkers(t *testing.T) {
+	defer func() { nodes = make(map[string]*Node) }()
+
+	// three nodes in a line (A - B - C) learn one route per epoch; epochs
+	// last 2 seconds (instead of the former fixed 5 seconds).
+	peers := make([][]byte, 3)
+	for i := range peers {
+		peers[i] = core.NewPeerPrivate().Public().Bytes()
+	}
+	a, b, c := peers[0], peers[1], peers[2]
+	var (
+		data []byte
+		seq  uint32
+	)
+	add := func(epoch int, typ uint32, peer []byte, fields ...any) {
+		seq++
+		ts := int64(epoch)*2000000 + int64(seq)
+		data = append(data, record(typ, ts, seq, peer, fields...)...)
+	}
+	for i, p := range peers {
+		add(0, sim.EvNodeAdded, p, 0., 0., 1., uint16(i+1), uint16(i+1), uint16(0))
+	}
+	steps := [][]any{
+		{a, b},                            // epoch 1: A -> B
+		{b, a},                            // epoch 2: B -> A
+		{b, c},                            // epoch 3: B -> C
+		{c, b},                            // epoch 4: C -> B
+		{a, a, c, []byte{1}, b, int16(1)}, // epoch 5: A -> C via B
+	}
+	for i, step := range steps {
+		typ := uint32(core.EvNeighborAdded)
+		if len(step) > 2 {
+			typ = core.EvForwardLearned
+		}
+		add(i, typ, step[0].([]byte), step[1:]...)
+		add(i+1, sim.EvEpoch, make([]byte, 32), uint32(i+1))
+	}
+	res, _ := runReplay(t, data, false)
+
+	// one row per marker: successful routes grow by one in each epoch
+	lines := strings.Split(strings.TrimSpace(res.stats), "\n")[1:]
+	if len(lines) != len(steps) {
+		t.Fatalf("%d rows of statistics:\n%s", len(lines), res.stats)
+	}
+	for i, line := range lines {
+		fields := strings.Split(line, ",")
+		if fields[0] != strconv.Itoa(i+1) || fields[3] != strconv.Itoa(i+1) {
+			t.Fatalf("row %d: %s", i+1, line)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package main
+
+import (
+	"encoding/csv"
+	"leatea/sim"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// ----------------------------------------------------------------------
+// Traffic distribution across nodes
+// ----------------------------------------------------------------------
+
+// Percentiles of a distribution of traffic values
+type Percentiles struct {
+	Min, P50, P90, P99, Max uint64
+}
+
+// String returns a human-readable representation
+func (p *Percentiles) String() string {
+	s := func(v uint64) string { return sim.Scale(float64(v)) }
+	return "min=" + s(p.Min) + ", p50=" + s(p.P50) + ", p90=" + s(p.P90) +
+		", p99=" + s(p.P99) + ", max=" + s(p.Max)
+}
+
+// compute percentiles (nearest-rank method) of a list of values
+func percentiles(vals []uint64) *Percentiles {
+	p := new(Percentiles)
+	n := len(vals)
+	if n == 0 {
+		return p
+	}
+	list := make([]uint64, n)
+	copy(list, vals)
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	rank := func(perc float64) uint64 {
+		r := int(math.Ceil(perc / 100 * float64(n)))
+		if r < 1 {
+			r = 1
+		}
+		return list[r-1]
+	}
+	p.Min, p.Max = list[0], list[n-1]
+	p.P50, p.P90, p.P99 = rank(50), rank(90), rank(99)
+	return p
+}
+
+// trafficSeries returns the total traffic (in/out) over all nodes for each
+// round of samples; nodes report traffic at each epoch boundary, so the
+// k.th sample of a node belongs to the k.th epoch. Nodes that stopped
+// early contribute their last sample to later rounds.
+func trafficSeries() (series [][2]uint64) {
+	rounds := 0
+	for _, node := range nodes {
+		if n := len(node.traffic); n > rounds {
+			rounds = n
+		}
+	}
+	series = make([][2]uint64, rounds)
+	for _, node := range nodes {
+		if len(node.traffic) == 0 {
+			continue
+		}
+		for k := range series {
+			s := node.traffic[len(node.traffic)-1]
+			if k < len(node.traffic) {
+				s = node.traffic[k]
+			}
+			series[k][0] += s[0]
+			series[k][1] += s[1]
+		}
+	}
+	return
+}
+
+// get list of nodes sorted by index
+func sortedNodes() []*Node {
+	list := make([]*Node, 0, len(nodes))
+	for _, node := range nodes {
+		list = append(list, node)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].idx < list[j].idx })
+	return list
+}
+
+// dump per-node traffic to a CSV file
+func dumpTraffic(fn string) error {
+	f, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	wrt := csv.NewWriter(f)
+	_ = wrt.Write([]string{"node", "idx", "in", "out"})
+	for _, node := range sortedNodes() {
+		_ = wrt.Write([]string{
+			node.self,
+			strconv.Itoa(node.idx),
+			strconv.FormatUint(node.traffIn, 10),
+			strconv.FormatUint(node.traffOut, 10),
+		})
+	}
+	wrt.Flush()
+	return wrt.Error()
+}
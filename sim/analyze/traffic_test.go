@@ -0,0 +1,65 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package main
+
+import "testing"
+
+func TestPercentiles(t *testing.T) {
+	// values 1..100 (reverse order)
+	vals := make([]uint64, 100)
+	for i := range vals {
+		vals[i] = uint64(100 - i)
+	}
+	p := percentiles(vals)
+	if *p != (Percentiles{Min: 1, P50: 50, P90: 90, P99: 99, Max: 100}) {
+		t.Fatalf("wrong percentiles: %s", p)
+	}
+	if vals[0] != 100 {
+		t.Fatal("input modified")
+	}
+	// a single hotspot in a uniform distribution
+	vals = []uint64{10, 10, 10, 10, 10, 10, 10, 10, 10, 1000}
+	p = percentiles(vals)
+	if p.P50 != 10 || p.P90 != 10 || p.P99 != 1000 || p.Max != 1000 {
+		t.Fatalf("wrong percentiles: %s", p)
+	}
+	// empty list
+	if p = percentiles(nil); *p != (Percentiles{}) {
+		t.Fatalf("wrong percentiles: %s", p)
+	}
+}
+
+func TestTrafficSeries(t *testing.T) {
+	defer func(list map[string]*Node) { nodes = list }(nodes)
+	nodes = map[string]*Node{
+		"A": {traffic: [][2]uint64{{10, 1}, {20, 2}, {30, 3}}},
+		"B": {traffic: [][2]uint64{{5, 5}}},
+	}
+	series := trafficSeries()
+	if len(series) != 3 {
+		t.Fatalf("%d epochs in series", len(series))
+	}
+	for k, s := range [][2]uint64{{15, 6}, {25, 7}, {35, 8}} {
+		if series[k] != s {
+			t.Fatalf("epoch %d: %v", k+1, series[k])
+		}
+	}
+}
@@ -0,0 +1,99 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"leatea/core"
+)
+
+//----------------------------------------------------------------------
+// Headless benchmark: a single-stepped simulation without canvas and
+// without wall-clock tickers that runs until the network converged.
+//----------------------------------------------------------------------
+
+// maxBenchEpochs limits a benchmark run if Options.StopAt is not set.
+const maxBenchEpochs = 200
+
+// Report of a benchmark run
+type Report struct {
+	NumNodes  int     // number of running nodes
+	Epochs    int     // number of simulated epochs
+	Converged int     // epoch of convergence (0 = not converged)
+	Messages  int     // total number of delivered broadcasts
+	MeanHops  float64 // mean number of hops on successful routes
+	PeakTable int     // size of the largest forward table during the run
+}
+
+// Benchmark runs a single-stepped simulation with the given configuration
+// until the network converged (or Options.StopAt epochs are reached).
+// The configuration is used as the global configuration during the run.
+// An unknown environment class falls back to random placement.
+func Benchmark(cfg *Config) (rep Report) {
+	prev := Cfg
+	Cfg = cfg
+	core.SetConfiguration(cfg.Core)
+	defer func() {
+		Cfg = prev
+		core.SetConfiguration(prev.Core)
+	}()
+	SetSeed(cfg.Env.Seed)
+
+	env := BuildEnvironment(cfg.Env)
+	if env == nil {
+		env = new(RndModel)
+	}
+	netw := NewNetwork(env, cfg.Env.NumNodes)
+	netw.RunStepped(nil)
+	defer netw.Stop()
+
+	limit := cfg.Options.StopAt
+	if limit <= 0 {
+		limit = maxBenchEpochs
+	}
+	var success, hops int
+	for {
+		epoch, msg := netw.Step()
+		if msg != nil {
+			rep.Messages++
+			continue
+		}
+		if epoch == 0 {
+			break
+		}
+		// evaluate the previous epoch
+		if epoch > 1 {
+			rep.Epochs = epoch - 1
+			_, _, success, hops = netw.RoutingTable().Status()
+			if _, size := netw.LargestTable(); size > rep.PeakTable {
+				rep.PeakTable = size
+			}
+			if conv, _ := netw.Converge(rep.Epochs, success); conv > 0 || epoch > limit {
+				rep.Converged = conv
+				break
+			}
+		}
+	}
+	rep.NumNodes, _, _, _ = netw.Stats()
+	if success > 0 {
+		rep.MeanHops = float64(hops) / float64(success)
+	}
+	return
+}
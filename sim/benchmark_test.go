@@ -0,0 +1,72 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// benchmark configuration: random network with constant node density
+func benchConfig(numNodes int) *Config {
+	cfg := defaultConfig()
+	cfg.Env.Class = "rand"
+	cfg.Env.NumNodes = numNodes
+	cfg.Env.Width = 100 * math.Sqrt(float64(numNodes)/60)
+	cfg.Env.Height = cfg.Env.Width
+	cfg.Node.Reach2 = 800
+	cfg.Options.EpochStatus = false
+	return cfg
+}
+
+func TestBenchmark(t *testing.T) {
+	rep := Benchmark(benchConfig(20))
+	t.Logf("%+v", rep)
+	if rep.Converged == 0 || rep.Converged != rep.Epochs {
+		t.Fatalf("not converged: %+v", rep)
+	}
+	if rep.NumNodes != 20 || rep.Messages == 0 || rep.MeanHops < 1 {
+		t.Fatalf("invalid report: %+v", rep)
+	}
+	if rep.PeakTable == 0 || rep.PeakTable > 19 {
+		t.Fatalf("invalid peak table size: %+v", rep)
+	}
+	// global configuration is restored
+	if Cfg.Env.NumNodes == 20 {
+		t.Fatal("configuration not restored")
+	}
+}
+
+func BenchmarkScaling(b *testing.B) {
+	for _, num := range []int{50, 100, 200} {
+		b.Run(fmt.Sprintf("nodes=%d", num), func(b *testing.B) {
+			var rep Report
+			for i := 0; i < b.N; i++ {
+				rep = Benchmark(benchConfig(num))
+			}
+			b.ReportMetric(float64(rep.Converged), "epochs")
+			b.ReportMetric(float64(rep.Messages), "msgs")
+			b.ReportMetric(rep.MeanHops, "hops")
+			b.ReportMetric(float64(rep.PeakTable), "table")
+		})
+	}
+}
@@ -22,7 +22,6 @@ package sim
 
 import (
 	"bytes"
-	_ "embed"
 	"fmt"
 	"image/color"
 	"math"
@@ -42,6 +41,16 @@ var (
 	ClrGreen = &color.RGBA{0, 255, 0, 0}
 )
 
+// HopColor returns a color for a hop distance on a gradient from green
+// (near) to red (far).
+func HopColor(hops, maxHops int) *color.RGBA {
+	f := 0.
+	if maxHops > 0 {
+		f = math.Min(float64(hops)/float64(maxHops), 1)
+	}
+	return &color.RGBA{uint8(255 * f), uint8(255 * (1 - f)), 0, 0}
+}
+
 // Canvas for drawing the network diagram and environment
 type Canvas interface {
 	// Open a canvas (prepare resources)
@@ -76,7 +85,8 @@ func GetCanvas(cfg *RenderCfg) (c Canvas) {
 	case "svg":
 		c = NewSVGCanvas(Cfg.Render.File, Cfg.Env.Width, Cfg.Env.Height, math.Sqrt(Cfg.Node.Reach2))
 	case "sdl":
-		//c = NewSDLCanvas(Cfg.Env.Width, Cfg.Env.Height, math.Sqrt(Cfg.Node.Reach2))
+		// only available if built with tag 'sdl'
+		c = NewSDLCanvas(Cfg.Env.Width, Cfg.Env.Height, math.Sqrt(Cfg.Node.Reach2))
 	}
 	return
 }
@@ -177,175 +187,3 @@ func (c *SVGCanvas) Close() (err error) {
 	c.buf = nil
 	return
 }
-
-/*
-//----------------------------------------------------------------------
-// SDL canvas
-//----------------------------------------------------------------------
-
-//go:embed ankacoder.ttf
-var font []byte
-
-// SDLCanvas for windowed display
-type SDLCanvas struct {
-	w, h, off         float64 // model size and margin
-	scale, offX, offY float64 // active scale and margin
-	cw, ch            int     // current canvas size
-	dirty             bool    // need to redraw canvas
-	win               *sdlcanvas.Window
-	cv                *canvas.Canvas
-}
-
-// NewSDLCanvas creates a new SDL canvas for display
-func NewSDLCanvas(w, h, off float64) *SDLCanvas {
-	c := new(SDLCanvas)
-	c.w, c.h, c.off = w, h, off
-	c.cw, c.ch = 0, 0
-	return c
-}
-
-// Open a canvas (prepare resources)
-func (c *SDLCanvas) Open() (err error) {
-	// create window
-	c.win, c.cv, err = sdlcanvas.CreateWindow(Cfg.Render.Width, Cfg.Render.Height, "LEArn/TEAch routing")
-	// load font
-	_, _ = c.cv.LoadFont(font)
-	return
-}
-
-// Start camvas (clear screen)
-func (c *SDLCanvas) Start() {
-	// clear screen
-	c.cv.SetFillStyle("#FFF")
-	c.cv.FillRect(0, 0, float64(c.cw), float64(c.ch))
-}
-
-// IsDynamic returns true if the canvas can draw a
-// sequence of renderings (like UI or video canvases)
-func (c *SDLCanvas) IsDynamic() bool {
-	return Cfg.Render.Dynamic
-}
-
-// Start the canvas (new rendering begins)
-func (c *SDLCanvas) Render(proc func(Canvas, bool)) {
-	// define UI actions
-	c.win.KeyDown = func(scancode int, rn rune, name string) {
-		centerX := (float64(c.cw)/2 - c.offX) / c.scale
-		centerY := (float64(c.ch)/2 - c.offY) / c.scale
-		rescaled := false
-		switch name {
-		case "NumpadSubtract":
-			// zoom out
-			c.scale = c.scale / 1.5
-			rescaled = true
-		case "NumpadAdd":
-			// zoom in
-			c.scale = c.scale * 1.5
-			rescaled = true
-		case "ArrowUp":
-			// pan up
-			c.offY += 0.1 * float64(c.ch)
-		case "ArrowDown":
-			// pan down
-			c.offY -= 0.1 * float64(c.ch)
-		case "ArrowLeft":
-			// pan left
-			c.offX += 0.1 * float64(c.cw)
-		case "ArrowRight":
-			// pan right
-			c.offX -= 0.1 * float64(c.cw)
-		case "NumpadEnter":
-			// reset zoom
-			c.ch, c.cw = 0, 0
-		default:
-			return
-		}
-		if rescaled {
-			c.offX = float64(c.cw)/2 - centerX*c.scale
-			c.offY = float64(c.ch)/2 - centerY*c.scale
-		}
-		c.dirty = true
-	}
-	// run frame handler
-	c.win.MainLoop(func() {
-		// compute best scale
-		resized := false
-		w, h := c.cv.Width(), c.cv.Height()
-		if w != c.cw || h != c.ch {
-			c.cw = w
-			c.ch = h
-			sw := float64(w) / (c.w + 2*c.off)
-			sh := float64(h) / (c.h + 2*c.off)
-			if sw > sh {
-				c.scale = sh
-				c.offX = (float64(w) - c.w*sh) / 2
-				c.offY = c.off * sh
-			} else {
-				c.scale = sw
-				c.offX = c.off * sw
-				c.offY = (float64(h) - c.h*sh) / 2
-			}
-			resized = true
-		}
-		// draw elements
-		proc(c, resized || c.dirty)
-	})
-}
-
-// Circle primitive
-func (c *SDLCanvas) Circle(x, y, r, w float64, clrBorder, clrFill *color.RGBA) {
-	cx, cy := c.xlate(x, y)
-	cr := c.scale * r
-	cw := c.scale * w
-	if clrFill != nil {
-		c.cv.SetFillStyle(clrFill.R, clrFill.G, clrFill.B)
-		c.cv.BeginPath()
-		c.cv.Arc(cx, cy, cr, 0, math.Pi*2, false)
-		c.cv.ClosePath()
-		c.cv.Fill()
-	}
-	if clrBorder != nil {
-		c.cv.SetStrokeStyle(clrBorder.R, clrBorder.G, clrBorder.B)
-		c.cv.SetLineWidth(cw)
-		c.cv.BeginPath()
-		c.cv.Arc(cx, cy, cr, 0, math.Pi*2, false)
-		c.cv.ClosePath()
-		c.cv.Stroke()
-	}
-}
-
-// Text primitive
-func (c *SDLCanvas) Text(x, y, fs float64, s string) {
-	cx, cy := c.xlate(x, y)
-	cfs := c.scale * fs
-	c.cv.SetFillStyle(0, 0, 0)
-	c.cv.SetTextAlign(canvas.Center)
-	c.cv.SetTextBaseline(canvas.Middle)
-	c.cv.SetFont(nil, cfs)
-	c.cv.FillText(s, cx, cy)
-}
-
-// Line primitive
-func (c *SDLCanvas) Line(x1, y1, x2, y2, w float64, clr *color.RGBA) {
-	cx1, cy1 := c.xlate(x1, y1)
-	cx2, cy2 := c.xlate(x2, y2)
-	cw := c.scale * w
-	c.cv.SetStrokeStyle(clr.R, clr.G, clr.B)
-	c.cv.SetLineWidth(cw)
-	c.cv.BeginPath()
-	c.cv.MoveTo(cx1, cy1)
-	c.cv.LineTo(cx2, cy2)
-	c.cv.ClosePath()
-	c.cv.Stroke()
-}
-
-// coordinate translation
-func (c *SDLCanvas) xlate(x, y float64) (float64, float64) {
-	return x*c.scale + c.offX, y*c.scale + c.offY
-}
-
-// Close a canvas. No further operations are allowed
-func (c *SDLCanvas) Close() error {
-	return nil
-}
-*/
@@ -0,0 +1,35 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+//go:build sdl
+
+package sim
+
+import "testing"
+
+// SDL canvas must implement the Canvas interface
+var _ Canvas = (*SDLCanvas)(nil)
+
+func TestSDLCanvas(t *testing.T) {
+	c := NewSDLCanvas(100, 100, 10)
+	if c == nil || c.IsDynamic() != Cfg.Render.Dynamic {
+		t.Fatal("invalid SDL canvas")
+	}
+}
@@ -0,0 +1,153 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"errors"
+	"io"
+	"leatea/core"
+	"math"
+
+	"github.com/bfix/gospel/data"
+)
+
+//----------------------------------------------------------------------
+// Checkpoints of a running network
+//----------------------------------------------------------------------
+
+// Error codes for checkpoints
+var (
+	ErrCheckpointNode = errors.New("invalid node in checkpoint")
+	ErrNetworkActive  = errors.New("network is active")
+)
+
+// CheckpointNode holds the state of a node in a checkpoint. Floating
+// point values are stored as IEEE 754 bit patterns.
+type CheckpointNode struct {
+	State    *DumpNode // forward table and incoming traffic
+	Index    uint16    `order:"big"` // placement index in environment
+	Seed     []byte    `size:"32"`   // seed of the private key
+	X, Y, Z  uint64    `order:"big"` // position
+	R2       uint64    `order:"big"` // squared reach
+	V, Dir   uint64    `order:"big"` // velocity and direction
+	TraffOut uint64    `order:"big"` // outgoing traffic
+}
+
+// Checkpoint of a network
+type Checkpoint struct {
+	NumNodes uint16            `order:"big"`
+	Nodes    []*CheckpointNode `size:"NumNodes"`
+}
+
+// Checkpoint writes the state of all started nodes (including removed and
+// dormant forwards) to a writer. Alternative next hops of equal-cost
+// routes are not included.
+func (n *Network) Checkpoint(w io.Writer) error {
+	nodes := n.Nodes()
+	cp := &Checkpoint{
+		NumNodes: uint16(len(nodes)),
+		Nodes:    make([]*CheckpointNode, 0, len(nodes)),
+	}
+	for _, node := range nodes {
+		cp.Nodes = append(cp.Nodes, &CheckpointNode{
+			State:    n.dumpNode(node, true),
+			Index:    uint16(node.idx),
+			Seed:     node.Private().Seed(),
+			X:        math.Float64bits(node.Pos.X),
+			Y:        math.Float64bits(node.Pos.Y),
+			Z:        math.Float64bits(node.Pos.Z),
+			R2:       math.Float64bits(node.r2),
+			V:        math.Float64bits(node.v),
+			Dir:      math.Float64bits(node.dir),
+			TraffOut: node.traffOut.Load(),
+		})
+	}
+	return data.MarshalStream(w, cp)
+}
+
+// Restore the nodes of a (not yet running) network from a checkpoint.
+// The nodes are registered with the environment and are started (if they
+// were running at checkpoint time) when the network is run.
+func (n *Network) Restore(r io.Reader) error {
+	if n.active.Load() {
+		return ErrNetworkActive
+	}
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	cp := new(Checkpoint)
+	if err = data.Unmarshal(cp, buf); err != nil {
+		return err
+	}
+	// re-create nodes
+	for _, cn := range cp.Nodes {
+		prv := core.NewPeerPrivateFromSeed(cn.Seed)
+		if prv == nil || cn.State == nil {
+			return ErrCheckpointNode
+		}
+		pos := &Position{
+			X: math.Float64frombits(cn.X),
+			Y: math.Float64frombits(cn.Y),
+			Z: math.Float64frombits(cn.Z),
+		}
+		node := NewSimNode(prv, n.queue, pos, math.Float64frombits(cn.R2))
+		node.idx = int(cn.Index)
+		if id := n.env.Register(node.idx, node); id != int(cn.State.ID) {
+			return ErrCheckpointNode
+		}
+		node.v = math.Float64frombits(cn.V)
+		node.dir = math.Float64frombits(cn.Dir)
+		node.traffIn.Store(cn.State.Traffic)
+		node.traffOut.Store(cn.TraffOut)
+
+		if err = n.addNode(node.id, node); err != nil {
+			return err
+		}
+		n.started++
+		if cn.State.Running {
+			n.running++
+			n.resume = append(n.resume, node)
+		}
+	}
+	// restore forward tables
+	for _, cn := range cp.Nodes {
+		list := make([]*core.Entry, 0, len(cn.State.Tbl))
+		for _, de := range cn.State.Tbl {
+			peer, ok := n.nodes[int(de.Peer)]
+			if !ok {
+				continue
+			}
+			entry := &core.Entry{
+				Peer:    peer.PeerID(),
+				Hops:    de.Hops,
+				Origin:  core.TimeFromAge(core.Age{Val: de.Age_}),
+				Changed: core.TimeNow(),
+			}
+			if next, ok := n.nodes[int(de.Next)]; ok {
+				entry.NextHop = next.PeerID()
+			}
+			list = append(list, entry)
+		}
+		n.nodes[int(cn.State.ID)].Restore(list)
+	}
+	return nil
+}
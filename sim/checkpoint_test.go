@@ -0,0 +1,115 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"leatea/core"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// start a node and wait until it is running
+func startNode(t *testing.T, ctx context.Context, node *SimNode) {
+	t.Helper()
+	go node.Start(ctx, nil)
+	for !node.IsRunning() {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// snapshot of network state: positions, traffic and forward tables
+func snapshot(netw *Network) string {
+	nodes := netw.Nodes()
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].id < nodes[j].id })
+	buf := new(strings.Builder)
+	for _, node := range nodes {
+		fmt.Fprintf(buf, "%d: %s (%.6f,%.6f) %d/%d [", node.id, node.PeerID(),
+			node.Pos.X, node.Pos.Y, node.traffIn.Load(), node.traffOut.Load())
+		entries := make([]string, 0)
+		for _, e := range node.Forwards(true) {
+			entries = append(entries, fmt.Sprintf("{%d,%d,%d}",
+				netw.GetShortID(e.Peer), netw.GetShortID(e.NextHop), e.Hops))
+		}
+		sort.Strings(entries)
+		buf.WriteString(strings.Join(entries, ",") + "]\n")
+	}
+	return buf.String()
+}
+
+func TestCheckpoint(t *testing.T) {
+	nodeCfg := *Cfg.Node
+	defer func() { *Cfg.Node = nodeCfg }()
+	Cfg.Node.Speed = 2
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// network of four mobile nodes in a line
+	netw := NewNetwork(new(RndModel), 4)
+	for i := 0; i < 4; i++ {
+		node := NewSimNode(core.NewPeerPrivate(), netw.queue, &Position{X: float64(10 + 10*i), Y: 50}, 150)
+		node.idx = i
+		if err := netw.addNode(netw.env.Register(i, node), node); err != nil {
+			t.Fatal(err)
+		}
+		node.traffIn.Store(uint64(100 * i))
+		node.traffOut.Store(uint64(200 * i))
+		startNode(t, ctx, node)
+	}
+	peer := func(id int) *core.PeerID { return netw.nodes[id].PeerID() }
+	for id := 1; id < 4; id++ {
+		netw.nodes[id].AddNeighbor(peer(id + 1))
+		netw.nodes[id+1].AddNeighbor(peer(id))
+	}
+	netw.nodes[1].Learn(core.NewTEAchMsg(peer(2), []*core.Forward{
+		{Peer: peer(3), Hops: 0, Age: core.Age{Val: 1000000}},
+	}))
+
+	// checkpoint and restore into a new network
+	buf := new(bytes.Buffer)
+	if err := netw.Checkpoint(buf); err != nil {
+		t.Fatal(err)
+	}
+	restored := NewNetwork(new(RndModel), 4)
+	if err := restored.Restore(buf); err != nil {
+		t.Fatal(err)
+	}
+	if len(restored.resume) != 4 {
+		t.Fatalf("%d nodes to resume", len(restored.resume))
+	}
+	for _, node := range restored.resume {
+		startNode(t, ctx, node)
+	}
+	// run one more epoch on both networks
+	netw.env.Epoch(1)
+	restored.env.Epoch(1)
+	s1, s2 := snapshot(netw), snapshot(restored)
+	if s1 != s2 {
+		t.Fatalf("restored network differs:\n%s\n%s", s1, s2)
+	}
+	if !strings.Contains(s1, "{3,2,1}") {
+		t.Fatalf("relay missing:\n%s", s1)
+	}
+}
@@ -0,0 +1,96 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"leatea/core"
+	"log"
+	"math/rand"
+	"sort"
+)
+
+// Error codes
+var (
+	ErrChurnAction = errors.New("unknown churn action")
+)
+
+//----------------------------------------------------------------------
+// Epoch handling shared by all environments: events of the environment
+// (node removals) and the churn schedule from the configuration.
+//----------------------------------------------------------------------
+
+// StartEpoch updates the environment at the start of an epoch and
+// applies the events it generates and the churn schedule for the epoch.
+func (n *Network) StartEpoch(epoch int) {
+	for _, ev := range n.env.Epoch(epoch) {
+		if ev.Type == EvNodeRemoved {
+			if val := core.GetVal[[]int](ev); val[1] < 0 {
+				n.StopNodeByID(ev.Peer)
+			}
+		}
+	}
+	for _, ce := range Cfg.Env.Churn {
+		if ce.Epoch != epoch {
+			continue
+		}
+		if err := n.churn(ce); err != nil {
+			log.Printf("churn at epoch %d: %s", epoch, err.Error())
+		}
+	}
+}
+
+// churn applies an event of the churn schedule
+func (n *Network) churn(ce *ChurnEvent) error {
+	var kill bool
+	switch ce.Action {
+	case "kill":
+		kill = true
+	case "revive":
+	default:
+		return fmt.Errorf("%w: %s", ErrChurnAction, ce.Action)
+	}
+	id := ce.ID
+	if id == 0 {
+		// pick a random node (running for kill, stopped for revive)
+		var ids []int
+		for _, node := range n.Nodes() {
+			if node.IsRunning() == kill {
+				ids = append(ids, node.id)
+			}
+		}
+		if len(ids) == 0 {
+			return fmt.Errorf("%s: %w", ce.Action, ErrNodeUnknown)
+		}
+		sort.Ints(ids)
+		id = ids[rand.Intn(len(ids))] //nolint:gosec // deterministic testing
+	}
+	if !kill {
+		return n.ReviveNode(id)
+	}
+	node := n.NodeByID(id)
+	if node == nil {
+		return fmt.Errorf("kill: %w: %d", ErrNodeUnknown, id)
+	}
+	n.StopNode(node)
+	return nil
+}
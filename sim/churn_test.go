@@ -0,0 +1,63 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestChurnSchedule(t *testing.T) {
+	defer func(n int, churn []*ChurnEvent) {
+		Cfg.Env.NumNodes, Cfg.Env.Churn = n, churn
+	}(Cfg.Env.NumNodes, Cfg.Env.Churn)
+	Cfg.Env.NumNodes = 3
+	Cfg.Env.Churn = []*ChurnEvent{
+		{Epoch: 3, Action: "kill", ID: 2},
+		{Epoch: 5, Action: "revive", ID: 2},
+		{Epoch: 5, Action: "restart", ID: 1},
+	}
+	netw := NewNetwork(new(lineModel), 3)
+	netw.RunStepped(nil)
+	defer netw.Stop()
+
+	// node 2 is down in epochs 3 and 4
+	node2 := netw.NodeByID(2)
+	for epoch := 1; epoch <= 6; epoch++ {
+		if e, msg := netw.Step(); e != epoch || msg != nil {
+			t.Fatalf("epoch %d not started", epoch)
+		}
+		if down := epoch == 3 || epoch == 4; node2.IsRunning() == down {
+			t.Fatalf("epoch %d: node running=%v", epoch, node2.IsRunning())
+		}
+		for netw.Pending() > 0 {
+			netw.Step()
+		}
+	}
+	// line re-established through the revived node
+	if tbl := tableState(netw); tbl != "[2:0:0,3:2:1] [1:0:0,3:0:0] [1:2:1,2:0:0]" {
+		t.Fatalf("tables: %s", tbl)
+	}
+	// unknown actions are rejected
+	if err := netw.churn(Cfg.Env.Churn[2]); !errors.Is(err, ErrChurnAction) {
+		t.Fatalf("unknown action: %v", err)
+	}
+}
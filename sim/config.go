@@ -21,9 +21,13 @@
 package sim
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
 	"leatea/core"
 	"os"
+	"reflect"
+	"strings"
 )
 
 // WallDef definition in environment
@@ -33,6 +37,41 @@ type WallDef struct {
 	X2 float64 `json:"x2"`
 	Y2 float64 `json:"y2"`
 	F  float64 `json:"f"`
+
+	// opacity per radio band (overrides F for nodes on a listed band)
+	Bands map[string]float64 `json:"bands"`
+
+	// moving walls: translation per epoch and opacity schedule
+	VX       float64      `json:"vx"`
+	VY       float64      `json:"vy"`
+	Schedule []*WallPhase `json:"schedule"`
+}
+
+// WallPhase sets the opacity of a wall from a given epoch on
+type WallPhase struct {
+	Epoch int     `json:"epoch"`
+	F     float64 `json:"f"`
+}
+
+// ChurnEvent in the churn schedule: a node is killed or revived at the
+// start of an epoch. If no node is given (ID 0), a random running node is
+// killed or a random stopped node is revived.
+type ChurnEvent struct {
+	Epoch  int    `json:"epoch"`
+	Action string `json:"action"` // "kill" or "revive"
+	ID     int    `json:"id"`     // node identifier (0 = random)
+}
+
+// ReachDef is a weighted (squared) reach value in a reach distribution
+type ReachDef struct {
+	Reach2 float64 `json:"reach2"`
+	Weight float64 `json:"weight"`
+}
+
+// BandDef is a weighted radio band in a band distribution
+type BandDef struct {
+	Band   string  `json:"band"`
+	Weight float64 `json:"weight"`
 }
 
 // NodeDef definition in environment
@@ -40,8 +79,8 @@ type NodeDef struct {
 	ID    int     `json:"id"`
 	X     float64 `json:"x"`
 	Y     float64 `json:"y"`
-	TTL   int     `json:"ttl"` // dies at given epoch
-	Links []int   `json:"links"`
+	TTL   int     `json:"ttl"`   // dies at given epoch
+	Links []int   `json:"links"` // nodes reached by broadcasts (one-way if not listed by both nodes)
 }
 
 // EnvironCfg holds configuration data for the environment
@@ -49,14 +88,29 @@ type EnvironCfg struct {
 	Class    string  `json:"class"`
 	Width    float64 `json:"width"`
 	Height   float64 `json:"height"`
+	Depth    float64 `json:"depth"` // 3D placement in RndModel (0=flat)
 	NumNodes int     `json:"numNodes"`
 	CoolDown int     `json:"cooldown"`
+	Seed     int64   `json:"seed"`     // seed for random generator (0=default)
+	Boundary string  `json:"boundary"` // moving nodes at field edges: "bounce" (default), "wrap" or "clamp"
+
+	// propagation latency (in milliseconds) of a delivery: fixed part,
+	// random jitter and additional latency per squared distance unit.
+	Latency   float64 `json:"latency"`
+	Jitter    float64 `json:"jitter"`
+	LatencyD2 float64 `json:"latencyD2"`
 
 	// used in WallModel
 	Walls []*WallDef `json:"walls"`
 
+	// used in TraceModel
+	TraceFile string `json:"traceFile"` // CSV or GeoJSON file with node traces
+
+	// churn schedule (honored by all environment classes)
+	Churn []*ChurnEvent `json:"churn"`
+
 	// used in LinkModel
-	NodesRef string     `json:"nodesRef"` // reference to JSON file with node defs
+	NodesRef string     `json:"nodesRef"` // reference to JSON or CSV file with node defs
 	Nodes    []*NodeDef `json:"nodes"`    // explicit node list
 }
 
@@ -66,6 +120,20 @@ type NodeCfg struct {
 	BootupTime float64 `json:"bootup"`
 	PeerTTL    float64 `json:"ttl"`
 	DeathRate  float64 `json:"deathRate"`
+	LossRate   float64 `json:"lossRate"` // probability of a lost delivery
+
+	// heterogeneous reach of nodes (used in RndModel): either a weighted
+	// list of reach values or a uniform range [Reach2,Reach2Max].
+	Reaches   []*ReachDef `json:"reaches"`
+	Reach2Max float64     `json:"reach2Max"`
+
+	// radio bands of nodes (used in WallModel): weighted list of bands
+	Bands []*BandDef `json:"bands"`
+
+	// mobility of nodes
+	Speed          float64 `json:"speed"`          // max. velocity (units per epoch)
+	RandomWaypoint int     `json:"randomWaypoint"` // re-pick direction/velocity every n epochs (0=never)
+	Pause          int     `json:"pause"`          // pause at destination (in epochs; "mobile" model)
 }
 
 // RenderCfg options
@@ -75,22 +143,43 @@ type RenderCfg struct {
 	Width   int    `json:"width"`
 	Height  int    `json:"height"`
 	Dynamic bool   `json:"dynamic"`
+	ColorBy string `json:"colorBy"` // color nodes by "none" or "hops"
+	Source  int    `json:"source"`  // source node for coloring by hops
 }
 
 // Option for comtrol flags/values
 type Option struct {
 	MaxRepeat  int  `json:"maxRepeat"`
 	StopOnLoop bool `json:"stopOnLoop"`
+	TrackLoops bool `json:"trackLoops"` // log and count loops per epoch (run continues on loops)
 	StopAt     int  `json:"stopAt"`
 
-	Events     []int  `json:"events"`
-	ShowEvents bool   `json:"showEvents"`
-	EventLog   string `json:"eventLog"`
+	StrictChecks bool `json:"strictChecks"` // panic on failed sanity checks
+	Stepped      bool `json:"stepped"`      // single-stepped simulation (debugging)
+
+	ConvergeTarget float64 `json:"convergeTarget"` // ratio of successful routes for convergence
+	StopOnConverge bool    `json:"stopOnConverge"` // stop simulation when converged
+
+	Events     []int    `json:"events"`
+	ShowEvents bool     `json:"showEvents"`
+	EventLog   string   `json:"eventLog"`
+	FocusPeers []string `json:"focusPeers"` // only show events for these peers
+
+	EventStream string `json:"eventStream"` // listen address for live event streaming
+	Console     bool   `json:"console"`     // read control commands from stdin
 
 	Statistics  string `json:"statistics"`
+	StatsFormat string `json:"statsFormat"` // "csv" (default) or "json"
 	TableDump   string `json:"tableDump"`
+	DotFile     string `json:"dotFile"`    // routing graph (GraphViz DOT)
+	MatrixFile  string `json:"matrixFile"` // routing matrix ("-" for stdout)
 	EpochStatus bool   `json:"epochStatus"`
 	FinalStatus bool   `json:"finalStatus"`
+	Summary     string `json:"summary"` // summary file ("-" for stdout)
+
+	TraceRoutes  [][2]int `json:"traceRoutes"`  // routes (from,to) to trace and render
+	CheckOptimal bool     `json:"checkOptimal"` // compare routes with shortest paths
+	BloomCheck   bool     `json:"bloomCheck"`   // count false positives of LEArn filters
 }
 
 // Config for test configuration data
@@ -103,36 +192,44 @@ type Config struct {
 }
 
 // Cfg is the global configuration
-var Cfg = &Config{
-	Core: &core.Config{
-		MaxTeachs:  10,
-		LearnIntv:  10,
-		Outdated:   60,
-		BeaconIntv: 1,
-		TTLBeacon:  5,
-	},
-	Env: &EnvironCfg{
-		Width:    100.,
-		Height:   100.,
-		NumNodes: 60,
-		CoolDown: 5,
-	},
-	Node: &NodeCfg{
-		Reach2:     500.,
-		BootupTime: 60.,
-		PeerTTL:    600.,
-		DeathRate:  0.,
-	},
-	Options: &Option{
-		MaxRepeat:   0,
-		StopOnLoop:  false,
-		Events:      nil,
-		EpochStatus: true,
-	},
-	Render: &RenderCfg{
-		Mode: "none",
-		File: "",
-	},
+var Cfg = defaultConfig()
+
+// defaultConfig returns a new configuration with default values
+func defaultConfig() *Config {
+	return &Config{
+		Core: &core.Config{
+			MaxTeachs:  10,
+			LearnIntv:  10,
+			Outdated:   60,
+			BeaconIntv: 1,
+			TTLBeacon:  5,
+			MaxHops:    32,
+		},
+		Env: &EnvironCfg{
+			Width:    100.,
+			Height:   100.,
+			NumNodes: 60,
+			CoolDown: 5,
+		},
+		Node: &NodeCfg{
+			Reach2:     500.,
+			BootupTime: 60.,
+			PeerTTL:    600.,
+			DeathRate:  0.,
+			LossRate:   0.,
+		},
+		Options: &Option{
+			MaxRepeat:      0,
+			StopOnLoop:     false,
+			ConvergeTarget: 0.99,
+			Events:         nil,
+			EpochStatus:    true,
+		},
+		Render: &RenderCfg{
+			Mode: "none",
+			File: "",
+		},
+	}
 }
 
 //----------------------------------------------------------------------
@@ -143,5 +240,57 @@ func ReadConfig(fn string) error {
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(data, &Cfg)
+	if err = json.Unmarshal(data, &Cfg); err != nil {
+		return err
+	}
+	SetSeed(Cfg.Env.Seed)
+	return nil
+}
+
+// WriteDefaultConfig writes the default configuration as JSON. Each value
+// is preceded by a comment entry ("//<name>") with the Go type of the
+// value; comment entries are ignored when reading the configuration.
+func WriteDefaultConfig(w io.Writer) error {
+	buf := new(bytes.Buffer)
+	if err := writeJSON(buf, reflect.ValueOf(defaultConfig()), ""); err != nil {
+		return err
+	}
+	buf.WriteString("\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// write a value as (commented) JSON
+func writeJSON(buf *bytes.Buffer, v reflect.Value, indent string) error {
+	if v.Kind() == reflect.Pointer && !v.IsNil() && v.Elem().Kind() == reflect.Struct {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		return nil
+	}
+	buf.WriteString("{")
+	first := true
+	for i := 0; i < v.NumField(); i++ {
+		fld := v.Type().Field(i)
+		name, _, _ := strings.Cut(fld.Tag.Get("json"), ",")
+		if !fld.IsExported() || name == "" || name == "-" {
+			continue
+		}
+		if !first {
+			buf.WriteString(",")
+		}
+		first = false
+		buf.WriteString("\n" + indent + "\t\"//" + name + "\": \"" + fld.Type.String() + "\",")
+		buf.WriteString("\n" + indent + "\t\"" + name + "\": ")
+		if err := writeJSON(buf, v.Field(i), indent+"\t"); err != nil {
+			return err
+		}
+	}
+	buf.WriteString("\n" + indent + "}")
+	return nil
 }
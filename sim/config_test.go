@@ -0,0 +1,55 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteDefaultConfig(t *testing.T) {
+	saved := Cfg
+	defer func() { Cfg = saved }()
+
+	buf := new(bytes.Buffer)
+	if err := WriteDefaultConfig(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"//maxTeachs": "int"`) {
+		t.Fatal("missing field comment")
+	}
+	// read back into an empty configuration
+	fn := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(fn, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	Cfg = new(Config)
+	if err := ReadConfig(fn); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(Cfg, defaultConfig()) {
+		t.Fatalf("configuration mismatch:\n%s", buf.String())
+	}
+}
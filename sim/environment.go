@@ -21,8 +21,11 @@
 package sim
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"leatea/core"
 	"log"
 	"math"
@@ -31,11 +34,18 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+)
+
+// Error codes for node definitions
+var (
+	ErrNodeFormat = errors.New("invalid node definition")
+	ErrNodeLink   = errors.New("link to undefined node")
 )
 
 type Environment interface {
 	// Connectivity between two nodes based on the "phsical" model
-	// of the environment.
+	// of the environment: true if n1 receives the broadcasts of n2.
 	Connectivity(n1, n2 *SimNode) bool
 
 	// Placement decides where to place i.th node with calculated reach.
@@ -51,12 +61,53 @@ type Environment interface {
 	Draw(Canvas)
 }
 
+//----------------------------------------------------------------------
+// Mobility of nodes (used in environments with placed nodes)
+//----------------------------------------------------------------------
+
+// mobility keeps track of registered nodes and moves them each epoch.
+type mobility struct {
+	sync.Mutex
+	nodes []*SimNode
+}
+
+// add a node with random velocity and direction (if mobility is enabled)
+func (m *mobility) add(node *SimNode) {
+	m.Lock()
+	defer m.Unlock()
+	if Cfg.Node.Speed > 0 {
+		node.v = rndFloat(Cfg.Node.Speed)
+		node.dir = rndFloat(2 * math.Pi)
+	}
+	m.nodes = append(m.nodes, node)
+}
+
+// move all running nodes for one epoch; re-pick direction and velocity
+// periodically in random-waypoint mode.
+func (m *mobility) move(epoch int) {
+	m.Lock()
+	defer m.Unlock()
+	repick := Cfg.Node.RandomWaypoint > 0 && epoch%Cfg.Node.RandomWaypoint == 0
+	for _, node := range m.nodes {
+		if !node.IsRunning() {
+			continue
+		}
+		if repick && Cfg.Node.Speed > 0 {
+			node.v = rndFloat(Cfg.Node.Speed)
+			node.dir = rndFloat(2 * math.Pi)
+		}
+		node.Move(1)
+	}
+}
+
 //----------------------------------------------------------------------
 // Model with "walls" that block connectivity
 //----------------------------------------------------------------------
 
 // WallModel for walls with opacity
 type WallModel struct {
+	mobility
+
 	walls []*Wall // list of all walls in the world
 }
 
@@ -67,28 +118,33 @@ func NewWallModel() *WallModel {
 	}
 }
 
-// Connectivity between two nodes based on a wall model (interface impl)
+// Connectivity between two nodes based on a wall model (interface impl).
+// Walls attenuate the reach of each node depending on its radio band.
 func (m *WallModel) Connectivity(n1, n2 *SimNode) bool {
 	los := &Line{n1.Pos, n2.Pos}
-	red := 1.0
+	red1, red2 := 1.0, 1.0
 	for _, w := range m.walls {
 		if w.Line.Intersect(los) {
-			red *= w.reduce
+			red1 *= w.opacity(n1.band)
+			red2 *= w.opacity(n2.band)
 		}
 	}
+	d2 := n1.Pos.Distance2(n2.Pos)
+	return reaches(n1.r2, d2, red1) || reaches(n2.r2, d2, red2)
+}
+
+// reaches returns true if a node with (squared) reach r2 covers the
+// squared distance d2 with reach reduced by factor red.
+func reaches(r2, d2, red float64) bool {
 	if red < 1e-8 {
 		return false
 	}
-	d2 := n1.Pos.Distance2(n2.Pos) / red
-	return n1.r2 > d2 || n2.r2 > d2
+	return r2 > d2/red
 }
 
 // Placement decides where to place i.th node with calculated reach (interface impl)
 func (m *WallModel) Placement(i int) (r2 float64, pos *Position) {
-	pos = &Position{
-		X: rndFloat(Cfg.Env.Width),
-		Y: rndFloat(Cfg.Env.Height),
-	}
+	pos = NewPosition(rndFloat(Cfg.Env.Width), rndFloat(Cfg.Env.Height))
 	r2 = Cfg.Node.Reach2
 	return
 }
@@ -96,11 +152,17 @@ func (m *WallModel) Placement(i int) (r2 float64, pos *Position) {
 // Register node with environment
 func (m *WallModel) Register(i int, node *SimNode) int {
 	node.id = i + 1
+	node.band = rndBand()
+	m.add(node)
 	return node.id
 }
 
-// Epoch started
+// Epoch started: move nodes and walls
 func (m *WallModel) Epoch(epoch int) []*core.Event {
+	m.move(epoch)
+	for _, wall := range m.walls {
+		wall.update(epoch)
+	}
 	return nil
 }
 
@@ -112,18 +174,46 @@ func (m *WallModel) Draw(c Canvas) {
 }
 
 // Add a new wall
-func (m *WallModel) Add(from, to *Position, red float64) {
+func (m *WallModel) Add(from, to *Position, red float64) *Wall {
 	wall := new(Wall)
 	wall.From = from
 	wall.To = to
 	wall.reduce = red
 	m.walls = append(m.walls, wall)
+	return wall
 }
 
-// Wall with opacity: reach is reduced by factor
+// Wall with opacity: reach is reduced by factor. Walls can move (by a
+// velocity per epoch) and change opacity (by schedule).
 type Wall struct {
 	Line
-	reduce float64
+	reduce   float64
+	bands    map[string]float64 // opacity per radio band
+	vx, vy   float64
+	schedule []*WallPhase
+}
+
+// opacity of the wall for a radio band (reduce if band is not listed)
+func (w *Wall) opacity(band string) float64 {
+	if f, ok := w.bands[band]; ok {
+		return f
+	}
+	return w.reduce
+}
+
+// update wall position and opacity for given epoch
+func (w *Wall) update(epoch int) {
+	if w.vx != 0 || w.vy != 0 {
+		w.Line = Line{
+			From: &Position{X: w.From.X + w.vx, Y: w.From.Y + w.vy},
+			To:   &Position{X: w.To.X + w.vx, Y: w.To.Y + w.vy},
+		}
+	}
+	for _, phase := range w.schedule {
+		if phase.Epoch == epoch {
+			w.reduce = phase.F
+		}
+	}
 }
 
 // Line in 2D space
@@ -153,8 +243,10 @@ func (l *Line) Side(p *Position) int {
 // Simple model with random distribution
 //----------------------------------------------------------------------
 
-// WallModel for walls with opacity
-type RndModel struct{}
+// RndModel for randomly placed (and moving) nodes
+type RndModel struct {
+	mobility
+}
 
 // Connectivity between two nodes only based on reach (interface impl)
 func (m *RndModel) Connectivity(n1, n2 *SimNode) bool {
@@ -164,22 +256,24 @@ func (m *RndModel) Connectivity(n1, n2 *SimNode) bool {
 
 // Placement decides where to place i.th node with calculated reach (interface impl)
 func (m *RndModel) Placement(i int) (r2 float64, pos *Position) {
-	pos = &Position{
-		X: rndFloat(Cfg.Env.Width),
-		Y: rndFloat(Cfg.Env.Height),
+	pos = NewPosition(rndFloat(Cfg.Env.Width), rndFloat(Cfg.Env.Height))
+	if Cfg.Env.Depth > 0 {
+		pos.Z = rndFloat(Cfg.Env.Depth)
 	}
-	r2 = Cfg.Node.Reach2
+	r2 = rndReach2()
 	return
 }
 
 // Register node with environment
 func (m *RndModel) Register(i int, node *SimNode) int {
 	node.id = i + 1
+	m.add(node)
 	return node.id
 }
 
-// Epoch started
+// Epoch started: move nodes
 func (m *RndModel) Epoch(epoch int) []*core.Event {
+	m.move(epoch)
 	return nil
 }
 
@@ -204,10 +298,10 @@ func (m *CircModel) Placement(i int) (r2 float64, pos *Position) {
 	rad := math.Max(Cfg.Env.Height, Cfg.Env.Width) / 2
 	alpha := 2 * math.Pi / float64(Cfg.Env.NumNodes)
 	reach := 1.2 * rad * math.Tan(alpha)
-	pos = &Position{
-		X: Cfg.Env.Width/2 + rad*math.Cos(float64(i)*alpha),
-		Y: Cfg.Env.Height/2 + rad*math.Sin(float64(i)*alpha),
-	}
+	pos = NewPosition(
+		Cfg.Env.Width/2+rad*math.Cos(float64(i)*alpha),
+		Cfg.Env.Height/2+rad*math.Sin(float64(i)*alpha),
+	)
 	r2 = reach * reach
 	return
 }
@@ -226,6 +320,84 @@ func (m *CircModel) Epoch(epoch int) []*core.Event {
 // Draw the environment
 func (m *CircModel) Draw(Canvas) {}
 
+//----------------------------------------------------------------------
+// Random-waypoint model: nodes move to random destinations (with
+// random speed) and pause on arrival before picking the next target.
+//----------------------------------------------------------------------
+
+// waypoint of a mobile node
+type waypoint struct {
+	node  *SimNode  // moving node
+	dest  *Position // current destination
+	pause int       // remaining epochs to pause
+}
+
+// MobileModel for nodes moving by the random-waypoint model
+type MobileModel struct {
+	sync.Mutex
+	nodes []*waypoint
+}
+
+// Connectivity between two nodes only based on reach (interface impl)
+func (m *MobileModel) Connectivity(n1, n2 *SimNode) bool {
+	d2 := n1.Pos.Distance2(n2.Pos)
+	return n1.r2 > d2 || n2.r2 > d2
+}
+
+// Placement decides where to place i.th node with calculated reach (interface impl)
+func (m *MobileModel) Placement(i int) (r2 float64, pos *Position) {
+	pos = NewPosition(rndFloat(Cfg.Env.Width), rndFloat(Cfg.Env.Height))
+	r2 = Cfg.Node.Reach2
+	return
+}
+
+// Register node with environment
+func (m *MobileModel) Register(i int, node *SimNode) int {
+	m.Lock()
+	defer m.Unlock()
+	node.id = i + 1
+	wp := &waypoint{node: node}
+	wp.next()
+	m.nodes = append(m.nodes, wp)
+	return node.id
+}
+
+// Epoch started: move nodes towards their destinations
+func (m *MobileModel) Epoch(epoch int) []*core.Event {
+	m.Lock()
+	defer m.Unlock()
+	for _, wp := range m.nodes {
+		// pausing at destination?
+		if wp.pause > 0 {
+			wp.pause--
+			continue
+		}
+		// arriving at destination?
+		node := wp.node
+		dist := math.Sqrt(node.Pos.Distance2(wp.dest))
+		if dist <= node.v {
+			node.Pos = wp.dest
+			wp.pause = Cfg.Node.Pause
+			wp.next()
+			continue
+		}
+		// move towards destination
+		node.dir = math.Atan2(wp.dest.Y-node.Pos.Y, wp.dest.X-node.Pos.X)
+		node.Move(1)
+	}
+	return nil
+}
+
+// Draw the environment
+func (m *MobileModel) Draw(Canvas) {}
+
+// next picks a new destination and speed for the node. The speed is
+// bounded from below to prevent the model from "slowing down" over time.
+func (wp *waypoint) next() {
+	wp.dest = NewPosition(rndFloat(Cfg.Env.Width), rndFloat(Cfg.Env.Height))
+	wp.node.v = Cfg.Node.Speed * (0.1 + rndFloat(0.9))
+}
+
 //----------------------------------------------------------------------
 // Model with explicit links
 //----------------------------------------------------------------------
@@ -250,32 +422,22 @@ func NewLinkModel() *LinkModel {
 	}
 }
 
-// Connectivity between two nodes based on link (interface impl)
+// Connectivity between two nodes based on link (interface impl):
+// n1 receives the broadcasts of n2 if n2 links to n1. Links can be
+// one-directional (asymmetric reach).
 func (m *LinkModel) Connectivity(n1, n2 *SimNode) bool {
-	check := func(n *SimNode, t int) bool {
-		for _, l := range m.nodes[n.id].d.Links {
-			if l == t {
-				return true
-			}
+	for _, l := range m.nodes[n2.id].d.Links {
+		if l == n1.id {
+			return true
 		}
-		return false
-	}
-	rc1 := check(n1, n2.id)
-	rc2 := check(n2, n1.id)
-	if rc1 != rc2 {
-		log.Printf("%d -> %d: %v", n1.id, n2.id, rc1)
-		log.Printf("%d: %v", n1.id, m.nodes[n1.id].d.Links)
-		log.Printf("%d -> %d: %v", n2.id, n1.id, rc2)
-		log.Printf("%d: %v", n2.id, m.nodes[n2.id].d.Links)
-		panic("")
 	}
-	return rc1
+	return false
 }
 
 // Placement decides where to place i.th node (interface impl)
 func (m *LinkModel) Placement(i int) (r2 float64, pos *Position) {
 	def := m.defs[i]
-	return 0, &Position{def.X, def.Y}
+	return 0, &Position{X: def.X, Y: def.Y}
 }
 
 // Register node with environment
@@ -337,6 +499,99 @@ func (m *LinkModel) Epoch(epoch int) (events []*core.Event) {
 // Draw the environment
 func (m *LinkModel) Draw(Canvas) {}
 
+// ReadNodeDefs reads node definitions for a LinkModel from a JSON file or
+// a CSV file (lines "id,x,y,ttl,link1,link2,..."; detected by the ".csv"
+// suffix). All linked nodes must be defined in the file.
+func ReadNodeDefs(fn string) (defs []*NodeDef, err error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	if strings.HasSuffix(fn, ".csv") {
+		defs, err = readNodesCSV(f)
+	} else {
+		err = json.NewDecoder(f).Decode(&defs)
+	}
+	if err != nil {
+		return
+	}
+	// check links
+	ids := make(map[int]bool)
+	for _, def := range defs {
+		ids[def.ID] = true
+	}
+	for _, def := range defs {
+		for _, l := range def.Links {
+			if !ids[l] {
+				return nil, fmt.Errorf("%w: node %d links to %d", ErrNodeLink, def.ID, l)
+			}
+		}
+	}
+	return
+}
+
+// read node definitions from CSV (with optional header line)
+func readNodesCSV(r io.Reader) (defs []*NodeDef, err error) {
+	rdr := csv.NewReader(r)
+	rdr.FieldsPerRecord = -1
+	rdr.TrimLeadingSpace = true
+	for line := 0; ; line++ {
+		var rec []string
+		if rec, err = rdr.Read(); err != nil {
+			if err == io.EOF {
+				err = nil
+				break
+			}
+			return
+		}
+		def, ok := parseNodeDef(rec)
+		if !ok {
+			// skip header line
+			if line == 0 {
+				continue
+			}
+			return nil, ErrNodeFormat
+		}
+		defs = append(defs, def)
+	}
+	return
+}
+
+// parse a node definition from a CSV record
+func parseNodeDef(rec []string) (def *NodeDef, ok bool) {
+	if len(rec) < 4 {
+		return
+	}
+	def = new(NodeDef)
+	var err error
+	if def.ID, err = strconv.Atoi(rec[0]); err != nil {
+		return
+	}
+	if def.X, err = strconv.ParseFloat(rec[1], 64); err != nil {
+		return
+	}
+	if def.Y, err = strconv.ParseFloat(rec[2], 64); err != nil {
+		return
+	}
+	if len(rec[3]) > 0 {
+		if def.TTL, err = strconv.Atoi(rec[3]); err != nil {
+			return
+		}
+	}
+	for _, s := range rec[4:] {
+		if len(s) == 0 {
+			continue
+		}
+		var l int
+		if l, err = strconv.Atoi(s); err != nil {
+			return
+		}
+		def.Links = append(def.Links, l)
+	}
+	return def, true
+}
+
 //----------------------------------------------------------------------
 
 // BuildEnvironment: create the "physical" environment that
@@ -350,6 +605,12 @@ func BuildEnvironment(env *EnvironCfg) Environment {
 	case "rand":
 		return new(RndModel)
 
+	//------------------------------------------------------------------
+	// Randomly distributed nodes moving by the random-waypoint model
+	//------------------------------------------------------------------
+	case "mobile":
+		return new(MobileModel)
+
 	//------------------------------------------------------------------
 	// Evenly space env.NumNodes nodes on a circle so that each node
 	// only reaches its two direct neighbors (Shortcut for calculating
@@ -364,13 +625,27 @@ func BuildEnvironment(env *EnvironCfg) Environment {
 	case "wall":
 		mdl := NewWallModel()
 		for _, wall := range env.Walls {
-			mdl.Add(
+			w := mdl.Add(
 				&Position{X: wall.X1, Y: wall.Y1},
 				&Position{X: wall.X2, Y: wall.Y2},
 				wall.F)
+			w.bands = wall.Bands
+			w.vx, w.vy = wall.VX, wall.VY
+			w.schedule = wall.Schedule
 		}
 		return mdl
 	//------------------------------------------------------------------
+	// Nodes moving along recorded traces
+	//------------------------------------------------------------------
+	case "trace":
+		mdl, err := NewTraceModel(env.TraceFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		Cfg.Env.NumNodes = len(mdl.ids)
+		return mdl
+
+	//------------------------------------------------------------------
 	// Use explicit node definitions and connectivity
 	//------------------------------------------------------------------
 	case "link":
@@ -378,14 +653,11 @@ func BuildEnvironment(env *EnvironCfg) Environment {
 		// get node definitions
 		if len(env.NodesRef) != 0 {
 			// we read nodes from a file
-			buf, err := os.ReadFile(env.NodesRef)
+			defs, err := ReadNodeDefs(env.NodesRef)
 			if err != nil {
 				log.Fatal(err)
 			}
-			// read node definitions
-			if err = json.Unmarshal(buf, &mdl.defs); err != nil {
-				log.Fatal(err)
-			}
+			mdl.defs = defs
 		} else {
 			mdl.defs = env.Nodes
 		}
@@ -403,6 +675,63 @@ func rndFloat(f float64) float64 {
 	return rand.Float64() * f //nolint:gosec // deterministic testing
 }
 
+// rndReach2 samples the (squared) reach of a node from the configured
+// reach distribution. Without a distribution all nodes share Reach2.
+func rndReach2() float64 {
+	if len(Cfg.Node.Reaches) > 0 {
+		total := 0.
+		for _, r := range Cfg.Node.Reaches {
+			total += r.Weight
+		}
+		v := rndFloat(total)
+		for _, r := range Cfg.Node.Reaches {
+			if v -= r.Weight; v < 0 {
+				return r.Reach2
+			}
+		}
+		return Cfg.Node.Reaches[len(Cfg.Node.Reaches)-1].Reach2
+	}
+	if span := Cfg.Node.Reach2Max - Cfg.Node.Reach2; span > 0 {
+		return Cfg.Node.Reach2 + rndFloat(span)
+	}
+	return Cfg.Node.Reach2
+}
+
+// rndBand samples the radio band of a node from the configured band
+// distribution. Without a distribution all nodes use the default band.
+func rndBand() string {
+	if len(Cfg.Node.Bands) == 0 {
+		return ""
+	}
+	total := 0.
+	for _, b := range Cfg.Node.Bands {
+		total += b.Weight
+	}
+	v := rndFloat(total)
+	for _, b := range Cfg.Node.Bands {
+		if v -= b.Weight; v < 0 {
+			return b.Band
+		}
+	}
+	return Cfg.Node.Bands[len(Cfg.Node.Bands)-1].Band
+}
+
+// Seed for the (deterministic) random number generator
+const Seed = 1962031967
+
+// seed currently used by the random number generator
+var seed int64
+
+// SetSeed of the random number generator that controls placement, boot
+// delays and node lifetimes (0 = default seed).
+func SetSeed(s int64) {
+	if s == 0 {
+		s = Seed
+	}
+	seed = s
+	rand.Seed(s)
+}
+
 func init() {
-	rand.Seed(1962031967)
+	SetSeed(Seed)
 }
@@ -21,7 +21,14 @@
 package sim
 
 import (
+	"errors"
+	"leatea/core"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestIntersect(t *testing.T) {
@@ -45,3 +52,337 @@ func TestIntersect(t *testing.T) {
 	}
 	t.Logf("Blocked %d from %d\n", blocked, num)
 }
+
+func TestMobileModel(t *testing.T) {
+	env, node := *Cfg.Env, *Cfg.Node
+	defer func() {
+		*Cfg.Env, *Cfg.Node = env, node
+	}()
+	Cfg.Env.Width, Cfg.Env.Height = 100, 100
+	Cfg.Node.Speed, Cfg.Node.Pause = 5, 0
+
+	// place nodes (no need to run them)
+	mdl := BuildEnvironment(&EnvironCfg{Class: "mobile"})
+	nodes := make([]*SimNode, 100)
+	for i := range nodes {
+		r2, pos := mdl.Placement(i)
+		nodes[i] = &SimNode{Pos: pos, r2: r2}
+		mdl.Register(i, nodes[i])
+	}
+	// mean pairwise distance (normalized to field size)
+	meanDist := func() float64 {
+		sum, num := 0., 0
+		for i, n1 := range nodes {
+			for _, n2 := range nodes[i+1:] {
+				sum += math.Sqrt(n1.Pos.Distance2(n2.Pos))
+				num++
+			}
+		}
+		return sum / float64(num) / Cfg.Env.Width
+	}
+	// move nodes (after a warm-up phase) and sample distances
+	sum, num := 0., 0
+	for epoch := 1; epoch <= 2000; epoch++ {
+		if mdl.Epoch(epoch) != nil {
+			t.Fatal("mobile model emitted events")
+		}
+		if epoch > 200 && epoch%10 == 0 {
+			sum += meanDist()
+			num++
+		}
+	}
+	// uniform distribution: 0.5214, random waypoint (nodes concentrate
+	// in the center of the field): ~0.40-0.42
+	mean := sum / float64(num)
+	t.Logf("mean distance: %.4f", mean)
+	if mean < 0.38 || mean > 0.45 {
+		t.Fatalf("mean distance %.4f does not match random waypoint", mean)
+	}
+}
+
+func TestRndModel3D(t *testing.T) {
+	env := *Cfg.Env
+	defer func() { *Cfg.Env = env }()
+	Cfg.Env.Depth = 50
+
+	// nodes are scattered in 3D
+	mdl := new(RndModel)
+	flat := true
+	for i := 0; i < 10; i++ {
+		if _, pos := mdl.Placement(i); pos.Z < 0 || pos.Z >= 50 {
+			t.Fatalf("invalid position %s", pos)
+		} else if pos.Z > 0 {
+			flat = false
+		}
+	}
+	if flat {
+		t.Fatal("no 3D placement")
+	}
+	// two nodes separated only in Z (reach 10)
+	n1 := &SimNode{Pos: &Position{X: 50, Y: 50, Z: 0}, r2: 100}
+	n2 := &SimNode{Pos: &Position{X: 50, Y: 50, Z: 9}, r2: 100}
+	if !mdl.Connectivity(n1, n2) {
+		t.Fatal("nodes in reach not connected")
+	}
+	n2.Pos.Z = 11
+	if mdl.Connectivity(n1, n2) {
+		t.Fatal("nodes beyond reach connected")
+	}
+}
+
+func TestRndModelReach(t *testing.T) {
+	node := *Cfg.Node
+	defer func() { *Cfg.Node = node }()
+	mdl := new(RndModel)
+	const num = 20000
+
+	// weighted reach values
+	Cfg.Node.Reaches = []*ReachDef{
+		{Reach2: 100, Weight: 1},
+		{Reach2: 400, Weight: 3},
+	}
+	count := make(map[float64]int)
+	for i := 0; i < num; i++ {
+		r2, _ := mdl.Placement(i)
+		count[r2]++
+	}
+	if len(count) != 2 {
+		t.Fatalf("unexpected reach values: %v", count)
+	}
+	if share := float64(count[400]) / num; math.Abs(share-0.75) > 0.02 {
+		t.Fatalf("reach share %.3f does not match weight", share)
+	}
+
+	// uniform reach range
+	Cfg.Node.Reaches = nil
+	Cfg.Node.Reach2, Cfg.Node.Reach2Max = 100, 300
+	sum := 0.
+	for i := 0; i < num; i++ {
+		r2, _ := mdl.Placement(i)
+		if r2 < 100 || r2 >= 300 {
+			t.Fatalf("reach %.1f out of range", r2)
+		}
+		sum += r2
+	}
+	if mean := sum / num; math.Abs(mean-200) > 3 {
+		t.Fatalf("mean reach %.1f does not match range", mean)
+	}
+
+	// no distribution: identical reach
+	Cfg.Node.Reach2Max = 0
+	if r2, _ := mdl.Placement(0); r2 != 100 {
+		t.Fatalf("reach %.1f != 100", r2)
+	}
+}
+
+func TestMovingWall(t *testing.T) {
+	mdl := BuildEnvironment(&EnvironCfg{
+		Class: "wall",
+		Walls: []*WallDef{
+			// opaque wall sliding out of the line of sight
+			{X1: 50, Y1: 40, X2: 50, Y2: 60, F: 0, VY: 7},
+			// wall turning transparent in epoch 4
+			{X1: 70, Y1: 40, X2: 70, Y2: 60, F: 0, Schedule: []*WallPhase{{Epoch: 4, F: 1}}},
+		},
+	})
+	n1 := &SimNode{Pos: &Position{X: 40, Y: 50}, r2: 900}
+	n2 := &SimNode{Pos: &Position{X: 60, Y: 50}, r2: 900}
+	n3 := &SimNode{Pos: &Position{X: 80, Y: 50}, r2: 900}
+	for epoch, reach := range []bool{false, false, true} {
+		if epoch > 0 {
+			mdl.Epoch(epoch)
+		}
+		if mdl.Connectivity(n1, n2) != reach {
+			t.Fatalf("epoch %d: connectivity %v", epoch, !reach)
+		}
+	}
+	for _, epoch := range []int{3, 4} {
+		mdl.Epoch(epoch)
+		if reach := epoch == 4; mdl.Connectivity(n2, n3) != reach {
+			t.Fatalf("epoch %d: connectivity %v", epoch, !reach)
+		}
+	}
+}
+
+func TestWallBands(t *testing.T) {
+	mdl := BuildEnvironment(&EnvironCfg{
+		Class: "wall",
+		Walls: []*WallDef{
+			// blocks 5GHz, barely attenuates 2.4GHz (default: F)
+			{X1: 50, Y1: 40, X2: 50, Y2: 60, F: 0.4, Bands: map[string]float64{"5GHz": 0, "2.4GHz": 0.9}},
+		},
+	})
+	node := func(x float64, band string) *SimNode {
+		return &SimNode{Pos: &Position{X: x, Y: 50}, r2: 900, band: band}
+	}
+	for _, tc := range []struct {
+		band  string
+		reach bool
+	}{
+		{"2.4GHz", true},
+		{"5GHz", false},
+		{"", false},
+	} {
+		// squared distance 400: reached only if attenuation >= 4/9
+		if mdl.Connectivity(node(40, tc.band), node(60, tc.band)) != tc.reach {
+			t.Fatalf("band %q: connectivity %v", tc.band, !tc.reach)
+		}
+	}
+	// same distance without a wall in the line of sight
+	if !mdl.Connectivity(node(10, "5GHz"), node(30, "5GHz")) {
+		t.Fatal("5GHz nodes not connected without wall")
+	}
+}
+
+func TestTraceModel(t *testing.T) {
+	env, coreCfg := *Cfg.Env, *Cfg.Core
+	defer func() { *Cfg.Env, *Cfg.Core = env, coreCfg }()
+	Cfg.Env.Width, Cfg.Env.Height = 100, 100
+	Cfg.Core.LearnIntv = 10
+
+	// node 1 is static, node 2 moves out of range and back; node 3
+	// appears late and disappears early.
+	fn := filepath.Join(t.TempDir(), "trace.csv")
+	trace := `time,node,lat,lon
+1000,1,0,0
+1100,1,0,0
+1000,2,0,0.1
+1050,2,0,1
+1100,2,0,0.1
+1030,3,0,0.5
+1060,3,0,0.5
+`
+	if err := os.WriteFile(fn, []byte(trace), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mdl := BuildEnvironment(&EnvironCfg{Class: "trace", TraceFile: fn}).(*TraceModel)
+	if Cfg.Env.NumNodes != 3 {
+		t.Fatalf("%d nodes in trace", Cfg.Env.NumNodes)
+	}
+	nodes := make([]*SimNode, 3)
+	for i := range nodes {
+		r2, pos := mdl.Placement(i)
+		nodes[i] = NewSimNode(core.NewPeerPrivate(), nil, pos, r2)
+		mdl.Register(i, nodes[i])
+	}
+	if d := mdl.BootDelay(2); d != 30*time.Second {
+		t.Fatalf("node 3 boots after %s", d)
+	}
+	// connectivity of nodes 1 and 2 per epoch
+	reach := []bool{true, false, false, false, false, false, false, false, false, false, true}
+	for epoch, ok := range reach {
+		events := mdl.Epoch(epoch)
+		if mdl.Connectivity(nodes[0], nodes[1]) != ok {
+			t.Fatalf("epoch %d: connectivity %v (%s, %s)", epoch, !ok, nodes[0].Pos, nodes[1].Pos)
+		}
+		// node 3 stops after its trace ended
+		if (len(events) == 1) != (epoch == 7) {
+			t.Fatalf("epoch %d: %d events", epoch, len(events))
+		}
+		if epoch == 7 && !events[0].Peer.Equal(nodes[2].PeerID()) {
+			t.Fatal("wrong node stopped")
+		}
+	}
+}
+
+func TestLinkModelOneWay(t *testing.T) {
+	defer func(n int) { Cfg.Env.NumNodes = n }(Cfg.Env.NumNodes)
+
+	// nodes 1 and 2 are linked; node 3 receives broadcasts from
+	// node 2, but node 2 does not receive broadcasts from node 3.
+	mdl := NewLinkModel()
+	mdl.defs = []*NodeDef{
+		{ID: 1, Links: []int{2}},
+		{ID: 2, Links: []int{1, 3}},
+		{ID: 3, Links: []int{}},
+	}
+	for _, def := range mdl.defs {
+		mdl.nodes[def.ID] = &LinkedNode{d: def}
+	}
+	Cfg.Env.NumNodes = len(mdl.defs)
+	netw := NewNetwork(mdl, len(mdl.defs))
+	netw.RunStepped(nil)
+	defer netw.Stop()
+	node := func(id int) *SimNode {
+		return mdl.nodes[id].n
+	}
+	if !mdl.Connectivity(node(3), node(2)) || mdl.Connectivity(node(2), node(3)) {
+		t.Fatal("link is not one-way")
+	}
+	for netw.Step(); netw.Pending() > 0 || netw.stepped.epoch < 3; {
+		netw.Step()
+	}
+	// node 3 learns routes via node 2 (which can't reach node 3): the
+	// reverse route is broken.
+	if next, hops := node(3).Forward(node(1).PeerID()); !next.Equal(node(2).PeerID()) || hops != 2 {
+		t.Fatalf("node 3 has no route to node 1 via node 2: %s/%d", next, hops)
+	}
+	for _, id := range []int{1, 2} {
+		if _, hops := node(id).Forward(node(3).PeerID()); hops != 0 {
+			t.Fatalf("node %d has a route to node 3", id)
+		}
+	}
+	// only the bidirectional link is an edge in the connectivity graph
+	g := netw.Graph()
+	if g.Distance(1, 2) != 1 || g.Distance(2, 3) >= 0 {
+		t.Fatalf("unexpected graph distances: %d/%d", g.Distance(1, 2), g.Distance(2, 3))
+	}
+}
+
+func TestReadNodeDefs(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		fn := filepath.Join(dir, name)
+		if err := os.WriteFile(fn, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return fn
+	}
+	fnJSON := write("nodes.json", `[
+	{"id": 1, "x": 10, "y": 25, "links": [2]},
+	{"id": 2, "x": 30, "y": 25.5, "ttl": 12, "links": [1, 3]},
+	{"id": 3, "x": 70, "y": 25}
+]`)
+	fnCSV := write("nodes.csv", `id,x,y,ttl,links
+1,10,25,0,2
+2,30,25.5,12,1,3
+3,70,25,
+`)
+	defsJSON, err := ReadNodeDefs(fnJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defsCSV, err := ReadNodeDefs(fnCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defsCSV) != 3 || !reflect.DeepEqual(defsJSON, defsCSV) {
+		t.Fatalf("node definitions differ: %v != %v", defsJSON, defsCSV)
+	}
+	// the resulting models are equal
+	env := *Cfg.Env
+	defer func() { *Cfg.Env = env }()
+	for _, fn := range []string{fnJSON, fnCSV} {
+		mdl := BuildEnvironment(&EnvironCfg{Class: "link", NodesRef: fn}).(*LinkModel)
+		if Cfg.Env.NumNodes != 3 || len(mdl.nodes) != 3 {
+			t.Fatalf("%s: %d nodes in model", fn, len(mdl.nodes))
+		}
+		if r2, pos := mdl.Placement(1); r2 != 0 || pos.X != 30 || pos.Y != 25.5 {
+			t.Fatalf("%s: node 2 placed at %s", fn, pos)
+		}
+		if mdl.nodes[2].d.TTL != 12 || !reflect.DeepEqual(mdl.nodes[2].d.Links, []int{1, 3}) {
+			t.Fatalf("%s: node 2 is %v", fn, mdl.nodes[2].d)
+		}
+	}
+	// links to undefined nodes are rejected
+	if _, err = ReadNodeDefs(write("bad.csv", "1,0,0,0,2\n2,0,0,0,3\n")); !errors.Is(err, ErrNodeLink) {
+		t.Fatalf("undefined link accepted: %v", err)
+	}
+	if _, err = ReadNodeDefs(write("bad.json", `[{"id": 1, "links": [7]}]`)); !errors.Is(err, ErrNodeLink) {
+		t.Fatalf("undefined link accepted: %v", err)
+	}
+	// malformed records are rejected
+	if _, err = ReadNodeDefs(write("bad2.csv", "1,0,0,0\n2,0,0\n")); !errors.Is(err, ErrNodeFormat) {
+		t.Fatalf("malformed record accepted: %v", err)
+	}
+}
@@ -0,0 +1,244 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"leatea/core"
+	"os"
+	"strings"
+)
+
+// Binary event log: a log starts with a header (magic and version) that
+// identifies the layout of the following entries.
+const (
+	LogMagic   = "LTEA" // magic bytes of an event log
+	LogVersion = 2      // version of the log layout
+)
+
+// Error codes
+var (
+	ErrLogTruncated = errors.New("event log truncated (no header)")
+	ErrLogMagic     = errors.New("not an event log (invalid magic)")
+)
+
+// WriteLogHeader writes the header of an event log
+func WriteLogHeader(w io.Writer) error {
+	if _, err := io.WriteString(w, LogMagic); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, uint16(LogVersion))
+}
+
+// ReadLogHeader reads and validates the header of an event log
+func ReadLogHeader(r io.Reader) error {
+	hdr := make([]byte, len(LogMagic)+2)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrLogTruncated
+		}
+		return err
+	}
+	if string(hdr[:len(LogMagic)]) != LogMagic {
+		return ErrLogMagic
+	}
+	if v := binary.BigEndian.Uint16(hdr[len(LogMagic):]); v != LogVersion {
+		return fmt.Errorf("unsupported event log version %d (expected %d)", v, LogVersion)
+	}
+	return nil
+}
+
+//----------------------------------------------------------------------
+// Log entries
+//----------------------------------------------------------------------
+
+// LogEntry is a representation of an entry in the log file
+type LogEntry struct {
+	// mandatory fields
+	Type uint32   // event type
+	TS   int64    // time stamp (event handler)
+	Seq  uint32   // sequence number (global)
+	Peer [32]byte // event sender
+
+	// EvForwardChanged, EvForwardLearned, EvNeighborAdded,
+	// EvNeighborExpired, EvNeighborUpdated, EvRelayRemoved,
+	// EvLoopDetect, EvTraffic
+	Ref [32]byte // reference peer
+
+	// EvForwardChanged, EvForwardLearned
+	Target   [32]byte
+	WithNext uint32
+	NextHop  [32]byte
+	Hops     uint32
+
+	// EvNodeTraffic
+	TraffIn  uint64
+	TraffOut uint64
+
+	// EvNodeAdded, EvNodeRemoved
+	Idx      uint16
+	Running  uint16
+	Pending  uint16
+	X, Y, R2 float64
+
+	// EvEpoch
+	Epoch uint32
+}
+
+// ReadLogEntry reads the next entry from an event log (after the header).
+// Returns io.EOF at the end of the log.
+func ReadLogEntry(r io.Reader) (ev *LogEntry, err error) {
+	// read mandatory fields
+	ev = new(LogEntry)
+	if err = binary.Read(r, binary.BigEndian, &ev.Type); err != nil {
+		return nil, err
+	}
+	_ = binary.Read(r, binary.BigEndian, &ev.TS)
+	_ = binary.Read(r, binary.BigEndian, &ev.Seq)
+	_, _ = io.ReadFull(r, ev.Peer[:])
+
+	// read additional fields depending on type
+	flag := make([]byte, 1)
+	switch ev.Type {
+	case EvEpoch:
+		_ = binary.Read(r, binary.BigEndian, &ev.Epoch)
+
+	case EvNodeAdded, EvNodeRemoved:
+		_ = binary.Read(r, binary.BigEndian, &ev.X)
+		_ = binary.Read(r, binary.BigEndian, &ev.Y)
+		_ = binary.Read(r, binary.BigEndian, &ev.R2)
+		_ = binary.Read(r, binary.BigEndian, &ev.Idx)
+		_ = binary.Read(r, binary.BigEndian, &ev.Running)
+		_ = binary.Read(r, binary.BigEndian, &ev.Pending)
+
+	case core.EvForwardChanged, core.EvForwardLearned:
+		_, _ = io.ReadFull(r, ev.Ref[:])
+		_, _ = io.ReadFull(r, ev.Target[:])
+		_, _ = io.ReadFull(r, flag)
+		ev.WithNext = 0
+		if flag[0] == 1 {
+			ev.WithNext = 1
+			_, _ = io.ReadFull(r, ev.NextHop[:])
+		}
+		var hops int16
+		_ = binary.Read(r, binary.BigEndian, &hops)
+
+	case EvNodeTraffic:
+		_ = binary.Read(r, binary.BigEndian, &ev.TraffIn)
+		_ = binary.Read(r, binary.BigEndian, &ev.TraffOut)
+
+	case core.EvNeighborAdded, core.EvNeighborExpired,
+		core.EvNeighborUpdated, core.EvRelayRemoved, core.EvLoopDetect:
+		_, _ = io.ReadFull(r, ev.Ref[:])
+
+	case core.EvSanityViolation:
+		// no additional fields
+
+	default:
+		return nil, fmt.Errorf("unknown log entry type %d", ev.Type)
+	}
+	return ev, nil
+}
+
+//----------------------------------------------------------------------
+
+// logFile is an event log file with an optional gzip layer
+type logFile struct {
+	f  *os.File
+	gw *gzip.Writer
+	gr *gzip.Reader
+	r  io.Reader
+}
+
+// Write to log (compressed if required)
+func (l *logFile) Write(buf []byte) (int, error) {
+	if l.gw != nil {
+		return l.gw.Write(buf)
+	}
+	return l.f.Write(buf)
+}
+
+// Read from log (decompressed if required)
+func (l *logFile) Read(buf []byte) (int, error) {
+	return l.r.Read(buf)
+}
+
+// Close log: flush and close the gzip layer and the file.
+func (l *logFile) Close() (err error) {
+	if l.gw != nil {
+		err = l.gw.Close()
+	}
+	if l.gr != nil {
+		err = l.gr.Close()
+	}
+	if err2 := l.f.Close(); err == nil {
+		err = err2
+	}
+	return
+}
+
+// CreateLog creates a new event log and writes the log header. The log
+// is gzip-compressed if the file name ends in ".gz".
+func CreateLog(fn string) (io.WriteCloser, error) {
+	f, err := os.Create(fn)
+	if err != nil {
+		return nil, err
+	}
+	l := &logFile{f: f}
+	if strings.HasSuffix(fn, ".gz") {
+		l.gw = gzip.NewWriter(f)
+	}
+	if err = WriteLogHeader(l); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// OpenLog opens an event log for reading and validates the log header.
+// Compressed logs (gzip) are detected and decompressed transparently.
+func OpenLog(fn string) (io.ReadCloser, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	l := &logFile{f: f}
+	br := bufio.NewReader(f)
+	l.r = br
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		if l.gr, err = gzip.NewReader(br); err != nil {
+			l.Close()
+			return nil, err
+		}
+		l.r = bufio.NewReader(l.gr)
+	}
+	if err = ReadLogHeader(l); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
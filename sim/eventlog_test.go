@@ -0,0 +1,54 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLogHeader(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := WriteLogHeader(buf); err != nil {
+		t.Fatal(err)
+	}
+	hdr := buf.Bytes()
+	// valid header (followed by entries)
+	if err := ReadLogHeader(bytes.NewReader(append(hdr, 0, 0, 0, 1))); err != nil {
+		t.Fatal(err)
+	}
+	// truncated header
+	for _, n := range []int{0, 3, len(hdr) - 1} {
+		if err := ReadLogHeader(bytes.NewReader(hdr[:n])); err != ErrLogTruncated {
+			t.Fatalf("truncated header (%d bytes): %v", n, err)
+		}
+	}
+	// wrong magic (e.g. an unversioned log starting with an entry)
+	if err := ReadLogHeader(bytes.NewReader([]byte{0, 0, 0, 100, 0, 0})); err != ErrLogMagic {
+		t.Fatalf("wrong magic: %v", err)
+	}
+	// wrong version
+	bad := append([]byte(nil), hdr...)
+	bad[len(bad)-1]++
+	if err := ReadLogHeader(bytes.NewReader(bad)); err == nil {
+		t.Fatal("wrong version accepted")
+	}
+}
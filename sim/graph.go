@@ -0,0 +1,165 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"container/heap"
+	"sort"
+)
+
+//----------------------------------------------------------------------
+// Connectivity graph (independent of routing)
+//----------------------------------------------------------------------
+
+// Graph of undirected links between nodes (identified by integers)
+type Graph struct {
+	links map[int]map[int]bool
+}
+
+// NewGraph creates an empty graph
+func NewGraph() *Graph {
+	return &Graph{
+		links: make(map[int]map[int]bool),
+	}
+}
+
+// AddNode to graph (without links)
+func (g *Graph) AddNode(n int) {
+	if _, ok := g.links[n]; !ok {
+		g.links[n] = make(map[int]bool)
+	}
+}
+
+// AddEdge between two nodes
+func (g *Graph) AddEdge(n1, n2 int) {
+	g.AddNode(n1)
+	g.AddNode(n2)
+	g.links[n1][n2] = true
+	g.links[n2][n1] = true
+}
+
+// Nodes returns a sorted list of nodes in the graph
+func (g *Graph) Nodes() (list []int) {
+	for n := range g.links {
+		list = append(list, n)
+	}
+	sort.Ints(list)
+	return
+}
+
+// Neighbors returns a sorted list of direct neighbors of a node
+func (g *Graph) Neighbors(n int) (list []int) {
+	for nb := range g.links[n] {
+		list = append(list, nb)
+	}
+	sort.Ints(list)
+	return
+}
+
+// Distances returns the number of hops from a node to all reachable
+// nodes in the graph (Dijkstra with unit weights).
+func (g *Graph) Distances(from int) map[int]int {
+	dist := make(map[int]int)
+	if _, ok := g.links[from]; !ok {
+		return dist
+	}
+	dist[from] = 0
+	pq := &distQueue{{from, 0}}
+	for pq.Len() > 0 {
+		cur, _ := heap.Pop(pq).(distItem)
+		if cur.dist > dist[cur.node] {
+			continue
+		}
+		for nb := range g.links[cur.node] {
+			d := cur.dist + 1
+			if old, ok := dist[nb]; !ok || d < old {
+				dist[nb] = d
+				heap.Push(pq, distItem{nb, d})
+			}
+		}
+	}
+	return dist
+}
+
+// Distance returns the number of hops between two nodes (or -1 if the
+// target is not reachable).
+func (g *Graph) Distance(from, to int) int {
+	if d, ok := g.Distances(from)[to]; ok {
+		return d
+	}
+	return -1
+}
+
+// Components returns the connected components of the graph as sorted
+// lists of nodes. Components are ordered by size (largest first); equal
+// sized components are ordered by their smallest node.
+func (g *Graph) Components() (list [][]int) {
+	seen := make(map[int]bool)
+	for _, n := range g.Nodes() {
+		if seen[n] {
+			continue
+		}
+		var comp []int
+		seen[n] = true
+		queue := []int{n}
+		for len(queue) > 0 {
+			cur := queue[0]
+			queue = queue[1:]
+			comp = append(comp, cur)
+			for nb := range g.links[cur] {
+				if !seen[nb] {
+					seen[nb] = true
+					queue = append(queue, nb)
+				}
+			}
+		}
+		sort.Ints(comp)
+		list = append(list, comp)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return len(list[i]) > len(list[j])
+	})
+	return
+}
+
+// priority queue for Dijkstra
+type distItem struct {
+	node, dist int
+}
+
+type distQueue []distItem
+
+func (q distQueue) Len() int           { return len(q) }
+func (q distQueue) Less(i, j int) bool { return q[i].dist < q[j].dist }
+func (q distQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *distQueue) Push(x any) {
+	item, _ := x.(distItem)
+	*q = append(*q, item)
+}
+
+func (q *distQueue) Pop() any {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	*q = old[:n-1]
+	return item
+}
@@ -0,0 +1,132 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// breadth-first search for hop distances
+func bfs(g *Graph, from int) map[int]int {
+	dist := map[int]int{from: 0}
+	queue := []int{from}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, nb := range g.Neighbors(cur) {
+			if _, ok := dist[nb]; !ok {
+				dist[nb] = dist[cur] + 1
+				queue = append(queue, nb)
+			}
+		}
+	}
+	return dist
+}
+
+func TestDistances(t *testing.T) {
+	// random routing table (neighbor relations only)
+	rnd := rand.New(rand.NewSource(Seed)) //nolint:gosec // deterministic testing
+	rt := NewRoutingTable()
+	for i := 1; i <= 50; i++ {
+		rt.List[i] = &RTEntry{Forwards: make(map[int]int)}
+	}
+	for k := 0; k < 80; k++ {
+		i1, i2 := 1+rnd.Intn(50), 1+rnd.Intn(50)
+		if i1 != i2 {
+			rt.List[i1].Forwards[i2] = i2
+			rt.List[i2].Forwards[i1] = i1
+		}
+	}
+	g := rt.Graph()
+	for _, from := range []int{1, 17, 42} {
+		dist := rt.Distances(from)
+		ref := bfs(g, from)
+		if len(dist) != len(ref) {
+			t.Fatalf("%d reachable nodes (expected %d)", len(dist), len(ref))
+		}
+		for to, d := range ref {
+			if dist[to] != d {
+				t.Fatalf("distance %d -> %d: %d (expected %d)", from, to, dist[to], d)
+			}
+		}
+	}
+	if g.Distance(1, 999) != -1 {
+		t.Fatal("unknown node reachable")
+	}
+}
+
+func TestComponents(t *testing.T) {
+	// split topology: triangle 1-2-3, line 4-5-6-7 and isolated node 8
+	g := NewGraph()
+	g.AddEdge(1, 2)
+	g.AddEdge(2, 3)
+	g.AddEdge(3, 1)
+	g.AddEdge(7, 6)
+	g.AddEdge(5, 4)
+	g.AddEdge(6, 5)
+	g.AddNode(8)
+	exp := [][]int{{4, 5, 6, 7}, {1, 2, 3}, {8}}
+	if comps := g.Components(); !reflect.DeepEqual(comps, exp) {
+		t.Fatalf("components %v (expected %v)", comps, exp)
+	}
+	// joining the line and the triangle leaves two components
+	g.AddEdge(3, 4)
+	exp = [][]int{{1, 2, 3, 4, 5, 6, 7}, {8}}
+	if comps := g.Components(); !reflect.DeepEqual(comps, exp) {
+		t.Fatalf("components %v (expected %v)", comps, exp)
+	}
+}
+
+func TestNetworkGraph(t *testing.T) {
+	defer func(n int) { Cfg.Env.NumNodes = n }(Cfg.Env.NumNodes)
+	Cfg.Env.NumNodes = 30
+	netw := NewNetwork(new(RndModel), Cfg.Env.NumNodes)
+	netw.RunStepped(nil)
+	defer netw.Stop()
+
+	// stopped nodes are not part of the graph
+	netw.StopNode(netw.NodeByID(5))
+	g := netw.Graph()
+	if len(g.Nodes()) != Cfg.Env.NumNodes-1 {
+		t.Fatalf("%d nodes in graph", len(g.Nodes()))
+	}
+	// neighbors are the running nodes with a bidirectional link
+	links := 0
+	for _, id := range g.Nodes() {
+		n1 := netw.NodeByID(id)
+		var nbs []int
+		for _, n2 := range netw.stepped.sorted {
+			if n2 != n1 && n2.IsRunning() &&
+				netw.env.Connectivity(n1, n2) && netw.env.Connectivity(n2, n1) {
+				nbs = append(nbs, n2.id)
+			}
+		}
+		if !reflect.DeepEqual(g.Neighbors(id), nbs) {
+			t.Fatalf("node %d: neighbors %v != %v", id, g.Neighbors(id), nbs)
+		}
+		links += len(nbs)
+	}
+	if links == 0 {
+		t.Fatal("no links in graph")
+	}
+}
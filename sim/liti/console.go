@@ -0,0 +1,148 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"leatea/core"
+	"leatea/sim"
+	"strconv"
+	"strings"
+)
+
+// Error codes
+var (
+	ErrCmdUnknown = errors.New("unknown command")
+	ErrCmdArgs    = errors.New("invalid arguments")
+	ErrNodeDown   = errors.New("node not running")
+)
+
+// Controller of a running network (implemented by sim.Network)
+type Controller interface {
+	NodeByID(id int) *sim.SimNode
+	StopNode(node *sim.SimNode) int
+	ReviveNode(id int) error
+	GetShortID(p *core.PeerID) int
+	Stats() (int, int, int, int)
+}
+
+// Console reads commands (one per line) to control a running network:
+//
+//	kill <id>    stop a running node
+//	revive <id>  restart a stopped node
+//	table <id>   print the forward table of a node
+//	stats        print network statistics
+//	help         list commands
+type Console struct {
+	ctrl Controller
+	out  io.Writer
+}
+
+// NewConsole creates a console for a network writing responses to 'out'
+func NewConsole(ctrl Controller, out io.Writer) *Console {
+	return &Console{
+		ctrl: ctrl,
+		out:  out,
+	}
+}
+
+// Run the console: execute commands from the reader until it is closed.
+func (c *Console) Run(in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		if err := c.Exec(scanner.Text()); err != nil {
+			fmt.Fprintf(c.out, "error: %s\n", err.Error())
+		}
+	}
+}
+
+// Exec a single command line (empty lines are ignored)
+func (c *Console) Exec(line string) error {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return nil
+	}
+	switch args[0] {
+	case "kill":
+		id, node, err := c.node(args)
+		if err != nil {
+			return err
+		}
+		if running := c.ctrl.StopNode(node); running < 0 {
+			return fmt.Errorf("%w: %d", ErrNodeDown, id)
+		}
+		fmt.Fprintf(c.out, "node %d stopped\n", id)
+
+	case "revive":
+		id, _, err := c.node(args)
+		if err != nil {
+			return err
+		}
+		if err = c.ctrl.ReviveNode(id); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "node %d revived\n", id)
+
+	case "table":
+		id, node, err := c.node(args)
+		if err != nil {
+			return err
+		}
+		cv := func(p *core.PeerID) string {
+			return strconv.Itoa(c.ctrl.GetShortID(p))
+		}
+		fmt.Fprintf(c.out, "node %d: %s\n", id, node.ListTable(cv, false))
+
+	case "stats":
+		if len(args) != 1 {
+			return fmt.Errorf("%w: %s", ErrCmdArgs, line)
+		}
+		running, started, removals, dropped := c.ctrl.Stats()
+		fmt.Fprintf(c.out, "%d nodes running (%d started, %d removals pending, %d dropped deliveries)\n",
+			running, started, removals, dropped)
+
+	case "help":
+		fmt.Fprintln(c.out, "commands: kill <id>, revive <id>, table <id>, stats, help")
+
+	default:
+		return fmt.Errorf("%w: %s", ErrCmdUnknown, args[0])
+	}
+	return nil
+}
+
+// get the node addressed in a command ("<cmd> <id>")
+func (c *Console) node(args []string) (id int, node *sim.SimNode, err error) {
+	if len(args) != 2 {
+		err = fmt.Errorf("%w: %s", ErrCmdArgs, strings.Join(args, " "))
+		return
+	}
+	if id, err = strconv.Atoi(args[1]); err != nil {
+		err = fmt.Errorf("%w: %s", ErrCmdArgs, err.Error())
+		return
+	}
+	if node = c.ctrl.NodeByID(id); node == nil {
+		err = fmt.Errorf("%w: %d", sim.ErrNodeUnknown, id)
+	}
+	return
+}
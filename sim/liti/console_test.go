@@ -0,0 +1,155 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"leatea/core"
+	"leatea/sim"
+	"strings"
+	"testing"
+)
+
+// network controller with two nodes (1 running, 2 stopped)
+type testController struct {
+	nodes   map[int]*sim.SimNode
+	running map[int]bool
+}
+
+func newTestController() *testController {
+	tc := &testController{
+		nodes:   make(map[int]*sim.SimNode),
+		running: map[int]bool{1: true},
+	}
+	for _, id := range []int{1, 2} {
+		tc.nodes[id] = sim.NewSimNode(core.NewPeerPrivate(), nil, &sim.Position{}, 1)
+	}
+	return tc
+}
+
+func (tc *testController) NodeByID(id int) *sim.SimNode {
+	return tc.nodes[id]
+}
+
+func (tc *testController) id(node *sim.SimNode) int {
+	for id, n := range tc.nodes {
+		if n == node {
+			return id
+		}
+	}
+	return -1
+}
+
+func (tc *testController) StopNode(node *sim.SimNode) int {
+	id := tc.id(node)
+	if !tc.running[id] {
+		return -1
+	}
+	tc.running[id] = false
+	return 0
+}
+
+func (tc *testController) ReviveNode(id int) error {
+	if tc.running[id] {
+		return core.ErrNodeRunning
+	}
+	tc.running[id] = true
+	return nil
+}
+
+func (tc *testController) GetShortID(p *core.PeerID) int {
+	for id, n := range tc.nodes {
+		if n.PeerID().Equal(p) {
+			return id
+		}
+	}
+	return -1
+}
+
+func (tc *testController) Stats() (int, int, int, int) {
+	num := 0
+	for _, ok := range tc.running {
+		if ok {
+			num++
+		}
+	}
+	return num, 2, 0, 0
+}
+
+func TestConsole(t *testing.T) {
+	tc := newTestController()
+	out := new(strings.Builder)
+	con := NewConsole(tc, out)
+
+	for _, cmd := range []struct {
+		line string
+		err  error
+		out  string
+	}{
+		{"", nil, ""},
+		{"stats", nil, "1 nodes running"},
+		{"kill 1", nil, "node 1 stopped"},
+		{"kill 1", ErrNodeDown, ""},
+		{"revive 2", nil, "node 2 revived"},
+		{"revive 2", core.ErrNodeRunning, ""},
+		{"revive 7", sim.ErrNodeUnknown, ""},
+		{"table 1", nil, "node 1: ["},
+		{"stats", nil, "1 nodes running"},
+		{"kill", ErrCmdArgs, ""},
+		{"kill x", ErrCmdArgs, ""},
+		{"jump 1", ErrCmdUnknown, ""},
+	} {
+		out.Reset()
+		if err := con.Exec(cmd.line); !errors.Is(err, cmd.err) {
+			t.Fatalf("%q: error %v (expected %v)", cmd.line, err, cmd.err)
+		}
+		if !strings.Contains(out.String(), cmd.out) {
+			t.Fatalf("%q: output %q", cmd.line, out.String())
+		}
+	}
+	if tc.running[1] || !tc.running[2] {
+		t.Fatalf("wrong node states: %v", tc.running)
+	}
+}
+
+func TestConsoleScript(t *testing.T) {
+	tc := newTestController()
+	out := new(strings.Builder)
+	script := strings.Join([]string{"kill 1", "revive 1", "bogus", "stats"}, "\n")
+	NewConsole(tc, out).Run(strings.NewReader(script))
+
+	exp := []string{
+		"node 1 stopped",
+		"node 1 revived",
+		fmt.Sprintf("error: %s: bogus", ErrCmdUnknown),
+		"1 nodes running",
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(exp) {
+		t.Fatalf("%d lines of output:\n%s", len(lines), out.String())
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, exp[i]) {
+			t.Fatalf("line %d: %q (expected %q)", i+1, line, exp[i])
+		}
+	}
+}
@@ -21,12 +21,13 @@
 package main
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"leatea/core"
 	"leatea/sim"
 	"log"
-	"os"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -38,7 +39,8 @@ type EventHandler struct {
 
 	changed bool
 	redraw  bool
-	log     *os.File
+	log     io.WriteCloser
+	stream  *EventStream
 	seq     atomic.Uint32
 }
 
@@ -51,16 +53,35 @@ func NewEventHandler() *EventHandler {
 	logName := sim.Cfg.Options.EventLog
 	if len(logName) > 0 {
 		var err error
-		if hdlr.log, err = os.Create(logName); err != nil {
+		if hdlr.log, err = sim.CreateLog(logName); err != nil {
 			log.Fatal(err)
 		}
 	}
+	if addr := sim.Cfg.Options.EventStream; len(addr) > 0 {
+		var err error
+		if hdlr.stream, err = NewEventStream(addr); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Streaming events on %s", hdlr.stream.Addr())
+	}
 	return hdlr
 }
 
 func (hdlr *EventHandler) Close() {
+	hdlr.Lock()
+	defer hdlr.Unlock()
 	if hdlr.log != nil {
-		hdlr.log.Close()
+		// flush compressed log
+		if err := hdlr.log.Close(); err != nil {
+			log.Printf("event log: %s", err.Error())
+		}
+		hdlr.log = nil
+	}
+	if hdlr.stream != nil {
+		if err := hdlr.stream.Close(); err != nil {
+			log.Printf("event stream: %s", err.Error())
+		}
+		hdlr.stream = nil
 	}
 }
 
@@ -75,6 +96,21 @@ func (hdlr *EventHandler) State() (changed, redraw bool) {
 	return
 }
 
+// inFocus returns true if the event is related to a focused peer (or if
+// no focus is set).
+func (hdlr *EventHandler) inFocus(ev *core.Event) bool {
+	focus := sim.Cfg.Options.FocusPeers
+	if len(focus) == 0 {
+		return true
+	}
+	for _, id := range focus {
+		if ev.Peer.String() == id || ev.Ref.String() == id {
+			return true
+		}
+	}
+	return false
+}
+
 func (hdlr *EventHandler) printEntry(f *core.Entry) string {
 	return fmt.Sprintf("{%s,%s,%d,%.3f}",
 		f.Peer, f.NextHop, f.Hops, f.Origin.Age().Seconds())
@@ -105,6 +141,9 @@ func (hdlr *EventHandler) HandleEvent(ev *core.Event) {
 	if !sim.Cfg.Options.ShowEvents {
 		show = !show
 	}
+	if show && !hdlr.inFocus(ev) {
+		show = false
+	}
 	// log network events
 	switch ev.Type {
 
@@ -121,9 +160,9 @@ func (hdlr *EventHandler) HandleEvent(ev *core.Event) {
 	//------------------------------------------------------------------
 	case sim.EvNodeRemoved:
 		if show {
-			val := core.GetVal[[]int](ev)
+			val := core.GetVal[*sim.NodeRemovedVal](ev)
 			log.Printf("[%s] %d stopped (%d running)",
-				ev.Peer, val[0], val[1])
+				ev.Peer, val.Idx, val.Running)
 		}
 		hdlr.WriteLog(ev, gs)
 		hdlr.redraw = true
@@ -189,6 +228,13 @@ func (hdlr *EventHandler) HandleEvent(ev *core.Event) {
 		hdlr.WriteLog(ev, gs)
 		hdlr.changed = true
 
+	//------------------------------------------------------------------
+	case core.EvRelayUpdated:
+		if show {
+			log.Printf("[%s] switched route to %s", ev.Peer, ev.Ref)
+		}
+		hdlr.changed = true
+
 	//------------------------------------------------------------------
 	case core.EvRelayRevived:
 		if show {
@@ -209,26 +255,41 @@ func (hdlr *EventHandler) HandleEvent(ev *core.Event) {
 			log.Printf("[%s] learning from %s", ev.Peer, ev.Ref)
 		}
 
+	//------------------------------------------------------------------
+	case core.EvLearnReceived:
+		if show {
+			log.Printf("[%s] LEArn from %s", ev.Peer, ev.Ref)
+		}
+
 	//------------------------------------------------------------------
 	case core.EvTeaching:
 		if show {
 			val := core.GetVal[[]any](ev)
-			msg, _ := val[0].(*core.TEAchMsg)
-			counts, _ := val[1].([4]int)
-			log.Printf("[%s] teaching: %d removed, %d unfiltered, %d pending, %d skipped",
-				ev.Peer, counts[0], counts[1], counts[2], counts[3])
-			announced := make([]string, 0)
-			for _, ann := range msg.Announce {
-				e := &core.Entry{
-					Peer:    ann.Peer,
-					Hops:    ann.Hops,
-					NextHop: msg.Sender(),
-					Origin:  core.TimeFromAge(ann.Age),
+			out, _ := val[0].([]*core.TEAchMsg)
+			counts, _ := val[1].([3]int)
+			log.Printf("[%s] teaching: %d removed, %d unfiltered, %d pending (%d messages)",
+				ev.Peer, counts[0], counts[1], counts[2], len(out))
+			for _, msg := range out {
+				announced := make([]string, 0)
+				for _, ann := range msg.Announce {
+					e := &core.Entry{
+						Peer:    ann.Peer,
+						Hops:    ann.Hops,
+						NextHop: msg.Sender(),
+						Origin:  core.TimeFromAge(ann.Age),
+					}
+					announced = append(announced, hdlr.printEntry(e))
 				}
-				announced = append(announced, hdlr.printEntry(e))
+				log.Printf("[%s] TEAch [%s]",
+					ev.Peer, strings.Join(announced, ","))
 			}
-			log.Printf("[%s] TEAch [%s]",
-				ev.Peer, strings.Join(announced, ","))
+		}
+
+	//------------------------------------------------------------------
+	case core.EvBeaconReceived:
+		if show {
+			log.Printf("[%s] beacon from %s (%d neighbors)",
+				ev.Peer, ev.Ref, core.GetVal[int](ev))
 		}
 
 	//------------------------------------------------------------------
@@ -247,6 +308,32 @@ func (hdlr *EventHandler) HandleEvent(ev *core.Event) {
 				ev.Peer, hdlr.printEntry(entry),
 				ev.Ref, hdlr.printForward(announce))
 		}
+		hdlr.WriteLog(ev, gs)
+
+	//------------------------------------------------------------------
+	case core.EvHopLimitExceeded:
+		if show {
+			e := core.GetVal[*core.Entry](ev)
+			log.Printf("[%s < %s] hop limit exceeded: %s",
+				ev.Peer, ev.Ref, hdlr.printEntry(e))
+		}
+		hdlr.changed = true
+
+	//------------------------------------------------------------------
+	case core.EvBloomFalsePositive:
+		if show {
+			target := core.GetVal[*core.PeerID](ev)
+			log.Printf("[%s > %s] withheld %s (false positive in LEArn filter)",
+				ev.Peer, ev.Ref, target)
+		}
+
+	//------------------------------------------------------------------
+	case core.EvSanityViolation:
+		if show {
+			v := core.GetVal[*core.Violation](ev)
+			log.Printf("[%s] sanity violation: %s", ev.Peer, v)
+		}
+		hdlr.WriteLog(ev, gs)
 
 	//------------------------------------------------------------------
 	case sim.EvNodeTraffic:
@@ -256,61 +343,87 @@ func (hdlr *EventHandler) HandleEvent(ev *core.Event) {
 				sim.Scale(float64(val[0])), sim.Scale(float64(val[1])))
 		}
 		hdlr.WriteLog(ev, gs)
+
+	//------------------------------------------------------------------
+	case sim.EvEpoch:
+		hdlr.WriteLog(ev, gs)
 	}
 }
 
-func (hdlr *EventHandler) writeEntry(e *core.Entry) {
-	_, _ = hdlr.log.Write(e.Peer.Data)
+func (hdlr *EventHandler) writeEntry(w io.Writer, e *core.Entry) {
+	_, _ = w.Write(e.Peer.Data)
 	if e.NextHop == nil {
-		_, _ = hdlr.log.Write([]byte{0})
+		_, _ = w.Write([]byte{0})
 	} else {
-		_, _ = hdlr.log.Write([]byte{1})
-		_, _ = hdlr.log.Write(e.NextHop.Data)
+		_, _ = w.Write([]byte{1})
+		_, _ = w.Write(e.NextHop.Data)
 	}
-	_ = binary.Write(hdlr.log, binary.BigEndian, e.Hops)
+	_ = binary.Write(w, binary.BigEndian, e.Hops)
 }
 
 func (hdlr *EventHandler) WriteLog(ev *core.Event, gs uint32) {
-	if hdlr.log == nil {
+	if hdlr.log == nil && hdlr.stream == nil {
 		return
 	}
-	_ = binary.Write(hdlr.log, binary.BigEndian, uint32(ev.Type))
-	_ = binary.Write(hdlr.log, binary.BigEndian, time.Now().UnixMicro())
-	_ = binary.Write(hdlr.log, binary.BigEndian, gs)
-	_, _ = hdlr.log.Write(ev.Peer.Data)
+	// encode event record
+	w := new(bytes.Buffer)
+	_ = binary.Write(w, binary.BigEndian, uint32(ev.Type))
+	_ = binary.Write(w, binary.BigEndian, time.Now().UnixMicro())
+	_ = binary.Write(w, binary.BigEndian, gs)
+	if ev.Peer != nil {
+		_, _ = w.Write(ev.Peer.Data)
+	} else {
+		// network events (no peer)
+		_, _ = w.Write(make([]byte, ev.Peer.Size()))
+	}
 	switch ev.Type {
 
 	case sim.EvNodeAdded:
 		val := core.GetVal[*sim.NodeAddedVal](ev)
-		_ = binary.Write(hdlr.log, binary.BigEndian, val.X)
-		_ = binary.Write(hdlr.log, binary.BigEndian, val.Y)
-		_ = binary.Write(hdlr.log, binary.BigEndian, val.R2)
-		_ = binary.Write(hdlr.log, binary.BigEndian, val.Idx)
-		_ = binary.Write(hdlr.log, binary.BigEndian, val.Running)
-		_ = binary.Write(hdlr.log, binary.BigEndian, val.Pending)
+		_ = binary.Write(w, binary.BigEndian, val.X)
+		_ = binary.Write(w, binary.BigEndian, val.Y)
+		_ = binary.Write(w, binary.BigEndian, val.R2)
+		_ = binary.Write(w, binary.BigEndian, val.Idx)
+		_ = binary.Write(w, binary.BigEndian, val.Running)
+		_ = binary.Write(w, binary.BigEndian, val.Pending)
 
 	case sim.EvNodeRemoved:
-		val := core.GetVal[[]int](ev)
-		_ = binary.Write(hdlr.log, binary.BigEndian, uint16(val[1]))
-		_ = binary.Write(hdlr.log, binary.BigEndian, uint16(val[2]))
+		val := core.GetVal[*sim.NodeRemovedVal](ev)
+		_ = binary.Write(w, binary.BigEndian, val.X)
+		_ = binary.Write(w, binary.BigEndian, val.Y)
+		_ = binary.Write(w, binary.BigEndian, val.R2)
+		_ = binary.Write(w, binary.BigEndian, val.Idx)
+		_ = binary.Write(w, binary.BigEndian, val.Running)
+		_ = binary.Write(w, binary.BigEndian, val.Pending)
 
 	case core.EvForwardChanged:
-		_, _ = hdlr.log.Write(ev.Ref.Data)
+		_, _ = w.Write(ev.Ref.Data)
 		val := core.GetVal[[3]*core.Entry](ev)
-		hdlr.writeEntry(val[2])
+		hdlr.writeEntry(w, val[2])
 
 	case core.EvForwardLearned:
-		_, _ = hdlr.log.Write(ev.Ref.Data)
+		_, _ = w.Write(ev.Ref.Data)
 		e := core.GetVal[*core.Entry](ev)
-		hdlr.writeEntry(e)
+		hdlr.writeEntry(w, e)
 
 	case sim.EvNodeTraffic:
 		val := core.GetVal[[]uint64](ev)
-		_ = binary.Write(hdlr.log, binary.BigEndian, val[0])
-		_ = binary.Write(hdlr.log, binary.BigEndian, val[1])
+		_ = binary.Write(w, binary.BigEndian, val[0])
+		_ = binary.Write(w, binary.BigEndian, val[1])
+
+	case sim.EvEpoch:
+		_ = binary.Write(w, binary.BigEndian, uint32(core.GetVal[int](ev)))
 
 	case core.EvNeighborAdded, core.EvNeighborUpdated,
-		core.EvNeighborExpired, core.EvRelayRemoved:
-		_, _ = hdlr.log.Write(ev.Ref.Data)
+		core.EvNeighborExpired, core.EvRelayRemoved, core.EvLoopDetect:
+		_, _ = w.Write(ev.Ref.Data)
+	}
+
+	// write record to log file and stream
+	if hdlr.log != nil {
+		_, _ = hdlr.log.Write(w.Bytes())
+	}
+	if hdlr.stream != nil {
+		hdlr.stream.Send(w.Bytes())
 	}
 }
@@ -0,0 +1,132 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"leatea/core"
+	"leatea/sim"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventStream(t *testing.T) {
+	defer func(addr string) { sim.Cfg.Options.EventStream = addr }(sim.Cfg.Options.EventStream)
+	sim.Cfg.Options.EventStream = "127.0.0.1:0"
+
+	hdlr := NewEventHandler()
+	defer hdlr.Close()
+
+	// connect client and wait for stream header
+	conn, err := net.Dial("tcp", hdlr.stream.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err = sim.ReadLogHeader(conn); err != nil {
+		t.Fatal(err)
+	}
+	// trigger event
+	peer, ref := core.NewPeerPrivate().Public(), core.NewPeerPrivate().Public()
+	hdlr.HandleEvent(&core.Event{
+		Type: core.EvNeighborAdded,
+		Peer: peer,
+		Ref:  ref,
+	})
+	// read matching record
+	rec := make([]byte, 16+2*len(peer.Data))
+	if _, err = io.ReadFull(conn, rec); err != nil {
+		t.Fatal(err)
+	}
+	if evType := binary.BigEndian.Uint32(rec[:4]); evType != core.EvNeighborAdded {
+		t.Fatalf("wrong event type %d", evType)
+	}
+	if seq := binary.BigEndian.Uint32(rec[12:16]); seq != 1 {
+		t.Fatalf("wrong sequence %d", seq)
+	}
+	n := len(peer.Data)
+	if !bytes.Equal(rec[16:16+n], peer.Data) || !bytes.Equal(rec[16+n:], ref.Data) {
+		t.Fatal("peer mismatch")
+	}
+	// epoch marker (no peer)
+	hdlr.HandleEvent(&core.Event{
+		Type: sim.EvEpoch,
+		Val:  7,
+	})
+	rec = make([]byte, 16+n+4)
+	if _, err = io.ReadFull(conn, rec); err != nil {
+		t.Fatal(err)
+	}
+	if evType := binary.BigEndian.Uint32(rec[:4]); evType != sim.EvEpoch {
+		t.Fatalf("wrong event type %d", evType)
+	}
+	if !bytes.Equal(rec[16:16+n], make([]byte, n)) {
+		t.Fatal("peer in epoch marker")
+	}
+	if epoch := binary.BigEndian.Uint32(rec[16+n:]); epoch != 7 {
+		t.Fatalf("wrong epoch %d", epoch)
+	}
+}
+
+func TestEventFocus(t *testing.T) {
+	defer func(focus []string) { sim.Cfg.Options.FocusPeers = focus }(sim.Cfg.Options.FocusPeers)
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	peers := make([]*core.PeerID, 3)
+	for i := range peers {
+		peers[i] = core.NewPeerPrivate().Public()
+	}
+	sim.Cfg.Options.FocusPeers = []string{peers[0].String()}
+
+	// neighbor-added events between all peers
+	hdlr := NewEventHandler()
+	defer hdlr.Close()
+	for i, p := range peers {
+		for j, r := range peers {
+			if i != j {
+				hdlr.HandleEvent(&core.Event{
+					Type: core.EvNeighborAdded,
+					Peer: p,
+					Ref:  r,
+				})
+			}
+		}
+	}
+	// only events related to the focused peer are shown
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("%d lines shown (expected 4)", len(lines))
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, peers[0].String()) {
+			t.Fatalf("unfocused event shown: %s", line)
+		}
+	}
+}
@@ -30,6 +30,9 @@ import (
 	"os"
 	"os/signal"
 	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -41,7 +44,8 @@ var (
 	changed bool              // routing modified?
 	redraw  bool              // graph modified?
 	rt      *sim.RoutingTable // compiled routing table
-	csv     *os.File          // statistics output
+	stats   *sim.StatsWriter  // statistics output
+	tracker *sim.LoopTracker  // loop tracking (on demand)
 	evHdlr  *EventHandler     // event handler
 )
 
@@ -53,10 +57,29 @@ func main() {
 	//------------------------------------------------------------------
 	// parse arguments
 	var cfgFile, profile string
+	var initCfg, dryRun bool
 	flag.StringVar(&cfgFile, "c", "config.json", "JSON-encoded configuration file")
 	flag.StringVar(&profile, "p", "", "write CPU profile")
+	flag.BoolVar(&initCfg, "init", false, "write default configuration file (if absent) and exit")
+	flag.BoolVar(&dryRun, "dry-run", false, "report the topology of the configured network and exit")
 	flag.Parse()
 
+	// write default configuration
+	if initCfg {
+		f, err := os.OpenFile(cfgFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = sim.WriteDefaultConfig(f); err != nil {
+			log.Fatal(err)
+		}
+		if err = f.Close(); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Default configuration written to %s", cfgFile)
+		return
+	}
+
 	// read configuration
 	err := sim.ReadConfig(cfgFile)
 	if err != nil {
@@ -64,15 +87,33 @@ func main() {
 	}
 	core.SetConfiguration(sim.Cfg.Core)
 
+	// report topology of the network without running it
+	if dryRun {
+		e := sim.BuildEnvironment(sim.Cfg.Env)
+		if e == nil {
+			log.Fatalf("No environment class '%s' defined.", sim.Cfg.Env.Class)
+		}
+		topo := sim.PlaceNodes(e, sim.Cfg.Env.NumNodes).Topology()
+		log.Println("Topology:")
+		log.Printf("  * Nodes: %d", topo.Nodes)
+		log.Printf("  * Edges: %d", topo.Edges)
+		log.Printf("  * Degree: min %d, mean %.2f, max %d", topo.MinDegree, topo.MeanDegree, topo.MaxDegree)
+		log.Printf("  * Components: %d", topo.Components)
+		log.Printf("  * Diameter: %d", topo.Diameter)
+		return
+	}
+
 	// if we write statistics, create output file
 	if len(sim.Cfg.Options.Statistics) > 0 {
 		// create file
-		if csv, err = os.Create(sim.Cfg.Options.Statistics); err != nil {
+		f, err := os.Create(sim.Cfg.Options.Statistics)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		if stats, err = sim.NewStatsWriter(f, sim.Cfg.Options.StatsFormat); err != nil {
 			log.Fatal(err)
 		}
-		defer csv.Close()
-		// write header
-		_, _ = csv.WriteString("Epoch,Loops,Broken,Success,NumPeers,Started,StopPending,MeanHops\n")
 	}
 
 	// turn on profiling
@@ -118,7 +159,11 @@ func main() {
 	//------------------------------------------------------------------
 	// Run test network
 	log.Println("Running network...")
-	go netw.Run(ctx, evHdlr.HandleEvent)
+	if sim.Cfg.Options.Stepped {
+		netw.RunStepped(evHdlr.HandleEvent)
+	} else {
+		go netw.Run(ctx, evHdlr.HandleEvent)
+	}
 
 	// run simulation depending on canvas mode (dynamic/static)
 	if sim.Cfg.Render.Dynamic && c != nil && c.IsDynamic() {
@@ -131,8 +176,12 @@ func main() {
 			log.Fatal(err)
 		}
 		// run simulation in go routine to keep main routine
-		// available for canvas.
-		go run(ctx, cancel, e)
+		// available for canvas; close canvas (and terminate the
+		// render loop) when the simulation ends.
+		go func() {
+			run(ctx, cancel)
+			c.Close()
+		}()
 
 		// run render loop
 		c.Render(func(c sim.Canvas, forced bool) {
@@ -149,7 +198,7 @@ func main() {
 		//--------------------------------------------------------------
 
 		// run simulation
-		run(ctx, cancel, e)
+		run(ctx, cancel)
 
 		if c != nil && rt != nil {
 			// draw final network graph if canvas is not dynamic
@@ -160,6 +209,11 @@ func main() {
 				c.Start()
 				// render routing table
 				rt.Render(c)
+				// render traced routes
+				for _, tr := range sim.Cfg.Options.TraceRoutes {
+					route, _ := rt.Trace(tr[0], tr[1])
+					rt.RenderTrace(c, route, sim.ClrRedTr)
+				}
 				// draw environment
 				e.Draw(c)
 			})
@@ -172,7 +226,7 @@ func main() {
 	log.Println("Done.")
 }
 
-func run(ctx context.Context, cancel context.CancelFunc, env sim.Environment) {
+func run(ctx context.Context, cancel context.CancelFunc) {
 	//------------------------------------------------------------------
 	// prepare monitoring
 	sigCh := make(chan os.Signal, 5)
@@ -185,8 +239,17 @@ func run(ctx context.Context, cancel context.CancelFunc, env sim.Environment) {
 	unchangedCount := 1
 	var active atomic.Bool
 
+	// control network from stdin on demand
+	if sim.Cfg.Options.Console {
+		log.Println("Console enabled (type 'help' for commands)")
+		go NewConsole(netw, os.Stdout).Run(os.Stdin)
+	}
 	// as long as active...
 	active.Store(true)
+	if sim.Cfg.Options.Stepped {
+		epoch = stepped()
+		active.Store(false)
+	}
 loop:
 	for active.Load() {
 		select {
@@ -216,20 +279,21 @@ loop:
 					log.Printf("Stopped on network inactivity")
 					break loop
 				}
-				running, started, removals := netw.Stats()
+				running, started, removals, dropped := netw.Stats()
 				log.Printf("[Epoch %d] %d nodes running (%d started, %d removals pending, %d epochs unchanged)",
 					epoch, running, started, removals, unchangedCount-1)
+				if dropped > 0 {
+					log.Printf("Dropped deliveries: %d", dropped)
+				}
+				if id, size := netw.LargestTable(); size > 0 {
+					log.Printf("Largest forward table: node %d (%d entries)", id, size)
+				}
 				log.Printf("Handling epoch tasks...")
 
-				// handle events generated by the environment
-				for _, ev := range env.Epoch(epoch) {
-					if ev.Type == sim.EvNodeRemoved {
-						val := core.GetVal[[]int](ev)
-						if val[1] < 0 {
-							netw.StopNodeByID(ev.Peer)
-						}
-					}
-				}
+				// update environment (and apply churn schedule)
+				netw.StartEpoch(epoch)
+				// report traffic of running nodes
+				netw.Epoch(epoch)
 				// check if simulation ends
 				if sim.Cfg.Options.StopAt > 0 && epoch > sim.Cfg.Options.StopAt {
 					log.Printf("Stopped on request")
@@ -242,11 +306,16 @@ loop:
 						// show status
 						rt = netw.RoutingTable()
 						loops, broken, _ := status(epoch, rt)
-						if loops > 0 && sim.Cfg.Options.StopOnLoop {
+						if loops > 0 && sim.Cfg.Options.StopOnLoop && !sim.Cfg.Options.TrackLoops {
 							log.Printf("Stopped on detected loop(s)")
 							active.Store(false)
 							return
 						}
+						if conv, _ := netw.Converged(); conv > 0 && sim.Cfg.Options.StopOnConverge {
+							log.Printf("Stopped on convergence")
+							active.Store(false)
+							return
+						}
 						if failed := loops + broken; failed == 0 {
 							if lastFailed == failed {
 								repeat++
@@ -279,6 +348,20 @@ loop:
 	if len(sim.Cfg.Options.TableDump) > 0 {
 		netw.DumpRouting(sim.Cfg.Options.TableDump)
 	}
+	// write routing graph on demand
+	if len(sim.Cfg.Options.DotFile) > 0 {
+		if rt == nil {
+			rt = netw.RoutingTable()
+		}
+		writeDOT(rt)
+	}
+	// write routing matrix on demand
+	if len(sim.Cfg.Options.MatrixFile) > 0 {
+		if rt == nil {
+			rt = netw.RoutingTable()
+		}
+		writeMatrix(rt)
+	}
 	// stop operations
 	cancel()
 
@@ -286,7 +369,161 @@ loop:
 	// print final statistics
 	if sim.Cfg.Options.FinalStatus {
 		log.Println("Network routing table constructed - checking routes:")
-		status(epoch, rt)
+		if loops, broken, _ := status(epoch, rt); loops+broken > 0 {
+			unreachable(rt)
+		}
+		if conv, dt := netw.Converged(); conv > 0 {
+			log.Printf("Converged at epoch %d (%.0f seconds)", conv, dt.Seconds())
+		} else {
+			log.Println("Not converged")
+		}
+		if tracker != nil {
+			ls := tracker.Summary()
+			log.Printf("Loops: %d (%d distinct), lifetime mean %.2f, max %d epochs",
+				ls.Loops, ls.Distinct, ls.MeanLifetime, ls.MaxLifetime)
+		}
+		traffic := sim.NewResult(netw, nil, nil, epoch).Traffic
+		log.Printf("Traffic sent: %s beacon, %s LEArn, %s TEAch",
+			sim.Scale(float64(traffic[core.MsgBeacon])),
+			sim.Scale(float64(traffic[core.MsgLEArn])),
+			sim.Scale(float64(traffic[core.MsgTEAch])))
+	}
+	// trace routes on demand
+	if len(sim.Cfg.Options.TraceRoutes) > 0 {
+		if rt == nil {
+			rt = netw.RoutingTable()
+		}
+		for _, tr := range sim.Cfg.Options.TraceRoutes {
+			route, err := rt.Trace(tr[0], tr[1])
+			if err != nil {
+				log.Printf("Route %d -> %d: %v (%s)", tr[0], tr[1], route, err.Error())
+				continue
+			}
+			log.Printf("Route %d -> %d: %v", tr[0], tr[1], route)
+		}
+	}
+	// write summary of the run
+	if len(sim.Cfg.Options.Summary) > 0 {
+		if rt == nil {
+			rt = netw.RoutingTable()
+		}
+		writeSummary(sim.NewResult(netw, rt, tracker, epoch))
+	}
+}
+
+// write routing graph to file (GraphViz DOT)
+func writeDOT(rt *sim.RoutingTable) {
+	f, err := os.Create(sim.Cfg.Options.DotFile)
+	if err != nil {
+		log.Printf("routing graph: %s", err.Error())
+		return
+	}
+	defer f.Close()
+	if err = rt.WriteDOT(f); err != nil {
+		log.Printf("routing graph: %s", err.Error())
+	}
+}
+
+// write routing matrix to file (or stdout)
+func writeMatrix(rt *sim.RoutingTable) {
+	out := os.Stdout
+	if fn := sim.Cfg.Options.MatrixFile; fn != "-" {
+		f, err := os.Create(fn)
+		if err != nil {
+			log.Printf("routing matrix: %s", err.Error())
+			return
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := rt.WriteMatrix(out); err != nil {
+		log.Printf("routing matrix: %s", err.Error())
+	}
+}
+
+// max. number of targets listed per node in the unreachable summary
+const maxUnreachable = 10
+
+// log the targets each node can't reach (one line per affected node)
+func unreachable(rt *sim.RoutingTable) {
+	nodes := make([]int, 0, len(rt.List))
+	for i := range rt.List {
+		nodes = append(nodes, i)
+	}
+	sort.Ints(nodes)
+	for _, from := range nodes {
+		list := rt.Unreachable(from)
+		if len(list) == 0 {
+			continue
+		}
+		targets := make([]string, 0, maxUnreachable+1)
+		for i, to := range list {
+			if i == maxUnreachable {
+				targets = append(targets, fmt.Sprintf("... (%d more)", len(list)-i))
+				break
+			}
+			targets = append(targets, strconv.Itoa(to))
+		}
+		log.Printf("  node %d cannot reach: %s", from, strings.Join(targets, ", "))
+	}
+}
+
+// write summary of a run to file (or stdout)
+func writeSummary(res *sim.Result) {
+	out := os.Stdout
+	if fn := sim.Cfg.Options.Summary; fn != "-" {
+		f, err := os.Create(fn)
+		if err != nil {
+			log.Printf("summary: %s", err.Error())
+			return
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := res.WriteSummary(out); err != nil {
+		log.Printf("summary: %s", err.Error())
+	}
+}
+
+// ----------------------------------------------------------------------
+// stepped runs a single-stepped simulation until the forward tables are
+// unchanged for more than MaxRepeat epochs (or the requested number of
+// epochs is reached). Returns the last epoch.
+func stepped() (epoch int) {
+	unchanged := 0
+	for {
+		ep, msg := netw.Step()
+		if msg != nil {
+			continue
+		}
+		if ep == 0 {
+			return
+		}
+		epoch = ep
+
+		// check routing table changes in the last epoch
+		if changed, _ := evHdlr.State(); changed {
+			unchanged = 0
+		} else {
+			unchanged++
+		}
+		running, started, _, _ := netw.Stats()
+		log.Printf("[Epoch %d] %d nodes running (%d started, %d epochs unchanged)",
+			epoch, running, started, unchanged)
+		netw.Epoch(epoch)
+		if sim.Cfg.Options.EpochStatus {
+			rt = netw.RoutingTable()
+			status(epoch, rt)
+		}
+		// check if simulation ends
+		if sim.Cfg.Options.StopAt > 0 && epoch > sim.Cfg.Options.StopAt {
+			log.Printf("Stopped on request")
+			return
+		}
+		if unchanged > sim.Cfg.Options.MaxRepeat {
+			log.Printf("Stopped on network inactivity")
+			return
+		}
 	}
 }
 
@@ -296,7 +533,7 @@ loop:
 func status(epoch int, rt *sim.RoutingTable) (loops, broken, success int) {
 	var totalHops int
 	loops, broken, success, totalHops = rt.Status()
-	num, started, stopPending := netw.Stats()
+	num, started, stopPending, _ := netw.Stats()
 	total := num * (num - 1)
 	if total > 0 {
 		// log statistics to console
@@ -307,15 +544,68 @@ func status(epoch int, rt *sim.RoutingTable) (loops, broken, success int) {
 		log.Printf("  * Broken: %d (%.2f%%)", broken, perc(broken))
 		log.Printf("  * Success: %d (%.2f%%)", success, perc(success))
 		mean := 0.
+		diameter, _ := rt.Diameter()
 		if success > 0 {
 			mean = float64(totalHops) / float64(success)
-			log.Printf("  * Hops (routg): %.2f (%d)", mean, success)
+			log.Printf("  * Hops (routg): %.2f (%d), diameter %d", mean, success, diameter)
+		}
+		// report partitions of the connectivity graph (broken routes
+		// between components are not a routing failure)
+		g := netw.Graph()
+		comps := g.Components()
+		sizes := make([]string, len(comps))
+		for i, comp := range comps {
+			sizes[i] = strconv.Itoa(len(comp))
+		}
+		log.Printf("  * Components: %d (sizes %s)", len(comps), strings.Join(sizes, ", "))
+		if sim.Cfg.Options.BloomCheck {
+			log.Printf("  * Filter false positives: %d", netw.FalsePositives())
+		}
+
+		// compare routes with shortest paths in the connectivity graph
+		if sim.Cfg.Options.CheckOptimal {
+			checked, subopt, excess := rt.CompareOptimal(g)
+			log.Printf("  * Suboptimal: %d of %d (+%.2f hops)", subopt, checked, excess)
+		}
+		// check for convergence
+		if conv, dt := netw.Converge(epoch, success); conv == epoch {
+			log.Printf("  * Converged at epoch %d (%.0f seconds)", conv, dt.Seconds())
+		}
+		// track distinct loops across epochs
+		var formed, cleared []*sim.LoopRecord
+		cycles := 0
+		if sim.Cfg.Options.TrackLoops {
+			if tracker == nil {
+				tracker = sim.NewLoopTracker()
+			}
+			formed, cleared = tracker.Update(epoch, rt)
+			cycles = tracker.Active()
+			log.Printf("  * Distinct loops: %d (%d formed, %d cleared)",
+				cycles, len(formed), len(cleared))
+			for _, rec := range formed {
+				log.Printf("    + loop %v", rec.Cycle)
+			}
+			for _, rec := range cleared {
+				log.Printf("    - loop %v (since epoch %d)", rec.Cycle, rec.First)
+			}
 		}
 		// log statistics to file if requested
-		if csv != nil {
-			line := fmt.Sprintf("%d,%d,%d,%d,%d,%d,%d,%.2f\n",
-				epoch, loops, broken, success, num, started, stopPending, mean)
-			_, _ = csv.WriteString(line)
+		if stats != nil {
+			_ = stats.Write(&sim.EpochStats{
+				Epoch:       epoch,
+				Loops:       loops,
+				Broken:      broken,
+				Success:     success,
+				NumPeers:    num,
+				Started:     started,
+				StopPending: stopPending,
+				MeanHops:    mean,
+				Diameter:    diameter,
+
+				Cycles:        cycles,
+				NewCycles:     len(formed),
+				ClearedCycles: len(cleared),
+			})
 		}
 	} else {
 		log.Println("  * No routes yet (routing table)")
@@ -0,0 +1,128 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package main
+
+import (
+	"leatea/sim"
+	"log"
+	"net"
+	"sync"
+)
+
+// number of pending records per client before it is dropped
+const streamBacklog = 1024
+
+// EventStream fans out binary event records to connected TCP clients.
+// Slow clients are disconnected instead of blocking the simulation.
+type EventStream struct {
+	sync.Mutex
+
+	lst     net.Listener
+	clients map[net.Conn]chan []byte
+}
+
+// NewEventStream starts listening for clients on the given address.
+func NewEventStream(addr string) (es *EventStream, err error) {
+	es = &EventStream{
+		clients: make(map[net.Conn]chan []byte),
+	}
+	if es.lst, err = net.Listen("tcp", addr); err != nil {
+		return
+	}
+	go es.accept()
+	return
+}
+
+// Addr returns the listen address of the stream.
+func (es *EventStream) Addr() net.Addr {
+	return es.lst.Addr()
+}
+
+// accept new clients until the listener is closed.
+func (es *EventStream) accept() {
+	for {
+		conn, err := es.lst.Accept()
+		if err != nil {
+			return
+		}
+		// every stream starts with a log header
+		if err = sim.WriteLogHeader(conn); err != nil {
+			conn.Close()
+			continue
+		}
+		ch := make(chan []byte, streamBacklog)
+		es.Lock()
+		es.clients[conn] = ch
+		es.Unlock()
+		go es.serve(conn, ch)
+	}
+}
+
+// serve a client with queued records.
+func (es *EventStream) serve(conn net.Conn, ch chan []byte) {
+	for rec := range ch {
+		if _, err := conn.Write(rec); err != nil {
+			es.drop(conn)
+			break
+		}
+	}
+	conn.Close()
+}
+
+// drop a client (must not be called with lock held)
+func (es *EventStream) drop(conn net.Conn) {
+	es.Lock()
+	defer es.Unlock()
+	es.remove(conn)
+}
+
+// remove a client (lock held by caller)
+func (es *EventStream) remove(conn net.Conn) {
+	if ch, ok := es.clients[conn]; ok {
+		delete(es.clients, conn)
+		close(ch)
+	}
+}
+
+// Send a record to all connected clients.
+func (es *EventStream) Send(rec []byte) {
+	es.Lock()
+	defer es.Unlock()
+	for conn, ch := range es.clients {
+		select {
+		case ch <- rec:
+		default:
+			log.Printf("event stream: dropping slow client %s", conn.RemoteAddr())
+			es.remove(conn)
+		}
+	}
+}
+
+// Close the listener and disconnect all clients.
+func (es *EventStream) Close() error {
+	err := es.lst.Close()
+	es.Lock()
+	defer es.Unlock()
+	for conn := range es.clients {
+		es.remove(conn)
+	}
+	return err
+}
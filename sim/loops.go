@@ -0,0 +1,133 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"fmt"
+	"sort"
+)
+
+//----------------------------------------------------------------------
+// Loop tracking (across epochs)
+//----------------------------------------------------------------------
+
+// LoopRecord is a distinct routing loop (cycle in canonical form) and
+// the epochs it was first and last seen in.
+type LoopRecord struct {
+	Cycle []int
+	First int
+	Last  int
+}
+
+// Lifetime of a loop (number of epochs it was seen in)
+func (r *LoopRecord) Lifetime() int {
+	return r.Last - r.First + 1
+}
+
+// LoopTracker keeps track of the routing loops in a network: loops are
+// identified by their cycle, so a loop is tracked from the epoch it
+// forms until the epoch it is cleared.
+type LoopTracker struct {
+	active map[string]*LoopRecord
+	done   []*LoopRecord // cleared loops
+}
+
+// NewLoopTracker creates a new tracker (with no active loops)
+func NewLoopTracker() *LoopTracker {
+	return &LoopTracker{
+		active: make(map[string]*LoopRecord),
+	}
+}
+
+// Update the tracker with the loops in the routing table of an epoch.
+// Returns the loops that formed and the loops that were cleared since
+// the last update (both sorted by cycle).
+func (lt *LoopTracker) Update(epoch int, rt *RoutingTable) (formed, cleared []*LoopRecord) {
+	current := make(map[string]bool)
+	for _, cycle := range rt.Loops() {
+		key := fmt.Sprint(cycle)
+		current[key] = true
+		if rec, ok := lt.active[key]; ok {
+			rec.Last = epoch
+			continue
+		}
+		rec := &LoopRecord{Cycle: cycle, First: epoch, Last: epoch}
+		lt.active[key] = rec
+		formed = append(formed, rec)
+	}
+	for key, rec := range lt.active {
+		if !current[key] {
+			delete(lt.active, key)
+			cleared = append(cleared, rec)
+		}
+	}
+	lt.done = append(lt.done, cleared...)
+	sort.Slice(cleared, func(i, j int) bool {
+		return lessInts(cleared[i].Cycle, cleared[j].Cycle)
+	})
+	return
+}
+
+// Active returns the number of loops currently in the network
+func (lt *LoopTracker) Active() int {
+	return len(lt.active)
+}
+
+// LoopSummary of the routing loops over a run
+type LoopSummary struct {
+	Loops        int     // number of loops (a loop can form more than once)
+	Distinct     int     // number of distinct loops (cycles)
+	Recurring    int     // number of distinct loops that formed more than once
+	MeanLifetime float64 // mean lifetime of loops (in epochs)
+	MaxLifetime  int     // max. lifetime of a loop (in epochs)
+}
+
+// Summary of all loops seen so far (cleared and active loops)
+func (lt *LoopTracker) Summary() (s *LoopSummary) {
+	s = new(LoopSummary)
+	cycles := make(map[string]int)
+	total := 0
+	count := func(rec *LoopRecord) {
+		cycles[fmt.Sprint(rec.Cycle)]++
+		life := rec.Lifetime()
+		total += life
+		if life > s.MaxLifetime {
+			s.MaxLifetime = life
+		}
+		s.Loops++
+	}
+	for _, rec := range lt.done {
+		count(rec)
+	}
+	for _, rec := range lt.active {
+		count(rec)
+	}
+	s.Distinct = len(cycles)
+	for _, n := range cycles {
+		if n > 1 {
+			s.Recurring++
+		}
+	}
+	if s.Loops > 0 {
+		s.MeanLifetime = float64(total) / float64(s.Loops)
+	}
+	return
+}
@@ -0,0 +1,100 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"reflect"
+	"testing"
+)
+
+// routing table for a line 1 - 2 - 3 - 4 (optionally with a loop
+// 2 -> 3 -> 2 for target 4 entered at 2 (from 1) and at 3)
+func loopTable(loop bool) *RoutingTable {
+	rt := NewRoutingTable()
+	for i := 1; i <= 4; i++ {
+		rt.List[i] = &RTEntry{Forwards: make(map[int]int)}
+		rt.Index[string(rune('a'+i))] = i
+	}
+	for from := 1; from <= 4; from++ {
+		for to := 1; to <= 4; to++ {
+			switch {
+			case to > from:
+				rt.List[from].Forwards[to] = from + 1
+			case to < from:
+				rt.List[from].Forwards[to] = from - 1
+			}
+		}
+	}
+	if loop {
+		rt.List[3].Forwards[4] = 2
+	}
+	return rt
+}
+
+func TestLoopTracker(t *testing.T) {
+	lt := NewLoopTracker()
+	for epoch, loop := range []bool{false, true, true, false} {
+		rt := loopTable(loop)
+		formed, cleared := lt.Update(epoch, rt)
+		switch epoch {
+		case 0:
+			if len(formed)+len(cleared)+lt.Active() != 0 {
+				t.Fatalf("epoch %d: loops without loop", epoch)
+			}
+		case 1:
+			// loop entered from different nodes is one loop
+			if len(formed) != 1 || len(cleared) != 0 || lt.Active() != 1 {
+				t.Fatalf("epoch %d: %d formed, %d cleared", epoch, len(formed), len(cleared))
+			}
+			if !reflect.DeepEqual(formed[0].Cycle, []int{2, 3}) {
+				t.Fatalf("epoch %d: loop %v", epoch, formed[0].Cycle)
+			}
+		case 2:
+			if len(formed)+len(cleared) != 0 || lt.Active() != 1 {
+				t.Fatalf("epoch %d: %d formed, %d cleared", epoch, len(formed), len(cleared))
+			}
+		case 3:
+			if len(formed) != 0 || len(cleared) != 1 || lt.Active() != 0 {
+				t.Fatalf("epoch %d: %d formed, %d cleared", epoch, len(formed), len(cleared))
+			}
+			if cleared[0].First != 1 {
+				t.Fatalf("loop first seen in epoch %d", cleared[0].First)
+			}
+		}
+	}
+}
+
+func TestLoopLifetime(t *testing.T) {
+	// same loop in epochs 1-3, cleared in epoch 4, formed again in 5
+	lt := NewLoopTracker()
+	for epoch, loop := range []bool{false, true, true, true, false, true} {
+		_, cleared := lt.Update(epoch, loopTable(loop))
+		if epoch == 4 {
+			if len(cleared) != 1 || cleared[0].Lifetime() != 3 {
+				t.Fatalf("cleared loops %v", cleared)
+			}
+		}
+	}
+	exp := &LoopSummary{Loops: 2, Distinct: 1, Recurring: 1, MeanLifetime: 2, MaxLifetime: 3}
+	if s := lt.Summary(); !reflect.DeepEqual(s, exp) {
+		t.Fatalf("summary %+v (expected %+v)", s, exp)
+	}
+}
@@ -22,8 +22,12 @@ package sim
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"leatea/core"
+	"log"
 	"math/rand"
+	"runtime"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -34,6 +38,15 @@ const (
 	EvNodeAdded   = 100 // node added to network
 	EvNodeRemoved = 101 // node removed from network
 	EvNodeTraffic = 102 // show number of bytes received/sent when peer closes
+	EvEpoch       = 103 // epoch boundary (no peer; value is the epoch)
+)
+
+// Error codes
+var (
+	ErrPeerExists   = errors.New("peer already in network")
+	ErrTagCollision = errors.New("peer tag collision")
+	ErrNodeUnknown  = errors.New("unknown node")
+	ErrNetInactive  = errors.New("network not running")
 )
 
 // NodeAddedVal for event value on EvNodeAdded
@@ -44,6 +57,14 @@ type NodeAddedVal struct {
 	X, Y, R2 float64
 }
 
+// NodeRemovedVal for event value on EvNodeRemoved (sent to listener)
+type NodeRemovedVal struct {
+	Idx      uint16
+	Running  uint16
+	Pending  uint16
+	X, Y, R2 float64
+}
+
 //----------------------------------------------------------------------
 // Network simulation to test the LEATEA algorithm
 //----------------------------------------------------------------------
@@ -54,11 +75,14 @@ type Network struct {
 
 	// Node management
 	index    map[string]int   // node index map
+	tags     map[uint32]int   // tags (short ids) of nodes
 	nodes    map[int]*SimNode // list of nodes
 	nodeLock sync.RWMutex     // manage access to nodes
 
 	// Transport layer
-	queue chan core.Message // "ether" for message transport
+	queue   chan core.Message  // "ether" for message transport
+	pool    *workerPool        // workers handling deliveries (nil = synchronous)
+	barrier chan chan struct{} // sync with transport layer (see drain)
 
 	// State of the network
 	active   atomic.Bool  // simulation running?
@@ -67,9 +91,29 @@ type Network struct {
 	running  int          // number of running nodes
 	started  int          // number of started nodes
 	removals int          // number of pending removals
+	dropped  atomic.Int64 // number of dropped deliveries (packet loss)
+	falsePos atomic.Int64 // number of false positives in LEArn filters
+	hopLimit atomic.Int64 // number of routes ignored at the hop limit
+
+	// Convergence of routing
+	startTime time.Time     // start of the simulation
+	converged int           // epoch of convergence (0 = not converged)
+	convTime  time.Duration // time to convergence
 
 	// Listener for network events
 	cb core.Listener
+
+	// context of the running simulation (for revived nodes)
+	ctx context.Context
+
+	// nodes restored from a checkpoint (resumed on run)
+	resume []*SimNode
+
+	// single-stepped simulation
+	stepped *stepper
+
+	// closed when Run returned (see Done)
+	done chan struct{}
 }
 
 // NewNetwork creates a new network of 'numNodes' in a given environment.
@@ -77,15 +121,87 @@ func NewNetwork(env Environment, numNodes int) *Network {
 	n := new(Network)
 	n.env = env
 	n.queue = make(chan core.Message)
+	n.barrier = make(chan chan struct{})
+	n.done = make(chan struct{})
 	n.nodes = make(map[int]*SimNode)
 	n.index = make(map[string]int)
+	n.tags = make(map[uint32]int)
 	n.running = 0
 	n.started = 0
 	n.removals = 0
+	n.startTime = time.Now()
 	n.active.Store(false)
 	return n
 }
 
+// add a node to the network under given identifier. Fails if the peer
+// is already in the network or if its tag (short identifier used in
+// forwards) is in use by another node.
+func (n *Network) addNode(idx int, node *SimNode) error {
+	n.nodeLock.Lock()
+	defer n.nodeLock.Unlock()
+	if err := n.checkPeer(node.PeerID()); err != nil {
+		return err
+	}
+	n.index[node.PeerID().Key()] = idx
+	n.tags[node.PeerID().Tag()] = idx
+	n.nodes[idx] = node
+	if Cfg.Options.BloomCheck {
+		node.SetFilterCheck(n.knows)
+	}
+	return nil
+}
+
+// knows returns true if the learner knows the target (filter check of
+// nodes): a target withheld from a learner not knowing it is a false
+// positive of the learner's LEArn filter.
+func (n *Network) knows(learner, target *core.PeerID) bool {
+	node, _ := n.getNode(learner)
+	if node == nil || node.Knows(target) {
+		return true
+	}
+	n.falsePos.Add(1)
+	return false
+}
+
+// FalsePositives returns the number of targets withheld from learners
+// because of false positives in their LEArn filters (if checked).
+func (n *Network) FalsePositives() int {
+	return int(n.falsePos.Load())
+}
+
+// HopLimitExceeded returns the number of routes ignored by nodes because
+// they exceeded the hop limit (count-to-infinity).
+func (n *Network) HopLimitExceeded() int {
+	return int(n.hopLimit.Load())
+}
+
+// listen wraps the listener of a simulation: network statistics are
+// collected from node events before the events are passed on.
+func (n *Network) listen(cb core.Listener) core.Listener {
+	return func(ev *core.Event) {
+		if ev.Type == core.EvHopLimitExceeded {
+			n.hopLimit.Add(1)
+		}
+		if cb != nil {
+			cb(ev)
+		}
+	}
+}
+
+// checkPeer for collisions with nodes in the network.
+// (only call from within a locked network instance!)
+func (n *Network) checkPeer(p *core.PeerID) error {
+	if _, ok := n.index[p.Key()]; ok {
+		return fmt.Errorf("%w: %s", ErrPeerExists, p.FullString())
+	}
+	if idx, ok := n.tags[p.Tag()]; ok {
+		return fmt.Errorf("%w: %s / %s", ErrTagCollision,
+			p.FullString(), n.nodes[idx].PeerID().FullString())
+	}
+	return nil
+}
+
 // GetShortID returns a short identifier for a node.
 func (n *Network) GetShortID(p *core.PeerID) int {
 	n.nodeLock.RLock()
@@ -103,29 +219,70 @@ func (n *Network) GetShortID(p *core.PeerID) int {
 	return id
 }
 
-// Run the network simulation
+// Run the network simulation until the context is done or the network is
+// stopped. Run must only be called once for a network.
 func (n *Network) Run(ctx context.Context, cb core.Listener) {
+	// go routines started by Run (joined before Done is closed)
+	var wg sync.WaitGroup
+	defer func() {
+		wg.Wait()
+		close(n.done)
+	}()
 	n.active.Store(true)
+	n.statLock.Lock()
+	n.startTime = time.Now()
+	n.statLock.Unlock()
 
-	// create and run nodes.
+	// start workers for message deliveries
+	n.pool = newWorkerPool(ctx, runtime.GOMAXPROCS(0))
+
+	// resume restored nodes or create and run new nodes.
+	cb = n.listen(cb)
 	n.cb = cb
-	for i := 0; i < Cfg.Env.NumNodes; i++ {
+	n.ctx = ctx
+	for _, node := range n.resume {
+		wg.Add(1)
+		go func(node *SimNode) {
+			defer wg.Done()
+			node.Start(ctx, cb)
+		}(node)
+	}
+	for i := 0; i < Cfg.Env.NumNodes && n.resume == nil; i++ {
 		r2, pos := n.env.Placement(i)
 		prv := core.NewPeerPrivate()
-		delay := Vary(Cfg.Node.BootupTime)
+		var delay time.Duration
+		if b, ok := n.env.(Bootup); ok {
+			delay = b.BootDelay(i)
+		} else {
+			delay = Vary(Cfg.Node.BootupTime)
+		}
 		node := NewSimNode(prv, n.queue, pos, r2)
 
+		// decide on node lifetime (only some peers stop working); all
+		// random values are drawn here to keep runs reproducible.
+		var ttl time.Duration
+		if rand.Float64() < Cfg.Node.DeathRate { //nolint:gosec // deterministic testing
+			ttl = Vary(Cfg.Node.PeerTTL) + delay + 2*time.Minute
+		}
+
 		// run node (delayed)
+		wg.Add(2)
 		go func(i int) {
-			time.Sleep(delay)
+			defer wg.Done()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
 			if n.active.Load() {
 				// register node with environment and get an integer identifier.
+				node.idx = i
 				idx := n.env.Register(i, node)
-				// add node to network
-				n.nodeLock.Lock()
-				n.index[node.PeerID().Key()] = idx
-				n.nodes[idx] = node
-				n.nodeLock.Unlock()
+				// add node to network (skip colliding peers)
+				if err := n.addNode(idx, node); err != nil {
+					log.Printf("node %d not started: %s", idx, err.Error())
+					return
+				}
 
 				// update status
 				n.statLock.Lock()
@@ -155,16 +312,18 @@ func (n *Network) Run(ctx context.Context, cb core.Listener) {
 		}(i)
 		// shutdown node (delayed)
 		go func() {
-			// only some peers stop working
-			if rand.Float64() < Cfg.Node.DeathRate { //nolint:gosec // deterministic testing
+			defer wg.Done()
+			if ttl > 0 {
 				n.statLock.Lock()
 				n.removals++
 				n.statLock.Unlock()
-				ttl := Vary(Cfg.Node.PeerTTL) + delay + 2*time.Minute
-				time.Sleep(ttl)
-				if n.active.Load() {
-					// stop node
-					n.StopNode(node)
+				select {
+				case <-ctx.Done():
+				case <-time.After(ttl):
+					if n.active.Load() {
+						// stop node
+						n.StopNode(node)
+					}
 				}
 				n.statLock.Lock()
 				n.removals--
@@ -174,6 +333,8 @@ func (n *Network) Run(ctx context.Context, cb core.Listener) {
 	}
 	// simulate transport layer
 	n.check.Store(false)
+	check := time.NewTicker(time.Second)
+	defer check.Stop()
 	for n.active.Load() {
 		select {
 		// requested termination
@@ -182,27 +343,90 @@ func (n *Network) Run(ctx context.Context, cb core.Listener) {
 
 		// wait for broadcasted message.
 		case msg := <-n.queue:
-			// lookup sender in node table
-			if sender, _ := n.getNode(msg.Sender()); sender != nil {
-				// add message to sender output
-				sender.traffOut.Add(uint64(msg.Size()))
-
-				// process all nodes that are in broadcast reach of the sender
-				n.nodeLock.RLock()
-				for _, node := range n.nodes {
-					if node.IsRunning() && n.env.Connectivity(node, sender) && !node.PeerID().Equal(sender.PeerID()) {
-						// active node in reach receives message
-						go node.Receive(msg)
-					}
-				}
-				n.nodeLock.RUnlock()
+			n.deliver(msg)
+
+		// all broadcasts taken from the queue so far are scheduled
+		case ack := <-n.barrier:
+			close(ack)
+
+		// call sanity check (not stacking)
+		case <-check.C:
+			if n.check.CompareAndSwap(false, true) {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					n.sanityCheck()
+				}()
 			}
-			// call sanity check (not stacking)
-			go n.sanityCheck()
 		}
 	}
 }
 
+// deliver a broadcasted message to all nodes in reach of the sender
+func (n *Network) deliver(msg core.Message) {
+	// lookup sender in node table
+	sender, _ := n.getNode(msg.Sender())
+	if sender == nil {
+		return
+	}
+	// add message to sender output
+	sender.sent(msg)
+
+	// collect all nodes that are in broadcast reach of the sender (the
+	// deliveries are scheduled without holding the lock: a submission
+	// can block until the receiving node handled earlier messages)
+	var targets []*SimNode
+	n.nodeLock.RLock()
+	for _, node := range n.nodes {
+		if node.IsRunning() && n.env.Connectivity(node, sender) && !node.PeerID().Equal(sender.PeerID()) {
+			targets = append(targets, node)
+		}
+	}
+	n.nodeLock.RUnlock()
+
+	for _, node := range targets {
+		// simulate packet loss
+		if Cfg.Node.LossRate > 0 && rand.Float64() < Cfg.Node.LossRate { //nolint:gosec // deterministic testing
+			n.dropped.Add(1)
+			continue
+		}
+		// active node in reach receives message (after propagation delay)
+		d := &delivery{from: sender, node: node, msg: msg}
+		sender.inflight.Add(1)
+		if delay := n.latency(sender, node); delay > 0 {
+			time.AfterFunc(delay, func() { n.receive(d) })
+		} else {
+			n.receive(d)
+		}
+	}
+}
+
+// receive a message on a node: handled by the worker pool (if the
+// network is running) or synchronously.
+func (n *Network) receive(d *delivery) {
+	if n.pool == nil {
+		d.handle()
+		return
+	}
+	n.pool.submit(d)
+}
+
+// latency of a delivery between two nodes (fixed part, jitter and
+// distance-dependent part)
+func (n *Network) latency(from, to *SimNode) time.Duration {
+	ms := Cfg.Env.Latency + Cfg.Env.LatencyD2*from.Pos.Distance2(to.Pos)
+	if Cfg.Env.Jitter > 0 {
+		ms += rndFloat(Cfg.Env.Jitter)
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// Done returns a channel that is closed when Run returned and all go
+// routines started by Run (like running nodes) terminated.
+func (n *Network) Done() <-chan struct{} {
+	return n.done
+}
+
 func (n *Network) IsActive() bool {
 	if n == nil {
 		return false
@@ -219,10 +443,87 @@ func (n *Network) Settled() bool {
 	return n.started == Cfg.Env.NumNodes && n.removals == 0
 }
 
-func (n *Network) Stats() (int, int, int) {
+// Stats returns the number of running and started nodes, the number of
+// pending removals and the number of dropped deliveries.
+func (n *Network) Stats() (int, int, int, int) {
 	n.statLock.RLock()
 	defer n.statLock.RUnlock()
-	return n.running, n.started, n.removals
+	return n.running, n.started, n.removals, int(n.dropped.Load())
+}
+
+// Converge checks if the network converged in the given epoch: the ratio
+// of successful routes between running nodes reached the target ratio
+// (Options.ConvergeTarget). Returns the epoch and time of the first
+// convergence (0 if not converged yet).
+func (n *Network) Converge(epoch, success int) (int, time.Duration) {
+	n.statLock.Lock()
+	defer n.statLock.Unlock()
+	if n.converged == 0 {
+		total := n.running * (n.running - 1)
+		if total > 0 && float64(success) >= Cfg.Options.ConvergeTarget*float64(total) {
+			n.converged = epoch
+			n.convTime = time.Since(n.startTime)
+		}
+	}
+	return n.converged, n.convTime
+}
+
+// Converged returns the epoch and time of convergence (0 if not
+// converged).
+func (n *Network) Converged() (int, time.Duration) {
+	n.statLock.RLock()
+	defer n.statLock.RUnlock()
+	return n.converged, n.convTime
+}
+
+// Route follows the route between two nodes in the running network (using
+// the current forward tables of the nodes). Returns the path (including
+// both nodes on success), the number of hops and the route status (see
+// core.RouteSuccess, core.RouteBroken and core.RouteLoop).
+func (n *Network) Route(from, to *core.PeerID) (path []*core.PeerID, hops, status int) {
+	peers := map[string]*core.PeerID{
+		from.Key(): from,
+		to.Key():   to,
+	}
+	n.nodeLock.RLock()
+	maxHops := len(n.nodes)
+	n.nodeLock.RUnlock()
+	keys, hops, status := core.WalkRoute(from.Key(), to.Key(), maxHops, func(at string) (string, bool) {
+		node, _ := n.getNode(peers[at])
+		if node == nil || !node.IsRunning() {
+			return "", false
+		}
+		next, num := node.Forward(to)
+		if num == 0 {
+			return "", false
+		}
+		if next == nil {
+			// direct neighbor
+			return to.Key(), true
+		}
+		peers[next.Key()] = next
+		return next.Key(), true
+	})
+	for _, key := range keys {
+		path = append(path, peers[key])
+	}
+	return
+}
+
+// LargestTable returns the identifier of the node with the largest forward
+// table (number of active entries) and the size of that table. On equal
+// sizes the node with the lowest identifier is returned.
+func (n *Network) LargestTable() (id, size int) {
+	n.nodeLock.RLock()
+	defer n.nodeLock.RUnlock()
+
+	for i, node := range n.nodes {
+		num := node.NumForwards()
+		if num > size || (num == size && num > 0 && i < id) {
+			id, size = i, num
+		}
+	}
+	return
 }
 
 func (n *Network) Nodes() (list []*SimNode) {
@@ -253,16 +554,137 @@ func (n *Network) StopNode(node *SimNode) (running int) {
 		running = n.running
 		node.Stop()
 		n.statLock.Unlock()
+		// collect last broadcasts (farewell) in single-stepped mode
+		if n.stepped != nil {
+			n.collect(node)
+		}
 		// notify listener (removal while sim is running)
 		if n.cb != nil {
 			n.cb(&core.Event{
 				Type: EvNodeRemoved,
 				Peer: node.PeerID(),
-				Val:  []int{node.id, running, n.removals},
+				Val: &NodeRemovedVal{
+					Idx:     uint16(node.id),
+					Running: uint16(running),
+					Pending: uint16(n.removals),
+					X:       node.Pos.X,
+					Y:       node.Pos.Y,
+					R2:      node.r2,
+				},
 			})
 		}
 	}
 	// notify listener (traffic info)
+	n.reportTraffic(node)
+	return
+}
+
+// NodeByID returns the node with given short identifier (or nil)
+func (n *Network) NodeByID(id int) *SimNode {
+	n.nodeLock.RLock()
+	defer n.nodeLock.RUnlock()
+	return n.nodes[id]
+}
+
+// ReviveNode restarts a stopped node: the node keeps its peer id but
+// rebuilds its forward table from scratch. Deliveries of broadcasts sent
+// by the node before it stopped (like its farewell) are handled before
+// the node is revived, so they can't reach neighbors afterwards.
+func (n *Network) ReviveNode(id int) error {
+	node := n.NodeByID(id)
+	if node == nil {
+		return fmt.Errorf("%w: %d", ErrNodeUnknown, id)
+	}
+	if !n.active.Load() {
+		return fmt.Errorf("revive node %d: %w", id, ErrNetInactive)
+	}
+	if node.IsRunning() {
+		return fmt.Errorf("node %d: %w", id, core.ErrNodeRunning)
+	}
+	// handle last broadcasts of the node first
+	if n.stepped != nil {
+		n.drainStepped(node)
+	} else if err := n.drain(node); err != nil {
+		return fmt.Errorf("revive node %d: %w", id, err)
+	}
+	// restart node on a new transport
+	var err error
+	n.statLock.Lock()
+	if n.stepped != nil {
+		trans := core.NewQueueTransport()
+		if err = node.SetTransport(trans); err == nil {
+			n.stepped.trans[id] = trans
+			node.Activate(n.cb)
+		}
+	} else {
+		err = node.Restart(n.ctx, n.cb, core.NewChannelTransport(node.recv, n.queue))
+	}
+	if err != nil {
+		n.statLock.Unlock()
+		return fmt.Errorf("node %d: %w", id, err)
+	}
+	n.running++
+	running := n.running
+	n.statLock.Unlock()
+
+	// notify listener
+	if n.cb != nil {
+		n.cb(&core.Event{
+			Type: EvNodeAdded,
+			Peer: node.PeerID(),
+			Val: &NodeAddedVal{
+				Idx:     uint16(id),
+				Running: uint16(running),
+				Pending: uint16(n.removals),
+				X:       node.Pos.X,
+				Y:       node.Pos.Y,
+				R2:      node.r2,
+			},
+		})
+	}
+	return nil
+}
+
+// drain waits until all deliveries of broadcasts of a stopped node are
+// handled. A stopped node has no pending broadcasts (they were taken from
+// the queue or discarded), but the transport layer may not have scheduled
+// the last one yet: passing the barrier makes sure it has.
+func (n *Network) drain(node *SimNode) error {
+	ack := make(chan struct{})
+	select {
+	case n.barrier <- ack:
+	case <-n.ctx.Done():
+		return n.ctx.Err()
+	}
+	<-ack
+	for node.inflight.Load() > 0 {
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-n.ctx.Done():
+			return n.ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Epoch boundary: mark the boundary and report (cumulative) traffic of
+// all running nodes.
+func (n *Network) Epoch(epoch int) {
+	if n.cb != nil {
+		n.cb(&core.Event{
+			Type: EvEpoch,
+			Val:  epoch,
+		})
+	}
+	for _, node := range n.Nodes() {
+		if node.IsRunning() {
+			n.reportTraffic(node)
+		}
+	}
+}
+
+// notify listener about traffic of a node
+func (n *Network) reportTraffic(node *SimNode) {
 	if n.cb != nil {
 		n.cb(&core.Event{
 			Type: EvNodeTraffic,
@@ -270,7 +692,6 @@ func (n *Network) StopNode(node *SimNode) (running int) {
 			Val:  []uint64{node.traffIn.Load(), node.traffOut.Load()},
 		})
 	}
-	return
 }
 
 // Stop the network (message exchange)
@@ -283,6 +704,12 @@ func (n *Network) Stop() int {
 	}
 	// stop network
 	n.active.Store(false)
+	if n.stepped != nil {
+		// no message queue in single-stepped simulations; the nodes
+		// use the wall clock again
+		core.SetClock(nil)
+		return len(n.stepped.queue)
+	}
 
 	// discard pending messages in queue
 	discard := 0
@@ -334,24 +761,45 @@ func (n *Network) RoutingTable() (rt *RoutingTable) {
 		}
 	}
 
-	// build routing table
+	// build routing table from a snapshot of the forwards of each node
 	for i1, e1 := range rt.List {
-		for i2, e2 := range n.nodes {
-			if i1 == i2 {
+		for _, hop := range e1.Node.NextHops() {
+			i2, ok := n.index[hop.Target.Key()]
+			if !ok || i1 == i2 {
 				continue
 			}
-			if next, hops := e1.Node.Forward(e2.Node.PeerID()); hops > 0 {
-				ref := i2
-				if next != nil {
-					ref = rt.Index[next.Key()]
-				}
-				rt.List[i1].Forwards[i2] = ref
+			ref := i2
+			if hop.NextHop != nil {
+				ref = rt.Index[hop.NextHop.Key()]
 			}
+			rt.List[i1].Forwards[i2] = ref
 		}
 	}
 	return
 }
 
+// Graph returns the connectivity graph of running nodes (as defined by
+// the environment). Only bidirectional links are edges in the graph.
+func (n *Network) Graph() *Graph {
+	n.nodeLock.RLock()
+	defer n.nodeLock.RUnlock()
+
+	g := NewGraph()
+	for i1, node1 := range n.nodes {
+		if !node1.IsRunning() {
+			continue
+		}
+		g.AddNode(i1)
+		for i2, node2 := range n.nodes {
+			if i2 > i1 && node2.IsRunning() &&
+				n.env.Connectivity(node1, node2) && n.env.Connectivity(node2, node1) {
+				g.AddEdge(i1, i2)
+			}
+		}
+	}
+	return g
+}
+
 // Render the network directly.
 func (n *Network) Render(c Canvas) {
 	n.nodeLock.RLock()
@@ -392,9 +840,6 @@ func (n *Network) Render(c Canvas) {
 }
 
 func (n *Network) sanityCheck() {
-	if n.check.Load() {
-		return
-	}
 	// do the sanity check...
 	n.check.Store(false)
 }
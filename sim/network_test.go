@@ -0,0 +1,556 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"leatea/core"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bfix/gospel/data"
+)
+
+// build a test network with given neighbor relations. The nodes are
+// running, but no messages are exchanged: the forward tables of the
+// nodes only hold the direct neighbors.
+func testNetwork(t *testing.T, links map[int][]int) *Network {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	netw := NewNetwork(new(RndModel), len(links))
+	t.Cleanup(func() {
+		// wait for the nodes to stop (they read the configuration)
+		cancel()
+		for _, node := range netw.nodes {
+			<-node.Done()
+		}
+	})
+	for id := range links {
+		node := NewSimNode(core.NewPeerPrivate(), netw.queue, &Position{}, 0)
+		node.id = id
+		if err := netw.addNode(id, node); err != nil {
+			t.Fatal(err)
+		}
+		netw.running++
+		go node.Start(ctx, nil)
+		for !node.IsRunning() {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	for id, nbs := range links {
+		for _, nb := range nbs {
+			netw.nodes[id].AddNeighbor(netw.nodes[nb].PeerID())
+		}
+	}
+	return netw
+}
+
+func TestLargestTable(t *testing.T) {
+	// star topology: node 1 is the center
+	netw := testNetwork(t, map[int][]int{
+		1: {2, 3, 4, 5, 6},
+		2: {1},
+		3: {1},
+		4: {1},
+		5: {1},
+		6: {1},
+	})
+	id, size := netw.LargestTable()
+	if id != 1 {
+		t.Fatalf("largest table at node %d (expected 1)", id)
+	}
+	if size != 5 {
+		t.Fatalf("largest table has %d entries (expected 5)", size)
+	}
+}
+
+// run a simulated network of eight nodes in a ring (circular model) with
+// given loss rate for a few beacon intervals.
+func runNetwork(t *testing.T, lossRate float64) *Network {
+	t.Helper()
+	env, node := *Cfg.Env, *Cfg.Node
+	defer func() {
+		*Cfg.Env, *Cfg.Node = env, node
+	}()
+	Cfg.Env.NumNodes = 8
+	Cfg.Node.BootupTime = 0
+	Cfg.Node.DeathRate = 0
+	Cfg.Node.LossRate = lossRate
+
+	ctx, cancel := context.WithCancel(context.Background())
+	netw := NewNetwork(new(CircModel), Cfg.Env.NumNodes)
+	go netw.Run(ctx, nil)
+	time.Sleep(time.Duration(2*Cfg.Core.BeaconIntv)*time.Second + 500*time.Millisecond)
+
+	// wait for the simulation to end before the configuration is restored
+	cancel()
+	waitDone(t, netw)
+	return netw
+}
+
+// wait for a cancelled simulation to end
+func waitDone(t *testing.T, netw *Network) {
+	t.Helper()
+	select {
+	case <-netw.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("simulation not stopped")
+	}
+}
+
+func TestReviveNode(t *testing.T) {
+	env, node := *Cfg.Env, *Cfg.Node
+	defer func() {
+		*Cfg.Env, *Cfg.Node = env, node
+	}()
+	Cfg.Env.NumNodes = 8
+	Cfg.Node.BootupTime = 0
+	Cfg.Node.DeathRate = 0
+	Cfg.Node.LossRate = 0
+
+	// run ring network (record node additions)
+	var lock sync.Mutex
+	added := make(map[string]int)
+	ctx, cancel := context.WithCancel(context.Background())
+	netw := NewNetwork(new(CircModel), Cfg.Env.NumNodes)
+	defer func() {
+		// wait for the simulation to end before the configuration is
+		// restored
+		cancel()
+		waitDone(t, netw)
+	}()
+	go netw.Run(ctx, func(ev *core.Event) {
+		if ev.Type == EvNodeAdded {
+			lock.Lock()
+			added[ev.Peer.Key()]++
+			lock.Unlock()
+		}
+	})
+	wait := time.Duration(2*Cfg.Core.BeaconIntv)*time.Second + 500*time.Millisecond
+	time.Sleep(wait)
+
+	node3 := netw.NodeByID(3)
+	if node3 == nil || len(node3.Neighbors()) != 2 {
+		t.Fatal("ring not established")
+	}
+	if err := netw.ReviveNode(3); !errors.Is(err, core.ErrNodeRunning) {
+		t.Fatalf("revived running node: %v", err)
+	}
+	// kill node 3: it forgets its neighbors
+	netw.StopNode(node3)
+	if node3.IsRunning() || len(node3.Neighbors()) != 0 {
+		t.Fatal("node not stopped")
+	}
+	// revive node 3: same identity, neighbors re-learned
+	peer := node3.PeerID()
+	if err := netw.ReviveNode(3); err != nil {
+		t.Fatal(err)
+	}
+	if running, _, _, _ := netw.Stats(); running != 8 {
+		t.Fatalf("%d nodes running", running)
+	}
+	time.Sleep(wait)
+	if !node3.IsRunning() || !node3.PeerID().Equal(peer) {
+		t.Fatal("node not revived")
+	}
+	g := netw.Graph()
+	nbs := node3.Neighbors()
+	if len(nbs) != len(g.Neighbors(3)) {
+		t.Fatalf("%d neighbors re-learned (expected %d)", len(nbs), len(g.Neighbors(3)))
+	}
+	for _, nb := range nbs {
+		if id := netw.GetShortID(nb); g.Distance(3, id) != 1 {
+			t.Fatalf("node %d is no neighbor", id)
+		}
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if added[peer.Key()] != 2 {
+		t.Fatalf("node added %d times", added[peer.Key()])
+	}
+}
+
+func TestPacketLoss(t *testing.T) {
+	// total loss: no node learns a neighbor
+	netw := runNetwork(t, 1.0)
+	for _, node := range netw.Nodes() {
+		if n := len(node.Neighbors()); n != 0 {
+			t.Fatalf("node %d has %d neighbors", node.ID(), n)
+		}
+	}
+	if _, _, _, dropped := netw.Stats(); dropped == 0 {
+		t.Fatal("no dropped deliveries")
+	}
+	// no loss: all nodes see their neighbors in the ring
+	netw = runNetwork(t, 0.0)
+	for _, node := range netw.Nodes() {
+		if n := len(node.Neighbors()); n != 2 {
+			t.Fatalf("node %d has %d neighbors", node.ID(), n)
+		}
+	}
+	if _, _, _, dropped := netw.Stats(); dropped != 0 {
+		t.Fatalf("%d dropped deliveries", dropped)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	env := *Cfg.Env
+	defer func() { *Cfg.Env = env }()
+	Cfg.Env.Latency, Cfg.Env.Jitter, Cfg.Env.LatencyD2 = 5, 0, 1
+
+	// sender (1) with a near (2) and a distant (3) node in reach
+	netw := testNetwork(t, map[int][]int{1: {}, 2: {}, 3: {}})
+	netw.nodes[1].r2 = 1000
+	netw.nodes[2].Pos = &Position{X: 3, Y: 0}
+	netw.nodes[3].Pos = &Position{X: 20, Y: 0}
+	sender := netw.nodes[1].PeerID()
+
+	// deliver beacon and record arrival times (sender becomes neighbor)
+	start := time.Now()
+	netw.deliver(core.NewBeaconMsg(sender, 0))
+	arrived := make(map[int]time.Duration)
+	for len(arrived) < 2 && time.Since(start) < time.Second {
+		for _, id := range []int{2, 3} {
+			if _, ok := arrived[id]; !ok && len(netw.nodes[id].Neighbors()) > 0 {
+				arrived[id] = time.Since(start)
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if len(arrived) < 2 {
+		t.Fatalf("message not delivered: %v", arrived)
+	}
+	// expected latencies: 14ms (near) and 405ms (distant)
+	if arrived[2] < 14*time.Millisecond || arrived[3] < 405*time.Millisecond {
+		t.Fatalf("message arrived too early: %v", arrived)
+	}
+	if arrived[3]-arrived[2] < 300*time.Millisecond {
+		t.Fatalf("distant message not delayed: %v", arrived)
+	}
+}
+
+// run a seeded random network until it converged and return a snapshot
+// of node identities, positions and route lengths.
+func seededRun(t *testing.T, seed int64) string {
+	t.Helper()
+	SetSeed(seed)
+	core.SetSeed(seed)
+	ctx, cancel := context.WithCancel(context.Background())
+	netw := NewNetwork(new(RndModel), Cfg.Env.NumNodes)
+	defer func() {
+		// wait for the simulation to end (before the next run starts
+		// or the configuration is restored)
+		cancel()
+		waitDone(t, netw)
+	}()
+	go netw.Run(ctx, nil)
+	time.Sleep(4 * time.Second)
+
+	buf := new(strings.Builder)
+	rt := netw.RoutingTable()
+	for from := 1; from <= Cfg.Env.NumNodes; from++ {
+		node := netw.nodes[from]
+		fmt.Fprintf(buf, "%d: %s (%.3f,%.3f)", from, node.PeerID(), node.Pos.X, node.Pos.Y)
+		for to := 1; to <= Cfg.Env.NumNodes; to++ {
+			hops, _ := rt.Route(from, to)
+			fmt.Fprintf(buf, " %d", hops)
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+func TestReproducibleRun(t *testing.T) {
+	env, node := *Cfg.Env, *Cfg.Node
+	defer func() {
+		*Cfg.Env, *Cfg.Node = env, node
+		SetSeed(Seed)
+		core.SetSeed(0)
+		core.SetConfiguration(Cfg.Core)
+	}()
+	Cfg.Env.Width, Cfg.Env.Height, Cfg.Env.NumNodes = 40, 40, 8
+	Cfg.Node.BootupTime = 0.5
+	Cfg.Node.DeathRate = 0
+	core.SetConfiguration(&core.Config{LearnIntv: 1})
+
+	run1 := seededRun(t, 4711)
+	run2 := seededRun(t, 4711)
+	if run1 != run2 {
+		t.Fatalf("runs differ:\n%s\n%s", run1, run2)
+	}
+	// a different seed results in a different network
+	if run3 := seededRun(t, 4712); run3 == run1 {
+		t.Fatal("seed has no effect")
+	}
+}
+
+func TestConvergence(t *testing.T) {
+	// line topology without learning: not converged
+	netw := testNetwork(t, map[int][]int{1: {2}, 2: {1, 3}, 3: {2}})
+	_, _, success, _ := netw.RoutingTable().Status()
+	if conv, _ := netw.Converge(1, success); conv != 0 {
+		t.Fatalf("line converged at epoch %d", conv)
+	}
+	// fully connected network
+	netw = testNetwork(t, map[int][]int{1: {2, 3}, 2: {1, 3}, 3: {1, 2}})
+	for epoch := 1; epoch < 4; epoch++ {
+		_, _, success, _ = netw.RoutingTable().Status()
+		if conv, dt := netw.Converge(epoch, success); conv != 1 || dt <= 0 {
+			t.Fatalf("converged at epoch %d (%s)", conv, dt)
+		}
+	}
+}
+
+func TestEpochTraffic(t *testing.T) {
+	netw := testNetwork(t, map[int][]int{1: {2}, 2: {1, 3}, 3: {2}})
+	samples := make(map[string]int)
+	netw.cb = func(ev *core.Event) {
+		if ev.Type == EvNodeTraffic {
+			samples[ev.Peer.Key()]++
+		}
+	}
+	const epochs = 5
+	for epoch := 1; epoch <= epochs; epoch++ {
+		netw.Epoch(epoch)
+	}
+	for _, node := range netw.Nodes() {
+		if n := samples[node.PeerID().Key()]; n != epochs {
+			t.Fatalf("node %d: %d traffic samples", node.ID(), n)
+		}
+	}
+}
+
+func TestTrafficByType(t *testing.T) {
+	netw := testNetwork(t, map[int][]int{1: {}, 2: {}})
+	netw.nodes[1].Pos = &Position{X: 10, Y: 10}
+	netw.nodes[2].Pos = &Position{X: 12, Y: 10}
+	netw.nodes[1].r2 = 100
+	sender := netw.nodes[1].PeerID()
+
+	// deliver beacons and a LEArn message
+	const beacons = 7
+	var size uint64
+	for i := 0; i < beacons; i++ {
+		msg := core.NewBeaconMsg(sender, i)
+		size = uint64(msg.Size())
+		netw.deliver(msg)
+	}
+	learn := netw.nodes[1].NewLearn()
+	netw.deliver(learn)
+
+	traffic := netw.nodes[1].TrafficByType()
+	if traffic[core.MsgBeacon] != beacons*size {
+		t.Fatalf("beacon traffic %d (expected %d)", traffic[core.MsgBeacon], beacons*size)
+	}
+	if traffic[core.MsgLEArn] != uint64(learn.Size()) || len(traffic) != 2 {
+		t.Fatalf("wrong traffic: %v", traffic)
+	}
+	if out := netw.nodes[1].traffOut.Load(); out != beacons*size+uint64(learn.Size()) {
+		t.Fatalf("total traffic %d", out)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	netw := testNetwork(t, map[int][]int{1: {2}, 2: {1, 3}, 3: {2}, 4: {}})
+	peer := func(id int) *core.PeerID {
+		return netw.nodes[id].PeerID()
+	}
+	// node learns a relay to target from a neighbor
+	teach := func(to, from, target int) {
+		netw.nodes[to].Learn(core.NewTEAchMsg(peer(from), []*core.Forward{
+			{Peer: peer(target), Hops: 1, NextHop: core.RndUInt32()},
+		}))
+	}
+	// node 1 learns node 3 from node 2
+	teach(1, 2, 3)
+
+	// successful route
+	path, hops, status := netw.Route(peer(1), peer(3))
+	if status != core.RouteSuccess || hops != 2 || len(path) != 3 ||
+		!path[1].Equal(peer(2)) || !path[2].Equal(peer(3)) {
+		t.Fatalf("route 1->3: %v (%d hops, status %d)", path, hops, status)
+	}
+	// broken route (node 4 is unknown)
+	path, hops, status = netw.Route(peer(1), peer(4))
+	if status != core.RouteBroken || hops != 0 || len(path) != 1 {
+		t.Fatalf("route 1->4: %v (%d hops, status %d)", path, hops, status)
+	}
+	// loop: nodes 1 and 2 forward to node 4 via each other
+	teach(1, 2, 4)
+	teach(2, 1, 4)
+	if path, hops, status = netw.Route(peer(1), peer(4)); status != core.RouteLoop {
+		t.Fatalf("route 1->4: %v (%d hops, status %d)", path, hops, status)
+	}
+}
+
+func TestPeerCollision(t *testing.T) {
+	netw := testNetwork(t, map[int][]int{1: {2}, 2: {1}})
+
+	// re-adding a node fails
+	node := netw.nodes[1]
+	if err := netw.addNode(3, node); !errors.Is(err, ErrPeerExists) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// different peer with the same tag as node 2
+	data := netw.nodes[2].PeerID().Bytes()
+	data[31] ^= 0x01
+	peer, err := core.NewPeerID(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peer.Tag() != netw.nodes[2].PeerID().Tag() || peer.Equal(netw.nodes[2].PeerID()) {
+		t.Fatal("no tag collision constructed")
+	}
+	if err := netw.checkPeer(peer); !errors.Is(err, ErrTagCollision) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// network is unchanged
+	if len(netw.nodes) != 2 || len(netw.index) != 2 || netw.GetShortID(netw.nodes[1].PeerID()) != 1 {
+		t.Fatal("network changed by failed registration")
+	}
+}
+
+// line network of 'num' nodes with complete forward tables (without
+// message exchange). Every tenth node is stopped.
+func lineNetwork(num int) *Network {
+	netw := NewNetwork(new(RndModel), num)
+	nodes := make([]*SimNode, num)
+	for i := range nodes {
+		nodes[i] = NewSimNode(core.NewPeerPrivate(), netw.queue, &Position{}, 0)
+		nodes[i].id = i + 1
+		if err := netw.addNode(i+1, nodes[i]); err != nil {
+			panic(err)
+		}
+	}
+	for i, node := range nodes {
+		list := make([]*core.Entry, 0, num)
+		for j, target := range nodes {
+			e := &core.Entry{Peer: target.PeerID()}
+			switch {
+			case i == j:
+				continue
+			case j < i-1:
+				e.NextHop, e.Hops = nodes[i-1].PeerID(), int16(i-j-1)
+			case j > i+1:
+				e.NextHop, e.Hops = nodes[i+1].PeerID(), int16(j-i-1)
+			}
+			if j%7 == 0 {
+				e.SetState(core.StateRemoved)
+			}
+			list = append(list, e)
+		}
+		node.Restore(list)
+		if i%10 != 9 {
+			node.Activate(nil)
+		}
+	}
+	return netw
+}
+
+// routing table built from per-pair forward lookups
+func pairRoutingTable(n *Network) (rt *RoutingTable) {
+	rt = NewRoutingTable()
+	for i, node := range n.nodes {
+		if node.IsRunning() {
+			rt.AddNode(i, node)
+		}
+	}
+	for i1, e1 := range rt.List {
+		for i2, e2 := range n.nodes {
+			if i1 == i2 {
+				continue
+			}
+			if next, hops := e1.Node.Forward(e2.Node.PeerID()); hops > 0 {
+				ref := i2
+				if next != nil {
+					ref = rt.Index[next.Key()]
+				}
+				rt.List[i1].Forwards[i2] = ref
+			}
+		}
+	}
+	return
+}
+
+func TestRoutingTableSnapshot(t *testing.T) {
+	netw := lineNetwork(50)
+	rt, ref := netw.RoutingTable(), pairRoutingTable(netw)
+	if !reflect.DeepEqual(rt, ref) {
+		t.Fatal("routing tables differ")
+	}
+	if _, _, success, _ := rt.Status(); success == 0 {
+		t.Fatal("no routes")
+	}
+}
+
+func BenchmarkRoutingTable(b *testing.B) {
+	netw := lineNetwork(500)
+	b.Run("pairs", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			pairRoutingTable(netw)
+		}
+	})
+	b.Run("snapshot", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			netw.RoutingTable()
+		}
+	})
+}
+
+func TestBloomCheck(t *testing.T) {
+	defer func(on bool) { Cfg.Options.BloomCheck = on }(Cfg.Options.BloomCheck)
+	Cfg.Options.BloomCheck = true
+
+	// line 1-2-3: node 1 only knows node 2
+	netw := testNetwork(t, map[int][]int{
+		1: {2},
+		2: {1, 3},
+		3: {2},
+	})
+	n1, n2, n3 := netw.nodes[1], netw.nodes[2], netw.nodes[3]
+
+	// a LEArn filter of node 1 falsely containing node 3
+	filter := data.NewSaltedBloomFilter(core.RndUInt32(), 1, 0.5)
+	filter.Add(n1.PeerID().Bytes())
+	filter.Add(n2.PeerID().Bytes())
+	for !filter.Contains(n3.PeerID().Bytes()) {
+		filter = data.NewSaltedBloomFilter(core.RndUInt32(), 1, 0.5)
+		filter.Add(n1.PeerID().Bytes())
+		filter.Add(n2.PeerID().Bytes())
+	}
+	// teach once without check (entries are no longer pending)
+	n2.SetFilterCheck(nil)
+	n2.Teach(core.NewLearnMsg(n1.PeerID(), filter))
+	if fp := netw.FalsePositives(); fp != 0 {
+		t.Fatalf("%d false positives without check", fp)
+	}
+	n2.SetFilterCheck(netw.knows)
+	n2.Teach(core.NewLearnMsg(n1.PeerID(), filter))
+	n2.Teach(core.NewLearnMsg(n1.PeerID(), filter))
+	if fp := netw.FalsePositives(); fp != 2 {
+		t.Fatalf("%d false positives", fp)
+	}
+}
@@ -23,6 +23,7 @@ package sim
 import (
 	"context"
 	"fmt"
+	"image/color"
 	"leatea/core"
 	"math"
 	"sort"
@@ -37,25 +38,42 @@ import (
 type SimNode struct {
 	core.Node
 	id       int               // simplified node identifier
+	idx      int               // placement index in environment
 	Pos      *Position         // position in the field
 	v        float64           // velocity (in units per epoch)
 	dir      float64           // direction [0,2π(
 	r2       float64           // square of broadcast distance
+	band     string            // radio band ("" = default)
 	traffIn  atomic.Uint64     // data received
 	traffOut atomic.Uint64     // data sent
-	recv     chan core.Message // channel for incoming messages
+	traffMsg [4]atomic.Uint64  // data sent per message type
+	recv     chan core.Message // channel for incoming messages (nil if stepped)
+	inflight atomic.Int64      // deliveries of broadcasts not handled yet
 }
 
 // NewSimNode creates a new node in the test network
 func NewSimNode(prv *core.PeerPrivate, out chan core.Message, pos *Position, r2 float64) *SimNode {
 	recv := make(chan core.Message)
 	node := &SimNode{
-		Node: *core.NewNode(prv, recv, out, true),
+		Node: *core.NewNode(prv, core.NewChannelTransport(recv, out), true),
 		r2:   r2,
 		Pos:  pos,
 		recv: recv,
 	}
 	node.traffIn.Store(0)
+	node.SetStrict(Cfg.Options.StrictChecks)
+	return node
+}
+
+// newSteppedNode creates a new node for single-stepped simulations: the
+// node queues its broadcasts and handles incoming messages synchronously.
+func newSteppedNode(prv *core.PeerPrivate, trans *core.QueueTransport, pos *Position, r2 float64) *SimNode {
+	node := &SimNode{
+		Node: *core.NewNode(prv, trans, true),
+		r2:   r2,
+		Pos:  pos,
+	}
+	node.SetStrict(Cfg.Options.StrictChecks)
 	return node
 }
 
@@ -70,6 +88,38 @@ func (n *SimNode) Stop() {
 	n.Node.Stop()
 }
 
+// Move the node along its direction for a time span 'dt' (in epochs).
+// At the edges of the field the node bounces off (default), wraps around
+// to the opposite edge or is clamped to the edge (see 'Cfg.Env.Boundary').
+func (n *SimNode) Move(dt float64) {
+	if n.v == 0 {
+		return
+	}
+	x := n.Pos.X + n.v*dt*math.Cos(n.dir)
+	y := n.Pos.Y + n.v*dt*math.Sin(n.dir)
+	w, h := Cfg.Env.Width, Cfg.Env.Height
+	switch Cfg.Env.Boundary {
+	case "wrap":
+		x, y = wrap(x, w), wrap(y, h)
+	case "clamp":
+		x, y = math.Min(math.Max(x, 0), w), math.Min(math.Max(y, 0), h)
+	default:
+		if x < 0 {
+			x, n.dir = -x, math.Pi-n.dir
+		} else if x > w {
+			x, n.dir = 2*w-x, math.Pi-n.dir
+		}
+		if y < 0 {
+			y, n.dir = -y, -n.dir
+		} else if y > h {
+			y, n.dir = 2*h-y, -n.dir
+		}
+		n.dir = math.Mod(n.dir+2*math.Pi, 2*math.Pi)
+	}
+	n.Pos = &Position{X: x, Y: y, Z: n.Pos.Z}
+}
+
+// ID returns the simplified node identifier
 func (n *SimNode) ID() int {
 	return n.id
 }
@@ -93,6 +143,26 @@ func (n *SimNode) ListTable(cv func(*core.PeerID) string, all bool) string {
 	return "[" + strings.Join(entries, ",") + "]"
 }
 
+// sent records the traffic of an outgoing message
+func (n *SimNode) sent(msg core.Message) {
+	size := uint64(msg.Size())
+	n.traffOut.Add(size)
+	if mt := int(msg.Type()); mt < len(n.traffMsg) {
+		n.traffMsg[mt].Add(size)
+	}
+}
+
+// TrafficByType returns the data sent per message type.
+func (n *SimNode) TrafficByType() map[uint16]uint64 {
+	res := make(map[uint16]uint64)
+	for mt := range n.traffMsg {
+		if v := n.traffMsg[mt].Load(); v > 0 {
+			res[uint16(mt)] = v
+		}
+	}
+	return res
+}
+
 // CanReach returns true if the node can reach another node by broadcast
 func (n *SimNode) CanReach(peer *SimNode) bool {
 	dist2 := n.Pos.Distance2(peer.Pos)
@@ -103,7 +173,15 @@ func (n *SimNode) CanReach(peer *SimNode) bool {
 func (n *SimNode) Receive(msg core.Message) {
 	if n.IsRunning() {
 		n.traffIn.Add(uint64(msg.Size()))
-		n.recv <- msg
+		// stepped node: handle message synchronously
+		if n.recv == nil {
+			n.Node.Receive(msg)
+			return
+		}
+		select {
+		case n.recv <- msg:
+		case <-n.Done():
+		}
 	}
 }
 
@@ -117,8 +195,12 @@ func (n *SimNode) String() string {
 
 // Draw a node on the canvas
 func (n *SimNode) Draw(c Canvas) {
-	//r := math.Sqrt(n.r2)
-	c.Circle(n.Pos.X, n.Pos.Y, 0.3, 0, nil, ClrRed)
+	n.DrawColored(c, ClrRed)
+}
+
+// DrawColored draws the node with given color
+func (n *SimNode) DrawColored(c Canvas, clr *color.RGBA) {
+	c.Circle(n.Pos.X, n.Pos.Y, 0.3, 0, nil, clr)
 	c.Circle(n.Pos.X, n.Pos.Y, math.Sqrt(n.r2), 0.03, ClrGray, nil)
 	c.Text(n.Pos.X, n.Pos.Y+1.3, 1, n.PeerID().String())
 }
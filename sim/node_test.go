@@ -0,0 +1,86 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNodeMoveEpoch(t *testing.T) {
+	netw := testNetwork(t, map[int][]int{1: {}})
+	node := netw.nodes[1]
+	node.Pos = &Position{X: 50, Y: 50}
+	node.v, node.dir = 5, math.Pi/4
+
+	env := new(RndModel)
+	env.Register(0, node)
+	pos := node.Pos
+	env.Epoch(1)
+	if d2 := node.Pos.Distance2(pos); math.Abs(d2-25) > 1e-6 {
+		t.Fatalf("node moved from %s to %s", pos, node.Pos)
+	}
+}
+
+func TestNodeMoveBounce(t *testing.T) {
+	node := &SimNode{Pos: &Position{X: Cfg.Env.Width - 1, Y: 1}, v: 4, dir: 0}
+	node.Move(1)
+	if math.Abs(node.Pos.X-(Cfg.Env.Width-3)) > 1e-6 || math.Abs(node.dir-math.Pi) > 1e-6 {
+		t.Fatalf("no bounce at right edge: %s (dir=%.2f)", node.Pos, node.dir)
+	}
+	node.dir = 3 * math.Pi / 2
+	node.Move(1)
+	if math.Abs(node.Pos.Y-3) > 1e-6 || math.Abs(node.dir-math.Pi/2) > 1e-6 {
+		t.Fatalf("no bounce at bottom edge: %s (dir=%.2f)", node.Pos, node.dir)
+	}
+}
+
+func TestNodeMoveWrap(t *testing.T) {
+	defer func(b string) { Cfg.Env.Boundary = b }(Cfg.Env.Boundary)
+	Cfg.Env.Boundary = "wrap"
+
+	node := &SimNode{Pos: &Position{X: Cfg.Env.Width - 1, Y: 1}, v: 4, dir: 0}
+	node.Move(1)
+	if math.Abs(node.Pos.X-3) > 1e-6 || node.dir != 0 {
+		t.Fatalf("no wrap at right edge: %s (dir=%.2f)", node.Pos, node.dir)
+	}
+	node.dir = 3 * math.Pi / 2
+	node.Move(1)
+	if math.Abs(node.Pos.Y-(Cfg.Env.Height-3)) > 1e-6 || node.dir != 3*math.Pi/2 {
+		t.Fatalf("no wrap at bottom edge: %s (dir=%.2f)", node.Pos, node.dir)
+	}
+}
+
+func TestNodeMoveClamp(t *testing.T) {
+	defer func(b string) { Cfg.Env.Boundary = b }(Cfg.Env.Boundary)
+	Cfg.Env.Boundary = "clamp"
+
+	node := &SimNode{Pos: &Position{X: Cfg.Env.Width - 1, Y: 1}, v: 4, dir: 0}
+	node.Move(1)
+	if node.Pos.X != Cfg.Env.Width || node.dir != 0 {
+		t.Fatalf("not clamped at right edge: %s (dir=%.2f)", node.Pos, node.dir)
+	}
+	node.dir = 3 * math.Pi / 2
+	node.Move(1)
+	if node.Pos.Y != 0 || node.Pos.X != Cfg.Env.Width {
+		t.Fatalf("not clamped at bottom edge: %s (dir=%.2f)", node.Pos, node.dir)
+	}
+}
@@ -0,0 +1,186 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"context"
+	"leatea/core"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// active nodes (not started) with readers draining their incoming
+// messages; the handler is called for every received message.
+func poolNodes(ctx context.Context, num int, hdlr func(int, core.Message)) []*SimNode {
+	nodes := make([]*SimNode, num)
+	for i := range nodes {
+		node := NewSimNode(core.NewPeerPrivate(), nil, &Position{}, 0)
+		node.id = i + 1
+		node.Activate(nil)
+		nodes[i] = node
+		go func(i int) {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case msg := <-node.recv:
+					hdlr(i, msg)
+				}
+			}
+		}(i)
+	}
+	return nodes
+}
+
+// running nodes (with drained broadcasts); the listener is called for
+// every event of a node. Returns a function that stops the nodes and
+// waits for their message loops to finish.
+func runningNodes(num int, hdlr func(int, *core.Event)) ([]*SimNode, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	out := make(chan core.Message)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-out:
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	nodes := make([]*SimNode, num)
+	for i := range nodes {
+		node := NewSimNode(core.NewPeerPrivate(), out, &Position{}, 0)
+		node.id = i + 1
+		nodes[i] = node
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			node.Start(ctx, func(ev *core.Event) { hdlr(i, ev) })
+		}(i)
+	}
+	// wait until all nodes are running
+	for _, node := range nodes {
+		for !node.IsRunning() {
+			runtime.Gosched()
+		}
+	}
+	return nodes, func() {
+		for _, node := range nodes {
+			node.Stop()
+		}
+		wg.Wait()
+		cancel()
+	}
+}
+
+func TestWorkerPoolOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// record beacon numbers in the order the nodes handle them
+	const num, msgs = 5, 1000
+	sender := core.NewPeerPrivate().Public()
+	var wg sync.WaitGroup
+	wg.Add(num * msgs)
+	recv := make([][]int, num)
+	nodes, stop := runningNodes(num, func(i int, ev *core.Event) {
+		if ev.Type == core.EvBeaconReceived && ev.Ref.Equal(sender) {
+			recv[i] = append(recv[i], ev.Val.(int))
+			wg.Done()
+		}
+	})
+	defer stop()
+	pool := newWorkerPool(ctx, 3)
+	for i := 0; i < msgs; i++ {
+		msg := core.NewBeaconMsg(sender, i)
+		for _, node := range nodes {
+			pool.submit(&delivery{node: node, msg: msg})
+		}
+	}
+	wg.Wait()
+	for i, list := range recv {
+		for j, k := range list {
+			if j != k {
+				t.Fatalf("node %d: message %d handled at position %d", i+1, k, j)
+			}
+		}
+	}
+}
+
+func BenchmarkDelivery(b *testing.B) {
+	const num = 50
+	run := func(b *testing.B, deliver func(*SimNode, core.Message)) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var wg sync.WaitGroup
+		nodes := poolNodes(ctx, num, func(int, core.Message) { wg.Done() })
+		msg := core.NewBeaconMsg(core.NewPeerPrivate().Public(), 0)
+		b.ResetTimer()
+		wg.Add(b.N * num)
+		for i := 0; i < b.N; i++ {
+			for _, node := range nodes {
+				deliver(node, msg)
+			}
+		}
+		wg.Wait()
+	}
+	b.Run("goroutine", func(b *testing.B) {
+		run(b, func(node *SimNode, msg core.Message) {
+			go node.Receive(msg)
+		})
+	})
+	b.Run("pool", func(b *testing.B) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		pool := newWorkerPool(ctx, runtime.GOMAXPROCS(0))
+		run(b, func(node *SimNode, msg core.Message) {
+			pool.submit(&delivery{node: node, msg: msg})
+		})
+	})
+}
+
+func BenchmarkReceive(b *testing.B) {
+	// deliveries handled by running nodes (throughput of the message
+	// handling in the node loop)
+	const num = 50
+	sender := core.NewPeerPrivate().Public()
+	var wg sync.WaitGroup
+	nodes, stop := runningNodes(num, func(_ int, ev *core.Event) {
+		if ev.Type == core.EvBeaconReceived && ev.Ref.Equal(sender) {
+			wg.Done()
+		}
+	})
+	defer stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool := newWorkerPool(ctx, runtime.GOMAXPROCS(0))
+	msg := core.NewBeaconMsg(sender, 0)
+	b.ResetTimer()
+	wg.Add(b.N * num)
+	for i := 0; i < b.N; i++ {
+		for _, node := range nodes {
+			pool.submit(&delivery{node: node, msg: msg})
+		}
+	}
+	wg.Wait()
+}
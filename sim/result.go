@@ -0,0 +1,191 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"fmt"
+	"io"
+	"leatea/core"
+	"sort"
+	"strings"
+)
+
+//----------------------------------------------------------------------
+// Summary of a simulation run
+//----------------------------------------------------------------------
+
+// Result of a simulation run
+type Result struct {
+	// scenario
+	Env      *EnvironCfg // environment parameters
+	Node     *NodeCfg    // node parameters
+	Seed     int64       // seed of the random generator
+	NumNodes int         // number of running nodes
+
+	// convergence
+	Epochs    int // number of epochs
+	Converged int // epoch of convergence (0 = not converged)
+
+	// routing status
+	Loops    int     // number of looping routes
+	Broken   int     // number of broken routes
+	Success  int     // number of successful routes
+	MeanHops float64 // mean number of hops on successful routes
+	Stretch  float64 // ratio of hops on successful routes to shortest paths (0 = unknown)
+	HopLimit int     // number of routes ignored at the hop limit
+
+	// loop lifetimes (only if loops are tracked)
+	LoopStats *LoopSummary
+
+	// traffic
+	TrafficIn  uint64            // total number of bytes received
+	TrafficOut uint64            // total number of bytes sent
+	Traffic    map[uint16]uint64 // bytes sent per message type (optional)
+
+	// anomalies detected during the run
+	Anomalies []string
+}
+
+// NewResult creates a summary of a network run from its current state,
+// the final routing table and the loops tracked during the run (both
+// optional).
+func NewResult(netw *Network, rt *RoutingTable, lt *LoopTracker, epoch int) *Result {
+	res := &Result{
+		Env:    Cfg.Env,
+		Node:   Cfg.Node,
+		Seed:   seed,
+		Epochs: epoch,
+	}
+	res.NumNodes, _, _, _ = netw.Stats()
+	res.Converged, _ = netw.Converged()
+	res.HopLimit = netw.HopLimitExceeded()
+	if lt != nil {
+		res.LoopStats = lt.Summary()
+	}
+	for _, node := range netw.Nodes() {
+		res.TrafficIn += node.traffIn.Load()
+		res.TrafficOut += node.traffOut.Load()
+		for mt, v := range node.TrafficByType() {
+			if res.Traffic == nil {
+				res.Traffic = make(map[uint16]uint64)
+			}
+			res.Traffic[mt] += v
+		}
+	}
+	if rt != nil {
+		var totalHops int
+		res.Loops, res.Broken, res.Success, totalHops = rt.Status()
+		if res.Success > 0 {
+			res.MeanHops = float64(totalHops) / float64(res.Success)
+		}
+		// compare successful routes with the shortest paths
+		checked, subopt, excess := rt.CompareOptimal(netw.Graph())
+		if checked > 0 && checked == res.Success {
+			optimal := float64(totalHops) - float64(subopt)*excess
+			res.Stretch = float64(totalHops) / optimal
+		}
+	}
+	if res.Loops > 0 {
+		res.Anomalies = append(res.Anomalies, fmt.Sprintf("%d looping routes", res.Loops))
+	}
+	if ls := res.LoopStats; ls != nil && ls.Recurring > 0 {
+		res.Anomalies = append(res.Anomalies, fmt.Sprintf("%d oscillating loops (formed repeatedly)", ls.Recurring))
+	}
+	if res.HopLimit > 0 {
+		res.Anomalies = append(res.Anomalies, fmt.Sprintf("%d routes over the hop limit (count-to-infinity)", res.HopLimit))
+	}
+	return res
+}
+
+// WriteSummary writes a human-readable summary of the run.
+func (r *Result) WriteSummary(w io.Writer) (err error) {
+	buf := new(strings.Builder)
+	line := func(label, format string, args ...any) {
+		fmt.Fprintf(buf, "%-16s "+format+"\n", append([]any{label + ":"}, args...)...)
+	}
+	total := r.NumNodes * (r.NumNodes - 1)
+	perc := func(n int) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(100*n) / float64(total)
+	}
+	buf.WriteString("LEArn/TEAch simulation summary\n")
+	if r.Env != nil {
+		line("Environment", "%s (%.0fx%.0f)", r.Env.Class, r.Env.Width, r.Env.Height)
+	}
+	if r.Node != nil {
+		line("Node", "reach2=%.2f, bootup=%.0f, ttl=%.0f, deathRate=%.2f",
+			r.Node.Reach2, r.Node.BootupTime, r.Node.PeerTTL, r.Node.DeathRate)
+	}
+	line("Seed", "%d", r.Seed)
+	line("Nodes", "%d", r.NumNodes)
+	line("Epochs", "%d", r.Epochs)
+	if r.Converged > 0 {
+		line("Converged", "epoch %d", r.Converged)
+	} else {
+		line("Converged", "no")
+	}
+	line("Loops", "%d (%.2f%%)", r.Loops, perc(r.Loops))
+	line("Broken", "%d (%.2f%%)", r.Broken, perc(r.Broken))
+	line("Success", "%d (%.2f%%)", r.Success, perc(r.Success))
+	line("Mean hops", "%.2f", r.MeanHops)
+	if r.Stretch > 0 {
+		line("Stretch", "%.3f", r.Stretch)
+	} else {
+		line("Stretch", "n/a")
+	}
+	if ls := r.LoopStats; ls != nil {
+		line("Loop lifetime", "%d loops (%d distinct, %d recurring), mean %.2f, max %d epochs",
+			ls.Loops, ls.Distinct, ls.Recurring, ls.MeanLifetime, ls.MaxLifetime)
+	}
+	line("Traffic", "%s in, %s out", Scale(float64(r.TrafficIn)), Scale(float64(r.TrafficOut)))
+	if len(r.Traffic) > 0 {
+		types := make([]int, 0, len(r.Traffic))
+		for mt := range r.Traffic {
+			types = append(types, int(mt))
+		}
+		sort.Ints(types)
+		for _, mt := range types {
+			line("  "+msgTypeName(uint16(mt)), "%s", Scale(float64(r.Traffic[uint16(mt)])))
+		}
+	}
+	if len(r.Anomalies) == 0 {
+		line("Anomalies", "none")
+	} else {
+		line("Anomalies", "%s", strings.Join(r.Anomalies, "; "))
+	}
+	_, err = io.WriteString(w, buf.String())
+	return
+}
+
+// get a human-readable name for a message type
+func msgTypeName(mt uint16) string {
+	switch mt {
+	case core.MsgBeacon:
+		return "Beacon"
+	case core.MsgLEArn:
+		return "LEArn"
+	case core.MsgTEAch:
+		return "TEAch"
+	}
+	return fmt.Sprintf("Type %d", mt)
+}
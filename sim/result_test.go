@@ -0,0 +1,114 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"leatea/core"
+	"strings"
+	"testing"
+)
+
+func TestWriteSummary(t *testing.T) {
+	netw := testNetwork(t, map[int][]int{
+		1: {2},
+		2: {1},
+	})
+	res := NewResult(netw, netw.RoutingTable(), nil, 5)
+	res.Converged = 3
+
+	buf := new(strings.Builder)
+	if err := res.WriteSummary(buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	t.Log("\n" + out)
+	for _, key := range []string{
+		"Environment:", "Seed:", "Nodes:", "Epochs:", "Converged:", "Loops:",
+		"Broken:", "Success:", "Mean hops:", "Stretch:", "Traffic:", "Anomalies:",
+	} {
+		if !strings.Contains(out, key) {
+			t.Errorf("summary is missing %q", key)
+		}
+	}
+	if !strings.Contains(out, "Success:         2 (100.00%)") {
+		t.Error("wrong success count")
+	}
+}
+
+func TestResultRun(t *testing.T) {
+	defer func(n int) {
+		Cfg.Env.NumNodes = n
+		core.SetConfiguration(Cfg.Core)
+	}(Cfg.Env.NumNodes)
+	Cfg.Env.NumNodes = 6
+	core.SetConfiguration(&core.Config{MaxHops: 3})
+
+	// stepped run on a line with routes limited to three hops
+	netw := NewNetwork(new(lineModel), 6)
+	netw.RunStepped(nil)
+	defer netw.Stop()
+	lt := NewLoopTracker()
+	epoch := 0
+	for epoch < 10 {
+		ep, msg := netw.Step()
+		if msg == nil {
+			epoch = ep
+			lt.Update(epoch, netw.RoutingTable())
+		}
+	}
+	// a neighbor (with a larger hop limit) teaches a route that is too
+	// long for the node
+	node, nb := netw.stepped.sorted[0], netw.stepped.sorted[1]
+	node.Learn(core.NewTEAchMsg(nb.PeerID(), []*core.Forward{
+		{Peer: core.NewPeerPrivate().Public(), Hops: 5, NextHop: 7},
+	}))
+	res := NewResult(netw, netw.RoutingTable(), lt, epoch)
+
+	// routes on a line are shortest paths
+	if res.Success == 0 || res.Stretch != 1 {
+		t.Fatalf("stretch %.3f on %d routes", res.Stretch, res.Success)
+	}
+	if res.HopLimit == 0 || res.LoopStats == nil {
+		t.Fatalf("%d routes over hop limit, loop stats %v", res.HopLimit, res.LoopStats)
+	}
+	if len(res.Anomalies) != 1 || !strings.Contains(res.Anomalies[0], "count-to-infinity") {
+		t.Fatalf("anomalies: %v", res.Anomalies)
+	}
+}
+
+func TestResultOscillation(t *testing.T) {
+	netw := testNetwork(t, map[int][]int{
+		1: {2},
+		2: {1},
+	})
+	// a loop forms, clears and forms again
+	lt := NewLoopTracker()
+	for epoch, loop := range []bool{true, false, true, false} {
+		lt.Update(epoch, loopTable(loop))
+	}
+	res := NewResult(netw, nil, lt, 4)
+	if ls := res.LoopStats; ls.Loops != 2 || ls.Distinct != 1 || ls.Recurring != 1 {
+		t.Fatalf("loop stats %+v", ls)
+	}
+	if len(res.Anomalies) != 1 || !strings.Contains(res.Anomalies[0], "oscillating") {
+		t.Fatalf("anomalies: %v", res.Anomalies)
+	}
+}
@@ -21,9 +21,17 @@
 package sim
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
 	"leatea/core"
 	"log"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/bfix/gospel/data"
 )
@@ -42,6 +50,8 @@ type RTEntry struct {
 type RoutingTable struct {
 	List  map[int]*RTEntry
 	Index map[string]int
+
+	hops map[int]map[int]int // hop counts of routes (computed in Status)
 }
 
 func NewRoutingTable() *RoutingTable {
@@ -61,12 +71,15 @@ func (rt *RoutingTable) AddNode(i int, node *SimNode) {
 }
 
 func (rt *RoutingTable) Status() (loops, broken, success, totalHops int) {
+	rt.hops = make(map[int]map[int]int)
 	for from := range rt.List {
+		rt.hops[from] = make(map[int]int)
 		for to := range rt.List {
 			if from == to {
 				continue
 			}
 			hops, _ := rt.Route(from, to)
+			rt.hops[from][to] = hops
 			switch hops {
 			case -1:
 				loops++
@@ -81,52 +94,305 @@ func (rt *RoutingTable) Status() (loops, broken, success, totalHops int) {
 	return
 }
 
+// Diameter returns the longest route (in hops) among all successful routes
+// and the eccentricity (longest successful route from a node) of each node.
+// The hop counts of the last Status call are used (computed if missing).
+func (rt *RoutingTable) Diameter() (diameter int, eccentricity map[int]int) {
+	if rt.hops == nil {
+		rt.Status()
+	}
+	eccentricity = make(map[int]int)
+	for from, targets := range rt.hops {
+		ecc := 0
+		for _, hops := range targets {
+			if hops > ecc {
+				ecc = hops
+			}
+		}
+		eccentricity[from] = ecc
+		if ecc > diameter {
+			diameter = ecc
+		}
+	}
+	return
+}
+
+// CompareOptimal compares the hop counts of all successful routes with
+// the shortest paths in a connectivity graph. Returns the number of
+// compared routes, the number of suboptimal routes (more hops than
+// necessary) and the mean number of excess hops of suboptimal routes.
+func (rt *RoutingTable) CompareOptimal(g *Graph) (checked, suboptimal int, excess float64) {
+	if rt.hops == nil {
+		rt.Status()
+	}
+	total := 0
+	for from, targets := range rt.hops {
+		dist := g.Distances(from)
+		for to, hops := range targets {
+			opt, ok := dist[to]
+			if hops <= 0 || !ok {
+				continue
+			}
+			checked++
+			if hops > opt {
+				suboptimal++
+				total += hops - opt
+			}
+		}
+	}
+	if suboptimal > 0 {
+		excess = float64(total) / float64(suboptimal)
+	}
+	return
+}
+
 // Follow the route to target. Returns number of hops on success, 0 for
 // broken routes and -1 for cycles.
 func (rt *RoutingTable) Route(from, to int) (hops int, route []int) {
-	ttl := len(rt.Index)
-	hops = 0
-	for {
-		route = append(route, from)
-		entry, ok := rt.List[from]
+	route, hops, status := core.WalkRoute(from, to, len(rt.Index), func(at int) (int, bool) {
+		entry, ok := rt.List[at]
 		if !ok {
-			hops = 0
-			return
+			return 0, false
 		}
-		hops++
 		next := entry.Forwards[to]
-		if next == to {
-			route = append(route, to)
-			return
+		return next, next >= 0
+	})
+	switch status {
+	case core.RouteBroken:
+		hops = 0
+	case core.RouteLoop:
+		hops = -1
+	}
+	return
+}
+
+// Unreachable returns the (sorted) list of targets that can't be reached
+// from a node (broken or looping routes).
+func (rt *RoutingTable) Unreachable(from int) (list []int) {
+	for to := range rt.List {
+		if to == from {
+			continue
+		}
+		if hops, _ := rt.Route(from, to); hops <= 0 {
+			list = append(list, to)
+		}
+	}
+	sort.Ints(list)
+	return
+}
+
+// Loops returns the distinct cycles of all looping routes in canonical
+// form (starting with the smallest node), sorted by their first nodes.
+func (rt *RoutingTable) Loops() (list [][]int) {
+	seen := make(map[string]bool)
+	for from := range rt.List {
+		for to := range rt.List {
+			if from == to {
+				continue
+			}
+			hops, route := rt.Route(from, to)
+			if hops != -1 {
+				continue
+			}
+			_, cycle := core.RouteCycle(route)
+			if cycle == nil {
+				continue
+			}
+			cycle = core.CanonicalCycle(cycle)
+			if key := fmt.Sprint(cycle); !seen[key] {
+				seen[key] = true
+				list = append(list, cycle)
+			}
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return lessInts(list[i], list[j])
+	})
+	return
+}
+
+// Error codes for route traces
+var (
+	ErrRouteBroken = errors.New("broken route")
+	ErrRouteLoop   = errors.New("route loop")
+)
+
+// Trace the route from one node to another. Returns the sequence of nodes
+// on the route. On a broken route the partial path is returned with
+// ErrRouteBroken; on a loop the path up to the first repeated node (closing
+// the cycle) is returned with ErrRouteLoop.
+func (rt *RoutingTable) Trace(from, to int) ([]int, error) {
+	hops, route := rt.Route(from, to)
+	switch {
+	case hops > 0:
+		return route, nil
+	case hops == 0:
+		// drop unknown node at the end of a broken route
+		if n := len(route); n > 0 {
+			if _, ok := rt.List[route[n-1]]; !ok {
+				route = route[:n-1]
+			}
+		}
+		return route, ErrRouteBroken
+	}
+	// find cycle in route
+	seen := make(map[int]bool)
+	for i, n := range route {
+		if seen[n] {
+			return route[:i+1], ErrRouteLoop
 		}
-		if next < 0 {
-			//log.Printf("%d --> %d: %v", from, to, route)
-			hops = 0
-			return
+		seen[n] = true
+	}
+	return route, ErrRouteLoop
+}
+
+// RenderTrace draws a route (as returned by Trace) over the graph.
+func (rt *RoutingTable) RenderTrace(canvas Canvas, route []int, clr *color.RGBA) {
+	for i := 1; i < len(route); i++ {
+		e1, ok1 := rt.List[route[i-1]]
+		e2, ok2 := rt.List[route[i]]
+		if !ok1 || !ok2 {
+			continue
 		}
-		from = next
-		if ttl--; ttl < 0 {
-			hops = -1
-			return
+		n1, n2 := e1.Node, e2.Node
+		canvas.Line(n1.Pos.X, n1.Pos.Y, n2.Pos.X, n2.Pos.Y, 0.5, clr)
+	}
+}
+
+// Graph returns the graph of neighbor relations in the routing table
+func (rt *RoutingTable) Graph() *Graph {
+	g := NewGraph()
+	for from, entry := range rt.List {
+		g.AddNode(from)
+		for to, next := range entry.Forwards {
+			if next == to {
+				g.AddEdge(from, to)
+			}
 		}
 	}
+	return g
 }
 
-// Render creates an image of the graph
+// Distances returns the number of hops from a node to all reachable nodes
+// (based on neighbor relations in the routing table).
+func (rt *RoutingTable) Distances(from int) map[int]int {
+	return rt.Graph().Distances(from)
+}
+
+// Render creates an image of the graph. Nodes and edges are colored by
+// hop distance from a source node if configured.
 func (rt *RoutingTable) Render(canvas Canvas) {
-	for _, entry := range rt.List {
+	// color by hop distance?
+	var dist map[int]int
+	maxDist := 0
+	if Cfg.Render.ColorBy == "hops" {
+		dist = rt.Distances(Cfg.Render.Source)
+		for _, d := range dist {
+			if d > maxDist {
+				maxDist = d
+			}
+		}
+	}
+	hopColor := func(id int, clr *color.RGBA) *color.RGBA {
+		if dist == nil {
+			return clr
+		}
+		if d, ok := dist[id]; ok {
+			return HopColor(d, maxDist)
+		}
+		return ClrGray
+	}
+	for from, entry := range rt.List {
 		// draw node
 		nodeFrom := entry.Node
-		nodeFrom.Draw(canvas)
+		nodeFrom.DrawColored(canvas, hopColor(from, ClrRed))
 
 		// draw connections
+		clr := hopColor(from, ClrBlue)
 		for _, next := range entry.Forwards {
 			nodeTo := rt.List[next].Node
-			canvas.Line(nodeFrom.Pos.X, nodeFrom.Pos.Y, nodeTo.Pos.X, nodeTo.Pos.Y, 0.15, ClrBlue)
+			canvas.Line(nodeFrom.Pos.X, nodeFrom.Pos.Y, nodeTo.Pos.X, nodeTo.Pos.Y, 0.15, clr)
 		}
 	}
 }
 
+// WriteDOT writes the routing graph in GraphViz DOT format: each forward
+// is an edge from node to next hop (labeled with the target). Edges to
+// neighbors are drawn solid, edges to relays dashed.
+func (rt *RoutingTable) WriteDOT(w io.Writer) error {
+	// sorted list of node ids (stable output)
+	ids := make([]int, 0, len(rt.List))
+	for id := range rt.List {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	wrt := bufio.NewWriter(w)
+	fmt.Fprintln(wrt, "digraph routing {")
+	for _, id := range ids {
+		fmt.Fprintf(wrt, "  n%d [label=\"%d\"];\n", id, id)
+	}
+	for _, from := range ids {
+		entry := rt.List[from]
+		targets := make([]int, 0, len(entry.Forwards))
+		for to := range entry.Forwards {
+			targets = append(targets, to)
+		}
+		sort.Ints(targets)
+		for _, to := range targets {
+			next := entry.Forwards[to]
+			style := "dashed"
+			if next == to {
+				style = "solid"
+			}
+			fmt.Fprintf(wrt, "  n%d -> n%d [label=\"%d\",style=%s];\n", from, next, to, style)
+		}
+	}
+	fmt.Fprintln(wrt, "}")
+	return wrt.Flush()
+}
+
+// WriteMatrix writes the routing table as a N×N matrix of next hops
+// (rows are the forwarding nodes, columns the targets). Markers: "-" for
+// the node itself, "*" for a direct neighbor and "." for a missing route.
+func (rt *RoutingTable) WriteMatrix(w io.Writer) error {
+	// sorted list of node ids (stable output)
+	ids := make([]int, 0, len(rt.List))
+	for id := range rt.List {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	// column width from largest id
+	width := 1
+	if len(ids) > 0 {
+		width = len(strconv.Itoa(ids[len(ids)-1]))
+	}
+	wrt := bufio.NewWriter(w)
+	fmt.Fprintf(wrt, "%*s |", width, "")
+	for _, to := range ids {
+		fmt.Fprintf(wrt, " %*d", width, to)
+	}
+	fmt.Fprintf(wrt, "\n%s+%s\n", strings.Repeat("-", width+1), strings.Repeat("-", (width+1)*len(ids)))
+	for _, from := range ids {
+		entry := rt.List[from]
+		fmt.Fprintf(wrt, "%*d |", width, from)
+		for _, to := range ids {
+			cell := "."
+			if next, ok := entry.Forwards[to]; from == to {
+				cell = "-"
+			} else if ok && next == to {
+				cell = "*"
+			} else if ok {
+				cell = strconv.Itoa(next)
+			}
+			fmt.Fprintf(wrt, " %*s", width, cell)
+		}
+		fmt.Fprintln(wrt)
+	}
+	return wrt.Flush()
+}
+
 //----------------------------------------------------------------------
 // Dump routing table
 //----------------------------------------------------------------------
@@ -170,29 +436,33 @@ func (n *Network) DumpRouting(fname string) {
 		Nodes:    make([]*DumpNode, 0),
 	}
 	for _, node := range nodes {
-		fw := make([]*DumpEntry, 0)
-		for _, entry := range node.Forwards(false) {
-			_, peer := n.getNode(entry.Peer)
-			_, next := n.getNode(entry.NextHop)
-			de := &DumpEntry{
-				Peer: uint16(peer),
-				Hops: entry.Hops,
-				Next: uint16(next),
-				Age_: entry.Origin.Age().Val,
-			}
-			fw = append(fw, de)
-		}
-		dn := &DumpNode{
-			ID:      uint16(node.id),
-			Running: node.IsRunning(),
-			Traffic: node.traffIn.Load(),
-			NumTbl:  uint16(len(fw)),
-			Tbl:     fw,
-		}
-		dump.Nodes = append(dump.Nodes, dn)
+		dump.Nodes = append(dump.Nodes, n.dumpNode(node, false))
 	}
 	// serialize to file
 	if err = data.MarshalStream(f, dump); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// dumpNode returns the dump of a node (with active or all forwards)
+func (n *Network) dumpNode(node *SimNode, all bool) *DumpNode {
+	fw := make([]*DumpEntry, 0)
+	for _, entry := range node.Forwards(all) {
+		_, peer := n.getNode(entry.Peer)
+		_, next := n.getNode(entry.NextHop)
+		de := &DumpEntry{
+			Peer: uint16(peer),
+			Hops: entry.Hops,
+			Next: uint16(next),
+			Age_: entry.Origin.Age().Val,
+		}
+		fw = append(fw, de)
+	}
+	return &DumpNode{
+		ID:      uint16(node.id),
+		Running: node.IsRunning(),
+		Traffic: node.traffIn.Load(),
+		NumTbl:  uint16(len(fw)),
+		Tbl:     fw,
+	}
+}
@@ -0,0 +1,240 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"bytes"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestWriteDOT(t *testing.T) {
+	// line topology 1 - 2 - 3
+	rt := NewRoutingTable()
+	for i := 1; i <= 3; i++ {
+		rt.List[i] = &RTEntry{Forwards: make(map[int]int)}
+	}
+	rt.List[1].Forwards = map[int]int{2: 2, 3: 2}
+	rt.List[2].Forwards = map[int]int{1: 1, 3: 3}
+	rt.List[3].Forwards = map[int]int{2: 2, 1: 2}
+
+	buf := new(bytes.Buffer)
+	if err := rt.WriteDOT(buf); err != nil {
+		t.Fatal(err)
+	}
+	// parse edges
+	edge := regexp.MustCompile(`n(\d+) -> n(\d+) \[label="(\d+)",style=(\w+)\]`)
+	edges := edge.FindAllStringSubmatch(buf.String(), -1)
+	if len(edges) != 6 {
+		t.Fatalf("got %d edges (expected 6):\n%s", len(edges), buf.String())
+	}
+	relays := 0
+	for _, e := range edges {
+		if e[4] == "dashed" {
+			relays++
+			if e[2] == e[3] {
+				t.Fatalf("neighbor edge styled as relay: %s", e[0])
+			}
+		}
+	}
+	if relays != 2 {
+		t.Fatalf("got %d relay edges (expected 2)", relays)
+	}
+}
+
+func TestWriteMatrix(t *testing.T) {
+	// line topology 1 - 2 - 3 (node 3 has no route to 1)
+	rt := NewRoutingTable()
+	for i := 1; i <= 3; i++ {
+		rt.List[i] = &RTEntry{Forwards: make(map[int]int)}
+	}
+	rt.List[1].Forwards = map[int]int{2: 2, 3: 2}
+	rt.List[2].Forwards = map[int]int{1: 1, 3: 3}
+	rt.List[3].Forwards = map[int]int{2: 2}
+
+	buf := new(bytes.Buffer)
+	if err := rt.WriteMatrix(buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("got %d lines (expected 5):\n%s", len(lines), buf.String())
+	}
+	rows := [][]string{
+		{"1", "|", "-", "*", "2"},
+		{"2", "|", "*", "-", "*"},
+		{"3", "|", ".", "*", "-"},
+	}
+	for i, row := range rows {
+		if got := strings.Fields(lines[i+2]); !reflect.DeepEqual(got, row) {
+			t.Fatalf("row %d: %v != %v", i+1, got, row)
+		}
+	}
+}
+
+func TestTrace(t *testing.T) {
+	// nodes 1..5: 1 -> 2 -> 3 -> 4 (success), 1 -> 2 -> 5 (broken),
+	// 1 -> 2 -> 3 -> 2 ... (loop to 6)
+	rt := NewRoutingTable()
+	for i := 1; i <= 6; i++ {
+		rt.List[i] = &RTEntry{Forwards: make(map[int]int)}
+		rt.Index[string(rune('a'+i))] = i // only size matters (TTL)
+	}
+	rt.List[1].Forwards = map[int]int{4: 2, 5: 2, 6: 2}
+	rt.List[2].Forwards = map[int]int{4: 3, 6: 3}
+	rt.List[3].Forwards = map[int]int{4: 4, 6: 2}
+
+	check := func(to int, expErr error, exp ...int) {
+		t.Helper()
+		route, err := rt.Trace(1, to)
+		if err != expErr {
+			t.Fatalf("route to %d: error %v (expected %v)", to, err, expErr)
+		}
+		if len(route) != len(exp) {
+			t.Fatalf("route to %d: %v (expected %v)", to, route, exp)
+		}
+		for i, n := range exp {
+			if route[i] != n {
+				t.Fatalf("route to %d: %v (expected %v)", to, route, exp)
+			}
+		}
+	}
+	check(4, nil, 1, 2, 3, 4)
+	check(5, ErrRouteBroken, 1, 2)
+	check(6, ErrRouteLoop, 1, 2, 3, 2)
+}
+
+func TestDiameter(t *testing.T) {
+	// line topology 1 - 2 - ... - N
+	const N = 7
+	rt := NewRoutingTable()
+	for i := 1; i <= N; i++ {
+		rt.List[i] = &RTEntry{Forwards: make(map[int]int)}
+		rt.Index[string(rune('a'+i))] = i
+	}
+	for from := 1; from <= N; from++ {
+		for to := 1; to <= N; to++ {
+			switch {
+			case to > from:
+				rt.List[from].Forwards[to] = from + 1
+			case to < from:
+				rt.List[from].Forwards[to] = from - 1
+			}
+		}
+	}
+	diameter, ecc := rt.Diameter()
+	if diameter != N-1 {
+		t.Fatalf("diameter %d (expected %d)", diameter, N-1)
+	}
+	for i := 1; i <= N; i++ {
+		exp := i - 1
+		if N-i > exp {
+			exp = N - i
+		}
+		if ecc[i] != exp {
+			t.Fatalf("eccentricity of %d: %d (expected %d)", i, ecc[i], exp)
+		}
+	}
+}
+
+func TestCompareOptimal(t *testing.T) {
+	// 3x3 grid (ids 1..9) with XY routing: all routes are optimal
+	const W = 3
+	pos := func(id int) (int, int) { return (id - 1) % W, (id - 1) / W }
+	g := NewGraph()
+	rt := NewRoutingTable()
+	for id := 1; id <= W*W; id++ {
+		rt.List[id] = &RTEntry{Forwards: make(map[int]int)}
+		rt.Index[string(rune('a'+id))] = id
+		if x, _ := pos(id); x < W-1 {
+			g.AddEdge(id, id+1)
+		}
+		if _, y := pos(id); y < W-1 {
+			g.AddEdge(id, id+W)
+		}
+	}
+	for from := 1; from <= W*W; from++ {
+		fx, fy := pos(from)
+		for to := 1; to <= W*W; to++ {
+			tx, ty := pos(to)
+			switch {
+			case tx > fx:
+				rt.List[from].Forwards[to] = from + 1
+			case tx < fx:
+				rt.List[from].Forwards[to] = from - 1
+			case ty > fy:
+				rt.List[from].Forwards[to] = from + W
+			case ty < fy:
+				rt.List[from].Forwards[to] = from - W
+			}
+		}
+	}
+	checked, subopt, _ := rt.CompareOptimal(g)
+	if checked != W*W*(W*W-1) || subopt != 0 {
+		t.Fatalf("%d suboptimal routes of %d", subopt, checked)
+	}
+	// detour from 1 to 2 (via 4, 5): two excess hops
+	rt.hops = nil
+	rt.List[1].Forwards[2] = 4
+	rt.List[4].Forwards[2] = 5
+	checked, subopt, excess := rt.CompareOptimal(g)
+	if checked != W*W*(W*W-1) || subopt != 1 || excess != 2 {
+		t.Fatalf("%d suboptimal routes of %d (+%.2f hops)", subopt, checked, excess)
+	}
+}
+
+func TestUnreachable(t *testing.T) {
+	// two partitions 1 - 2 - 3 and 4 - 5 - 6 with routes inside each
+	// partition, a stale route 1 -> 4 (broken at 2) and a loop 3 <-> 2
+	// for target 5.
+	rt := NewRoutingTable()
+	for i := 1; i <= 6; i++ {
+		rt.List[i] = &RTEntry{Forwards: make(map[int]int)}
+		rt.Index[string(rune('a'+i))] = i
+	}
+	for _, part := range [][]int{{1, 2, 3}, {4, 5, 6}} {
+		for i, from := range part {
+			for j, to := range part {
+				switch {
+				case j > i:
+					rt.List[from].Forwards[to] = part[i+1]
+				case j < i:
+					rt.List[from].Forwards[to] = part[i-1]
+				}
+			}
+		}
+	}
+	rt.List[1].Forwards[4] = 2
+	rt.List[2].Forwards[5] = 3
+	rt.List[3].Forwards[5] = 2
+
+	for from := 1; from <= 6; from++ {
+		exp := []int{4, 5, 6}
+		if from > 3 {
+			exp = []int{1, 2, 3}
+		}
+		if got := rt.Unreachable(from); !reflect.DeepEqual(got, exp) {
+			t.Fatalf("node %d cannot reach %v (expected %v)", from, got, exp)
+		}
+	}
+}
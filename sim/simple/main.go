@@ -23,6 +23,7 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"leatea/core"
 	"os"
 	"strconv"
 	"strings"
@@ -352,39 +353,31 @@ func check() {
 	total := 0
 	failed := 0
 	loops := 0
-	ttl := len(nodes)
 	for n1 := range nodes {
-	targets:
 		for n2 := range nodes {
 			total++
 			if n1 == n2 {
 				continue
 			}
-			from := n1
-			to := n2
-			hops := 0
-			var route []int
-			for from != to && hops < ttl {
-				route = append(route, from)
-				hop, ok := nodes[from]
+			_, _, status := core.WalkRoute(n1, n2, len(nodes), func(at int) (int, bool) {
+				// removed nodes break the route
+				hop, ok := nodes[at]
 				if !ok {
-					failed++
-					fmt.Printf("%d -> %d failed: %v\n", n1, n2, route)
-					panic("")
-					//continue targets
+					return 0, false
 				}
-				n, ok := hop.tbl[to]
+				e, ok := hop.tbl[n2]
 				if !ok {
-					failed++
-					continue targets
+					return 0, false
 				}
-				hops++
-				if n.peer == to {
-					continue targets
+				if e.next == 0 {
+					return n2, true
 				}
-				from = n.next
-			}
-			if hops == ttl {
+				return e.next, true
+			})
+			switch status {
+			case core.RouteBroken:
+				failed++
+			case core.RouteLoop:
 				loops++
 			}
 		}
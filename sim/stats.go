@@ -0,0 +1,89 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Error codes
+var (
+	ErrStatsFormat = errors.New("unknown statistics format")
+)
+
+// EpochStats holds the routing statistics of an epoch
+type EpochStats struct {
+	Epoch       int     `json:"epoch"`
+	Loops       int     `json:"loops"`
+	Broken      int     `json:"broken"`
+	Success     int     `json:"success"`
+	NumPeers    int     `json:"numPeers"`
+	Started     int     `json:"started"`
+	StopPending int     `json:"stopPending"`
+	MeanHops    float64 `json:"meanHops"`
+	Diameter    int     `json:"diameter"`
+
+	// distinct routing loops (only if loops are tracked)
+	Cycles        int `json:"cycles"`        // loops in the network
+	NewCycles     int `json:"newCycles"`     // loops formed in the epoch
+	ClearedCycles int `json:"clearedCycles"` // loops cleared in the epoch
+}
+
+// StatsWriter writes epoch statistics as CSV (with header line) or as
+// JSON (one object per line).
+type StatsWriter struct {
+	w    io.Writer
+	json bool
+}
+
+// NewStatsWriter creates a new writer for statistics in given format
+// ("csv" (default) or "json"). The CSV header is written immediately.
+func NewStatsWriter(w io.Writer, format string) (sw *StatsWriter, err error) {
+	sw = &StatsWriter{w: w}
+	switch format {
+	case "", "csv":
+		_, err = io.WriteString(w, "Epoch,Loops,Broken,Success,NumPeers,Started,StopPending,MeanHops,Diameter,Cycles,NewCycles,ClearedCycles\n")
+	case "json":
+		sw.json = true
+	default:
+		return nil, ErrStatsFormat
+	}
+	return
+}
+
+// Write statistics of an epoch
+func (sw *StatsWriter) Write(s *EpochStats) (err error) {
+	if sw.json {
+		var buf []byte
+		if buf, err = json.Marshal(s); err != nil {
+			return
+		}
+		_, err = sw.w.Write(append(buf, '\n'))
+		return
+	}
+	_, err = fmt.Fprintf(sw.w, "%d,%d,%d,%d,%d,%d,%d,%.2f,%d,%d,%d,%d\n",
+		s.Epoch, s.Loops, s.Broken, s.Success, s.NumPeers, s.Started, s.StopPending, s.MeanHops, s.Diameter,
+		s.Cycles, s.NewCycles, s.ClearedCycles)
+	return
+}
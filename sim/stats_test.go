@@ -0,0 +1,78 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestStatsJSON(t *testing.T) {
+	buf := new(bytes.Buffer)
+	sw, err := NewStatsWriter(buf, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for epoch := 1; epoch <= 3; epoch++ {
+		if err = sw.Write(&EpochStats{Epoch: epoch, Success: 10 * epoch, MeanHops: 1.5}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// one JSON object per line
+	scanner := bufio.NewScanner(buf)
+	num := 0
+	for scanner.Scan() {
+		num++
+		s := new(EpochStats)
+		if err = json.Unmarshal(scanner.Bytes(), s); err != nil {
+			t.Fatal(err)
+		}
+		if s.Epoch != num || s.Success != 10*num || s.MeanHops != 1.5 {
+			t.Fatalf("invalid stats: %s", scanner.Text())
+		}
+		if !strings.Contains(scanner.Text(), `"numPeers":`) {
+			t.Fatalf("missing field: %s", scanner.Text())
+		}
+	}
+	if num != 3 {
+		t.Fatalf("got %d lines (expected 3)", num)
+	}
+}
+
+func TestStatsCSV(t *testing.T) {
+	buf := new(bytes.Buffer)
+	sw, err := NewStatsWriter(buf, "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = sw.Write(&EpochStats{Epoch: 1, Loops: 2, MeanHops: 2.345})
+	exp := "Epoch,Loops,Broken,Success,NumPeers,Started,StopPending,MeanHops,Diameter,Cycles,NewCycles,ClearedCycles\n" +
+		"1,2,0,0,0,0,0,2.35,0,0,0,0\n"
+	if buf.String() != exp {
+		t.Fatalf("invalid CSV:\n%s", buf.String())
+	}
+	if _, err = NewStatsWriter(buf, "xml"); err != ErrStatsFormat {
+		t.Fatalf("unknown format accepted: %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"leatea/core"
+	"log"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+//----------------------------------------------------------------------
+// Single-stepped simulation (for debugging): no timers, no concurrent
+// message handling. Each step either delivers a single broadcast (in
+// order of sending) or starts a new epoch. The time of the nodes is
+// derived from the steps, so entries expire the same way in every run:
+// an epoch lasts a beacon interval (no beacons are sent; the LEArn
+// broadcasts of an epoch keep the neighbors alive) and a delivery one
+// microsecond.
+//----------------------------------------------------------------------
+
+// stepper keeps the state of a single-stepped simulation
+type stepper struct {
+	epoch  int                          // current epoch
+	queue  []core.Message               // broadcasts not delivered yet
+	trans  map[int]*core.QueueTransport // transports of nodes
+	sorted []*SimNode                   // nodes in order of identifiers
+	start  int64                        // time of epoch 0
+	now    atomic.Int64                 // current time of the simulation
+}
+
+// clock of the simulation (see core.SetClock)
+func (s *stepper) clock() int64 {
+	return s.now.Load()
+}
+
+// RunStepped prepares a single-stepped simulation: all nodes are created
+// and activated at once (no boot delays, no limited lifetimes). The
+// simulation is advanced by calling Step.
+func (n *Network) RunStepped(cb core.Listener) {
+	n.active.Store(true)
+	cb = n.listen(cb)
+	n.cb = cb
+	n.stepped = &stepper{
+		trans: make(map[int]*core.QueueTransport),
+		start: time.Now().UnixMicro(),
+	}
+	n.stepped.now.Store(n.stepped.start)
+	core.SetClock(n.stepped.clock)
+	for i := 0; i < Cfg.Env.NumNodes; i++ {
+		r2, pos := n.env.Placement(i)
+		trans := core.NewQueueTransport()
+		node := newSteppedNode(core.NewPeerPrivate(), trans, pos, r2)
+		node.idx = i
+
+		// register node with environment and add to network
+		idx := n.env.Register(i, node)
+		if err := n.addNode(idx, node); err != nil {
+			log.Printf("node %d not started: %s", idx, err.Error())
+			continue
+		}
+		n.stepped.trans[idx] = trans
+		n.stepped.sorted = append(n.stepped.sorted, node)
+
+		// update status
+		n.statLock.Lock()
+		n.started++
+		n.running++
+		running := n.running
+		n.statLock.Unlock()
+
+		// notify listener
+		if cb != nil {
+			cb(&core.Event{
+				Type: EvNodeAdded,
+				Peer: node.PeerID(),
+				Val: &NodeAddedVal{
+					Idx:     uint16(idx),
+					Running: uint16(running),
+					X:       node.Pos.X,
+					Y:       node.Pos.Y,
+					R2:      node.r2,
+				},
+			})
+		}
+		node.Activate(cb)
+	}
+	sort.Slice(n.stepped.sorted, func(i, j int) bool {
+		return n.stepped.sorted[i].id < n.stepped.sorted[j].id
+	})
+}
+
+// Step advances a single-stepped simulation: the oldest pending broadcast
+// is delivered to all nodes in reach (in order of node identifiers). If
+// no broadcast is pending, a new epoch starts: the environment is updated
+// and all running nodes (in order) broadcast a LEArn message. Returns the
+// current epoch and the delivered message (nil on a new epoch).
+func (n *Network) Step() (int, core.Message) {
+	s := n.stepped
+	if s == nil || !n.active.Load() {
+		return 0, nil
+	}
+	// start new epoch if no broadcast is pending
+	if len(s.queue) == 0 {
+		s.epoch++
+		intv := time.Duration(Cfg.Core.BeaconIntv) * time.Second
+		s.now.Store(s.start + int64(s.epoch)*intv.Microseconds())
+		n.StartEpoch(s.epoch)
+		for _, node := range s.sorted {
+			if node.IsRunning() {
+				node.SendLearn()
+				n.collect(node)
+			}
+		}
+		return s.epoch, nil
+	}
+	// deliver oldest broadcast
+	s.now.Add(1)
+	msg := s.queue[0]
+	s.queue = s.queue[1:]
+	sender, _ := n.getNode(msg.Sender())
+	if sender == nil {
+		return s.epoch, msg
+	}
+	sender.sent(msg)
+	for _, node := range s.sorted {
+		if node == sender || !node.IsRunning() || !n.env.Connectivity(node, sender) {
+			continue
+		}
+		node.Receive(msg)
+		n.collect(node)
+	}
+	return s.epoch, msg
+}
+
+// drainStepped delivers pending broadcasts until none of a node is left.
+func (n *Network) drainStepped(node *SimNode) {
+	for {
+		pending := false
+		for _, msg := range n.stepped.queue {
+			if msg.Sender().Equal(node.PeerID()) {
+				pending = true
+				break
+			}
+		}
+		if !pending {
+			return
+		}
+		n.Step()
+	}
+}
+
+// Pending returns the number of broadcasts not delivered yet in a
+// single-stepped simulation.
+func (n *Network) Pending() int {
+	if n.stepped == nil {
+		return 0
+	}
+	return len(n.stepped.queue)
+}
+
+// collect broadcasts of a node
+func (n *Network) collect(node *SimNode) {
+	if trans, ok := n.stepped.trans[node.id]; ok {
+		n.stepped.queue = append(n.stepped.queue, trans.Pop()...)
+	}
+}
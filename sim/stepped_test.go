@@ -0,0 +1,133 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"fmt"
+	"leatea/core"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// line of nodes (10 units apart, each node only reaches direct neighbors)
+type lineModel struct {
+	RndModel
+}
+
+func (m *lineModel) Placement(i int) (float64, *Position) {
+	return 150, &Position{X: float64(10 * i)}
+}
+
+func (m *lineModel) Epoch(int) []*core.Event {
+	return nil
+}
+
+// state of all forward tables in a stepped network: "target:next:hops"
+// entries per node (in order of node identifiers).
+func tableState(netw *Network) string {
+	tables := make([]string, 0)
+	for _, node := range netw.stepped.sorted {
+		list := make([]string, 0)
+		for _, e := range node.Forwards(true) {
+			list = append(list, fmt.Sprintf("%d:%d:%d",
+				netw.GetShortID(e.Peer), netw.GetShortID(e.NextHop), e.Hops))
+		}
+		sort.Strings(list)
+		tables = append(tables, "["+strings.Join(list, ",")+"]")
+	}
+	return strings.Join(tables, " ")
+}
+
+func TestSteppedRun(t *testing.T) {
+	defer func(n int) { Cfg.Env.NumNodes = n }(Cfg.Env.NumNodes)
+	Cfg.Env.NumNodes = 3
+	netw := NewNetwork(new(lineModel), 3)
+	netw.RunStepped(nil)
+	defer netw.Stop()
+
+	// expected table states after each step of the first epoch
+	// (and the first step of the second epoch)
+	steps := []struct {
+		epoch  int
+		msg    string // type/sender of delivered message
+		tables string
+	}{
+		{1, "", "[] [] []"},
+		{1, "2/1", "[] [1:0:0] []"},
+		{1, "2/2", "[2:0:0] [1:0:0] [2:0:0]"},
+		{1, "2/3", "[2:0:0] [1:0:0,3:0:0] [2:0:0]"},
+		{1, "3/2", "[2:0:0] [1:0:0,3:0:0] [1:2:1,2:0:0]"},
+		{1, "3/1", "[2:0:0] [1:0:0,3:0:0] [1:2:1,2:0:0]"},
+		{1, "3/3", "[2:0:0] [1:0:0,3:0:0] [1:2:1,2:0:0]"},
+		{1, "3/2", "[2:0:0,3:2:1] [1:0:0,3:0:0] [1:2:1,2:0:0]"},
+		{2, "", "[2:0:0,3:2:1] [1:0:0,3:0:0] [1:2:1,2:0:0]"},
+	}
+	for i, step := range steps {
+		epoch, msg := netw.Step()
+		desc := ""
+		if msg != nil {
+			desc = fmt.Sprintf("%d/%d", msg.Type(), netw.GetShortID(msg.Sender()))
+		}
+		if epoch != step.epoch || desc != step.msg {
+			t.Fatalf("step %d: epoch %d, message %q", i+1, epoch, desc)
+		}
+		if tables := tableState(netw); tables != step.tables {
+			t.Fatalf("step %d: tables %s (expected %s)", i+1, tables, step.tables)
+		}
+	}
+}
+
+func TestSteppedExpiry(t *testing.T) {
+	defer func(n int) { Cfg.Env.NumNodes = n }(Cfg.Env.NumNodes)
+	Cfg.Env.NumNodes = 3
+	netw := NewNetwork(new(lineModel), 3)
+	netw.RunStepped(nil)
+	defer netw.Stop()
+
+	// run epochs (delivering all broadcasts)
+	epoch := func() int {
+		ep, _ := netw.Step()
+		for netw.Pending() > 0 {
+			netw.Step()
+		}
+		return ep
+	}
+	for epoch() < 3 {
+	}
+	// node 3 stops silently: node 2 expires it after TTLBeacon epochs
+	// (time of the nodes is derived from the epochs, not the wall clock)
+	node2, node3 := netw.NodeByID(2), netw.NodeByID(3)
+	netw.StopNode(node3)
+	ttl := Cfg.Core.TTLBeacon / Cfg.Core.BeaconIntv
+	for i := 1; i <= ttl+1; i++ {
+		ep := epoch()
+		active := false
+		for _, nb := range node2.Neighbors() {
+			if nb.Equal(node3.PeerID()) {
+				active = true
+			}
+		}
+		if expired := i > ttl; active == expired {
+			t.Fatalf("epoch %d: neighbor active=%v", ep, active)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"fmt"
+
+	"leatea/core"
+)
+
+//----------------------------------------------------------------------
+// Topology of a network (without running the routing protocol)
+//----------------------------------------------------------------------
+
+// Topology metrics of a connectivity graph
+type Topology struct {
+	Nodes      int     // number of nodes
+	Edges      int     // number of (bidirectional) links
+	MinDegree  int     // smallest number of neighbors
+	MaxDegree  int     // largest number of neighbors
+	MeanDegree float64 // mean number of neighbors
+	Components int     // number of connected components
+	Diameter   int     // longest shortest path (within components)
+}
+
+// String returns a human-readable representation
+func (t *Topology) String() string {
+	return fmt.Sprintf("Topology{nodes=%d,edges=%d,degree=%d/%.2f/%d,components=%d,diameter=%d}",
+		t.Nodes, t.Edges, t.MinDegree, t.MeanDegree, t.MaxDegree, t.Components, t.Diameter)
+}
+
+// Topology returns the metrics of the graph.
+func (g *Graph) Topology() *Topology {
+	t := new(Topology)
+	nodes := g.Nodes()
+	t.Nodes = len(nodes)
+	if t.Nodes == 0 {
+		return t
+	}
+	t.MinDegree = -1
+	sum := 0
+	for _, n := range nodes {
+		deg := len(g.links[n])
+		sum += deg
+		if t.MinDegree < 0 || deg < t.MinDegree {
+			t.MinDegree = deg
+		}
+		if deg > t.MaxDegree {
+			t.MaxDegree = deg
+		}
+		for _, d := range g.Distances(n) {
+			if d > t.Diameter {
+				t.Diameter = d
+			}
+		}
+	}
+	t.Edges = sum / 2
+	t.MeanDegree = float64(sum) / float64(t.Nodes)
+	t.Components = len(g.Components())
+	return t
+}
+
+// PlaceNodes places 'numNodes' nodes in the environment (without running
+// them) and returns the resulting connectivity graph. Only bidirectional
+// links are edges in the graph.
+func PlaceNodes(env Environment, numNodes int) *Graph {
+	nodes := make(map[int]*SimNode)
+	for i := 0; i < numNodes; i++ {
+		r2, pos := env.Placement(i)
+		node := NewSimNode(core.NewPeerPrivate(), nil, pos, r2)
+		node.idx = i
+		nodes[env.Register(i, node)] = node
+	}
+	g := NewGraph()
+	for i1, node1 := range nodes {
+		g.AddNode(i1)
+		for i2, node2 := range nodes {
+			if i2 > i1 && env.Connectivity(node1, node2) && env.Connectivity(node2, node1) {
+				g.AddEdge(i1, i2)
+			}
+		}
+	}
+	return g
+}
@@ -0,0 +1,57 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import "testing"
+
+func TestTopology(t *testing.T) {
+	// chain of four nodes (with a one-way link to node 5) and an
+	// isolated node 5.
+	mdl := NewLinkModel()
+	mdl.defs = []*NodeDef{
+		{ID: 1, Links: []int{2}},
+		{ID: 2, Links: []int{1, 3}},
+		{ID: 3, Links: []int{2, 4}},
+		{ID: 4, Links: []int{3, 5}},
+		{ID: 5, Links: []int{}},
+	}
+	for _, def := range mdl.defs {
+		mdl.nodes[def.ID] = &LinkedNode{d: def}
+	}
+	g := PlaceNodes(mdl, len(mdl.defs))
+	topo := g.Topology()
+	exp := &Topology{
+		Nodes:      5,
+		Edges:      3,
+		MinDegree:  0,
+		MaxDegree:  2,
+		MeanDegree: 1.2,
+		Components: 2,
+		Diameter:   3,
+	}
+	if *topo != *exp {
+		t.Fatalf("topology %s (expected %s)", topo, exp)
+	}
+	// empty graph
+	if topo = NewGraph().Topology(); *topo != (Topology{}) {
+		t.Fatalf("empty topology %s", topo)
+	}
+}
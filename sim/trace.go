@@ -0,0 +1,281 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"leatea/core"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//----------------------------------------------------------------------
+// Model driven by recorded (GPS) traces: nodes are positioned along
+// their trace at each epoch. Nodes start with their first trace point
+// and stop after their last trace point.
+//----------------------------------------------------------------------
+
+// Error codes for traces
+var (
+	ErrTraceEmpty  = errors.New("empty trace")
+	ErrTraceFormat = errors.New("invalid trace format")
+)
+
+// Bootup is implemented by environments that schedule the start of
+// nodes themselves (instead of random boot delays).
+type Bootup interface {
+	// BootDelay returns the start delay of the i.th node.
+	BootDelay(i int) time.Duration
+}
+
+// tracePoint is a position of a node at a given time (in seconds
+// relative to the start of the trace).
+type tracePoint struct {
+	t        float64
+	lat, lon float64
+	pos      *Position
+}
+
+// TraceModel for nodes moving along recorded traces
+type TraceModel struct {
+	sync.Mutex
+
+	ids    []int                 // node identifiers (sorted)
+	traces map[int][]*tracePoint // position timeline per node
+	nodes  map[int]*SimNode      // registered nodes
+	gone   map[int]bool          // nodes beyond their trace
+}
+
+// NewTraceModel reads traces from a CSV file (lines "time,node,lat,lon")
+// or a GeoJSON file (point features with "time" and "node" properties).
+// Coordinates are projected to the field of the environment.
+func NewTraceModel(fn string) (m *TraceModel, err error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	var points map[int][]*tracePoint
+	if strings.HasSuffix(fn, ".json") || strings.HasSuffix(fn, ".geojson") {
+		points, err = readGeoJSON(f)
+	} else {
+		points, err = readTraceCSV(f)
+	}
+	if err != nil {
+		return
+	}
+	return newTraceModel(points)
+}
+
+// create a model from trace points
+func newTraceModel(traces map[int][]*tracePoint) (*TraceModel, error) {
+	if len(traces) == 0 {
+		return nil, ErrTraceEmpty
+	}
+	m := &TraceModel{
+		traces: traces,
+		nodes:  make(map[int]*SimNode),
+		gone:   make(map[int]bool),
+	}
+	// get bounding box and start of trace
+	t0 := math.Inf(1)
+	latMin, latMax := math.Inf(1), math.Inf(-1)
+	lonMin, lonMax := math.Inf(1), math.Inf(-1)
+	for id, list := range traces {
+		m.ids = append(m.ids, id)
+		for _, p := range list {
+			t0 = math.Min(t0, p.t)
+			latMin, latMax = math.Min(latMin, p.lat), math.Max(latMax, p.lat)
+			lonMin, lonMax = math.Min(lonMin, p.lon), math.Max(lonMax, p.lon)
+		}
+	}
+	sort.Ints(m.ids)
+	// project coordinates to the field (north is up)
+	scale := func(v, vMin, vMax, size float64) float64 {
+		if vMax-vMin < 1e-12 {
+			return size / 2
+		}
+		return (v - vMin) / (vMax - vMin) * size
+	}
+	for _, list := range traces {
+		sort.Slice(list, func(i, j int) bool { return list[i].t < list[j].t })
+		for _, p := range list {
+			p.t -= t0
+			p.pos = NewPosition(
+				scale(p.lon, lonMin, lonMax, Cfg.Env.Width),
+				Cfg.Env.Height-scale(p.lat, latMin, latMax, Cfg.Env.Height),
+			)
+		}
+	}
+	return m, nil
+}
+
+// read traces from CSV (with optional header line)
+func readTraceCSV(r io.Reader) (map[int][]*tracePoint, error) {
+	rdr := csv.NewReader(r)
+	rdr.FieldsPerRecord = 4
+	rdr.TrimLeadingSpace = true
+	traces := make(map[int][]*tracePoint)
+	for line := 0; ; line++ {
+		rec, err := rdr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var vals [4]float64
+		for i, s := range rec {
+			if vals[i], err = strconv.ParseFloat(s, 64); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			// skip header line
+			if line == 0 {
+				continue
+			}
+			return nil, ErrTraceFormat
+		}
+		id := int(vals[1])
+		traces[id] = append(traces[id], &tracePoint{t: vals[0], lat: vals[2], lon: vals[3]})
+	}
+	return traces, nil
+}
+
+// read traces from GeoJSON (feature collection of points)
+func readGeoJSON(r io.Reader) (map[int][]*tracePoint, error) {
+	var fc struct {
+		Features []struct {
+			Geometry struct {
+				Type        string    `json:"type"`
+				Coordinates []float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties struct {
+				Time float64 `json:"time"`
+				Node int     `json:"node"`
+			} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.NewDecoder(r).Decode(&fc); err != nil {
+		return nil, err
+	}
+	traces := make(map[int][]*tracePoint)
+	for _, f := range fc.Features {
+		if f.Geometry.Type != "Point" || len(f.Geometry.Coordinates) < 2 {
+			return nil, ErrTraceFormat
+		}
+		id := f.Properties.Node
+		traces[id] = append(traces[id], &tracePoint{
+			t:   f.Properties.Time,
+			lon: f.Geometry.Coordinates[0],
+			lat: f.Geometry.Coordinates[1],
+		})
+	}
+	return traces, nil
+}
+
+// position of a node at time t (interpolated along the trace)
+func (m *TraceModel) position(id int, t float64) *Position {
+	list := m.traces[id]
+	if t <= list[0].t {
+		return list[0].pos
+	}
+	for i := 1; i < len(list); i++ {
+		p0, p1 := list[i-1], list[i]
+		if t <= p1.t {
+			f := (t - p0.t) / (p1.t - p0.t)
+			return NewPosition(
+				p0.pos.X+f*(p1.pos.X-p0.pos.X),
+				p0.pos.Y+f*(p1.pos.Y-p0.pos.Y),
+			)
+		}
+	}
+	return list[len(list)-1].pos
+}
+
+// Connectivity between two nodes only based on reach (interface impl)
+func (m *TraceModel) Connectivity(n1, n2 *SimNode) bool {
+	d2 := n1.Pos.Distance2(n2.Pos)
+	return n1.r2 > d2 || n2.r2 > d2
+}
+
+// Placement of i.th node at the start of its trace (interface impl)
+func (m *TraceModel) Placement(i int) (r2 float64, pos *Position) {
+	return Cfg.Node.Reach2, m.position(m.ids[i], 0)
+}
+
+// BootDelay of i.th node is the start of its trace (interface impl)
+func (m *TraceModel) BootDelay(i int) time.Duration {
+	t := m.traces[m.ids[i]][0].t
+	return time.Duration(t * float64(time.Second))
+}
+
+// Register node with environment (interface impl)
+func (m *TraceModel) Register(i int, node *SimNode) int {
+	m.Lock()
+	defer m.Unlock()
+	node.id = m.ids[i]
+	m.nodes[node.id] = node
+	return node.id
+}
+
+// Epoch started: move nodes along their traces; nodes beyond the end
+// of their trace are stopped (interface impl).
+func (m *TraceModel) Epoch(epoch int) (events []*core.Event) {
+	m.Lock()
+	defer m.Unlock()
+	t := float64(epoch * Cfg.Core.LearnIntv)
+	for id, node := range m.nodes {
+		list := m.traces[id]
+		if t > list[len(list)-1].t {
+			if !m.gone[id] {
+				m.gone[id] = true
+				events = append(events, &core.Event{
+					Type: EvNodeRemoved,
+					Peer: node.PeerID(),
+					Val:  []int{id, -1},
+				})
+			}
+			continue
+		}
+		node.Pos = m.position(id, t)
+	}
+	return
+}
+
+// Draw the traces
+func (m *TraceModel) Draw(c Canvas) {
+	for _, list := range m.traces {
+		for i := 1; i < len(list); i++ {
+			p0, p1 := list[i-1].pos, list[i].pos
+			c.Line(p0.X, p0.Y, p1.X, p1.Y, 0.2, ClrGray)
+		}
+	}
+}
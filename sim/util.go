@@ -22,26 +22,70 @@ package sim
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 	"time"
 )
 
 //----------------------------------------------------------------------
 
-// Position (2D)
+// Position (2D or 3D): Z is 0 in a flat environment. Canvases draw the
+// projection to the XY plane.
 type Position struct {
-	X, Y float64
+	X, Y, Z float64
 }
 
-// Distance2 returns the squared distance between positions.
+// NewPosition returns a position in the XY plane.
+func NewPosition(x, y float64) *Position {
+	return &Position{X: x, Y: y}
+}
+
+// Distance2 returns the squared distance between positions. If the field
+// wraps around at its edges (torus), the shortest distance between the
+// positions (minimum image) is used.
 func (p *Position) Distance2(pos *Position) float64 {
 	dx := p.X - pos.X
 	dy := p.Y - pos.Y
-	return dx*dx + dy*dy
+	dz := p.Z - pos.Z
+	if Cfg.Env.Boundary == "wrap" {
+		dx = wrapDelta(dx, Cfg.Env.Width)
+		dy = wrapDelta(dy, Cfg.Env.Height)
+	}
+	return dx*dx + dy*dy + dz*dz
+}
+
+// wrapDelta returns the shortest difference of coordinates on a
+// circle with given size.
+func wrapDelta(d, size float64) float64 {
+	if size <= 0 {
+		return d
+	}
+	d = math.Mod(d, size)
+	if d > size/2 {
+		d -= size
+	} else if d < -size/2 {
+		d += size
+	}
+	return d
+}
+
+// wrap a coordinate into the range [0,size)
+func wrap(v, size float64) float64 {
+	if size <= 0 {
+		return v
+	}
+	v = math.Mod(v, size)
+	if v < 0 {
+		v += size
+	}
+	return v
 }
 
 // String returns a human-readable representation
 func (p *Position) String() string {
+	if p.Z != 0 {
+		return fmt.Sprintf("(%.2f,%.2f,%.2f)", p.X, p.Y, p.Z)
+	}
 	return fmt.Sprintf("(%.2f,%.2f)", p.X, p.Y)
 }
 
@@ -66,3 +110,13 @@ func Vary(t float64) time.Duration {
 	v := rand.ExpFloat64() * t
 	return time.Duration(v*1000) * time.Millisecond
 }
+
+// lessInts compares two lists of integers lexicographically
+func lessInts(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
@@ -0,0 +1,71 @@
+//----------------------------------------------------------------------
+// This file is part of leatea-routing.
+// Copyright (C) 2022 Bernd Fix >Y<
+//
+// leatea-routing is free software: you can redistribute it and/or modify it
+// under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License,
+// or (at your option) any later version.
+//
+// leatea-routing is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+// SPDX-License-Identifier: AGPL3.0-or-later
+//----------------------------------------------------------------------
+
+package sim
+
+import "testing"
+
+func TestPosition(t *testing.T) {
+	p1 := NewPosition(10, 20)
+	if p1.X != 10 || p1.Y != 20 || p1.Z != 0 {
+		t.Fatalf("position %s", p1)
+	}
+	if s := p1.String(); s != "(10.00,20.00)" {
+		t.Fatalf("string %s", s)
+	}
+	p2 := NewPosition(13, 24)
+	if d2 := p1.Distance2(p2); d2 != 25 {
+		t.Fatalf("distance2 %f", d2)
+	}
+	if d2 := p2.Distance2(p1); d2 != 25 {
+		t.Fatalf("distance2 %f (reversed)", d2)
+	}
+	p2.Z = 12
+	if d2 := p1.Distance2(p2); d2 != 169 {
+		t.Fatalf("distance2 %f (3D)", d2)
+	}
+	if s := p2.String(); s != "(13.00,24.00,12.00)" {
+		t.Fatalf("string %s", s)
+	}
+}
+
+func TestPositionWrap(t *testing.T) {
+	defer func(b string) { Cfg.Env.Boundary = b }(Cfg.Env.Boundary)
+
+	p1 := NewPosition(1, 2)
+	p2 := NewPosition(Cfg.Env.Width-2, Cfg.Env.Height-2)
+	dx, dy := Cfg.Env.Width-3, Cfg.Env.Height-4
+	if d2 := p1.Distance2(p2); d2 != dx*dx+dy*dy {
+		t.Fatalf("distance2 %f (flat)", d2)
+	}
+	// minimum image across both edges of the torus
+	Cfg.Env.Boundary = "wrap"
+	if d2 := p1.Distance2(p2); d2 != 25 {
+		t.Fatalf("distance2 %f (wrapped)", d2)
+	}
+	if d2 := p2.Distance2(p1); d2 != 25 {
+		t.Fatalf("distance2 %f (wrapped, reversed)", d2)
+	}
+	// positions without a shorter image are unaffected
+	p3 := NewPosition(4, 6)
+	if d2 := p1.Distance2(p3); d2 != 25 {
+		t.Fatalf("distance2 %f (wrapped, inside)", d2)
+	}
+}